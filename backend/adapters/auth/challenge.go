@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+const (
+	// challengeTTL is how long the second step of a login may take
+	challengeTTL = 5 * time.Minute
+	// challengeAttempts is how often a challenge can be checked before it
+	// is discarded, so codes can't be guessed within its lifetime
+	challengeAttempts = 5
+)
+
+// Challenge is a short-lived token proving that a user passed the password
+// step of a login that needs a second factor
+type Challenge struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func challengeKey(hash string) string         { return "auth:challenge:" + hash }
+func challengeAttemptsKey(hash string) string { return "auth:challenge_attempts:" + hash }
+
+// IssueChallenge issues a login challenge for a user
+func (j *JWTAdapter) IssueChallenge(userID string) (*Challenge, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	challenge := &Challenge{
+		Token:     base64.RawURLEncoding.EncodeToString(secret),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+	if err := j.store.Set(challengeKey(hashToken(challenge.Token)), userID, challengeTTL); err != nil {
+		return nil, fmt.Errorf("failed to store challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// CheckChallenge returns the user a challenge was issued for. Every check
+// counts as an attempt; once they are used up the challenge fails with
+// ErrUnknownToken like an expired one.
+func (j *JWTAdapter) CheckChallenge(token string) (string, error) {
+	hash := hashToken(token)
+
+	var userID string
+	if err := j.store.Get(challengeKey(hash), &userID); err != nil {
+		return "", ErrUnknownToken
+	}
+
+	attempts, err := j.store.IncrementCounter(challengeAttemptsKey(hash), challengeTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to check challenge: %w", err)
+	}
+	if attempts > challengeAttempts {
+		j.EndChallenge(token)
+		return "", ErrUnknownToken
+	}
+
+	return userID, nil
+}
+
+// EndChallenge discards a challenge once the login completed
+func (j *JWTAdapter) EndChallenge(token string) error {
+	hash := hashToken(token)
+	if err := j.store.Delete(challengeKey(hash)); err != nil {
+		return fmt.Errorf("failed to end challenge: %w", err)
+	}
+	j.store.Delete(challengeAttemptsKey(hash))
+	return nil
+}
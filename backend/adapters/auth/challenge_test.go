@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallenge(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	challenge, err := adapter.IssueChallenge("u1")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", challenge.UserID)
+
+	for i := 0; i < challengeAttempts; i++ {
+		userID, err := adapter.CheckChallenge(challenge.Token)
+		require.NoError(t, err)
+		assert.Equal(t, "u1", userID)
+	}
+
+	_, err = adapter.CheckChallenge(challenge.Token)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+	_, err = adapter.CheckChallenge("unknown")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+
+	ended, err := adapter.IssueChallenge("u1")
+	require.NoError(t, err)
+	require.NoError(t, adapter.EndChallenge(ended.Token))
+	_, err = adapter.CheckChallenge(ended.Token)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+}
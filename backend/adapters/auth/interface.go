@@ -9,12 +9,20 @@ type AuthAdapter interface {
 	// Token Operations
 	GenerateToken(claims AuthClaims) (string, error)
 	ValidateToken(token string) (*AuthClaims, error)
-	RefreshToken(token string) (string, error)
+	IssueTokens(claims AuthClaims) (*AuthResult, error)
+	RefreshToken(refreshToken string) (*AuthClaims, error)
 	RevokeToken(token string) error
+	RevokeUserTokens(userID string) error
+	TokenSession(token string) (string, error)
 
 	// User Authentication
 	AuthenticateUser(credentials AuthCredentials) (*AuthResult, error)
 
+	// Login Challenges
+	IssueChallenge(userID string) (*Challenge, error)
+	CheckChallenge(token string) (string, error)
+	EndChallenge(token string) error
+
 	// Claims Management
 	ExtractClaims(token string) (*AuthClaims, error)
 
@@ -33,6 +41,8 @@ type AuthClaims struct {
 	Email     string                 `json:"email"`
 	IssuedAt  time.Time              `json:"issued_at"`
 	ExpiresAt time.Time              `json:"expires_at"`
+	TokenID   string                 `json:"token_id"`
+	SessionID string                 `json:"session_id"`
 	Custom    map[string]interface{} `json:"custom"`
 }
 
@@ -5,20 +5,32 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"webenable-cms-backend/adapters/cache"
 	"webenable-cms-backend/models"
 )
 
-// JWTAdapter implements AuthAdapter for JWT authentication
+// JWTAdapter implements AuthAdapter for JWT authentication. Access tokens
+// are short-lived JWTs, refresh tokens and revocations are kept in the
+// cache so that every replica sees them.
 type JWTAdapter struct {
-	secret     []byte
-	expiration time.Duration
-	config     map[string]interface{}
+	secret            []byte
+	expiration        time.Duration
+	refreshExpiration time.Duration
+	store             cache.CacheAdapter
+	config            map[string]interface{}
 }
 
-// NewJWTAdapter creates a new JWT adapter
-func NewJWTAdapter(config map[string]interface{}) (AuthAdapter, error) {
+// NewJWTAdapter creates a new JWT adapter storing refresh tokens and
+// revocations in store
+func NewJWTAdapter(config map[string]interface{}, store cache.CacheAdapter) (AuthAdapter, error) {
+	if store == nil {
+		return nil, fmt.Errorf("jwt adapter requires a cache for refresh tokens")
+	}
+
 	adapter := &JWTAdapter{
 		config: config,
+		store:  store,
 	}
 
 	if err := adapter.Configure(AuthConfig{
@@ -43,7 +55,7 @@ func (j *JWTAdapter) Configure(config AuthConfig) error {
 	// Parse expiration duration
 	expirationStr, ok := config.Config["expiration"].(string)
 	if !ok {
-		expirationStr = "24h" // default
+		expirationStr = "15m" // default
 	}
 
 	duration, err := time.ParseDuration(expirationStr)
@@ -51,7 +63,21 @@ func (j *JWTAdapter) Configure(config AuthConfig) error {
 		return fmt.Errorf("invalid expiration duration: %w", err)
 	}
 
+	refreshStr, ok := config.Config["refresh_expiration"].(string)
+	if !ok {
+		refreshStr = "720h" // default
+	}
+
+	refreshDuration, err := time.ParseDuration(refreshStr)
+	if err != nil {
+		return fmt.Errorf("invalid refresh expiration duration: %w", err)
+	}
+	if refreshDuration < duration {
+		return fmt.Errorf("refresh expiration must not be shorter than the token expiration")
+	}
+
 	j.expiration = duration
+	j.refreshExpiration = refreshDuration
 	return nil
 }
 
@@ -64,12 +90,17 @@ func (j *JWTAdapter) GenerateToken(claims AuthClaims) (string, error) {
 	if claims.ExpiresAt.IsZero() {
 		claims.ExpiresAt = now.Add(j.expiration)
 	}
+	if claims.TokenID == "" {
+		claims.TokenID = uuid.New().String()
+	}
 
 	// Convert to JWT claims
 	jwtClaims := &JWTClaims{
-		Username: claims.Username,
-		Role:     claims.Role,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        claims.TokenID,
 			Subject:   claims.UserID,
 			IssuedAt:  jwt.NewNumericDate(claims.IssuedAt),
 			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
@@ -85,7 +116,8 @@ func (j *JWTAdapter) GenerateToken(claims AuthClaims) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// ValidateToken validates a JWT token and returns the claims. Revoked
+// tokens fail with ErrRevoked.
 func (j *JWTAdapter) ValidateToken(tokenString string) (*AuthClaims, error) {
 	claims := &JWTClaims{}
 
@@ -104,44 +136,14 @@ func (j *JWTAdapter) ValidateToken(tokenString string) (*AuthClaims, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
-	// Convert to AuthClaims
-	authClaims := &AuthClaims{
-		UserID:    claims.Subject,
-		Username:  claims.Username,
-		Role:      claims.Role,
-		IssuedAt:  claims.IssuedAt.Time,
-		ExpiresAt: claims.ExpiresAt.Time,
+	authClaims := claims.authClaims()
+	if err := j.checkRevoked(authClaims); err != nil {
+		return nil, err
 	}
 
 	return authClaims, nil
 }
 
-// RefreshToken refreshes a JWT token
-func (j *JWTAdapter) RefreshToken(tokenString string) (string, error) {
-	claims, err := j.ValidateToken(tokenString)
-	if err != nil {
-		return "", fmt.Errorf("invalid token for refresh: %w", err)
-	}
-
-	// Create new claims with extended expiration
-	newClaims := AuthClaims{
-		UserID:    claims.UserID,
-		Username:  claims.Username,
-		Role:      claims.Role,
-		IssuedAt:  time.Now(),
-		ExpiresAt: time.Now().Add(j.expiration),
-	}
-
-	return j.GenerateToken(newClaims)
-}
-
-// RevokeToken revokes a JWT token (JWT tokens can't be revoked, so this is a no-op)
-func (j *JWTAdapter) RevokeToken(token string) error {
-	// JWT tokens are stateless and cannot be revoked
-	// In a production system, you might want to maintain a blacklist
-	return nil
-}
-
 // AuthenticateUser authenticates a user with credentials
 func (j *JWTAdapter) AuthenticateUser(credentials AuthCredentials) (*AuthResult, error) {
 	// This method should typically call a user service to validate credentials
@@ -162,16 +164,7 @@ func (j *JWTAdapter) ExtractClaims(tokenString string) (*AuthClaims, error) {
 		return nil, fmt.Errorf("invalid claims type")
 	}
 
-	// Convert to AuthClaims
-	authClaims := &AuthClaims{
-		UserID:    claims.Subject,
-		Username:  claims.Username,
-		Role:      claims.Role,
-		IssuedAt:  claims.IssuedAt.Time,
-		ExpiresAt: claims.ExpiresAt.Time,
-	}
-
-	return authClaims, nil
+	return claims.authClaims(), nil
 }
 
 // Health checks the health of the JWT adapter
@@ -182,13 +175,33 @@ func (j *JWTAdapter) Health() error {
 	return nil
 }
 
-// JWTClaims represents JWT-specific claims structure
+// JWTClaims represents JWT-specific claims structure. SessionID names the
+// refresh token family the token was issued for.
 type JWTClaims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// authClaims converts the JWT claims to AuthClaims
+func (c *JWTClaims) authClaims() *AuthClaims {
+	claims := &AuthClaims{
+		UserID:    c.Subject,
+		Username:  c.Username,
+		Role:      c.Role,
+		TokenID:   c.ID,
+		SessionID: c.SessionID,
+	}
+	if c.IssuedAt != nil {
+		claims.IssuedAt = c.IssuedAt.Time
+	}
+	if c.ExpiresAt != nil {
+		claims.ExpiresAt = c.ExpiresAt.Time
+	}
+	return claims
+}
+
 // AuthenticateUserWithPassword authenticates a user with username/password
 func (j *JWTAdapter) AuthenticateUserWithPassword(username, password string, user *models.User) (*AuthResult, error) {
 	// Verify password
@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"webenable-cms-backend/adapters/cache"
+)
+
+const (
+	// oidcLoginTTL is how long a user may take to sign in at the provider
+	oidcLoginTTL = 10 * time.Minute
+	// oidcTimeout bounds the requests to the provider
+	oidcTimeout = 10 * time.Second
+)
+
+var (
+	// ErrOIDCNoRole is returned for identities that map to no role, which
+	// are not allowed to sign in
+	ErrOIDCNoRole = errors.New("identity has no role")
+	// ErrOIDCEmailUnverified is returned for identities without a verified
+	// email address, which can't be matched to users
+	ErrOIDCEmailUnverified = errors.New("identity has no verified email address")
+)
+
+// OIDCProvider signs users in with an OpenID Connect provider through the
+// authorization code flow with PKCE
+type OIDCProvider interface {
+	// BeginLogin starts a login and returns where to send the user
+	BeginLogin() (*OIDCLogin, error)
+	// CompleteLogin redeems the code the provider returned with state and
+	// returns the verified identity. binding is the Binding of the started
+	// login. Each login completes once.
+	CompleteLogin(ctx context.Context, state, binding, code string) (*OIDCIdentity, error)
+}
+
+// OIDCLogin is a started login. The provider sends the user back to the
+// redirect URL with the state and a code.
+type OIDCLogin struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	// Binding is a secret kept by the client that started the login. The
+	// login only completes with it, so a code and state obtained elsewhere
+	// can't sign a victim's browser in to another account.
+	Binding string `json:"-"`
+}
+
+// OIDCIdentity is the verified identity of a signed in user, with the role
+// its claims map to
+type OIDCIdentity struct {
+	Issuer            string `json:"issuer"`
+	Subject           string `json:"subject"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Role              string `json:"role"`
+}
+
+// oidcLoginState is kept in the cache between the start and the end of a
+// login
+type oidcLoginState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	// Binding is the hash of the binding of the login
+	Binding string `json:"binding"`
+}
+
+func oidcStateKey(hash string) string     { return "auth:oidc_state:" + hash }
+func oidcStateUsesKey(hash string) string { return "auth:oidc_state_uses:" + hash }
+
+// OIDCAdapter implements AuthAdapter for OpenID Connect. Users sign in at
+// the provider; the sessions that follow use the tokens of the JWT adapter.
+type OIDCAdapter struct {
+	*JWTAdapter
+	provider    *oidc.Provider
+	verifier    *oidc.IDTokenVerifier
+	oauth2      oauth2.Config
+	client      *http.Client
+	roleClaim   string
+	roleMapping map[string]string
+	defaultRole string
+}
+
+// NewOIDCAdapter creates an OpenID Connect adapter, discovering the
+// provider at issuer_url. Login state, refresh tokens and revocations are
+// kept in store.
+func NewOIDCAdapter(config map[string]interface{}, store cache.CacheAdapter) (AuthAdapter, error) {
+	jwtAdapter, err := NewJWTAdapter(config, store)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter := &OIDCAdapter{
+		JWTAdapter: jwtAdapter.(*JWTAdapter),
+		client:     &http.Client{Timeout: oidcTimeout},
+	}
+	if client, ok := config["http_client"].(*http.Client); ok {
+		adapter.client = client
+	}
+
+	if err := adapter.Configure(AuthConfig{
+		Type:   AuthTypeOAuth2,
+		Config: config,
+	}); err != nil {
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+// Configure discovers the provider and sets up the client
+func (o *OIDCAdapter) Configure(config AuthConfig) error {
+	if err := o.JWTAdapter.Configure(config); err != nil {
+		return err
+	}
+
+	issuer, _ := config.Config["issuer_url"].(string)
+	clientID, _ := config.Config["client_id"].(string)
+	clientSecret, _ := config.Config["client_secret"].(string)
+	redirectURL, _ := config.Config["redirect_url"].(string)
+	if issuer == "" || clientID == "" || redirectURL == "" {
+		return fmt.Errorf("oauth2 issuer_url, client_id and redirect_url are required")
+	}
+
+	scopes := configStrings(config.Config["scopes"])
+	if !containsString(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	roleMapping, err := parseRoleMapping(config.Config["role_mapping"])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(o.context(context.Background()), oidcTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+
+	o.provider = provider
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: clientID})
+	o.oauth2 = oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	o.roleClaim, _ = config.Config["role_claim"].(string)
+	if o.roleClaim == "" {
+		o.roleClaim = "groups"
+	}
+	o.roleMapping = roleMapping
+	o.defaultRole, _ = config.Config["default_role"].(string)
+	return nil
+}
+
+// context makes the provider requests use the adapter's HTTP client
+func (o *OIDCAdapter) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, o.client)
+}
+
+// BeginLogin starts a login with a fresh state, nonce, binding and PKCE
+// verifier
+func (o *OIDCAdapter) BeginLogin() (*OIDCLogin, error) {
+	state, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login state: %w", err)
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login nonce: %w", err)
+	}
+	binding, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login binding: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := o.store.Set(oidcStateKey(hashToken(state)), oidcLoginState{
+		Verifier: verifier,
+		Nonce:    nonce,
+		Binding:  hashToken(binding),
+	}, oidcLoginTTL); err != nil {
+		return nil, fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return &OIDCLogin{
+		AuthorizationURL: o.oauth2.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)),
+		State:            state,
+		ExpiresAt:        time.Now().Add(oidcLoginTTL),
+		Binding:          binding,
+	}, nil
+}
+
+// CompleteLogin exchanges the code for tokens and verifies the ID token
+// against the provider's keys. Unknown, expired and reused states, and
+// states presented without the binding of their login, fail with
+// ErrUnknownToken.
+func (o *OIDCAdapter) CompleteLogin(ctx context.Context, state, binding, code string) (*OIDCIdentity, error) {
+	hash := hashToken(state)
+
+	var login oidcLoginState
+	if err := o.store.Get(oidcStateKey(hash), &login); err != nil {
+		return nil, ErrUnknownToken
+	}
+	// A wrong binding leaves the login to the client that started it
+	if subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(login.Binding)) != 1 {
+		return nil, ErrUnknownToken
+	}
+	uses, err := o.store.IncrementCounter(oidcStateUsesKey(hash), oidcLoginTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check login state: %w", err)
+	}
+	if uses > 1 {
+		return nil, ErrUnknownToken
+	}
+	o.store.Delete(oidcStateKey(hash))
+
+	ctx, cancel := context.WithTimeout(o.context(ctx), oidcTimeout)
+	defer cancel()
+
+	token, err := o.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, fmt.Errorf("failed to verify id token: nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id token claims: %w", err)
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	identity.Role = o.mapRole(claims[o.roleClaim])
+	if identity.Role == "" {
+		return nil, ErrOIDCNoRole
+	}
+
+	return identity, nil
+}
+
+// mapRole returns the role of the first mapped claim value, or the default
+// role. A value of the role claim may be a string or a list of strings,
+// like groups.
+func (o *OIDCAdapter) mapRole(value interface{}) string {
+	for _, claim := range configStrings(value) {
+		if role, ok := o.roleMapping[claim]; ok {
+			return role
+		}
+	}
+	return o.defaultRole
+}
+
+// Health checks that the provider was discovered
+func (o *OIDCAdapter) Health() error {
+	if o.provider == nil {
+		return fmt.Errorf("oidc provider not configured")
+	}
+	return o.JWTAdapter.Health()
+}
+
+// parseRoleMapping reads a claim to role mapping, either a map or a string
+// like "cms-admins=admin,cms-editors=editor"
+func parseRoleMapping(value interface{}) (map[string]string, error) {
+	mapping := map[string]string{}
+
+	switch v := value.(type) {
+	case nil:
+	case map[string]string:
+		for claim, role := range v {
+			mapping[claim] = role
+		}
+	case string:
+		for _, pair := range strings.Split(v, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			claim, role, ok := strings.Cut(pair, "=")
+			claim, role = strings.TrimSpace(claim), strings.TrimSpace(role)
+			if !ok || claim == "" || role == "" {
+				return nil, fmt.Errorf("invalid oauth2 role mapping %q: expected claim=role", pair)
+			}
+			mapping[claim] = role
+		}
+	default:
+		return nil, fmt.Errorf("invalid oauth2 role mapping type %T", value)
+	}
+
+	return mapping, nil
+}
+
+// configStrings reads a string list from a config or claim value
+func configStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	case []string:
+		values = append(values, v...)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
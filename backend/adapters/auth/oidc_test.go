@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"webenable-cms-backend/adapters/auth/oidctest"
+	"webenable-cms-backend/adapters/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOIDCAdapter(t *testing.T, provider *oidctest.Provider, config map[string]interface{}) *OIDCAdapter {
+	t.Helper()
+
+	store, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+
+	settings := map[string]interface{}{
+		"secret":        "test-secret",
+		"issuer_url":    provider.URL,
+		"client_id":     provider.ClientID,
+		"client_secret": provider.ClientSecret,
+		"redirect_url":  "http://localhost:3000/auth/callback",
+		"scopes":        "profile,email",
+		"role_mapping":  "cms-admins=admin, cms-editors=editor",
+		"http_client":   provider.Client(),
+	}
+	for key, value := range config {
+		settings[key] = value
+	}
+
+	adapter, err := NewOIDCAdapter(settings, store)
+	require.NoError(t, err)
+	return adapter.(*OIDCAdapter)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider, err := oidctest.NewProvider()
+	require.NoError(t, err)
+	defer provider.Close()
+
+	adapter := newTestOIDCAdapter(t, provider, nil)
+	require.NoError(t, adapter.Health())
+
+	login := func() (string, string, string) {
+		t.Helper()
+		started, err := adapter.BeginLogin()
+		require.NoError(t, err)
+		require.NotEmpty(t, started.Binding)
+
+		u, err := url.Parse(started.AuthorizationURL)
+		require.NoError(t, err)
+		assert.Equal(t, provider.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal(t, "openid profile email", u.Query().Get("scope"))
+		assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+		assert.NotEmpty(t, u.Query().Get("nonce"))
+
+		code, state, err := provider.Authorize(started.AuthorizationURL)
+		require.NoError(t, err)
+		assert.Equal(t, started.State, state)
+		return code, state, started.Binding
+	}
+
+	provider.SetClaims(map[string]interface{}{
+		"sub":                "staff-1",
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"name":               "Jane Doe",
+		"preferred_username": "jane",
+		"groups":             []string{"staff", "cms-editors"},
+	})
+	code, state, binding := login()
+
+	// Only the client that started a login completes it
+	_, err = adapter.CompleteLogin(context.Background(), state, "", code)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+	_, _, otherBinding := login()
+	_, err = adapter.CompleteLogin(context.Background(), state, otherBinding, code)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+
+	identity, err := adapter.CompleteLogin(context.Background(), state, binding, code)
+	require.NoError(t, err)
+	assert.Equal(t, provider.URL, identity.Issuer)
+	assert.Equal(t, "staff-1", identity.Subject)
+	assert.Equal(t, "jane@example.com", identity.Email)
+	assert.Equal(t, "jane", identity.PreferredUsername)
+	assert.Equal(t, "editor", identity.Role)
+
+	// A state completes once
+	_, err = adapter.CompleteLogin(context.Background(), state, binding, code)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+	_, err = adapter.CompleteLogin(context.Background(), "unknown", binding, code)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+
+	// Codes are bound to the verifier of their login
+	_, first, firstBinding := login()
+	code, _, _ = login()
+	_, err = adapter.CompleteLogin(context.Background(), first, firstBinding, code)
+	assert.Error(t, err)
+
+	provider.SetClaims(map[string]interface{}{
+		"sub":            "staff-2",
+		"email":          "joe@example.com",
+		"email_verified": true,
+		"groups":         []string{"staff"},
+	})
+	code, state, binding = login()
+	_, err = adapter.CompleteLogin(context.Background(), state, binding, code)
+	assert.ErrorIs(t, err, ErrOIDCNoRole)
+
+	provider.SetClaims(map[string]interface{}{
+		"sub":    "staff-3",
+		"email":  "ann@example.com",
+		"groups": []string{"cms-admins"},
+	})
+	code, state, binding = login()
+	_, err = adapter.CompleteLogin(context.Background(), state, binding, code)
+	assert.ErrorIs(t, err, ErrOIDCEmailUnverified)
+}
+
+func TestOIDCDefaultRole(t *testing.T) {
+	provider, err := oidctest.NewProvider()
+	require.NoError(t, err)
+	defer provider.Close()
+
+	adapter := newTestOIDCAdapter(t, provider, map[string]interface{}{
+		"role_claim":   "cms_role",
+		"role_mapping": map[string]string{"chief": "editor"},
+		"default_role": "author",
+	})
+
+	tests := []struct {
+		name  string
+		value interface{}
+		role  string
+	}{
+		{"Mapped string", "chief", "editor"},
+		{"Unmapped", "intern", "author"},
+		{"Missing", nil, "author"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.role, adapter.mapRole(tt.value))
+		})
+	}
+}
+
+func TestOIDCConfiguration(t *testing.T) {
+	provider, err := oidctest.NewProvider()
+	require.NoError(t, err)
+	defer provider.Close()
+
+	store, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+
+	base := map[string]interface{}{
+		"secret":       "test-secret",
+		"issuer_url":   provider.URL,
+		"client_id":    provider.ClientID,
+		"redirect_url": "http://localhost:3000/auth/callback",
+		"http_client":  provider.Client(),
+	}
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+	}{
+		{"Missing issuer", "issuer_url", ""},
+		{"Unreachable issuer", "issuer_url", provider.URL + "/missing"},
+		{"Missing client", "client_id", ""},
+		{"Invalid role mapping", "role_mapping", "cms-admins"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{}
+			for key, value := range base {
+				config[key] = value
+			}
+			config[tt.key] = tt.value
+
+			_, err := NewOIDCAdapter(config, store)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRevoked is returned for tokens that were revoked before they expired
+	ErrRevoked = errors.New("token has been revoked")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is used
+	// again. The whole token family is revoked, as the token was stolen or
+	// the client is misbehaving.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrUnknownToken is returned for tokens that were not issued here or
+	// that expired
+	ErrUnknownToken = errors.New("unknown or expired token")
+)
+
+// refreshRecord is the cached state of a refresh token
+type refreshRecord struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Email     string    `json:"email"`
+	SessionID string    `json:"session_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Cache keys. Opaque tokens are stored by hash, so a cache dump does not
+// leak usable tokens.
+func refreshTokenKey(hash string) string  { return "auth:refresh:" + hash }
+func refreshUsesKey(hash string) string   { return "auth:refresh_uses:" + hash }
+func revokedTokenKey(jti string) string   { return "auth:revoked_token:" + jti }
+func revokedSessionKey(sid string) string { return "auth:revoked_session:" + sid }
+func revokedUserKey(userID string) string { return "auth:revoked_user:" + userID }
+func hashToken(token string) string       { return fmt.Sprintf("%x", sha256.Sum256([]byte(token))) }
+
+// IssueTokens issues an access token and a refresh token. Refresh tokens of
+// one login form a family named by claims.SessionID, which is started when
+// empty.
+func (j *JWTAdapter) IssueTokens(claims AuthClaims) (*AuthResult, error) {
+	now := time.Now()
+	if claims.SessionID == "" {
+		claims.SessionID = uuid.New().String()
+	}
+	claims.TokenID = ""
+	claims.IssuedAt = now
+	claims.ExpiresAt = now.Add(j.expiration)
+
+	token, err := j.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	record := refreshRecord{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		Email:     claims.Email,
+		SessionID: claims.SessionID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(j.refreshExpiration),
+	}
+	if err := j.store.Set(refreshTokenKey(hashToken(refreshToken)), record, j.refreshExpiration); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &AuthResult{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt,
+		Claims:       &claims,
+	}, nil
+}
+
+// RefreshToken redeems a refresh token and returns the claims it was
+// issued for, including its family, so the caller can issue the next pair
+// with IssueTokens. Each refresh token can be redeemed once; redeeming it
+// again revokes the family.
+func (j *JWTAdapter) RefreshToken(refreshToken string) (*AuthClaims, error) {
+	hash := hashToken(refreshToken)
+
+	var record refreshRecord
+	if err := j.store.Get(refreshTokenKey(hash), &record); err != nil {
+		exists, existsErr := j.store.Exists(refreshTokenKey(hash))
+		if existsErr != nil {
+			return nil, fmt.Errorf("failed to load refresh token: %w", existsErr)
+		}
+		if !exists {
+			return nil, ErrUnknownToken
+		}
+		return nil, fmt.Errorf("failed to load refresh token: %w", err)
+	}
+
+	claims := &AuthClaims{
+		UserID:    record.UserID,
+		Username:  record.Username,
+		Role:      record.Role,
+		Email:     record.Email,
+		IssuedAt:  record.IssuedAt,
+		ExpiresAt: record.ExpiresAt,
+		SessionID: record.SessionID,
+	}
+	if err := j.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+
+	// The record is kept after use until it expires, so reuse is detected
+	uses, err := j.store.IncrementCounter(refreshUsesKey(hash), time.Until(record.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem refresh token: %w", err)
+	}
+	if uses > 1 {
+		if err := j.revokeSession(record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return claims, nil
+}
+
+// parseIssuedToken parses an access token signed by the adapter, whether
+// or not it has expired
+func (j *JWTAdapter) parseIssuedToken(token string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return j.secret, nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// TokenSession returns the session ID of an access or refresh token the
+// adapter issued, whether or not it has expired. Unknown and forged tokens
+// fail with ErrUnknownToken.
+func (j *JWTAdapter) TokenSession(token string) (string, error) {
+	if claims, err := j.parseIssuedToken(token); err == nil {
+		return claims.SessionID, nil
+	}
+
+	var record refreshRecord
+	if err := j.store.Get(refreshTokenKey(hashToken(token)), &record); err != nil {
+		return "", ErrUnknownToken
+	}
+	return record.SessionID, nil
+}
+
+// RevokeToken revokes an access token by its jti together with its refresh
+// token family, or the family of a refresh token. Unknown tokens fail with
+// ErrUnknownToken.
+func (j *JWTAdapter) RevokeToken(token string) error {
+	claims, err := j.parseIssuedToken(token)
+	if err == nil {
+		if claims.ID != "" && claims.ExpiresAt != nil {
+			if ttl := time.Until(claims.ExpiresAt.Time); ttl > 0 {
+				if err := j.store.Set(revokedTokenKey(claims.ID), true, ttl); err != nil {
+					return fmt.Errorf("failed to revoke token: %w", err)
+				}
+			}
+		}
+		return j.revokeSession(claims.SessionID)
+	}
+
+	var record refreshRecord
+	if err := j.store.Get(refreshTokenKey(hashToken(token)), &record); err != nil {
+		return ErrUnknownToken
+	}
+	return j.revokeSession(record.SessionID)
+}
+
+// RevokeUserTokens revokes every access and refresh token issued to a user
+// so far
+func (j *JWTAdapter) RevokeUserTokens(userID string) error {
+	// Kept until every token issued before now has expired
+	if err := j.store.Set(revokedUserKey(userID), time.Now().Unix(), j.refreshExpiration); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeSession revokes a refresh token family and the access tokens
+// issued for it
+func (j *JWTAdapter) revokeSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	if err := j.store.Set(revokedSessionKey(sessionID), true, j.refreshExpiration); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// checkRevoked returns ErrRevoked if the token, its family or every token
+// of its user issued up to then was revoked. Lookup failures are returned
+// as errors too, so tokens are rejected while revocations can't be checked.
+func (j *JWTAdapter) checkRevoked(claims *AuthClaims) error {
+	if claims.TokenID != "" {
+		revoked, err := j.store.Exists(revokedTokenKey(claims.TokenID))
+		if err != nil {
+			return fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := j.store.Exists(revokedSessionKey(claims.SessionID))
+		if err != nil {
+			return fmt.Errorf("failed to check session revocation: %w", err)
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+
+	var revokedAt int64
+	if err := j.store.Get(revokedUserKey(claims.UserID), &revokedAt); err == nil {
+		// Issue times have second precision, so a token from the second
+		// of the revocation counts as revoked
+		if claims.IssuedAt.Unix() <= revokedAt {
+			return ErrRevoked
+		}
+	} else if exists, existsErr := j.store.Exists(revokedUserKey(claims.UserID)); existsErr != nil || exists {
+		return fmt.Errorf("failed to check user revocation: %w", err)
+	}
+
+	return nil
+}
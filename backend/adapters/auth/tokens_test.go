@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters/cache"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdapter(t *testing.T) AuthAdapter {
+	t.Helper()
+
+	store, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+	adapter, err := NewJWTAdapter(map[string]interface{}{
+		"secret": "test-secret",
+	}, store)
+	require.NoError(t, err)
+	return adapter
+}
+
+func TestIssueTokens(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	result, err := adapter.IssueTokens(AuthClaims{UserID: "u1", Username: "alice", Role: "editor"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), result.ExpiresAt, time.Minute)
+
+	claims, err := adapter.ValidateToken(result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+	assert.Equal(t, "alice", claims.Username)
+	assert.NotEmpty(t, claims.TokenID)
+	assert.Equal(t, result.Claims.SessionID, claims.SessionID)
+
+	refreshed, err := adapter.RefreshToken(result.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", refreshed.UserID)
+	assert.Equal(t, claims.SessionID, refreshed.SessionID)
+
+	rotated, err := adapter.IssueTokens(*refreshed)
+	require.NoError(t, err)
+	assert.Equal(t, claims.SessionID, rotated.Claims.SessionID)
+	assert.NotEqual(t, result.RefreshToken, rotated.RefreshToken)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	first, err := adapter.IssueTokens(AuthClaims{UserID: "u1", Username: "alice"})
+	require.NoError(t, err)
+	refreshed, err := adapter.RefreshToken(first.RefreshToken)
+	require.NoError(t, err)
+	second, err := adapter.IssueTokens(*refreshed)
+	require.NoError(t, err)
+
+	_, err = adapter.RefreshToken(first.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	// The whole family is revoked
+	_, err = adapter.RefreshToken(second.RefreshToken)
+	assert.ErrorIs(t, err, ErrRevoked)
+	_, err = adapter.ValidateToken(second.Token)
+	assert.ErrorIs(t, err, ErrRevoked)
+
+	_, err = adapter.RefreshToken("unknown")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+}
+
+func TestRevokeToken(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	t.Run("Access token", func(t *testing.T) {
+		result, err := adapter.IssueTokens(AuthClaims{UserID: "u1"})
+		require.NoError(t, err)
+		other, err := adapter.IssueTokens(AuthClaims{UserID: "u1"})
+		require.NoError(t, err)
+
+		require.NoError(t, adapter.RevokeToken(result.Token))
+		_, err = adapter.ValidateToken(result.Token)
+		assert.ErrorIs(t, err, ErrRevoked)
+		_, err = adapter.RefreshToken(result.RefreshToken)
+		assert.ErrorIs(t, err, ErrRevoked)
+
+		_, err = adapter.ValidateToken(other.Token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Refresh token", func(t *testing.T) {
+		result, err := adapter.IssueTokens(AuthClaims{UserID: "u2"})
+		require.NoError(t, err)
+
+		require.NoError(t, adapter.RevokeToken(result.RefreshToken))
+		_, err = adapter.ValidateToken(result.Token)
+		assert.ErrorIs(t, err, ErrRevoked)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		assert.ErrorIs(t, adapter.RevokeToken("unknown"), ErrUnknownToken)
+	})
+
+	t.Run("Session of a token", func(t *testing.T) {
+		result, err := adapter.IssueTokens(AuthClaims{UserID: "u5"})
+		require.NoError(t, err)
+
+		for _, token := range []string{result.Token, result.RefreshToken} {
+			sessionID, err := adapter.TokenSession(token)
+			require.NoError(t, err)
+			assert.Equal(t, result.Claims.SessionID, sessionID)
+		}
+
+		// Tokens signed by anyone else don't name a session
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &JWTClaims{SessionID: result.Claims.SessionID}).SignedString([]byte("other-secret"))
+		require.NoError(t, err)
+		_, err = adapter.TokenSession(forged)
+		assert.ErrorIs(t, err, ErrUnknownToken)
+		_, err = adapter.TokenSession("unknown")
+		assert.ErrorIs(t, err, ErrUnknownToken)
+	})
+
+	t.Run("All tokens of a user", func(t *testing.T) {
+		result, err := adapter.IssueTokens(AuthClaims{UserID: "u3"})
+		require.NoError(t, err)
+		other, err := adapter.IssueTokens(AuthClaims{UserID: "u4"})
+		require.NoError(t, err)
+
+		require.NoError(t, adapter.RevokeUserTokens("u3"))
+		_, err = adapter.ValidateToken(result.Token)
+		assert.ErrorIs(t, err, ErrRevoked)
+		_, err = adapter.RefreshToken(result.RefreshToken)
+		assert.ErrorIs(t, err, ErrRevoked)
+
+		_, err = adapter.ValidateToken(other.Token)
+		assert.NoError(t, err)
+	})
+}
+
+func TestJWTAdapterConfig(t *testing.T) {
+	store, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+
+	_, err = NewJWTAdapter(map[string]interface{}{"secret": "s"}, nil)
+	assert.Error(t, err)
+	_, err = NewJWTAdapter(map[string]interface{}{"secret": "s", "expiration": "2h", "refresh_expiration": "1h"}, store)
+	assert.Error(t, err)
+	_, err = NewJWTAdapter(map[string]interface{}{"secret": "s", "refresh_expiration": "soon"}, store)
+	assert.Error(t, err)
+}
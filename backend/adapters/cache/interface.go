@@ -34,6 +34,10 @@ type CacheAdapter interface {
 	ResetAllRateLimits() error
 	GetRateLimitInfo(identifier string) (current int64, ttl time.Duration, err error)
 
+	// Distributed Locking
+	AcquireLock(key, owner string, ttl time.Duration) (bool, error)
+	ReleaseLock(key, owner string) error
+
 	// Page Caching
 	CachePage(cacheKey string, response []byte, contentType string, ttl time.Duration) error
 	GetCachedPage(cacheKey string) ([]byte, string, error)
@@ -0,0 +1,561 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a value stored by MemoryAdapter
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// MemoryAdapter implements CacheAdapter in process memory. State is not
+// shared between replicas, so it suits single instance deployments,
+// development and tests. Keys and patterns mirror ValkeyAdapter.
+type MemoryAdapter struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	size    int64
+	maxSize int64
+}
+
+// NewMemoryAdapter creates a new in-memory adapter. max_size limits the
+// total size of the stored values, e.g. "100MB"; writes beyond it fail
+// rather than evict, since entries such as revoked tokens must not be lost.
+func NewMemoryAdapter(config map[string]interface{}) (CacheAdapter, error) {
+	adapter := &MemoryAdapter{entries: make(map[string]memoryEntry)}
+
+	if maxSize, ok := config["max_size"].(string); ok && maxSize != "" {
+		size, err := parseSize(maxSize)
+		if err != nil {
+			return nil, err
+		}
+		adapter.maxSize = size
+	}
+
+	return adapter, nil
+}
+
+// parseSize parses a size such as 512KB, 100MB or 1GB
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid cache size %q", value)
+	}
+	return size * multiplier, nil
+}
+
+// lookup returns a live entry, dropping it if it expired. The caller holds mu.
+func (m *MemoryAdapter) lookup(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return entry, false
+	}
+	if entry.expired(time.Now()) {
+		m.remove(key)
+		return entry, false
+	}
+	return entry, true
+}
+
+// store replaces the value of a key. The caller holds mu.
+func (m *MemoryAdapter) store(key string, value []byte, expires time.Time) error {
+	previous := int64(0)
+	if entry, ok := m.entries[key]; ok {
+		previous = int64(len(entry.value))
+	}
+
+	if m.maxSize > 0 && m.size-previous+int64(len(value)) > m.maxSize {
+		m.purgeExpired()
+		if m.size-previous+int64(len(value)) > m.maxSize {
+			return fmt.Errorf("failed to set key %s: cache is full", key)
+		}
+	}
+
+	m.remove(key)
+	m.entries[key] = memoryEntry{value: value, expires: expires}
+	m.size += int64(len(value))
+	return nil
+}
+
+// remove deletes a key. The caller holds mu.
+func (m *MemoryAdapter) remove(key string) {
+	if entry, ok := m.entries[key]; ok {
+		m.size -= int64(len(entry.value))
+		delete(m.entries, key)
+	}
+}
+
+// purgeExpired drops every expired entry. The caller holds mu.
+func (m *MemoryAdapter) purgeExpired() {
+	now := time.Now()
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			m.remove(key)
+		}
+	}
+}
+
+// keys returns the live keys matching a glob pattern. The caller holds mu.
+func (m *MemoryAdapter) keys(pattern string) []string {
+	now := time.Now()
+	var keys []string
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			continue
+		}
+		if matchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// matchPattern reports whether key matches a Valkey KEYS pattern, where *
+// matches any run of characters and ? any single one
+func matchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(key); i >= 0; i-- {
+				if matchPattern(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+// deletePattern deletes the keys matching a glob pattern
+func (m *MemoryAdapter) deletePattern(pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.keys(pattern) {
+		m.remove(key)
+	}
+	return nil
+}
+
+// expiry returns the expiry time of a ttl, zero for no expiry
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// Basic Operations
+
+// Set stores a key-value pair with expiration
+func (m *MemoryAdapter) Set(key string, value interface{}, ttl time.Duration) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store(key, jsonValue, expiry(ttl))
+}
+
+// Get retrieves a value by key
+func (m *MemoryAdapter) Get(key string, dest interface{}) error {
+	m.mu.Lock()
+	entry, ok := m.lookup(key)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("key %s not found", key)
+	}
+
+	if err := json.Unmarshal(entry.value, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal value for key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete removes a key
+func (m *MemoryAdapter) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(key)
+	return nil
+}
+
+// Exists checks if a key exists
+func (m *MemoryAdapter) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.lookup(key)
+	return ok, nil
+}
+
+// Advanced Operations
+
+// SetExpiration updates the expiration time for a key
+func (m *MemoryAdapter) SetExpiration(key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.lookup(key); ok {
+		entry.expires = expiry(ttl)
+		m.entries[key] = entry
+	}
+	return nil
+}
+
+// GetTTL returns the time to live for a key, -1 without expiry and -2 for a
+// missing key like Valkey
+func (m *MemoryAdapter) GetTTL(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		return -2, nil
+	}
+	if entry.expires.IsZero() {
+		return -1, nil
+	}
+	return time.Until(entry.expires), nil
+}
+
+// IncrementCounter increments a counter and returns the new value
+func (m *MemoryAdapter) IncrementCounter(key string, ttl time.Duration) (int64, error) {
+	return m.IncrementCounterBy(key, 1, ttl)
+}
+
+// IncrementCounterBy increments a counter by a specific amount
+func (m *MemoryAdapter) IncrementCounterBy(key string, increment int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current int64
+	if entry, ok := m.lookup(key); ok {
+		value, err := strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment counter %s: not an integer", key)
+		}
+		current = value
+	}
+
+	current += increment
+	if err := m.store(key, []byte(strconv.FormatInt(current, 10)), expiry(ttl)); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+// Application-Specific Operations
+
+// SetSession stores session data
+func (m *MemoryAdapter) SetSession(sessionID string, data interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("session:%s", sessionID), data, ttl)
+}
+
+// GetSession retrieves session data
+func (m *MemoryAdapter) GetSession(sessionID string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("session:%s", sessionID), dest)
+}
+
+// DeleteSession removes session data
+func (m *MemoryAdapter) DeleteSession(sessionID string) error {
+	return m.Delete(fmt.Sprintf("session:%s", sessionID))
+}
+
+// CachePost caches a post for faster retrieval
+func (m *MemoryAdapter) CachePost(postID string, post interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("post:%s", postID), post, ttl)
+}
+
+// GetCachedPost retrieves a cached post
+func (m *MemoryAdapter) GetCachedPost(postID string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("post:%s", postID), dest)
+}
+
+// InvalidatePostCache removes a cached post
+func (m *MemoryAdapter) InvalidatePostCache(postID string) error {
+	return m.Delete(fmt.Sprintf("post:%s", postID))
+}
+
+// Rate Limiting
+
+// SetRateLimit sets a rate limit counter
+func (m *MemoryAdapter) SetRateLimit(identifier string, limit int, window time.Duration) (bool, error) {
+	current, err := m.IncrementCounter(fmt.Sprintf("rate_limit:%s", identifier), window)
+	if err != nil {
+		return false, err
+	}
+	return current <= int64(limit), nil
+}
+
+// ResetRateLimit removes a specific rate limit counter
+func (m *MemoryAdapter) ResetRateLimit(identifier string) error {
+	return m.Delete(fmt.Sprintf("rate_limit:%s", identifier))
+}
+
+// ResetRateLimitByPattern removes all rate limit counters matching a pattern
+func (m *MemoryAdapter) ResetRateLimitByPattern(pattern string) error {
+	return m.deletePattern(fmt.Sprintf("rate_limit:%s", pattern))
+}
+
+// ResetAllRateLimits removes all rate limit counters
+func (m *MemoryAdapter) ResetAllRateLimits() error {
+	return m.ResetRateLimitByPattern("*")
+}
+
+// GetRateLimitInfo returns information about a rate limit
+func (m *MemoryAdapter) GetRateLimitInfo(identifier string) (current int64, ttl time.Duration, err error) {
+	key := fmt.Sprintf("rate_limit:%s", identifier)
+
+	m.mu.Lock()
+	entry, ok := m.lookup(key)
+	m.mu.Unlock()
+	if ok {
+		current, _ = strconv.ParseInt(string(entry.value), 10, 64)
+	}
+
+	ttl, err = m.GetTTL(key)
+	return current, ttl, err
+}
+
+// Distributed Locking
+
+// AcquireLock tries to take a lock. It returns false when another owner
+// already holds it.
+func (m *MemoryAdapter) AcquireLock(key, owner string, ttl time.Duration) (bool, error) {
+	lockKey := fmt.Sprintf("lock:%s", key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(lockKey); ok {
+		return false, nil
+	}
+	if err := m.store(lockKey, []byte(owner), expiry(ttl)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLock releases a lock previously acquired by owner
+func (m *MemoryAdapter) ReleaseLock(key, owner string) error {
+	lockKey := fmt.Sprintf("lock:%s", key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.lookup(lockKey); ok && string(entry.value) == owner {
+		m.remove(lockKey)
+	}
+	return nil
+}
+
+// Page Caching
+
+// cachedPage is the stored form of a cached page
+type cachedPage struct {
+	Content     string `json:"content"`
+	ContentType string `json:"content_type"`
+	CachedAt    int64  `json:"cached_at"`
+}
+
+// CachePage stores a full page response with headers
+func (m *MemoryAdapter) CachePage(cacheKey string, response []byte, contentType string, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("page_cache:%s", cacheKey), cachedPage{
+		Content:     string(response),
+		ContentType: contentType,
+		CachedAt:    time.Now().Unix(),
+	}, ttl)
+}
+
+// GetCachedPage retrieves a cached page response
+func (m *MemoryAdapter) GetCachedPage(cacheKey string) ([]byte, string, error) {
+	var page cachedPage
+	if err := m.Get(fmt.Sprintf("page_cache:%s", cacheKey), &page); err != nil {
+		return nil, "", err
+	}
+
+	if page.ContentType == "" {
+		page.ContentType = "application/json"
+	}
+	return []byte(page.Content), page.ContentType, nil
+}
+
+// InvalidatePageCache removes cached pages based on pattern
+func (m *MemoryAdapter) InvalidatePageCache(pattern string) error {
+	return m.deletePattern(fmt.Sprintf("page_cache:%s", pattern))
+}
+
+// InvalidateAllPageCache clears all page cache
+func (m *MemoryAdapter) InvalidateAllPageCache() error {
+	return m.deletePattern("page_cache:*")
+}
+
+// Posts List Caching
+
+// CachePostsList caches the posts list with query parameters
+func (m *MemoryAdapter) CachePostsList(queryHash string, posts interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("posts_list:%s", queryHash), posts, ttl)
+}
+
+// GetCachedPostsList retrieves cached posts list
+func (m *MemoryAdapter) GetCachedPostsList(queryHash string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("posts_list:%s", queryHash), dest)
+}
+
+// InvalidatePostsListCache removes cached posts lists
+func (m *MemoryAdapter) InvalidatePostsListCache() error {
+	return m.deletePattern("posts_list:*")
+}
+
+// Application State Management
+
+// SetApplicationState stores application-wide state
+func (m *MemoryAdapter) SetApplicationState(key string, value interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("app_state:%s", key), value, ttl)
+}
+
+// GetApplicationState retrieves application-wide state
+func (m *MemoryAdapter) GetApplicationState(key string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("app_state:%s", key), dest)
+}
+
+// SetUserState stores user-specific state
+func (m *MemoryAdapter) SetUserState(userID, key string, value interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("user_state:%s:%s", userID, key), value, ttl)
+}
+
+// GetUserState retrieves user-specific state
+func (m *MemoryAdapter) GetUserState(userID, key string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("user_state:%s:%s", userID, key), dest)
+}
+
+// SetTemporaryData stores temporary data with auto-expiration
+func (m *MemoryAdapter) SetTemporaryData(key string, value interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("temp:%s", key), value, ttl)
+}
+
+// GetTemporaryData retrieves temporary data
+func (m *MemoryAdapter) GetTemporaryData(key string, dest interface{}) error {
+	return m.Get(fmt.Sprintf("temp:%s", key), dest)
+}
+
+// Counter Operations
+
+// SetCounterWithExpiry sets a counter with expiry
+func (m *MemoryAdapter) SetCounterWithExpiry(key string, value int64, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store(fmt.Sprintf("counter:%s", key), []byte(strconv.FormatInt(value, 10)), expiry(ttl))
+}
+
+// GetCounter retrieves a counter value, 0 if it doesn't exist
+func (m *MemoryAdapter) GetCounter(key string) (int64, error) {
+	counterKey := fmt.Sprintf("counter:%s", key)
+
+	m.mu.Lock()
+	entry, ok := m.lookup(counterKey)
+	m.mu.Unlock()
+	if !ok {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get counter %s: not an integer", key)
+	}
+	return value, nil
+}
+
+// Notifications
+
+// SetNotification stores a notification for a user
+func (m *MemoryAdapter) SetNotification(userID, notificationID string, notification interface{}, ttl time.Duration) error {
+	return m.Set(fmt.Sprintf("notification:%s:%s", userID, notificationID), notification, ttl)
+}
+
+// GetUserNotifications retrieves the notification keys of a user
+func (m *MemoryAdapter) GetUserNotifications(userID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.keys(fmt.Sprintf("notification:%s:*", userID)), nil
+}
+
+// PublishEvent accepts an event. There are no subscribers in process, so
+// it is only checked to be serializable.
+func (m *MemoryAdapter) PublishEvent(channel string, message interface{}) error {
+	if _, err := json.Marshal(message); err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return nil
+}
+
+// Health & Stats
+
+// Health always succeeds, the cache lives in process
+func (m *MemoryAdapter) Health() error {
+	return nil
+}
+
+// GetStats returns cache statistics
+func (m *MemoryAdapter) GetStats() (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purgeExpired()
+	return map[string]interface{}{
+		"connected": true,
+		"db_size":   int64(len(m.entries)),
+		"size":      m.size,
+		"max_size":  m.maxSize,
+	}, nil
+}
+
+// Close drops every entry
+func (m *MemoryAdapter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = make(map[string]memoryEntry)
+	m.size = 0
+	return nil
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryAdapter(t *testing.T) {
+	adapter, err := NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+
+	t.Run("Values expire", func(t *testing.T) {
+		require.NoError(t, adapter.Set("greeting", map[string]string{"text": "hello"}, 20*time.Millisecond))
+
+		var value map[string]string
+		require.NoError(t, adapter.Get("greeting", &value))
+		assert.Equal(t, "hello", value["text"])
+
+		time.Sleep(30 * time.Millisecond)
+		assert.Error(t, adapter.Get("greeting", &value))
+		exists, err := adapter.Exists("greeting")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		count, err := adapter.IncrementCounter("hits", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		count, err = adapter.IncrementCounterBy("hits", 4, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+
+		var stored int64
+		require.NoError(t, adapter.Get("hits", &stored))
+		assert.Equal(t, int64(5), stored)
+
+		allowed, err := adapter.SetRateLimit("client", 1, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, err = adapter.SetRateLimit("client", 1, time.Minute)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		require.NoError(t, adapter.ResetAllRateLimits())
+		current, _, err := adapter.GetRateLimitInfo("client")
+		require.NoError(t, err)
+		assert.Zero(t, current)
+	})
+
+	t.Run("Locks", func(t *testing.T) {
+		acquired, err := adapter.AcquireLock("job", "a", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		acquired, err = adapter.AcquireLock("job", "b", time.Minute)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+
+		require.NoError(t, adapter.ReleaseLock("job", "b"))
+		acquired, _ = adapter.AcquireLock("job", "b", time.Minute)
+		assert.False(t, acquired)
+		require.NoError(t, adapter.ReleaseLock("job", "a"))
+		acquired, _ = adapter.AcquireLock("job", "b", time.Minute)
+		assert.True(t, acquired)
+	})
+
+	t.Run("Pattern invalidation", func(t *testing.T) {
+		require.NoError(t, adapter.CachePage("/api/v1/posts?page=1", []byte("[]"), "application/json", time.Minute))
+		require.NoError(t, adapter.CachePage("/api/v1/categories", []byte("[]"), "application/json", time.Minute))
+
+		content, contentType, err := adapter.GetCachedPage("/api/v1/posts?page=1")
+		require.NoError(t, err)
+		assert.Equal(t, "[]", string(content))
+		assert.Equal(t, "application/json", contentType)
+
+		require.NoError(t, adapter.InvalidatePageCache("/api/v1/posts*"))
+		_, _, err = adapter.GetCachedPage("/api/v1/posts?page=1")
+		assert.Error(t, err)
+		_, _, err = adapter.GetCachedPage("/api/v1/categories")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Size limit", func(t *testing.T) {
+		small, err := NewMemoryAdapter(map[string]interface{}{"max_size": "1KB"})
+		require.NoError(t, err)
+		require.NoError(t, small.Set("a", strings.Repeat("x", 600), time.Minute))
+		assert.Error(t, small.Set("b", strings.Repeat("x", 600), time.Minute))
+		// Replacing a value only counts the difference
+		require.NoError(t, small.Set("a", strings.Repeat("x", 900), time.Minute))
+
+		_, err = NewMemoryAdapter(map[string]interface{}{"max_size": "lots"})
+		assert.Error(t, err)
+	})
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"posts_list:*", "posts_list:abc", true},
+		{"page_cache:/api/*", "page_cache:/api/v1/posts", true},
+		{"notification:42:*", "notification:420:1", false},
+		{"rate_limit:?", "rate_limit:a", true},
+		{"rate_limit:?", "rate_limit:ab", false},
+		{"exact", "exact", true},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.match, matchPattern(tt.pattern, tt.key))
+		})
+	}
+}
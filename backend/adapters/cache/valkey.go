@@ -252,6 +252,40 @@ func (v *ValkeyAdapter) GetRateLimitInfo(identifier string) (current int64, ttl
 	return current, ttl, nil
 }
 
+// Distributed Locking
+
+// releaseLockScript deletes a lock only if it is still held by the caller
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock tries to take a lock shared by all replicas. It returns false
+// when another owner already holds it.
+func (v *ValkeyAdapter) AcquireLock(key, owner string, ttl time.Duration) (bool, error) {
+	lockKey := fmt.Sprintf("lock:%s", key)
+
+	acquired, err := v.client.SetNX(v.ctx, lockKey, owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+
+	return acquired, nil
+}
+
+// ReleaseLock releases a lock previously acquired by owner
+func (v *ValkeyAdapter) ReleaseLock(key, owner string) error {
+	lockKey := fmt.Sprintf("lock:%s", key)
+
+	if err := releaseLockScript.Run(v.ctx, v.client, []string{lockKey}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", key, err)
+	}
+
+	return nil
+}
+
 // Page Caching
 
 // CachePage stores a full page response with headers
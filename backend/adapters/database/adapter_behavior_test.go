@@ -0,0 +1,1039 @@
+package database
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"webenable-cms-backend/models"
+)
+
+// behaviorOptions describes what an adapter under test supports
+type behaviorOptions struct {
+	// transactional adapters must discard writes on Rollback
+	transactional bool
+}
+
+// testAdapterBehavior runs the behavior every DatabaseAdapter must share.
+// Names are randomized so the suite can run against a non-empty database.
+func testAdapterBehavior(t *testing.T, db DatabaseAdapter, opts behaviorOptions) {
+	t.Run("Posts", func(t *testing.T) { testPostBehavior(t, db) })
+	t.Run("PostSlugs", func(t *testing.T) { testPostSlugBehavior(t, db) })
+	t.Run("PostRevisions", func(t *testing.T) { testPostRevisionBehavior(t, db) })
+	t.Run("Users", func(t *testing.T) { testUserBehavior(t, db) })
+	t.Run("Contacts", func(t *testing.T) { testContactBehavior(t, db) })
+	t.Run("Categories", func(t *testing.T) { testCategoryBehavior(t, db) })
+	t.Run("Lists", func(t *testing.T) { testListBehavior(t, db) })
+	t.Run("Media", func(t *testing.T) { testMediaBehavior(t, db) })
+	t.Run("TwoFactor", func(t *testing.T) { testTwoFactorBehavior(t, db) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeyBehavior(t, db) })
+	t.Run("PasswordHistory", func(t *testing.T) { testPasswordHistoryBehavior(t, db) })
+	t.Run("Invitations", func(t *testing.T) { testInvitationBehavior(t, db) })
+	t.Run("Identities", func(t *testing.T) { testIdentityBehavior(t, db) })
+	t.Run("Audit", func(t *testing.T) { testAuditBehavior(t, db) })
+	t.Run("Settings", func(t *testing.T) { testSettingBehavior(t, db) })
+	if opts.transactional {
+		t.Run("Transactions", func(t *testing.T) { testTransactionBehavior(t, db) })
+	}
+}
+
+func uniqueName(prefix string) string {
+	return prefix + "-" + uuid.New().String()[:8]
+}
+
+func testPostBehavior(t *testing.T, db DatabaseAdapter) {
+	slug := uniqueName("post")
+
+	post := &models.Post{
+		Title:      "Behavior test",
+		Slug:       slug,
+		Content:    "Body",
+		Author:     "tester",
+		Status:     "draft",
+		Tags:       []string{"go", "tests"},
+		Categories: []string{"engineering"},
+		IsFeatured: true,
+	}
+	require.NoError(t, db.CreatePost(post))
+	require.NotEmpty(t, post.ID)
+	assert.NotEmpty(t, post.Rev)
+	assert.Nil(t, post.PublishedAt)
+
+	stored, err := db.GetPost(post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, stored.ID)
+	assert.Equal(t, "Behavior test", stored.Title)
+	assert.Equal(t, []string{"go", "tests"}, stored.Tags)
+	assert.Equal(t, []string{"engineering"}, stored.Categories)
+	assert.True(t, stored.IsFeatured)
+	assert.NotEmpty(t, stored.Rev)
+
+	bySlug, err := db.GetPostBySlug(slug)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, bySlug.ID)
+
+	// Publishing sets the publish time and moving the slug keeps the old one
+	stored.Status = "published"
+	stored.Slug = slug + "-renamed"
+	stored.PreviousSlugs = []string{slug}
+	require.NoError(t, db.UpdatePost(post.ID, stored))
+	assert.NotNil(t, stored.PublishedAt)
+
+	updated, err := db.GetPost(post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "published", updated.Status)
+	require.NotNil(t, updated.PublishedAt)
+	assert.WithinDuration(t, post.CreatedAt, updated.CreatedAt, time.Second)
+
+	_, err = db.GetPostBySlug(slug)
+	assert.Error(t, err)
+	moved, err := db.GetPostByPreviousSlug(slug)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, moved.ID)
+
+	page, err := db.GetPosts(1, 0)
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+
+	require.NoError(t, db.DeletePost(post.ID))
+	_, err = db.GetPost(post.ID)
+	assert.ErrorIs(t, err, ErrPostNotFound)
+	assert.Error(t, db.DeletePost(post.ID))
+	assert.Error(t, db.UpdatePost(post.ID, updated))
+
+	// Only scheduled posts that are due are returned
+	due := time.Now().Add(-time.Minute)
+	scheduled := &models.Post{Title: "Scheduled", Slug: uniqueName("scheduled"), Status: "scheduled", ScheduledAt: &due}
+	require.NoError(t, db.CreatePost(scheduled))
+	defer db.DeletePost(scheduled.ID)
+
+	isDue := func(before time.Time) bool {
+		posts, err := db.GetScheduledPosts(before)
+		require.NoError(t, err)
+		for _, p := range posts {
+			if p.ID == scheduled.ID {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, isDue(time.Now()))
+	assert.False(t, isDue(due.Add(-time.Second)))
+}
+
+func testPostSlugBehavior(t *testing.T, db DatabaseAdapter) {
+	slug := uniqueName("taken")
+
+	first := &models.Post{Title: "First", Slug: slug, Status: "draft"}
+	require.NoError(t, db.CreatePost(first))
+
+	// A slug is held by one post at a time
+	second := &models.Post{Title: "Second", Slug: slug, Status: "draft"}
+	assert.ErrorIs(t, db.CreatePost(second), ErrSlugTaken)
+
+	second.Slug = uniqueName("second")
+	require.NoError(t, db.CreatePost(second))
+	defer db.DeletePost(second.ID)
+
+	stored, err := db.GetPost(second.ID)
+	require.NoError(t, err)
+	stored.Slug = slug
+	assert.ErrorIs(t, db.UpdatePost(second.ID, stored), ErrSlugTaken)
+
+	bySlug, err := db.GetPostBySlug(slug)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, bySlug.ID)
+
+	// Posts without a slug don't clash
+	for i := 0; i < 2; i++ {
+		untitled := &models.Post{Title: "Untitled", Status: "draft"}
+		require.NoError(t, db.CreatePost(untitled))
+		defer db.DeletePost(untitled.ID)
+	}
+
+	// Deleted posts free their slug
+	require.NoError(t, db.DeletePost(first.ID))
+	stored, err = db.GetPost(second.ID)
+	require.NoError(t, err)
+	stored.Slug = slug
+	require.NoError(t, db.UpdatePost(second.ID, stored))
+}
+
+func testPostRevisionBehavior(t *testing.T, db DatabaseAdapter) {
+	postID := uniqueName("post")
+
+	first := &models.PostRevision{
+		PostID:   postID,
+		Author:   "tester",
+		Snapshot: models.PostSnapshot{Title: "One", Tags: []string{"a"}},
+	}
+	require.NoError(t, db.CreatePostRevision(first))
+	assert.Equal(t, 1, first.Number)
+
+	second := &models.PostRevision{
+		PostID:        postID,
+		Author:        "tester",
+		ChangedFields: []string{"title"},
+		RestoredFrom:  1,
+		Snapshot:      models.PostSnapshot{Title: "Two"},
+	}
+	require.NoError(t, db.CreatePostRevision(second))
+	assert.Equal(t, 2, second.Number)
+
+	revisions, err := db.GetPostRevisions(postID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, "One", revisions[0].Snapshot.Title)
+	assert.Equal(t, []string{"a"}, revisions[0].Snapshot.Tags)
+	assert.Equal(t, 2, revisions[1].Number)
+
+	revision, err := db.GetPostRevision(postID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"title"}, revision.ChangedFields)
+	assert.Equal(t, 1, revision.RestoredFrom)
+
+	_, err = db.GetPostRevision(postID, 3)
+	assert.Error(t, err)
+}
+
+func testUserBehavior(t *testing.T, db DatabaseAdapter) {
+	username := uniqueName("user")
+
+	user := &models.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: "hash",
+		Role:         "editor",
+		Active:       true,
+	}
+	require.NoError(t, db.CreateUser(user))
+	require.NotEmpty(t, user.ID)
+
+	byID, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, username, byID.Username)
+	assert.Equal(t, "hash", byID.PasswordHash)
+
+	byName, err := db.GetUserByUsername(username)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, byName.ID)
+
+	byEmail, err := db.GetUserByEmail(username + "@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, byEmail.ID)
+
+	_, err = db.GetUserByUsername(uniqueName("missing"))
+	assert.Error(t, err)
+
+	users, err := db.GetUsers(100, 0)
+	require.NoError(t, err)
+	for _, u := range users {
+		assert.Empty(t, u.PasswordHash)
+	}
+
+	// Empty fields are left alone, Active is always applied
+	update := &models.User{Role: "author", Active: false}
+	require.NoError(t, db.UpdateUser(user.ID, update))
+	assert.Equal(t, username, update.Username)
+	assert.Empty(t, update.PasswordHash)
+
+	updated, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "author", updated.Role)
+	assert.Equal(t, username+"@example.com", updated.Email)
+	assert.Equal(t, "hash", updated.PasswordHash)
+	assert.False(t, updated.Active)
+
+	// Verification applies to the address it was requested for, and a new
+	// address starts out unverified
+	assert.False(t, updated.EmailVerified)
+	assert.Error(t, db.MarkEmailVerified(user.ID, "other@example.com"))
+	require.NoError(t, db.MarkEmailVerified(user.ID, username+"@example.com"))
+	verified, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+
+	require.NoError(t, db.UpdateUser(user.ID, &models.User{Email: username + "@example.com"}))
+	unchanged, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.True(t, unchanged.EmailVerified)
+
+	require.NoError(t, db.UpdateUser(user.ID, &models.User{Email: username + "@example.org"}))
+	changed, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, username+"@example.org", changed.Email)
+	assert.False(t, changed.EmailVerified)
+
+	require.NoError(t, db.DeleteUser(user.ID))
+	_, err = db.GetUser(user.ID)
+	assert.Error(t, err)
+}
+
+func testContactBehavior(t *testing.T, db DatabaseAdapter) {
+	contact := &models.Contact{
+		Name:    "Tester",
+		Email:   uniqueName("contact") + "@example.com",
+		Subject: "Hello",
+		Message: "Message",
+		Status:  "replied",
+	}
+	require.NoError(t, db.CreateContact(contact))
+	require.NotEmpty(t, contact.ID)
+	assert.Equal(t, "new", contact.Status)
+
+	stored, err := db.GetContact(contact.ID)
+	require.NoError(t, err)
+	assert.Equal(t, contact.ID, stored.ID)
+	assert.Equal(t, "Hello", stored.Subject)
+	assert.Nil(t, stored.ReadAt)
+
+	readAt := time.Now()
+	stored.Status = "read"
+	stored.ReadAt = &readAt
+	require.NoError(t, db.UpdateContact(contact.ID, stored))
+
+	updated, err := db.GetContact(contact.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "read", updated.Status)
+	require.NotNil(t, updated.ReadAt)
+	assert.WithinDuration(t, readAt, *updated.ReadAt, time.Second)
+
+	contacts, err := db.GetContacts(1, 0)
+	require.NoError(t, err)
+	assert.Len(t, contacts, 1)
+
+	require.NoError(t, db.DeleteContact(contact.ID))
+	_, err = db.GetContact(contact.ID)
+	assert.Error(t, err)
+}
+
+func testCategoryBehavior(t *testing.T, db DatabaseAdapter) {
+	slug := uniqueName("category")
+
+	category := &models.Category{Name: "Behavior", Slug: slug}
+	require.NoError(t, db.CreateCategory(category))
+	require.NotEmpty(t, category.ID)
+
+	bySlug, err := db.GetCategoryBySlug(slug)
+	require.NoError(t, err)
+	assert.Equal(t, category.ID, bySlug.ID)
+
+	require.NoError(t, db.IncrementCategoryPostCount(slug, 2))
+	require.NoError(t, db.IncrementCategoryPostCount(slug, -5))
+
+	stored, err := db.GetCategory(category.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stored.PostCount)
+
+	stored.Description = "Updated"
+	require.NoError(t, db.UpdateCategory(category.ID, stored))
+
+	categories, err := db.GetCategories()
+	require.NoError(t, err)
+	found := false
+	for _, c := range categories {
+		if c.ID == category.ID {
+			found = true
+			assert.Equal(t, "Updated", c.Description)
+		}
+	}
+	assert.True(t, found)
+
+	require.NoError(t, db.DeleteCategory(category.ID))
+	_, err = db.GetCategory(category.ID)
+	assert.Error(t, err)
+}
+
+// walkPages follows the cursors of a list and returns every ID it saw
+func walkPages(t *testing.T, page func(cursor string) ([]string, string)) []string {
+	var ids []string
+	cursor := ""
+	for i := 0; i < 20; i++ {
+		pageIDs, next := page(cursor)
+		ids = append(ids, pageIDs...)
+		if next == "" {
+			return ids
+		}
+		cursor = next
+	}
+	t.Fatal("cursor pagination did not terminate")
+	return nil
+}
+
+func testListBehavior(t *testing.T, db DatabaseAdapter) {
+	author := uniqueName("author")
+	tag := uniqueName("tag")
+
+	// Posts by view count: c(1) a(2) e(3) b(4) d(5)
+	titles := []string{"a", "b", "c", "d", "e"}
+	views := []int{2, 4, 1, 5, 3}
+	ids := make(map[string]string)
+	for i, title := range titles {
+		post := &models.Post{
+			Title:      title,
+			Slug:       uniqueName("list"),
+			Author:     author,
+			Status:     "published",
+			ViewCount:  views[i],
+			IsFeatured: i%2 == 0,
+		}
+		if i < 2 {
+			post.Tags = []string{tag}
+		}
+		require.NoError(t, db.CreatePost(post))
+		defer db.DeletePost(post.ID)
+		ids[title] = post.ID
+	}
+	byTitle := func(titles ...string) []string {
+		var expected []string
+		for _, title := range titles {
+			expected = append(expected, ids[title])
+		}
+		return expected
+	}
+
+	listPosts := func(query models.PostQuery) []string {
+		query.Author = author
+		query.Limit = 2
+		return walkPages(t, func(cursor string) ([]string, string) {
+			query.Cursor = cursor
+			list, err := db.ListPosts(query)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(list.Posts), 2)
+			var pageIDs []string
+			for _, post := range list.Posts {
+				pageIDs = append(pageIDs, post.ID)
+			}
+			return pageIDs, list.NextCursor
+		})
+	}
+
+	featured := true
+	tests := []struct {
+		name     string
+		query    models.PostQuery
+		expected []string
+	}{
+		{"view count ascending", models.PostQuery{ListOptions: models.ListOptions{Sort: "view_count"}}, byTitle("c", "a", "e", "b", "d")},
+		{"view count descending", models.PostQuery{ListOptions: models.ListOptions{Sort: "view_count", Desc: true}}, byTitle("d", "b", "e", "a", "c")},
+		{"title ascending", models.PostQuery{ListOptions: models.ListOptions{Sort: "title"}}, byTitle("a", "b", "c", "d", "e")},
+		{"title descending", models.PostQuery{ListOptions: models.ListOptions{Sort: "title", Desc: true}}, byTitle("e", "d", "c", "b", "a")},
+		{"created ascending", models.PostQuery{}, byTitle("a", "b", "c", "d", "e")},
+		{"published descending", models.PostQuery{ListOptions: models.ListOptions{Sort: "published_at", Desc: true}}, byTitle("e", "d", "c", "b", "a")},
+		{"tag filter", models.PostQuery{Tag: tag, ListOptions: models.ListOptions{Sort: "title"}}, byTitle("a", "b")},
+		{"featured filter", models.PostQuery{Featured: &featured, ListOptions: models.ListOptions{Sort: "title"}}, byTitle("a", "c", "e")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, listPosts(tt.query))
+
+			count, err := db.CountPosts(models.PostQuery{
+				Author: author, Tag: tt.query.Tag, Featured: tt.query.Featured,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.expected), count)
+		})
+	}
+
+	future := time.Now().Add(time.Hour)
+	none, err := db.ListPosts(models.PostQuery{Author: author, Created: models.TimeRange{From: &future}})
+	require.NoError(t, err)
+	assert.Empty(t, none.Posts)
+	assert.Empty(t, none.NextCursor)
+
+	offset, err := db.ListPosts(models.PostQuery{
+		Author:      author,
+		ListOptions: models.ListOptions{Sort: "title", Limit: 2, Offset: 1},
+	})
+	require.NoError(t, err)
+	require.Len(t, offset.Posts, 2)
+	assert.Equal(t, ids["b"], offset.Posts[0].ID)
+
+	// Cursors are bound to the sort they were issued for
+	first, err := db.ListPosts(models.PostQuery{Author: author, ListOptions: models.ListOptions{Sort: "title", Limit: 2}})
+	require.NoError(t, err)
+	require.NotEmpty(t, first.NextCursor)
+	_, err = db.ListPosts(models.PostQuery{Author: author, ListOptions: models.ListOptions{Sort: "view_count", Cursor: first.NextCursor}})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = db.ListPosts(models.PostQuery{ListOptions: models.ListOptions{Cursor: "not a cursor"}})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = db.ListPosts(models.PostQuery{ListOptions: models.ListOptions{Sort: "content"}})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	// Users
+	role := uniqueName("role")
+	var usernames []string
+	for i := 0; i < 3; i++ {
+		username := uniqueName("list")
+		user := &models.User{Username: username, Email: username + "@example.com", PasswordHash: "hash", Role: role, Active: true}
+		require.NoError(t, db.CreateUser(user))
+		defer db.DeleteUser(user.ID)
+		usernames = append(usernames, username)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(usernames)))
+
+	listedUsers := walkPages(t, func(cursor string) ([]string, string) {
+		list, err := db.ListUsers(models.UserQuery{
+			Role:        role,
+			ListOptions: models.ListOptions{Sort: "username", Desc: true, Limit: 2, Cursor: cursor},
+		})
+		require.NoError(t, err)
+		var names []string
+		for _, user := range list.Users {
+			assert.Empty(t, user.PasswordHash)
+			names = append(names, user.Username)
+		}
+		return names, list.NextCursor
+	})
+	assert.Equal(t, usernames, listedUsers)
+
+	userCount, err := db.CountUsers(models.UserQuery{Role: role})
+	require.NoError(t, err)
+	assert.Equal(t, 3, userCount)
+
+	// Contacts
+	status := uniqueName("status")
+	var contactIDs []string
+	for i := 0; i < 3; i++ {
+		contact := &models.Contact{Name: "Lister", Email: uniqueName("list") + "@example.com", Subject: "Hi", Message: "Message"}
+		require.NoError(t, db.CreateContact(contact))
+		defer db.DeleteContact(contact.ID)
+		contact.Status = status
+		require.NoError(t, db.UpdateContact(contact.ID, contact))
+		contactIDs = append([]string{contact.ID}, contactIDs...)
+	}
+
+	listedContacts := walkPages(t, func(cursor string) ([]string, string) {
+		list, err := db.ListContacts(models.ContactQuery{
+			Status:      status,
+			ListOptions: models.ListOptions{Desc: true, Limit: 2, Cursor: cursor},
+		})
+		require.NoError(t, err)
+		var pageIDs []string
+		for _, contact := range list.Contacts {
+			pageIDs = append(pageIDs, contact.ID)
+		}
+		return pageIDs, list.NextCursor
+	})
+	assert.Equal(t, contactIDs, listedContacts)
+
+	contactCount, err := db.CountContacts(models.ContactQuery{Status: status})
+	require.NoError(t, err)
+	assert.Equal(t, 3, contactCount)
+}
+
+func testTwoFactorBehavior(t *testing.T, db DatabaseAdapter) {
+	username := uniqueName("user")
+	user := &models.User{Username: username, Email: username + "@example.com", Role: "admin", Active: true}
+	require.NoError(t, db.CreateUser(user))
+	defer db.DeleteUser(user.ID)
+
+	missing, err := db.GetTwoFactor(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	pending := &models.TwoFactor{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP"}
+	require.NoError(t, db.SaveTwoFactor(pending))
+
+	stored, err := db.GetTwoFactor(user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", stored.Secret)
+	assert.False(t, stored.Enabled)
+	assert.Empty(t, stored.RecoveryCodes)
+	assert.Nil(t, stored.EnabledAt)
+
+	enabledAt := time.Now().Truncate(time.Second)
+	stored.Enabled = true
+	stored.EnabledAt = &enabledAt
+	stored.RecoveryCodes = []string{"hash-a", "hash-b"}
+	stored.LastUsedStep = 56666666
+	require.NoError(t, db.SaveTwoFactor(stored))
+
+	enabled, err := db.GetTwoFactor(user.ID)
+	require.NoError(t, err)
+	assert.True(t, enabled.Enabled)
+	assert.Equal(t, []string{"hash-a", "hash-b"}, enabled.RecoveryCodes)
+	assert.Equal(t, int64(56666666), enabled.LastUsedStep)
+	require.NotNil(t, enabled.EnabledAt)
+	assert.True(t, enabledAt.Equal(*enabled.EnabledAt))
+	assert.True(t, stored.CreatedAt.Sub(enabled.CreatedAt).Abs() < time.Second)
+
+	require.NoError(t, db.DeleteTwoFactor(user.ID))
+	deleted, err := db.GetTwoFactor(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+	assert.NoError(t, db.DeleteTwoFactor(user.ID))
+
+	// The configuration is deleted with its user
+	require.NoError(t, db.SaveTwoFactor(&models.TwoFactor{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP"}))
+	require.NoError(t, db.DeleteUser(user.ID))
+	orphan, err := db.GetTwoFactor(user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, orphan)
+}
+
+func testAPIKeyBehavior(t *testing.T, db DatabaseAdapter) {
+	username := uniqueName("user")
+	user := &models.User{Username: username, Email: username + "@example.com", Role: "author", Active: true}
+	require.NoError(t, db.CreateUser(user))
+	defer db.DeleteUser(user.ID)
+
+	hash := uniqueName("hash")
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	key := &models.APIKey{
+		UserID:    user.ID,
+		Name:      "deploy",
+		Prefix:    "wcms_abcdefgh",
+		KeyHash:   hash,
+		Scopes:    []string{"posts:create", "media:read"},
+		ExpiresAt: expiresAt,
+	}
+	require.NoError(t, db.CreateAPIKey(key))
+	require.NotEmpty(t, key.ID)
+
+	stored, err := db.GetAPIKeyByHash(hash)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, stored.ID)
+	assert.Equal(t, user.ID, stored.UserID)
+	assert.Equal(t, []string{"posts:create", "media:read"}, stored.Scopes)
+	assert.True(t, expiresAt.Equal(stored.ExpiresAt))
+	assert.Nil(t, stored.LastUsedAt)
+	assert.Nil(t, stored.RevokedAt)
+
+	_, err = db.GetAPIKeyByHash(uniqueName("hash"))
+	assert.Error(t, err)
+
+	usedAt := time.Now().Truncate(time.Second)
+	require.NoError(t, db.TouchAPIKey(key.ID, usedAt, "192.0.2.1"))
+	used, err := db.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	require.NotNil(t, used.LastUsedAt)
+	assert.True(t, usedAt.Equal(*used.LastUsedAt))
+	assert.Equal(t, "192.0.2.1", used.LastUsedIP)
+
+	second := &models.APIKey{UserID: user.ID, Name: "import", KeyHash: uniqueName("hash"), ExpiresAt: expiresAt}
+	require.NoError(t, db.CreateAPIKey(second))
+	keys, err := db.ListAPIKeys(user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.ElementsMatch(t, []string{key.ID, second.ID}, []string{keys[0].ID, keys[1].ID})
+	all, err := db.ListAPIKeys("")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(all), 2)
+
+	// A second revocation keeps the first
+	require.NoError(t, db.RevokeAPIKey(key.ID, "admin"))
+	require.NoError(t, db.RevokeAPIKey(key.ID, "root"))
+	revoked, err := db.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	assert.Equal(t, "admin", revoked.RevokedBy)
+	assert.False(t, revoked.Active(time.Now()))
+	assert.Error(t, db.RevokeAPIKey(uniqueName("key"), "admin"))
+
+	// Keys are deleted with their user
+	require.NoError(t, db.DeleteUser(user.ID))
+	_, err = db.GetAPIKey(second.ID)
+	assert.Error(t, err)
+}
+
+func testPasswordHistoryBehavior(t *testing.T, db DatabaseAdapter) {
+	username := uniqueName("user")
+	user := &models.User{Username: username, Email: username + "@example.com", Role: "author", Active: true}
+	require.NoError(t, db.CreateUser(user))
+
+	history, err := db.GetPasswordHistory(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	require.NoError(t, db.SavePasswordHistory(user.ID, []string{"hash-1"}))
+	require.NoError(t, db.SavePasswordHistory(user.ID, []string{"hash-2", "hash-1"}))
+	history, err = db.GetPasswordHistory(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hash-2", "hash-1"}, history)
+
+	require.NoError(t, db.DeleteUser(user.ID))
+	history, err = db.GetPasswordHistory(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testInvitationBehavior(t *testing.T, db DatabaseAdapter) {
+	var users []*models.User
+	for i := 0; i < 2; i++ {
+		username := uniqueName("invitee")
+		user := &models.User{Username: username, Email: username + "@example.com", Role: "author"}
+		require.NoError(t, db.CreateUser(user))
+		users = append(users, user)
+	}
+	defer db.DeleteUser(users[1].ID)
+
+	missing, err := db.GetInvitation(users[0].ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	base := time.Date(2001, 1, 1, 12, 0, 0, 0, time.UTC)
+	hashes := []string{uniqueName("hash"), uniqueName("hash")}
+	for i, user := range users {
+		require.NoError(t, db.SaveInvitation(&models.Invitation{
+			UserID:    user.ID,
+			Email:     user.Email,
+			TokenHash: hashes[i],
+			InvitedBy: "admin",
+			ExpiresAt: base.Add(7 * 24 * time.Hour),
+			SentAt:    base,
+			CreatedAt: base.Add(time.Duration(i) * time.Hour),
+		}))
+	}
+
+	stored, err := db.GetInvitationByTokenHash(hashes[0])
+	require.NoError(t, err)
+	assert.Equal(t, users[0].ID, stored.UserID)
+	assert.Equal(t, users[0].Email, stored.Email)
+	assert.Equal(t, "admin", stored.InvitedBy)
+	assert.True(t, base.Add(7*24*time.Hour).Equal(stored.ExpiresAt))
+
+	_, err = db.GetInvitationByTokenHash(uniqueName("hash"))
+	assert.Error(t, err)
+
+	// Resending replaces the link and keeps when the invitation was made
+	resent := *stored
+	resent.TokenHash = uniqueName("hash")
+	resent.SentAt = base.Add(time.Hour)
+	require.NoError(t, db.SaveInvitation(&resent))
+	_, err = db.GetInvitationByTokenHash(hashes[0])
+	assert.Error(t, err)
+	stored, err = db.GetInvitation(users[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, resent.TokenHash, stored.TokenHash)
+	assert.True(t, base.Equal(stored.CreatedAt))
+	assert.True(t, base.Add(time.Hour).Equal(stored.SentAt))
+
+	list, err := db.ListInvitations()
+	require.NoError(t, err)
+	var ids []string
+	for _, invitation := range list {
+		if invitation.UserID == users[0].ID || invitation.UserID == users[1].ID {
+			ids = append(ids, invitation.UserID)
+		}
+	}
+	assert.Equal(t, []string{users[1].ID, users[0].ID}, ids)
+
+	require.NoError(t, db.DeleteInvitation(users[1].ID))
+	require.NoError(t, db.DeleteInvitation(users[1].ID))
+	missing, err = db.GetInvitation(users[1].ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// Invitations are deleted with their user
+	require.NoError(t, db.DeleteUser(users[0].ID))
+	missing, err = db.GetInvitation(users[0].ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func testIdentityBehavior(t *testing.T, db DatabaseAdapter) {
+	username := uniqueName("user")
+	user := &models.User{Username: username, Email: username + "@example.com", Role: "author", Active: true}
+	require.NoError(t, db.CreateUser(user))
+
+	issuer := "https://" + uniqueName("idp") + ".example.com"
+	missing, err := db.GetUserIdentity(issuer, "subject-1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, db.LinkUserIdentity(&models.UserIdentity{Issuer: issuer, Subject: "subject-1", UserID: user.ID}))
+	stored, err := db.GetUserIdentity(issuer, "subject-1")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, user.ID, stored.UserID)
+	assert.False(t, stored.CreatedAt.IsZero())
+
+	// The same subject of another issuer is another identity
+	missing, err = db.GetUserIdentity(issuer+"/other", "subject-1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// An identity is linked to one user only
+	username = uniqueName("user")
+	other := &models.User{Username: username, Email: username + "@example.com", Role: "author", Active: true}
+	require.NoError(t, db.CreateUser(other))
+	defer db.DeleteUser(other.ID)
+	assert.Error(t, db.LinkUserIdentity(&models.UserIdentity{Issuer: issuer, Subject: "subject-1", UserID: other.ID}))
+
+	// Identities are deleted with their user
+	require.NoError(t, db.DeleteUser(user.ID))
+	missing, err = db.GetUserIdentity(issuer, "subject-1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func testAuditBehavior(t *testing.T, db DatabaseAdapter) {
+	target := uniqueName("post")
+	base := time.Date(2001, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []*models.AuditEvent{
+		{Actor: "alice", Action: "post.create", TargetType: "post", TargetID: target, CreatedAt: base,
+			Changes: map[string]models.AuditChange{"title": {After: "Hello"}}},
+		{Actor: "bob", Action: "post.update", TargetType: "post", TargetID: target, CreatedAt: base.Add(time.Hour),
+			Changes: map[string]models.AuditChange{"title": {Before: "Hello", After: "Bye"}}},
+		{Actor: "scheduler", Action: "post.publish", TargetType: "post", TargetID: target, CreatedAt: base.Add(2 * time.Hour),
+			IP: "192.0.2.1", RequestID: "req-1"},
+	}
+	for _, event := range events {
+		require.NoError(t, db.CreateAuditEvent(event))
+		require.NotEmpty(t, event.ID)
+	}
+
+	list, err := db.ListAuditEvents(models.AuditQuery{
+		TargetID:    target,
+		ListOptions: models.ListOptions{Sort: "created_at", Limit: 10},
+	})
+	require.NoError(t, err)
+	require.Len(t, list.Events, 3)
+	assert.Equal(t, events[0].ID, list.Events[0].ID)
+	assert.Equal(t, "Hello", list.Events[0].Changes["title"].After)
+	assert.Equal(t, "192.0.2.1", list.Events[2].IP)
+	assert.Equal(t, "req-1", list.Events[2].RequestID)
+	assert.True(t, base.Equal(list.Events[0].CreatedAt))
+
+	filtered, err := db.ListAuditEvents(models.AuditQuery{
+		Actor:       "bob",
+		TargetID:    target,
+		ListOptions: models.ListOptions{Limit: 10},
+	})
+	require.NoError(t, err)
+	require.Len(t, filtered.Events, 1)
+	assert.Equal(t, "post.update", filtered.Events[0].Action)
+
+	from := base.Add(30 * time.Minute)
+	count, err := db.CountAuditEvents(models.AuditQuery{
+		TargetID: target,
+		Created:  models.TimeRange{From: &from},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// Pages follow on from the cursor
+	first, err := db.ListAuditEvents(models.AuditQuery{
+		TargetID:    target,
+		ListOptions: models.ListOptions{Sort: "created_at", Desc: true, Limit: 2},
+	})
+	require.NoError(t, err)
+	require.Len(t, first.Events, 2)
+	require.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, events[2].ID, first.Events[0].ID)
+	rest, err := db.ListAuditEvents(models.AuditQuery{
+		TargetID:    target,
+		ListOptions: models.ListOptions{Sort: "created_at", Desc: true, Limit: 2, Cursor: first.NextCursor},
+	})
+	require.NoError(t, err)
+	require.Len(t, rest.Events, 1)
+	assert.Equal(t, events[0].ID, rest.Events[0].ID)
+
+	deleted, err := db.DeleteAuditEventsBefore(base.Add(90 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	count, err = db.CountAuditEvents(models.AuditQuery{TargetID: target})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = db.DeleteAuditEventsBefore(base.Add(24 * time.Hour))
+	require.NoError(t, err)
+}
+
+func testSettingBehavior(t *testing.T, db DatabaseAdapter) {
+	key := uniqueName("setting")
+
+	missing, err := db.GetSetting(key)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, db.SaveSetting(&models.Setting{Key: key, Value: `{"enabled":true}`, UpdatedBy: "admin"}))
+	require.NoError(t, db.SaveSetting(&models.Setting{Key: key, Value: `{"enabled":false}`, UpdatedBy: "root"}))
+
+	setting, err := db.GetSetting(key)
+	require.NoError(t, err)
+	require.NotNil(t, setting)
+	assert.Equal(t, key, setting.Key)
+	assert.Equal(t, `{"enabled":false}`, setting.Value)
+	assert.Equal(t, "root", setting.UpdatedBy)
+	assert.False(t, setting.UpdatedAt.IsZero())
+}
+
+func testMediaBehavior(t *testing.T, db DatabaseAdapter) {
+	uploader := uniqueName("uploader")
+
+	files := []struct {
+		name     string
+		mimeType string
+		size     int64
+		alt      string
+	}{
+		{"beach.jpg", "image/jpeg", 300, "Sunset at the beach"},
+		{"logo.png", "image/png", 100, "Company logo"},
+		{"report_100%.pdf", "application/pdf", 200, ""},
+	}
+
+	ids := make(map[string]string)
+	for _, f := range files {
+		media := &models.Media{
+			Filename:   f.name,
+			Path:       "media/" + uniqueName("file"),
+			MimeType:   f.mimeType,
+			Size:       f.size,
+			Width:      640,
+			Height:     480,
+			AltText:    f.alt,
+			UploadedBy: uploader,
+		}
+		media.URL = "https://cdn.example.com/" + media.Path
+		if f.name == "beach.jpg" {
+			media.SHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+			media.Variants = []models.MediaVariant{{
+				Name: "thumbnail", Path: media.Path + "/thumbnail.jpg", URL: media.URL + "/thumbnail.jpg",
+				MimeType: "image/jpeg", Size: 40, Width: 150, Height: 150,
+			}}
+		}
+		require.NoError(t, db.CreateMedia(media))
+		defer db.DeleteMedia(media.ID)
+		assert.NotEmpty(t, media.Rev)
+		assert.Empty(t, media.UsedBy)
+		ids[f.name] = media.ID
+	}
+
+	stored, err := db.GetMedia(ids["beach.jpg"])
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", stored.MimeType)
+	assert.Equal(t, int64(300), stored.Size)
+	assert.Equal(t, 640, stored.Width)
+	assert.Equal(t, uploader, stored.UploadedBy)
+	assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", stored.SHA256)
+	require.Len(t, stored.Variants, 1)
+	assert.Equal(t, "thumbnail", stored.Variants[0].Name)
+	assert.Equal(t, 150, stored.Variants[0].Width)
+
+	byURL, err := db.GetMediaByURL(stored.URL)
+	require.NoError(t, err)
+	assert.Equal(t, stored.ID, byURL.ID)
+
+	// Deduplicated uploads share a URL, which resolves to the oldest asset
+	duplicate := &models.Media{
+		Filename:   "beach-copy.jpg",
+		Path:       stored.Path,
+		URL:        stored.URL,
+		MimeType:   stored.MimeType,
+		Size:       stored.Size,
+		SHA256:     stored.SHA256,
+		UploadedBy: uniqueName("uploader"),
+	}
+	require.NoError(t, db.CreateMedia(duplicate))
+	defer db.DeleteMedia(duplicate.ID)
+	byURL, err = db.GetMediaByURL(stored.URL)
+	require.NoError(t, err)
+	assert.Equal(t, stored.ID, byURL.ID)
+	_, err = db.GetMediaByURL("https://cdn.example.com/" + uniqueName("missing"))
+	assert.Error(t, err)
+
+	list := func(query models.MediaQuery) []string {
+		query.UploadedBy = uploader
+		result, err := db.ListMedia(query)
+		require.NoError(t, err)
+		var names []string
+		for _, media := range result.Media {
+			names = append(names, media.Filename)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		query    models.MediaQuery
+		expected []string
+	}{
+		{"newest first", models.MediaQuery{ListOptions: models.ListOptions{Desc: true}}, []string{"report_100%.pdf", "logo.png", "beach.jpg"}},
+		{"largest first", models.MediaQuery{ListOptions: models.ListOptions{Sort: "size", Desc: true}}, []string{"beach.jpg", "report_100%.pdf", "logo.png"}},
+		{"search matches alt text", models.MediaQuery{Search: "SUNSET"}, []string{"beach.jpg"}},
+		{"search matches filename", models.MediaQuery{Search: "logo"}, []string{"logo.png"}},
+		{"search wildcards are literal", models.MediaQuery{Search: "100%"}, []string{"report_100%.pdf"}},
+		{"mime type prefix", models.MediaQuery{MimeType: "image/", ListOptions: models.ListOptions{Sort: "filename"}}, []string{"beach.jpg", "logo.png"}},
+		{"exact mime type", models.MediaQuery{MimeType: "application/pdf"}, []string{"report_100%.pdf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, list(tt.query))
+
+			count, err := db.CountMedia(models.MediaQuery{UploadedBy: uploader, Search: tt.query.Search, MimeType: tt.query.MimeType})
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.expected), count)
+		})
+	}
+
+	// Usage is tracked per post and survives metadata updates
+	postID := uniqueName("post")
+	require.NoError(t, db.AddMediaUsage(stored.ID, postID))
+	require.NoError(t, db.AddMediaUsage(stored.ID, postID))
+	assert.Error(t, db.AddMediaUsage(uniqueName("missing"), postID))
+
+	stored.AltText = "Sunrise at the beach"
+	require.NoError(t, db.UpdateMedia(stored.ID, stored))
+
+	updated, err := db.GetMedia(stored.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Sunrise at the beach", updated.AltText)
+	assert.Equal(t, []string{postID}, updated.UsedBy)
+	assert.Equal(t, uploader, updated.UploadedBy)
+	assert.Equal(t, stored.Variants, updated.Variants)
+
+	usedBy, err := db.GetMediaUsedBy(postID)
+	require.NoError(t, err)
+	require.Len(t, usedBy, 1)
+	assert.Equal(t, stored.ID, usedBy[0].ID)
+
+	require.NoError(t, db.RemoveMediaUsage(stored.ID, postID))
+	usedBy, err = db.GetMediaUsedBy(postID)
+	require.NoError(t, err)
+	assert.Empty(t, usedBy)
+
+	require.NoError(t, db.DeleteMedia(ids["logo.png"]))
+	_, err = db.GetMedia(ids["logo.png"])
+	assert.Error(t, err)
+	assert.Error(t, db.DeleteMedia(ids["logo.png"]))
+}
+
+func testTransactionBehavior(t *testing.T, db DatabaseAdapter) {
+	t.Run("Rollback discards writes", func(t *testing.T) {
+		tx, err := db.BeginTransaction()
+		require.NoError(t, err)
+
+		post := &models.Post{Title: "Rolled back", Slug: uniqueName("tx"), Status: "draft"}
+		require.NoError(t, tx.Database().CreatePost(post))
+
+		_, err = tx.Database().GetPost(post.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, tx.Rollback())
+
+		_, err = db.GetPost(post.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("Commit keeps writes", func(t *testing.T) {
+		tx, err := db.BeginTransaction()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		post := &models.Post{Title: "Committed", Slug: uniqueName("tx"), Status: "draft"}
+		require.NoError(t, tx.Database().CreatePost(post))
+		require.NoError(t, tx.Commit())
+
+		_, err = db.GetPost(post.ID)
+		require.NoError(t, err)
+		require.NoError(t, db.DeletePost(post.ID))
+	})
+}
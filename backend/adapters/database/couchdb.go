@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-kivik/kivik/v4"
@@ -14,11 +16,22 @@ import (
 
 // CouchDBAdapter implements DatabaseAdapter for CouchDB
 type CouchDBAdapter struct {
-	client     *kivik.Client
-	postsDB    *kivik.DB
-	usersDB    *kivik.DB
-	contactsDB *kivik.DB
-	config     map[string]interface{}
+	client       *kivik.Client
+	postsDB      *kivik.DB
+	usersDB      *kivik.DB
+	contactsDB   *kivik.DB
+	categoriesDB *kivik.DB
+	revisionsDB  *kivik.DB
+	mediaDB      *kivik.DB
+	twoFactorDB  *kivik.DB
+	passwordsDB  *kivik.DB
+	invitationsDB *kivik.DB
+	identitiesDB *kivik.DB
+	slugsDB      *kivik.DB
+	settingsDB   *kivik.DB
+	apiKeysDB    *kivik.DB
+	auditDB      *kivik.DB
+	config       map[string]interface{}
 }
 
 // NewCouchDBAdapter creates a new CouchDB adapter
@@ -75,9 +88,99 @@ func (c *CouchDBAdapter) Connect(config DatabaseConfig) error {
 		}
 	}
 
+	// Create categories database
+	if exists, _ := client.DBExists(ctx, "categories"); !exists {
+		if err := client.CreateDB(ctx, "categories"); err != nil {
+			return fmt.Errorf("failed to create categories database: %w", err)
+		}
+	}
+
+	// Create post revisions database
+	if exists, _ := client.DBExists(ctx, "post_revisions"); !exists {
+		if err := client.CreateDB(ctx, "post_revisions"); err != nil {
+			return fmt.Errorf("failed to create post_revisions database: %w", err)
+		}
+	}
+
+	// Create media database
+	if exists, _ := client.DBExists(ctx, "media"); !exists {
+		if err := client.CreateDB(ctx, "media"); err != nil {
+			return fmt.Errorf("failed to create media database: %w", err)
+		}
+	}
+
+	// Create two-factor database
+	if exists, _ := client.DBExists(ctx, "user_two_factor"); !exists {
+		if err := client.CreateDB(ctx, "user_two_factor"); err != nil {
+			return fmt.Errorf("failed to create user_two_factor database: %w", err)
+		}
+	}
+
+	// Create password history database
+	if exists, _ := client.DBExists(ctx, "password_history"); !exists {
+		if err := client.CreateDB(ctx, "password_history"); err != nil {
+			return fmt.Errorf("failed to create password_history database: %w", err)
+		}
+	}
+
+	// Create invitations database
+	if exists, _ := client.DBExists(ctx, "invitations"); !exists {
+		if err := client.CreateDB(ctx, "invitations"); err != nil {
+			return fmt.Errorf("failed to create invitations database: %w", err)
+		}
+	}
+
+	// Create user identities database
+	if exists, _ := client.DBExists(ctx, "user_identities"); !exists {
+		if err := client.CreateDB(ctx, "user_identities"); err != nil {
+			return fmt.Errorf("failed to create user_identities database: %w", err)
+		}
+	}
+
+	// Create post slugs database
+	if exists, _ := client.DBExists(ctx, "post_slugs"); !exists {
+		if err := client.CreateDB(ctx, "post_slugs"); err != nil {
+			return fmt.Errorf("failed to create post_slugs database: %w", err)
+		}
+	}
+
+	// Create settings database
+	if exists, _ := client.DBExists(ctx, "settings"); !exists {
+		if err := client.CreateDB(ctx, "settings"); err != nil {
+			return fmt.Errorf("failed to create settings database: %w", err)
+		}
+	}
+
+	// Create API keys database
+	if exists, _ := client.DBExists(ctx, "api_keys"); !exists {
+		if err := client.CreateDB(ctx, "api_keys"); err != nil {
+			return fmt.Errorf("failed to create api_keys database: %w", err)
+		}
+	}
+
+	// Create audit log database
+	if exists, _ := client.DBExists(ctx, "audit_events"); !exists {
+		if err := client.CreateDB(ctx, "audit_events"); err != nil {
+			return fmt.Errorf("failed to create audit_events database: %w", err)
+		}
+	}
+
 	c.postsDB = client.DB("posts")
 	c.usersDB = client.DB("users")
 	c.contactsDB = client.DB("contacts")
+	c.categoriesDB = client.DB("categories")
+	c.revisionsDB = client.DB("post_revisions")
+	c.mediaDB = client.DB("media")
+	c.twoFactorDB = client.DB("user_two_factor")
+	c.passwordsDB = client.DB("password_history")
+	c.invitationsDB = client.DB("invitations")
+	c.identitiesDB = client.DB("user_identities")
+	c.slugsDB = client.DB("post_slugs")
+	c.settingsDB = client.DB("settings")
+	c.apiKeysDB = client.DB("api_keys")
+	c.auditDB = client.DB("audit_events")
+
+	c.ensureIndexes(ctx)
 
 	log.Println("CouchDB adapter connected successfully")
 	return nil
@@ -117,6 +220,8 @@ func (c *CouchDBAdapter) CreatePost(post *models.Post) error {
 	// Create document
 	doc := map[string]interface{}{
 		"title":          post.Title,
+		"slug":           post.Slug,
+		"previous_slugs": post.PreviousSlugs,
 		"content":        post.Content,
 		"excerpt":        post.Excerpt,
 		"author":         post.Author,
@@ -136,8 +241,14 @@ func (c *CouchDBAdapter) CreatePost(post *models.Post) error {
 		"scheduled_at":   post.ScheduledAt,
 	}
 
+	reserved, err := c.reservePostSlugs(post.ID, postSlugs(post))
+	if err != nil {
+		return fmt.Errorf("failed to create post: %w", err)
+	}
+
 	rev, err := c.postsDB.Put(ctx, post.ID, doc)
 	if err != nil {
+		c.releasePostSlugs(post.ID, reserved)
 		return fmt.Errorf("failed to create post: %w", err)
 	}
 
@@ -152,12 +263,72 @@ func (c *CouchDBAdapter) GetPost(id string) (*models.Post, error) {
 	row := c.postsDB.Get(ctx, id)
 	var post models.Post
 	if err := row.ScanDoc(&post); err != nil {
+		if kivik.HTTPStatus(err) == http.StatusNotFound {
+			return nil, fmt.Errorf("failed to get post: %w", ErrPostNotFound)
+		}
 		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
 
+	// Document metadata is stored as _id/_rev, not in the post fields
+	post.ID = id
+	if rev, err := row.Rev(); err == nil {
+		post.Rev = rev
+	}
+
 	return &post, nil
 }
 
+// GetPostBySlug retrieves a post by its current slug
+func (c *CouchDBAdapter) GetPostBySlug(slug string) (*models.Post, error) {
+	return c.findPost(map[string]interface{}{
+		"slug": slug,
+	})
+}
+
+// GetPostByPreviousSlug retrieves the post that used to be published under slug
+func (c *CouchDBAdapter) GetPostByPreviousSlug(slug string) (*models.Post, error) {
+	return c.findPost(map[string]interface{}{
+		"previous_slugs": map[string]interface{}{
+			"$elemMatch": map[string]interface{}{
+				"$eq": slug,
+			},
+		},
+	})
+}
+
+// findPost returns the first post matching a Mango selector
+func (c *CouchDBAdapter) findPost(selector map[string]interface{}) (*models.Post, error) {
+	ctx := context.Background()
+
+	query := map[string]interface{}{
+		"selector": selector,
+		"limit":    1,
+	}
+
+	rows := c.postsDB.Find(ctx, query)
+	defer rows.Close()
+
+	if rows.Next() {
+		var post models.Post
+		if err := rows.ScanDoc(&post); err != nil {
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+		if id, err := rows.ID(); err == nil {
+			post.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			post.Rev = rev
+		}
+		return &post, nil
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find post: %w", err)
+	}
+
+	return nil, fmt.Errorf("post not found")
+}
+
 // GetPosts retrieves posts with pagination
 func (c *CouchDBAdapter) GetPosts(limit, offset int) ([]models.Post, error) {
 	ctx := context.Background()
@@ -172,6 +343,11 @@ func (c *CouchDBAdapter) GetPosts(limit, offset int) ([]models.Post, error) {
 	skipped := 0
 
 	for rows.Next() {
+		id, _ := rows.ID()
+		if strings.HasPrefix(id, "_design/") {
+			continue
+		}
+
 		if skipped < offset {
 			skipped++
 			continue
@@ -186,6 +362,11 @@ func (c *CouchDBAdapter) GetPosts(limit, offset int) ([]models.Post, error) {
 			continue
 		}
 
+		post.ID = id
+		if rev, err := rows.Rev(); err == nil {
+			post.Rev = rev
+		}
+
 		posts = append(posts, post)
 		count++
 	}
@@ -193,6 +374,47 @@ func (c *CouchDBAdapter) GetPosts(limit, offset int) ([]models.Post, error) {
 	return posts, nil
 }
 
+// GetScheduledPosts retrieves scheduled posts that are due at or before the given time
+func (c *CouchDBAdapter) GetScheduledPosts(before time.Time) ([]models.Post, error) {
+	ctx := context.Background()
+
+	// Timestamps are stored with their local offset, so the due check
+	// happens here rather than as a string comparison in the selector
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"status": "scheduled",
+		},
+	}
+
+	rows := c.postsDB.Find(ctx, query)
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		if err := rows.ScanDoc(&post); err != nil {
+			continue
+		}
+		if post.ScheduledAt == nil || post.ScheduledAt.After(before) {
+			continue
+		}
+
+		if id, err := rows.ID(); err == nil {
+			post.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			post.Rev = rev
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query scheduled posts: %w", err)
+	}
+
+	return posts, nil
+}
+
 // UpdatePost updates a post
 func (c *CouchDBAdapter) UpdatePost(id string, post *models.Post) error {
 	ctx := context.Background()
@@ -209,7 +431,7 @@ func (c *CouchDBAdapter) UpdatePost(id string, post *models.Post) error {
 	post.CreatedAt = existing.CreatedAt
 	post.UpdatedAt = time.Now()
 
-	if post.Status == "published" && existing.Status != "published" {
+	if post.Status == "published" && existing.Status != "published" && post.PublishedAt == nil {
 		now := time.Now()
 		post.PublishedAt = &now
 	}
@@ -218,6 +440,8 @@ func (c *CouchDBAdapter) UpdatePost(id string, post *models.Post) error {
 	doc := map[string]interface{}{
 		"_rev":           post.Rev,
 		"title":          post.Title,
+		"slug":           post.Slug,
+		"previous_slugs": post.PreviousSlugs,
 		"content":        post.Content,
 		"excerpt":        post.Excerpt,
 		"author":         post.Author,
@@ -237,10 +461,17 @@ func (c *CouchDBAdapter) UpdatePost(id string, post *models.Post) error {
 		"scheduled_at":   post.ScheduledAt,
 	}
 
+	reserved, err := c.reservePostSlugs(id, postSlugs(post))
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+
 	rev, err := c.postsDB.Put(ctx, id, doc)
 	if err != nil {
+		c.releasePostSlugs(id, reserved)
 		return fmt.Errorf("failed to update post: %w", err)
 	}
+	c.releasePostSlugs(id, droppedSlugs(existing, post))
 
 	post.Rev = rev
 	return nil
@@ -260,10 +491,98 @@ func (c *CouchDBAdapter) DeletePost(id string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
+	c.releasePostSlugs(id, postSlugs(existing))
 
 	return nil
 }
 
+// Post Revision Operations
+
+// revisionDocID builds a sortable document ID so that revisions of a post
+// are contiguous and a duplicate revision number is rejected as a conflict
+func revisionDocID(postID string, number int) string {
+	return fmt.Sprintf("%s:%08d", postID, number)
+}
+
+// CreatePostRevision stores a new revision, assigning the next revision
+// number for the post when none is set
+func (c *CouchDBAdapter) CreatePostRevision(revision *models.PostRevision) error {
+	ctx := context.Background()
+
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+
+	number := revision.Number
+	if number == 0 {
+		existing, err := c.GetPostRevisions(revision.PostID)
+		if err != nil {
+			return err
+		}
+		number = len(existing) + 1
+		if len(existing) > 0 {
+			number = existing[len(existing)-1].Number + 1
+		}
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		revision.Number = number
+		revision.ID = revisionDocID(revision.PostID, number)
+
+		_, err := c.revisionsDB.Put(ctx, revision.ID, revision)
+		if err == nil {
+			return nil
+		}
+		if kivik.HTTPStatus(err) != http.StatusConflict {
+			return fmt.Errorf("failed to create post revision: %w", err)
+		}
+
+		// Another save took this number, try the next one
+		number++
+	}
+
+	return fmt.Errorf("failed to create post revision: too many conflicts")
+}
+
+// GetPostRevisions retrieves all revisions of a post, oldest first
+func (c *CouchDBAdapter) GetPostRevisions(postID string) ([]models.PostRevision, error) {
+	ctx := context.Background()
+
+	rows := c.revisionsDB.AllDocs(ctx, kivik.Params(map[string]interface{}{
+		"include_docs": true,
+		"startkey":     postID + ":",
+		"endkey":       postID + ":\ufff0",
+	}))
+	defer rows.Close()
+
+	var revisions []models.PostRevision
+	for rows.Next() {
+		var revision models.PostRevision
+		if err := rows.ScanDoc(&revision); err != nil {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get post revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetPostRevision retrieves a single revision of a post
+func (c *CouchDBAdapter) GetPostRevision(postID string, number int) (*models.PostRevision, error) {
+	ctx := context.Background()
+
+	var revision models.PostRevision
+	if err := c.revisionsDB.Get(ctx, revisionDocID(postID, number)).ScanDoc(&revision); err != nil {
+		return nil, fmt.Errorf("failed to get post revision: %w", err)
+	}
+
+	return &revision, nil
+}
+
 // User Operations
 
 // CreateUser creates a new user
@@ -386,8 +705,9 @@ func (c *CouchDBAdapter) UpdateUser(id string, user *models.User) error {
 	if user.Username != "" {
 		existing.Username = user.Username
 	}
-	if user.Email != "" {
+	if user.Email != "" && user.Email != existing.Email {
 		existing.Email = user.Email
+		existing.EmailVerified = false
 	}
 	if user.Role != "" {
 		existing.Role = user.Role
@@ -413,6 +733,27 @@ func (c *CouchDBAdapter) UpdateUser(id string, user *models.User) error {
 	return nil
 }
 
+// MarkEmailVerified marks the email address of a user as verified, unless
+// it changed since the verification was requested
+func (c *CouchDBAdapter) MarkEmailVerified(id, email string) error {
+	ctx := context.Background()
+
+	existing, err := c.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if existing.Email != email {
+		return fmt.Errorf("user not found")
+	}
+
+	existing.EmailVerified = true
+	existing.UpdatedAt = time.Now()
+	if _, err := c.usersDB.Put(ctx, id, existing); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	return nil
+}
+
 // DeleteUser deletes a user
 func (c *CouchDBAdapter) DeleteUser(id string) error {
 	ctx := context.Background()
@@ -428,7 +769,20 @@ func (c *CouchDBAdapter) DeleteUser(id string) error {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
-	return nil
+	// CouchDB has no cascading deletes
+	if err := c.deleteUserAPIKeys(id); err != nil {
+		return err
+	}
+	if err := c.deletePasswordHistory(id); err != nil {
+		return err
+	}
+	if err := c.DeleteInvitation(id); err != nil {
+		return err
+	}
+	if err := c.deleteUserIdentities(id); err != nil {
+		return err
+	}
+	return c.DeleteTwoFactor(id)
 }
 
 // Contact Operations
@@ -477,6 +831,11 @@ func (c *CouchDBAdapter) GetContact(id string) (*models.Contact, error) {
 		return nil, fmt.Errorf("failed to get contact: %w", err)
 	}
 
+	contact.ID = id
+	if rev, err := row.Rev(); err == nil {
+		contact.Rev = rev
+	}
+
 	return &contact, nil
 }
 
@@ -492,6 +851,11 @@ func (c *CouchDBAdapter) GetContacts(limit, offset int) ([]models.Contact, error
 	skipped := 0
 
 	for rows.Next() {
+		id, _ := rows.ID()
+		if strings.HasPrefix(id, "_design/") {
+			continue
+		}
+
 		if skipped < offset {
 			skipped++
 			continue
@@ -506,6 +870,11 @@ func (c *CouchDBAdapter) GetContacts(limit, offset int) ([]models.Contact, error
 			continue
 		}
 
+		contact.ID = id
+		if rev, err := rows.Rev(); err == nil {
+			contact.Rev = rev
+		}
+
 		contacts = append(contacts, contact)
 		count++
 	}
@@ -569,15 +938,206 @@ func (c *CouchDBAdapter) DeleteContact(id string) error {
 	return nil
 }
 
+// Category Operations
+
+// CreateCategory creates a new category
+func (c *CouchDBAdapter) CreateCategory(category *models.Category) error {
+	ctx := context.Background()
+
+	if category.ID == "" {
+		category.ID = uuid.New().String()
+	}
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	rev, err := c.categoriesDB.Put(ctx, category.ID, c.categoryDoc(category))
+	if err != nil {
+		return fmt.Errorf("failed to create category: %w", err)
+	}
+
+	category.Rev = rev
+	return nil
+}
+
+// GetCategory retrieves a category by ID
+func (c *CouchDBAdapter) GetCategory(id string) (*models.Category, error) {
+	ctx := context.Background()
+
+	row := c.categoriesDB.Get(ctx, id)
+	var category models.Category
+	if err := row.ScanDoc(&category); err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	category.ID = id
+	if rev, err := row.Rev(); err == nil {
+		category.Rev = rev
+	}
+
+	return &category, nil
+}
+
+// GetCategoryBySlug retrieves a category by slug
+func (c *CouchDBAdapter) GetCategoryBySlug(slug string) (*models.Category, error) {
+	ctx := context.Background()
+
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"slug": slug,
+		},
+		"limit": 1,
+	}
+
+	rows := c.categoriesDB.Find(ctx, query)
+	defer rows.Close()
+
+	if rows.Next() {
+		var category models.Category
+		if err := rows.ScanDoc(&category); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		if id, err := rows.ID(); err == nil {
+			category.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			category.Rev = rev
+		}
+		return &category, nil
+	}
+
+	return nil, fmt.Errorf("category not found")
+}
+
+// GetCategories retrieves all categories
+func (c *CouchDBAdapter) GetCategories() ([]models.Category, error) {
+	ctx := context.Background()
+
+	rows := c.categoriesDB.AllDocs(ctx, kivik.Param("include_docs", true))
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		id, err := rows.ID()
+		if err != nil || strings.HasPrefix(id, "_design/") {
+			continue
+		}
+
+		var category models.Category
+		if err := rows.ScanDoc(&category); err != nil {
+			continue
+		}
+
+		category.ID = id
+		if rev, err := rows.Rev(); err == nil {
+			category.Rev = rev
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+// UpdateCategory updates a category
+func (c *CouchDBAdapter) UpdateCategory(id string, category *models.Category) error {
+	ctx := context.Background()
+
+	// Get existing category first
+	existing, err := c.GetCategory(id)
+	if err != nil {
+		return fmt.Errorf("failed to get existing category: %w", err)
+	}
+
+	category.ID = id
+	category.Rev = existing.Rev
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+
+	doc := c.categoryDoc(category)
+	doc["_rev"] = category.Rev
+
+	rev, err := c.categoriesDB.Put(ctx, id, doc)
+	if err != nil {
+		return fmt.Errorf("failed to update category: %w", err)
+	}
+
+	category.Rev = rev
+	return nil
+}
+
+// DeleteCategory deletes a category
+func (c *CouchDBAdapter) DeleteCategory(id string) error {
+	ctx := context.Background()
+
+	existing, err := c.GetCategory(id)
+	if err != nil {
+		return fmt.Errorf("failed to get existing category: %w", err)
+	}
+
+	_, err = c.categoriesDB.Delete(ctx, id, existing.Rev)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+
+	return nil
+}
+
+// IncrementCategoryPostCount adjusts the post count of a category by delta,
+// retrying on revision conflicts caused by concurrent post updates
+func (c *CouchDBAdapter) IncrementCategoryPostCount(slug string, delta int) error {
+	ctx := context.Background()
+
+	for attempt := 0; attempt < 5; attempt++ {
+		category, err := c.GetCategoryBySlug(slug)
+		if err != nil {
+			return err
+		}
+
+		category.PostCount += delta
+		if category.PostCount < 0 {
+			category.PostCount = 0
+		}
+
+		doc := c.categoryDoc(category)
+		doc["_rev"] = category.Rev
+
+		_, err = c.categoriesDB.Put(ctx, category.ID, doc)
+		if err == nil {
+			return nil
+		}
+		if kivik.HTTPStatus(err) != http.StatusConflict {
+			return fmt.Errorf("failed to update category post count: %w", err)
+		}
+	}
+
+	return fmt.Errorf("failed to update category post count: too many conflicts")
+}
+
+// categoryDoc builds the CouchDB document for a category
+func (c *CouchDBAdapter) categoryDoc(category *models.Category) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        category.Name,
+		"slug":        category.Slug,
+		"description": category.Description,
+		"color":       category.Color,
+		"icon":        category.Icon,
+		"post_count":  category.PostCount,
+		"created_at":  category.CreatedAt,
+		"updated_at":  category.UpdatedAt,
+	}
+}
+
 // Transaction Support
 
 // BeginTransaction begins a transaction (CouchDB doesn't support transactions)
 func (c *CouchDBAdapter) BeginTransaction() (Transaction, error) {
-	return &CouchDBTransaction{}, nil
+	return &CouchDBTransaction{adapter: c}, nil
 }
 
 // CouchDBTransaction implements Transaction interface for CouchDB
-type CouchDBTransaction struct{}
+type CouchDBTransaction struct {
+	adapter *CouchDBAdapter
+}
 
 // Commit commits the transaction (no-op for CouchDB)
 func (t *CouchDBTransaction) Commit() error {
@@ -592,4 +1152,9 @@ func (t *CouchDBTransaction) Rollback() error {
 // Context returns the transaction context
 func (t *CouchDBTransaction) Context() context.Context {
 	return context.Background()
-}
\ No newline at end of file
+}
+
+// Database returns the adapter itself; writes are applied immediately
+func (t *CouchDBTransaction) Database() DatabaseAdapter {
+	return t.adapter
+}
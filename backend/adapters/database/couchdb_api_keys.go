@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// apiKeyDoc is the CouchDB document of an API key. The model hides the
+// key hash from JSON, so it is stored through this type.
+type apiKeyDoc struct {
+	Rev        string     `json:"_rev,omitempty"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"key_hash"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	RevokedBy  string     `json:"revoked_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyDoc(key *models.APIKey, rev string) apiKeyDoc {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return apiKeyDoc{
+		Rev:        rev,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		KeyHash:    key.KeyHash,
+		Scopes:     scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  key.RevokedAt,
+		RevokedBy:  key.RevokedBy,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func (d apiKeyDoc) model(id string) models.APIKey {
+	return models.APIKey{
+		ID:         id,
+		UserID:     d.UserID,
+		Name:       d.Name,
+		Prefix:     d.Prefix,
+		KeyHash:    d.KeyHash,
+		Scopes:     d.Scopes,
+		ExpiresAt:  d.ExpiresAt,
+		LastUsedAt: d.LastUsedAt,
+		LastUsedIP: d.LastUsedIP,
+		RevokedAt:  d.RevokedAt,
+		RevokedBy:  d.RevokedBy,
+		CreatedAt:  d.CreatedAt,
+	}
+}
+
+// getAPIKeyDoc returns an API key with the revision of its document
+func (c *CouchDBAdapter) getAPIKeyDoc(id string) (*models.APIKey, string, error) {
+	var doc apiKeyDoc
+	err := c.apiKeysDB.Get(context.Background(), id).ScanDoc(&doc)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil, "", fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	key := doc.model(id)
+	return &key, doc.Rev, nil
+}
+
+func (c *CouchDBAdapter) findAPIKeys(query map[string]interface{}) ([]models.APIKey, error) {
+	rows := c.apiKeysDB.Find(context.Background(), query)
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var doc apiKeyDoc
+		if err := rows.ScanDoc(&doc); err != nil {
+			continue
+		}
+		id, err := rows.ID()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, doc.model(id))
+	}
+
+	return keys, rows.Err()
+}
+
+// CreateAPIKey creates a new API key
+func (c *CouchDBAdapter) CreateAPIKey(key *models.APIKey) error {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	key.CreatedAt = time.Now()
+
+	if _, err := c.apiKeysDB.Put(context.Background(), key.ID, newAPIKeyDoc(key, "")); err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (c *CouchDBAdapter) GetAPIKey(id string) (*models.APIKey, error) {
+	key, _, err := c.getAPIKeyDoc(id)
+	return key, err
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its secret
+func (c *CouchDBAdapter) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	keys, err := c.findAPIKeys(map[string]interface{}{
+		"selector": map[string]interface{}{"key_hash": hash},
+		"limit":    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("API key not found")
+	}
+	return &keys[0], nil
+}
+
+// ListAPIKeys lists the API keys of a user, or of every user when userID is
+// empty, newest first
+func (c *CouchDBAdapter) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	selector := map[string]interface{}{}
+	mangoSorted(selector, "created_at")
+	sort := []map[string]string{{"created_at": "desc"}}
+	if userID != "" {
+		selector["user_id"] = userID
+		sort = []map[string]string{{"user_id": "desc"}, {"created_at": "desc"}}
+	}
+
+	keys, err := c.findAPIKeys(map[string]interface{}{
+		"selector": selector,
+		"sort":     sort,
+		// Mango returns 25 documents unless told otherwise
+		"limit": couchCountBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// updateAPIKey applies change to a stored API key
+func (c *CouchDBAdapter) updateAPIKey(id string, change func(key *models.APIKey)) error {
+	key, rev, err := c.getAPIKeyDoc(id)
+	if err != nil {
+		return err
+	}
+
+	change(key)
+	if _, err := c.apiKeysDB.Put(context.Background(), id, newAPIKeyDoc(key, rev)); err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// TouchAPIKey records the use of an API key
+func (c *CouchDBAdapter) TouchAPIKey(id string, usedAt time.Time, ip string) error {
+	return c.updateAPIKey(id, func(key *models.APIKey) {
+		key.LastUsedAt = &usedAt
+		key.LastUsedIP = ip
+	})
+}
+
+// RevokeAPIKey revokes an API key. Revoking a revoked key keeps the
+// original revocation.
+func (c *CouchDBAdapter) RevokeAPIKey(id, revokedBy string) error {
+	return c.updateAPIKey(id, func(key *models.APIKey) {
+		if key.RevokedAt != nil {
+			return
+		}
+		now := time.Now()
+		key.RevokedAt = &now
+		key.RevokedBy = revokedBy
+	})
+}
+
+// deleteUserAPIKeys deletes the API keys of a user, as CouchDB has no
+// cascading deletes
+func (c *CouchDBAdapter) deleteUserAPIKeys(userID string) error {
+	keys, err := c.ListAPIKeys(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		rev, err := currentRev(c.apiKeysDB, key.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get API key: %w", err)
+		}
+		if rev == "" {
+			continue
+		}
+		if _, err := c.apiKeysDB.Delete(context.Background(), key.ID, rev); err != nil {
+			return fmt.Errorf("failed to delete API key: %w", err)
+		}
+	}
+	return nil
+}
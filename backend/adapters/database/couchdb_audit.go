@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// auditEventDoc is the CouchDB document of an audit event, which keeps the
+// ID in _id only
+type auditEventDoc struct {
+	ActorID    string                        `json:"actor_id"`
+	Actor      string                        `json:"actor"`
+	APIKeyID   string                        `json:"api_key_id"`
+	Action     string                        `json:"action"`
+	TargetType string                        `json:"target_type"`
+	TargetID   string                        `json:"target_id"`
+	Changes    map[string]models.AuditChange `json:"changes"`
+	IP         string                        `json:"ip"`
+	RequestID  string                        `json:"request_id"`
+	CreatedAt  time.Time                     `json:"created_at"`
+}
+
+func (d auditEventDoc) model(id string) models.AuditEvent {
+	return models.AuditEvent{
+		ID:         id,
+		ActorID:    d.ActorID,
+		Actor:      d.Actor,
+		APIKeyID:   d.APIKeyID,
+		Action:     d.Action,
+		TargetType: d.TargetType,
+		TargetID:   d.TargetID,
+		Changes:    d.Changes,
+		IP:         d.IP,
+		RequestID:  d.RequestID,
+		CreatedAt:  d.CreatedAt,
+	}
+}
+
+// CreateAuditEvent appends an event to the audit log
+func (c *CouchDBAdapter) CreateAuditEvent(event *models.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	changes := event.Changes
+	if changes == nil {
+		changes = map[string]models.AuditChange{}
+	}
+
+	if _, err := c.auditDB.Put(context.Background(), event.ID, auditEventDoc{
+		ActorID:    event.ActorID,
+		Actor:      event.Actor,
+		APIKeyID:   event.APIKeyID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Changes:    changes,
+		IP:         event.IP,
+		RequestID:  event.RequestID,
+		CreatedAt:  event.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+func auditSelector(query models.AuditQuery, sort string) map[string]interface{} {
+	selector := map[string]interface{}{}
+
+	if query.Actor != "" {
+		selector["actor"] = query.Actor
+	}
+	if query.Action != "" {
+		selector["action"] = query.Action
+	}
+	if query.TargetType != "" {
+		selector["target_type"] = query.TargetType
+	}
+	if query.TargetID != "" {
+		selector["target_id"] = query.TargetID
+	}
+	mangoTimeRange(selector, "created_at", query.Created)
+	mangoSorted(selector, sort)
+
+	return selector
+}
+
+// ListAuditEvents retrieves one page of audit events matching the query
+func (c *CouchDBAdapter) ListAuditEvents(query models.AuditQuery) (*models.AuditList, error) {
+	sort, err := listSort(query.ListOptions, models.AuditSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	find, err := mangoQuery(auditSelector(query, sort), sort, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := c.auditDB.Find(context.Background(), find)
+	defer rows.Close()
+
+	list := &models.AuditList{Events: []models.AuditEvent{}}
+	for rows.Next() {
+		var doc auditEventDoc
+		if err := rows.ScanDoc(&doc); err != nil {
+			continue
+		}
+		id, err := rows.ID()
+		if err != nil {
+			continue
+		}
+		list.Events = append(list.Events, doc.model(id))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	list.NextCursor = nextBookmark(rows, len(list.Events), sort, query.ListOptions)
+	return list, nil
+}
+
+// CountAuditEvents counts the audit events matching the query
+func (c *CouchDBAdapter) CountAuditEvents(query models.AuditQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.AuditSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := countMango(c.auditDB, auditSelector(query, sort))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteAuditEventsBefore deletes the audit events created before a time
+// and returns how many were deleted
+func (c *CouchDBAdapter) DeleteAuditEventsBefore(before time.Time) (int, error) {
+	ctx := context.Background()
+
+	deleted := 0
+	for {
+		rows := c.auditDB.Find(ctx, map[string]interface{}{
+			"selector": map[string]interface{}{
+				"created_at": map[string]interface{}{"$lt": mangoTime(before)},
+			},
+			"fields": []string{"_id", "_rev"},
+			"limit":  couchCountBatch,
+		})
+
+		type doc struct{ id, rev string }
+		var batch []doc
+		for rows.Next() {
+			id, err := rows.ID()
+			if err != nil {
+				continue
+			}
+			rev, err := rows.Rev()
+			if err != nil {
+				continue
+			}
+			batch = append(batch, doc{id, rev})
+		}
+		err := rows.Err()
+		rows.Close()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to find audit events: %w", err)
+		}
+
+		for _, d := range batch {
+			if _, err := c.auditDB.Delete(ctx, d.id, d.rev); err != nil {
+				return deleted, fmt.Errorf("failed to delete audit event: %w", err)
+			}
+			deleted++
+		}
+
+		if len(batch) < couchCountBatch {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// identityDocID returns the document ID of an identity. Identities are
+// stored under the hash of their issuer and subject, so CouchDB refuses to
+// link one twice.
+func identityDocID(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(issuer + "\x00" + subject))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUserIdentity retrieves a linked identity, or nil when the identity is
+// not linked to a user
+func (c *CouchDBAdapter) GetUserIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := c.identitiesDB.Get(context.Background(), identityDocID(issuer, subject)).ScanDoc(&identity)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// LinkUserIdentity links an identity to a user. Identities already linked
+// to a user are not relinked.
+func (c *CouchDBAdapter) LinkUserIdentity(identity *models.UserIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	if _, err := c.identitiesDB.Put(context.Background(), identityDocID(identity.Issuer, identity.Subject), identity); err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return nil
+}
+
+// deleteUserIdentities deletes the identities of a deleted user
+func (c *CouchDBAdapter) deleteUserIdentities(userID string) error {
+	rows := c.identitiesDB.Find(context.Background(), map[string]interface{}{
+		"selector": map[string]interface{}{"user_id": userID},
+	})
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		id, err := rows.ID()
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list user identities: %w", err)
+	}
+
+	for _, id := range ids {
+		rev, err := currentRev(c.identitiesDB, id)
+		if err != nil {
+			return fmt.Errorf("failed to get user identity: %w", err)
+		}
+		if rev == "" {
+			continue
+		}
+		if _, err := c.identitiesDB.Delete(context.Background(), id, rev); err != nil {
+			return fmt.Errorf("failed to delete user identity: %w", err)
+		}
+	}
+	return nil
+}
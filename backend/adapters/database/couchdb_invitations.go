@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// invitationDoc is the CouchDB document of an invitation, stored under the
+// user ID. The model hides the token hash from JSON, so it is stored
+// through this type.
+type invitationDoc struct {
+	Rev       string    `json:"_rev,omitempty"`
+	Email     string    `json:"email"`
+	TokenHash string    `json:"token_hash"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SentAt    time.Time `json:"sent_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (d invitationDoc) model(userID string) models.Invitation {
+	return models.Invitation{
+		UserID:    userID,
+		Email:     d.Email,
+		TokenHash: d.TokenHash,
+		InvitedBy: d.InvitedBy,
+		ExpiresAt: d.ExpiresAt,
+		SentAt:    d.SentAt,
+		CreatedAt: d.CreatedAt,
+	}
+}
+
+func (c *CouchDBAdapter) findInvitations(query map[string]interface{}) ([]models.Invitation, error) {
+	rows := c.invitationsDB.Find(context.Background(), query)
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		var doc invitationDoc
+		if err := rows.ScanDoc(&doc); err != nil {
+			continue
+		}
+		id, err := rows.ID()
+		if err != nil {
+			continue
+		}
+		invitations = append(invitations, doc.model(id))
+	}
+
+	return invitations, rows.Err()
+}
+
+// GetInvitation retrieves the invitation of a user, or nil when the user
+// has none
+func (c *CouchDBAdapter) GetInvitation(userID string) (*models.Invitation, error) {
+	var doc invitationDoc
+	err := c.invitationsDB.Get(context.Background(), userID).ScanDoc(&doc)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	invitation := doc.model(userID)
+	return &invitation, nil
+}
+
+// GetInvitationByTokenHash retrieves an invitation by the hash of the token
+// of its link
+func (c *CouchDBAdapter) GetInvitationByTokenHash(hash string) (*models.Invitation, error) {
+	invitations, err := c.findInvitations(map[string]interface{}{
+		"selector": map[string]interface{}{"token_hash": hash},
+		"limit":    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if len(invitations) == 0 {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	return &invitations[0], nil
+}
+
+// ListInvitations lists the invitations, newest first
+func (c *CouchDBAdapter) ListInvitations() ([]models.Invitation, error) {
+	selector := map[string]interface{}{}
+	mangoSorted(selector, "created_at")
+
+	invitations, err := c.findInvitations(map[string]interface{}{
+		"selector": selector,
+		"sort":     []map[string]string{{"created_at": "desc"}},
+		// Mango returns 25 documents unless told otherwise
+		"limit": couchCountBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// SaveInvitation creates or replaces the invitation of a user
+func (c *CouchDBAdapter) SaveInvitation(invitation *models.Invitation) error {
+	rev, err := currentRev(c.invitationsDB, invitation.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	if _, err := c.invitationsDB.Put(context.Background(), invitation.UserID, invitationDoc{
+		Rev:       rev,
+		Email:     invitation.Email,
+		TokenHash: invitation.TokenHash,
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+		SentAt:    invitation.SentAt,
+		CreatedAt: invitation.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+	return nil
+}
+
+// DeleteInvitation deletes the invitation of a user. Deleting an invitation
+// that doesn't exist is not an error.
+func (c *CouchDBAdapter) DeleteInvitation(userID string) error {
+	rev, err := currentRev(c.invitationsDB, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if rev == "" {
+		return nil
+	}
+
+	if _, err := c.invitationsDB.Delete(context.Background(), userID, rev); err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// couchCountBatch is the page size used when counting Mango results
+const couchCountBatch = 1000
+
+// couchIndex is a Mango index on one of the CouchDB databases
+type couchIndex struct {
+	name   string
+	fields []string
+}
+
+// couchIndexes are the Mango indexes behind the list queries, by database.
+// Mango only uses an index for sorting if it covers the sort field, so every
+// sortable field has one.
+var couchIndexes = map[string][]couchIndex{
+	"posts": {
+		{"status-published-index", []string{"status", "published_at"}},
+		{"author-created-index", []string{"author", "created_at"}},
+		{"tags-index", []string{"tags"}},
+		{"categories-index", []string{"categories"}},
+		{"featured-status-index", []string{"is_featured", "status"}},
+		{"slug-index", []string{"slug"}},
+		{"previous-slugs-index", []string{"previous_slugs"}},
+		{"created-at-index", []string{"created_at"}},
+		{"published-at-index", []string{"published_at"}},
+		{"view-count-index", []string{"view_count"}},
+		{"title-index", []string{"title"}},
+	},
+	"users": {
+		{"username-index", []string{"username"}},
+		{"email-index", []string{"email"}},
+		{"role-active-index", []string{"role", "active"}},
+		{"created-at-index", []string{"created_at"}},
+	},
+	"contacts": {
+		{"status-created-index", []string{"status", "created_at"}},
+		{"email-index", []string{"email"}},
+		{"created-at-index", []string{"created_at"}},
+	},
+	"api_keys": {
+		{"key-hash-index", []string{"key_hash"}},
+		{"user-created-index", []string{"user_id", "created_at"}},
+		{"created-at-index", []string{"created_at"}},
+	},
+	"invitations": {
+		{"token-hash-index", []string{"token_hash"}},
+		{"created-at-index", []string{"created_at"}},
+	},
+	"audit_events": {
+		{"actor-created-index", []string{"actor", "created_at"}},
+		{"action-created-index", []string{"action", "created_at"}},
+		{"target-created-index", []string{"target_type", "target_id", "created_at"}},
+		{"created-at-index", []string{"created_at"}},
+	},
+	"media": {
+		{"url-index", []string{"url"}},
+		{"url-created-index", []string{"url", "created_at"}},
+		{"sha256-index", []string{"sha256"}},
+		{"used-by-index", []string{"used_by"}},
+		{"uploaded-by-index", []string{"uploaded_by"}},
+		{"created-at-index", []string{"created_at"}},
+		{"filename-index", []string{"filename"}},
+		{"size-index", []string{"size"}},
+	},
+}
+
+// ensureIndexes creates the Mango indexes. Creating an existing index is a
+// no-op, so this runs on every connect.
+func (c *CouchDBAdapter) ensureIndexes(ctx context.Context) {
+	for dbName, indexes := range couchIndexes {
+		db := c.client.DB(dbName)
+		for _, index := range indexes {
+			if err := db.CreateIndex(ctx, "", index.name, map[string]interface{}{
+				"fields": index.fields,
+			}); err != nil {
+				log.Printf("Failed to create %s index %s: %v", dbName, index.name, err)
+			}
+		}
+	}
+}
+
+// mangoTime formats a time the way CouchDB documents store it, so that
+// range selectors compare like for like
+func mangoTime(t time.Time) string {
+	return t.In(time.Local).Format(time.RFC3339Nano)
+}
+
+// mangoCondition returns the condition on a field, creating it if needed
+func mangoCondition(selector map[string]interface{}, field string) map[string]interface{} {
+	if condition, ok := selector[field].(map[string]interface{}); ok {
+		return condition
+	}
+	condition := map[string]interface{}{}
+	selector[field] = condition
+	return condition
+}
+
+func mangoTimeRange(selector map[string]interface{}, field string, r models.TimeRange) {
+	if r.IsZero() {
+		return
+	}
+
+	condition := mangoCondition(selector, field)
+	if r.From != nil {
+		condition["$gte"] = mangoTime(*r.From)
+	}
+	if r.To != nil {
+		condition["$lte"] = mangoTime(*r.To)
+	}
+}
+
+// mangoSorted adds the sort field to the selector, which Mango needs to pick
+// the index on it. Documents without the field are left out of the list.
+func mangoSorted(selector map[string]interface{}, sort string) {
+	condition := mangoCondition(selector, sort)
+	if len(condition) == 0 {
+		condition["$gt"] = nil
+	}
+}
+
+// mangoQuery builds a Mango query for one page of a list
+func mangoQuery(selector map[string]interface{}, sort string, options models.ListOptions) (map[string]interface{}, error) {
+	cursor, err := decodeCursor(options.Cursor, sort, options.Desc)
+	if err != nil {
+		return nil, err
+	}
+
+	direction := "asc"
+	if options.Desc {
+		direction = "desc"
+	}
+
+	query := map[string]interface{}{
+		"selector": selector,
+		"sort":     []map[string]string{{sort: direction}},
+		"limit":    listLimit(options),
+	}
+
+	switch {
+	case cursor != nil && cursor.Bookmark != "":
+		query["bookmark"] = cursor.Bookmark
+	case cursor != nil:
+		return nil, ErrInvalidCursor
+	case options.Offset > 0:
+		query["skip"] = options.Offset
+	}
+
+	return query, nil
+}
+
+// nextBookmark returns the cursor for the page after rows. A full page may
+// be followed by an empty one, as Mango can't tell whether more rows match.
+func nextBookmark(rows *kivik.ResultSet, count int, sort string, options models.ListOptions) string {
+	if count < listLimit(options) {
+		return ""
+	}
+
+	metadata, err := rows.Metadata()
+	if err != nil || metadata.Bookmark == "" {
+		return ""
+	}
+
+	return encodeCursor(listCursor{
+		Sort:     sort,
+		Desc:     options.Desc,
+		Bookmark: metadata.Bookmark,
+	})
+}
+
+// countMango counts the documents matching a selector, paging through the
+// IDs with bookmarks
+func countMango(db *kivik.DB, selector map[string]interface{}) (int, error) {
+	ctx := context.Background()
+
+	count := 0
+	bookmark := ""
+	for {
+		query := map[string]interface{}{
+			"selector": selector,
+			"fields":   []string{"_id"},
+			"limit":    couchCountBatch,
+		}
+		if bookmark != "" {
+			query["bookmark"] = bookmark
+		}
+
+		rows := db.Find(ctx, query)
+		batch := 0
+		for rows.Next() {
+			batch++
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		metadata, err := rows.Metadata()
+		rows.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		count += batch
+		if batch < couchCountBatch || metadata.Bookmark == "" {
+			return count, nil
+		}
+		bookmark = metadata.Bookmark
+	}
+}
+
+func postSelector(query models.PostQuery, sort string) map[string]interface{} {
+	selector := map[string]interface{}{}
+
+	if query.Status != "" {
+		selector["status"] = query.Status
+	}
+	if query.Author != "" {
+		selector["author"] = query.Author
+	}
+	if query.Featured != nil {
+		selector["is_featured"] = *query.Featured
+	}
+	if query.Tag != "" {
+		selector["tags"] = map[string]interface{}{
+			"$elemMatch": map[string]interface{}{"$eq": query.Tag},
+		}
+	}
+	if query.Category != "" {
+		selector["categories"] = map[string]interface{}{
+			"$elemMatch": map[string]interface{}{"$eq": query.Category},
+		}
+	}
+	mangoTimeRange(selector, "created_at", query.Created)
+	mangoTimeRange(selector, "published_at", query.Published)
+	mangoSorted(selector, sort)
+
+	return selector
+}
+
+// ListPosts retrieves one page of posts matching the query
+func (c *CouchDBAdapter) ListPosts(query models.PostQuery) (*models.PostList, error) {
+	sort, err := listSort(query.ListOptions, models.PostSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	find, err := mangoQuery(postSelector(query, sort), sort, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := c.postsDB.Find(context.Background(), find)
+	defer rows.Close()
+
+	list := &models.PostList{}
+	for rows.Next() {
+		var post models.Post
+		if err := rows.ScanDoc(&post); err != nil {
+			continue
+		}
+		if id, err := rows.ID(); err == nil {
+			post.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			post.Rev = rev
+		}
+		list.Posts = append(list.Posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list posts: %w", err)
+	}
+
+	list.NextCursor = nextBookmark(rows, len(list.Posts), sort, query.ListOptions)
+	return list, nil
+}
+
+// CountPosts counts the posts matching the query
+func (c *CouchDBAdapter) CountPosts(query models.PostQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.PostSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := countMango(c.postsDB, postSelector(query, sort))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count posts: %w", err)
+	}
+	return count, nil
+}
+
+func userSelector(query models.UserQuery, sort string) map[string]interface{} {
+	selector := map[string]interface{}{}
+
+	if query.Role != "" {
+		selector["role"] = query.Role
+	}
+	if query.Active != nil {
+		selector["active"] = *query.Active
+	}
+	mangoTimeRange(selector, "created_at", query.Created)
+	mangoSorted(selector, sort)
+
+	return selector
+}
+
+// ListUsers retrieves one page of users matching the query
+func (c *CouchDBAdapter) ListUsers(query models.UserQuery) (*models.UserList, error) {
+	sort, err := listSort(query.ListOptions, models.UserSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	find, err := mangoQuery(userSelector(query, sort), sort, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := c.usersDB.Find(context.Background(), find)
+	defer rows.Close()
+
+	list := &models.UserList{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.ScanDoc(&user); err != nil {
+			continue
+		}
+		if id, err := rows.ID(); err == nil {
+			user.ID = id
+		}
+		// Don't return password hashes and revisions in lists
+		user.PasswordHash = ""
+		user.Rev = ""
+		list.Users = append(list.Users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	list.NextCursor = nextBookmark(rows, len(list.Users), sort, query.ListOptions)
+	return list, nil
+}
+
+// CountUsers counts the users matching the query
+func (c *CouchDBAdapter) CountUsers(query models.UserQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.UserSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := countMango(c.usersDB, userSelector(query, sort))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+func contactSelector(query models.ContactQuery, sort string) map[string]interface{} {
+	selector := map[string]interface{}{}
+
+	if query.Status != "" {
+		selector["status"] = query.Status
+	}
+	mangoTimeRange(selector, "created_at", query.Created)
+	mangoSorted(selector, sort)
+
+	return selector
+}
+
+// ListContacts retrieves one page of contacts matching the query
+func (c *CouchDBAdapter) ListContacts(query models.ContactQuery) (*models.ContactList, error) {
+	sort, err := listSort(query.ListOptions, models.ContactSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	find, err := mangoQuery(contactSelector(query, sort), sort, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := c.contactsDB.Find(context.Background(), find)
+	defer rows.Close()
+
+	list := &models.ContactList{}
+	for rows.Next() {
+		var contact models.Contact
+		if err := rows.ScanDoc(&contact); err != nil {
+			continue
+		}
+		if id, err := rows.ID(); err == nil {
+			contact.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			contact.Rev = rev
+		}
+		list.Contacts = append(list.Contacts, contact)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list contacts: %w", err)
+	}
+
+	list.NextCursor = nextBookmark(rows, len(list.Contacts), sort, query.ListOptions)
+	return list, nil
+}
+
+// CountContacts counts the contacts matching the query
+func (c *CouchDBAdapter) CountContacts(query models.ContactQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.ContactSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := countMango(c.contactsDB, contactSelector(query, sort))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count contacts: %w", err)
+	}
+	return count, nil
+}
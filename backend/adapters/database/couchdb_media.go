@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// mediaDoc builds the CouchDB document for a media asset
+func (c *CouchDBAdapter) mediaDoc(media *models.Media) map[string]interface{} {
+	usedBy := media.UsedBy
+	if usedBy == nil {
+		usedBy = []string{}
+	}
+
+	return map[string]interface{}{
+		"filename":    media.Filename,
+		"path":        media.Path,
+		"url":         media.URL,
+		"mime_type":   media.MimeType,
+		"size":        media.Size,
+		"sha256":      media.SHA256,
+		"width":       media.Width,
+		"height":      media.Height,
+		"alt_text":    media.AltText,
+		"uploaded_by": media.UploadedBy,
+		"used_by":     usedBy,
+		"variants":    media.Variants,
+		"created_at":  media.CreatedAt,
+		"updated_at":  media.UpdatedAt,
+	}
+}
+
+// findMedia returns the media assets matching a Mango selector
+func (c *CouchDBAdapter) findMedia(query map[string]interface{}) ([]models.Media, *kivik.ResultSet, error) {
+	rows := c.mediaDB.Find(context.Background(), query)
+
+	var list []models.Media
+	for rows.Next() {
+		var media models.Media
+		if err := rows.ScanDoc(&media); err != nil {
+			continue
+		}
+		if id, err := rows.ID(); err == nil {
+			media.ID = id
+		}
+		if rev, err := rows.Rev(); err == nil {
+			media.Rev = rev
+		}
+		if media.UsedBy == nil {
+			media.UsedBy = []string{}
+		}
+		list = append(list, media)
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, nil, err
+	}
+
+	return list, rows, nil
+}
+
+// CreateMedia creates a new media asset
+func (c *CouchDBAdapter) CreateMedia(media *models.Media) error {
+	ctx := context.Background()
+
+	if media.ID == "" {
+		media.ID = uuid.New().String()
+	}
+
+	media.CreatedAt = time.Now()
+	media.UpdatedAt = time.Now()
+	media.UsedBy = []string{}
+
+	rev, err := c.mediaDB.Put(ctx, media.ID, c.mediaDoc(media))
+	if err != nil {
+		return fmt.Errorf("failed to create media: %w", err)
+	}
+
+	media.Rev = rev
+	return nil
+}
+
+// GetMedia retrieves a media asset by ID
+func (c *CouchDBAdapter) GetMedia(id string) (*models.Media, error) {
+	ctx := context.Background()
+
+	row := c.mediaDB.Get(ctx, id)
+	var media models.Media
+	if err := row.ScanDoc(&media); err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+
+	media.ID = id
+	if rev, err := row.Rev(); err == nil {
+		media.Rev = rev
+	}
+	if media.UsedBy == nil {
+		media.UsedBy = []string{}
+	}
+
+	return &media, nil
+}
+
+// GetMediaByURL retrieves the media asset served at url, the oldest one
+// when deduplicated uploads share it
+func (c *CouchDBAdapter) GetMediaByURL(url string) (*models.Media, error) {
+	list, rows, err := c.findMedia(map[string]interface{}{
+		"selector": map[string]interface{}{"url": url},
+		"sort":     []map[string]string{{"url": "asc"}, {"created_at": "asc"}},
+		"limit":    1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	rows.Close()
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("media not found")
+	}
+	return &list[0], nil
+}
+
+func mediaSelector(query models.MediaQuery, sort string) map[string]interface{} {
+	selector := map[string]interface{}{}
+
+	if query.Search != "" {
+		pattern := "(?i)" + regexp.QuoteMeta(query.Search)
+		selector["$or"] = []map[string]interface{}{
+			{"filename": map[string]interface{}{"$regex": pattern}},
+			{"alt_text": map[string]interface{}{"$regex": pattern}},
+		}
+	}
+	if query.MimeType != "" {
+		if query.MimeType[len(query.MimeType)-1] == '/' {
+			selector["mime_type"] = map[string]interface{}{"$regex": "^" + regexp.QuoteMeta(query.MimeType)}
+		} else {
+			selector["mime_type"] = query.MimeType
+		}
+	}
+	if query.UploadedBy != "" {
+		selector["uploaded_by"] = query.UploadedBy
+	}
+	mangoSorted(selector, sort)
+
+	return selector
+}
+
+// ListMedia retrieves one page of media matching the query
+func (c *CouchDBAdapter) ListMedia(query models.MediaQuery) (*models.MediaList, error) {
+	sort, err := listSort(query.ListOptions, models.MediaSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	find, err := mangoQuery(mediaSelector(query, sort), sort, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	media, rows, err := c.findMedia(find)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media: %w", err)
+	}
+	defer rows.Close()
+
+	return &models.MediaList{
+		Media:      media,
+		NextCursor: nextBookmark(rows, len(media), sort, query.ListOptions),
+	}, nil
+}
+
+// CountMedia counts the media matching the query
+func (c *CouchDBAdapter) CountMedia(query models.MediaQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.MediaSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := countMango(c.mediaDB, mediaSelector(query, sort))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count media: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateMedia updates the metadata of a media asset
+func (c *CouchDBAdapter) UpdateMedia(id string, media *models.Media) error {
+	ctx := context.Background()
+
+	existing, err := c.GetMedia(id)
+	if err != nil {
+		return fmt.Errorf("failed to get existing media: %w", err)
+	}
+
+	media.ID = id
+	media.Rev = existing.Rev
+	media.UploadedBy = existing.UploadedBy
+	media.UsedBy = existing.UsedBy
+	media.CreatedAt = existing.CreatedAt
+	media.UpdatedAt = time.Now()
+
+	doc := c.mediaDoc(media)
+	doc["_rev"] = media.Rev
+
+	rev, err := c.mediaDB.Put(ctx, id, doc)
+	if err != nil {
+		return fmt.Errorf("failed to update media: %w", err)
+	}
+
+	media.Rev = rev
+	return nil
+}
+
+// DeleteMedia deletes a media asset
+func (c *CouchDBAdapter) DeleteMedia(id string) error {
+	ctx := context.Background()
+
+	existing, err := c.GetMedia(id)
+	if err != nil {
+		return fmt.Errorf("failed to get existing media: %w", err)
+	}
+
+	if _, err := c.mediaDB.Delete(ctx, id, existing.Rev); err != nil {
+		return fmt.Errorf("failed to delete media: %w", err)
+	}
+
+	return nil
+}
+
+// updateMediaUsage applies change to the used_by list of a media asset,
+// retrying on revision conflicts caused by concurrent post updates
+func (c *CouchDBAdapter) updateMediaUsage(id string, change func(usedBy []string) ([]string, bool)) error {
+	ctx := context.Background()
+
+	for attempt := 0; attempt < 5; attempt++ {
+		media, err := c.GetMedia(id)
+		if err != nil {
+			return err
+		}
+
+		usedBy, changed := change(media.UsedBy)
+		if !changed {
+			return nil
+		}
+		media.UsedBy = usedBy
+
+		doc := c.mediaDoc(media)
+		doc["_rev"] = media.Rev
+
+		_, err = c.mediaDB.Put(ctx, id, doc)
+		if err == nil {
+			return nil
+		}
+		if kivik.HTTPStatus(err) != http.StatusConflict {
+			return fmt.Errorf("failed to update media usage: %w", err)
+		}
+	}
+
+	return fmt.Errorf("failed to update media usage: too many conflicts")
+}
+
+// AddMediaUsage records that a post references a media asset
+func (c *CouchDBAdapter) AddMediaUsage(id, postID string) error {
+	return c.updateMediaUsage(id, func(usedBy []string) ([]string, bool) {
+		for _, existing := range usedBy {
+			if existing == postID {
+				return usedBy, false
+			}
+		}
+		return append(usedBy, postID), true
+	})
+}
+
+// RemoveMediaUsage removes the record that a post references a media asset
+func (c *CouchDBAdapter) RemoveMediaUsage(id, postID string) error {
+	return c.updateMediaUsage(id, func(usedBy []string) ([]string, bool) {
+		remaining := make([]string, 0, len(usedBy))
+		for _, existing := range usedBy {
+			if existing != postID {
+				remaining = append(remaining, existing)
+			}
+		}
+		return remaining, len(remaining) != len(usedBy)
+	})
+}
+
+// GetMediaUsedBy retrieves the media assets a post references
+func (c *CouchDBAdapter) GetMediaUsedBy(postID string) ([]models.Media, error) {
+	media, rows, err := c.findMedia(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"used_by": map[string]interface{}{
+				"$elemMatch": map[string]interface{}{"$eq": postID},
+			},
+		},
+		// Mango returns 25 documents unless told otherwise
+		"limit": couchCountBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media used by post: %w", err)
+	}
+	rows.Close()
+
+	return media, nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+)
+
+// passwordHistoryDoc is the CouchDB document of the password history of a
+// user, stored under the user ID
+type passwordHistoryDoc struct {
+	Rev       string    `json:"_rev,omitempty"`
+	Hashes    []string  `json:"hashes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetPasswordHistory retrieves the hashes of the previous passwords of a
+// user, newest first
+func (c *CouchDBAdapter) GetPasswordHistory(userID string) ([]string, error) {
+	var doc passwordHistoryDoc
+	err := c.passwordsDB.Get(context.Background(), userID).ScanDoc(&doc)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	if doc.Hashes == nil {
+		return []string{}, nil
+	}
+	return doc.Hashes, nil
+}
+
+// SavePasswordHistory replaces the password history of a user
+func (c *CouchDBAdapter) SavePasswordHistory(userID string, hashes []string) error {
+	rev, err := currentRev(c.passwordsDB, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	if hashes == nil {
+		hashes = []string{}
+	}
+
+	if _, err := c.passwordsDB.Put(context.Background(), userID, passwordHistoryDoc{
+		Rev:       rev,
+		Hashes:    hashes,
+		UpdatedAt: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+	return nil
+}
+
+// deletePasswordHistory deletes the password history of a deleted user
+func (c *CouchDBAdapter) deletePasswordHistory(userID string) error {
+	rev, err := currentRev(c.passwordsDB, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+	if rev == "" {
+		return nil
+	}
+
+	if _, err := c.passwordsDB.Delete(context.Background(), userID, rev); err != nil {
+		return fmt.Errorf("failed to delete password history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// GetSetting retrieves a setting, or nil when it was never saved
+func (c *CouchDBAdapter) GetSetting(key string) (*models.Setting, error) {
+	var setting models.Setting
+	err := c.settingsDB.Get(context.Background(), key).ScanDoc(&setting)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setting: %w", err)
+	}
+
+	setting.Key = key
+	return &setting, nil
+}
+
+// SaveSetting creates or replaces a setting
+func (c *CouchDBAdapter) SaveSetting(setting *models.Setting) error {
+	rev, err := currentRev(c.settingsDB, setting.Key)
+	if err != nil {
+		return fmt.Errorf("failed to get setting: %w", err)
+	}
+
+	setting.UpdatedAt = time.Now()
+	doc := map[string]interface{}{
+		"value":      setting.Value,
+		"updated_by": setting.UpdatedBy,
+		"updated_at": setting.UpdatedAt,
+	}
+	if rev != "" {
+		doc["_rev"] = rev
+	}
+
+	if _, err := c.settingsDB.Put(context.Background(), setting.Key, doc); err != nil {
+		return fmt.Errorf("failed to save setting: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// slugReservation marks a slug as held by a post. CouchDB has no unique
+// indexes, so reservations are stored under the slug and a second post
+// reserving it gets a conflict.
+type slugReservation struct {
+	PostID string `json:"post_id"`
+}
+
+// slugDocID returns the document ID of the reservation of slug
+func slugDocID(slug string) string {
+	return "slug:" + slug
+}
+
+// postSlugs returns the slugs held by a post: its current one and the ones
+// kept for redirects
+func postSlugs(post *models.Post) []string {
+	slugs := make([]string, 0, len(post.PreviousSlugs)+1)
+	if post.Slug != "" {
+		slugs = append(slugs, post.Slug)
+	}
+	for _, slug := range post.PreviousSlugs {
+		if slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// reservePostSlugs reserves slugs for postID. It returns the slugs that were
+// newly reserved, so they can be released when the post isn't saved after
+// all, and ErrSlugTaken when another post holds one of them.
+func (c *CouchDBAdapter) reservePostSlugs(postID string, slugs []string) ([]string, error) {
+	ctx := context.Background()
+
+	var reserved []string
+	for _, slug := range slugs {
+		_, err := c.slugsDB.Put(ctx, slugDocID(slug), slugReservation{PostID: postID})
+		if err == nil {
+			reserved = append(reserved, slug)
+			continue
+		}
+
+		if kivik.HTTPStatus(err) != http.StatusConflict {
+			c.releasePostSlugs(postID, reserved)
+			return nil, fmt.Errorf("failed to reserve post slug: %w", err)
+		}
+
+		// The slug is reserved already, possibly by this post
+		var holder slugReservation
+		if err := c.slugsDB.Get(ctx, slugDocID(slug)).ScanDoc(&holder); err != nil {
+			c.releasePostSlugs(postID, reserved)
+			return nil, fmt.Errorf("failed to get slug reservation: %w", err)
+		}
+		if holder.PostID != postID {
+			c.releasePostSlugs(postID, reserved)
+			return nil, ErrSlugTaken
+		}
+	}
+
+	return reserved, nil
+}
+
+// releasePostSlugs releases the slugs postID holds. A reservation left behind
+// only keeps its slug from being reused, so failures are logged.
+func (c *CouchDBAdapter) releasePostSlugs(postID string, slugs []string) {
+	ctx := context.Background()
+
+	for _, slug := range slugs {
+		row := c.slugsDB.Get(ctx, slugDocID(slug))
+		var holder slugReservation
+		if err := row.ScanDoc(&holder); err != nil {
+			if kivik.HTTPStatus(err) != http.StatusNotFound {
+				log.Printf("Failed to get reservation of slug %s: %v", slug, err)
+			}
+			continue
+		}
+		if holder.PostID != postID {
+			continue
+		}
+
+		rev, err := row.Rev()
+		if err == nil {
+			_, err = c.slugsDB.Delete(ctx, slugDocID(slug), rev)
+		}
+		if err != nil {
+			log.Printf("Failed to release slug %s: %v", slug, err)
+		}
+	}
+}
+
+// droppedSlugs returns the slugs of before that after no longer holds
+func droppedSlugs(before, after *models.Post) []string {
+	kept := make(map[string]bool)
+	for _, slug := range postSlugs(after) {
+		kept[slug] = true
+	}
+
+	var dropped []string
+	for _, slug := range postSlugs(before) {
+		if !kept[slug] {
+			dropped = append(dropped, slug)
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+	"webenable-cms-backend/models"
+)
+
+// twoFactorDoc is the CouchDB document of a two-factor configuration. The
+// model hides the secret from JSON, so it is stored through this type.
+type twoFactorDoc struct {
+	Rev           string     `json:"_rev,omitempty"`
+	Secret        string     `json:"secret"`
+	Enabled       bool       `json:"enabled"`
+	RecoveryCodes []string   `json:"recovery_codes"`
+	LastUsedStep  int64      `json:"last_used_step"`
+	EnabledAt     *time.Time `json:"enabled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// currentRev returns the revision of a document, or an empty string when
+// it doesn't exist
+func currentRev(db *kivik.DB, id string) (string, error) {
+	rev, err := db.GetRev(context.Background(), id)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return "", nil
+	}
+	return rev, err
+}
+
+// GetTwoFactor retrieves the two-factor configuration of a user, or nil
+// when the user has none
+func (c *CouchDBAdapter) GetTwoFactor(userID string) (*models.TwoFactor, error) {
+	var doc twoFactorDoc
+	err := c.twoFactorDB.Get(context.Background(), userID).ScanDoc(&doc)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor configuration: %w", err)
+	}
+
+	return &models.TwoFactor{
+		UserID:        userID,
+		Secret:        doc.Secret,
+		Enabled:       doc.Enabled,
+		RecoveryCodes: doc.RecoveryCodes,
+		LastUsedStep:  doc.LastUsedStep,
+		EnabledAt:     doc.EnabledAt,
+		CreatedAt:     doc.CreatedAt,
+		UpdatedAt:     doc.UpdatedAt,
+	}, nil
+}
+
+// SaveTwoFactor creates or replaces the two-factor configuration of a user
+func (c *CouchDBAdapter) SaveTwoFactor(twoFactor *models.TwoFactor) error {
+	rev, err := currentRev(c.twoFactorDB, twoFactor.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get two-factor configuration: %w", err)
+	}
+
+	now := time.Now()
+	if twoFactor.CreatedAt.IsZero() {
+		twoFactor.CreatedAt = now
+	}
+	twoFactor.UpdatedAt = now
+
+	recoveryCodes := twoFactor.RecoveryCodes
+	if recoveryCodes == nil {
+		recoveryCodes = []string{}
+	}
+
+	_, err = c.twoFactorDB.Put(context.Background(), twoFactor.UserID, twoFactorDoc{
+		Rev:           rev,
+		Secret:        twoFactor.Secret,
+		Enabled:       twoFactor.Enabled,
+		RecoveryCodes: recoveryCodes,
+		LastUsedStep:  twoFactor.LastUsedStep,
+		EnabledAt:     twoFactor.EnabledAt,
+		CreatedAt:     twoFactor.CreatedAt,
+		UpdatedAt:     twoFactor.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save two-factor configuration: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTwoFactor deletes the two-factor configuration of a user. Deleting
+// a configuration that doesn't exist is not an error.
+func (c *CouchDBAdapter) DeleteTwoFactor(userID string) error {
+	rev, err := currentRev(c.twoFactorDB, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get two-factor configuration: %w", err)
+	}
+	if rev == "" {
+		return nil
+	}
+
+	if _, err := c.twoFactorDB.Delete(context.Background(), userID, rev); err != nil {
+		return fmt.Errorf("failed to delete two-factor configuration: %w", err)
+	}
+	return nil
+}
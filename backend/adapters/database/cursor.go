@@ -0,0 +1,154 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// defaultListLimit is the page size used when a list query sets none
+const defaultListLimit = 10
+
+var (
+	// ErrInvalidCursor is returned when a list cursor can't be decoded or was
+	// issued for a different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidSort is returned when a list is sorted by an unsupported field
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// listCursor is the decoded form of the opaque cursor handed to clients.
+// SQL adapters continue after the sort value and ID of the last row,
+// CouchDB continues from the bookmark returned by Mango.
+type listCursor struct {
+	Sort     string          `json:"s"`
+	Desc     bool            `json:"d,omitempty"`
+	Value    json.RawMessage `json:"v,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Bookmark string          `json:"b,omitempty"`
+}
+
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes token and checks that it belongs to the same sort
+// order. An empty token decodes to nil.
+func decodeCursor(token, sort string, desc bool) (*listCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Desc != desc {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidCursor)
+	}
+
+	return &cursor, nil
+}
+
+// sortValue decodes the sort value stored in the cursor into the Go type
+// of the sort field
+func (c *listCursor) sortValue() (interface{}, error) {
+	switch c.Sort {
+	case "created_at", "published_at":
+		var value time.Time
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	case "view_count", "size":
+		var value int64
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	default:
+		var value string
+		if err := json.Unmarshal(c.Value, &value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return value, nil
+	}
+}
+
+// listSort returns the field a list is sorted by, created_at by default
+func listSort(options models.ListOptions, allowed []string) (string, error) {
+	if options.Sort == "" {
+		return "created_at", nil
+	}
+
+	for _, field := range allowed {
+		if field == options.Sort {
+			return field, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrInvalidSort, options.Sort)
+}
+
+func listLimit(options models.ListOptions) int {
+	if options.Limit <= 0 {
+		return defaultListLimit
+	}
+	return options.Limit
+}
+
+// postSortValue returns the value of the field a post list is sorted by
+func postSortValue(post *models.Post, sort string) interface{} {
+	switch sort {
+	case "published_at":
+		return post.PublishedAt
+	case "view_count":
+		return post.ViewCount
+	case "title":
+		return post.Title
+	default:
+		return post.CreatedAt
+	}
+}
+
+// userSortValue returns the value of the field a user list is sorted by
+func userSortValue(user *models.User, sort string) interface{} {
+	if sort == "username" {
+		return user.Username
+	}
+	return user.CreatedAt
+}
+
+// mediaSortValue returns the value of the field a media list is sorted by
+func mediaSortValue(media *models.Media, sort string) interface{} {
+	switch sort {
+	case "filename":
+		return media.Filename
+	case "size":
+		return media.Size
+	default:
+		return media.CreatedAt
+	}
+}
+
+// keysetCursor builds the cursor that continues after a row
+func keysetCursor(sort string, desc bool, value interface{}, id string) string {
+	data, _ := json.Marshal(value)
+	return encodeCursor(listCursor{
+		Sort:  sort,
+		Desc:  desc,
+		Value: data,
+		ID:    id,
+	})
+}
@@ -2,9 +2,20 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 	"webenable-cms-backend/models"
 )
 
+var (
+	// ErrPostNotFound is returned when a post looked up by ID doesn't exist
+	ErrPostNotFound = errors.New("post not found")
+
+	// ErrSlugTaken is returned when a post is saved with a slug that another
+	// post is using
+	ErrSlugTaken = errors.New("slug already in use")
+)
+
 // DatabaseAdapter defines the interface for database operations
 type DatabaseAdapter interface {
 	// Connection Management
@@ -15,9 +26,19 @@ type DatabaseAdapter interface {
 	// Post Operations
 	CreatePost(post *models.Post) error
 	GetPost(id string) (*models.Post, error)
+	GetPostBySlug(slug string) (*models.Post, error)
+	GetPostByPreviousSlug(slug string) (*models.Post, error)
 	GetPosts(limit, offset int) ([]models.Post, error)
 	UpdatePost(id string, post *models.Post) error
 	DeletePost(id string) error
+	GetScheduledPosts(before time.Time) ([]models.Post, error)
+	ListPosts(query models.PostQuery) (*models.PostList, error)
+	CountPosts(query models.PostQuery) (int, error)
+
+	// Post Revision Operations (revisions are immutable once created)
+	CreatePostRevision(revision *models.PostRevision) error
+	GetPostRevisions(postID string) ([]models.PostRevision, error)
+	GetPostRevision(postID string, number int) (*models.PostRevision, error)
 
 	// User Operations
 	CreateUser(user *models.User) error
@@ -25,16 +46,95 @@ type DatabaseAdapter interface {
 	GetUserByUsername(username string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	GetUsers(limit, offset int) ([]models.User, error)
+	ListUsers(query models.UserQuery) (*models.UserList, error)
+	CountUsers(query models.UserQuery) (int, error)
 	UpdateUser(id string, user *models.User) error
+	MarkEmailVerified(id, email string) error
 	DeleteUser(id string) error
 
+	// Two-factor Operations. A user has at most one configuration, which is
+	// deleted with the user. GetTwoFactor returns nil without an error when
+	// the user has none.
+	GetTwoFactor(userID string) (*models.TwoFactor, error)
+	SaveTwoFactor(twoFactor *models.TwoFactor) error
+	DeleteTwoFactor(userID string) error
+
+	// Password History Operations. The hashes of the previous passwords of
+	// a user, newest first, are deleted with the user. GetPasswordHistory
+	// returns an empty list for users without one.
+	GetPasswordHistory(userID string) ([]string, error)
+	SavePasswordHistory(userID string, hashes []string) error
+
+	// Invitation Operations. A user has at most one invitation, which is
+	// deleted with the user. GetInvitation returns nil without an error
+	// when the user has none; invitations are found by the hash of the
+	// token of their link. ListInvitations lists them newest first.
+	GetInvitation(userID string) (*models.Invitation, error)
+	GetInvitationByTokenHash(hash string) (*models.Invitation, error)
+	ListInvitations() ([]models.Invitation, error)
+	SaveInvitation(invitation *models.Invitation) error
+	DeleteInvitation(userID string) error
+
+	// Identity Operations. Users signing in with an identity provider are
+	// found by the issuer and subject of their identity, which is deleted
+	// with the user. GetUserIdentity returns nil without an error for
+	// identities not linked to a user; linking one twice fails.
+	GetUserIdentity(issuer, subject string) (*models.UserIdentity, error)
+	LinkUserIdentity(identity *models.UserIdentity) error
+
+	// API Key Operations. Keys are found by the hash of their secret and
+	// deleted with their user. ListAPIKeys lists the keys of every user
+	// when userID is empty, newest first.
+	CreateAPIKey(key *models.APIKey) error
+	GetAPIKey(id string) (*models.APIKey, error)
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	ListAPIKeys(userID string) ([]models.APIKey, error)
+	TouchAPIKey(id string, usedAt time.Time, ip string) error
+	RevokeAPIKey(id, revokedBy string) error
+
+	// Audit Operations. Events are append-only; DeleteAuditEventsBefore
+	// enforces the retention period and returns how many it deleted.
+	CreateAuditEvent(event *models.AuditEvent) error
+	ListAuditEvents(query models.AuditQuery) (*models.AuditList, error)
+	CountAuditEvents(query models.AuditQuery) (int, error)
+	DeleteAuditEventsBefore(before time.Time) (int, error)
+
+	// Setting Operations. GetSetting returns nil without an error for
+	// settings that were never saved.
+	GetSetting(key string) (*models.Setting, error)
+	SaveSetting(setting *models.Setting) error
+
 	// Contact Operations
 	CreateContact(contact *models.Contact) error
 	GetContact(id string) (*models.Contact, error)
 	GetContacts(limit, offset int) ([]models.Contact, error)
+	ListContacts(query models.ContactQuery) (*models.ContactList, error)
+	CountContacts(query models.ContactQuery) (int, error)
 	UpdateContact(id string, contact *models.Contact) error
 	DeleteContact(id string) error
 
+	// Media Operations. UsedBy is maintained through the usage methods and
+	// ignored by CreateMedia and UpdateMedia.
+	CreateMedia(media *models.Media) error
+	GetMedia(id string) (*models.Media, error)
+	GetMediaByURL(url string) (*models.Media, error)
+	ListMedia(query models.MediaQuery) (*models.MediaList, error)
+	CountMedia(query models.MediaQuery) (int, error)
+	UpdateMedia(id string, media *models.Media) error
+	DeleteMedia(id string) error
+	AddMediaUsage(id, postID string) error
+	RemoveMediaUsage(id, postID string) error
+	GetMediaUsedBy(postID string) ([]models.Media, error)
+
+	// Category Operations
+	CreateCategory(category *models.Category) error
+	GetCategory(id string) (*models.Category, error)
+	GetCategoryBySlug(slug string) (*models.Category, error)
+	GetCategories() ([]models.Category, error)
+	UpdateCategory(id string, category *models.Category) error
+	DeleteCategory(id string) error
+	IncrementCategoryPostCount(slug string, delta int) error
+
 	// Transaction Support
 	BeginTransaction() (Transaction, error)
 }
@@ -44,6 +144,8 @@ type Transaction interface {
 	Commit() error
 	Rollback() error
 	Context() context.Context
+	// Database returns an adapter whose operations run inside the transaction
+	Database() DatabaseAdapter
 }
 
 // DatabaseConfig holds configuration for database adapters
@@ -57,4 +159,5 @@ const (
 	DatabaseTypeCouchDB  = "couchdb"
 	DatabaseTypePostgres = "postgres"
 	DatabaseTypeMongoDB  = "mongodb"
+	DatabaseTypeSQLite   = "sqlite"
 )
\ No newline at end of file
@@ -0,0 +1,624 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a numbered, forward-only schema change
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// listSortIndexes back the keyset pagination of every sortable list field.
+// The id column breaks ties between rows with the same sort value.
+var listSortIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS posts_created_id_idx ON posts (created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS posts_published_id_idx ON posts (published_at, id) WHERE published_at IS NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS posts_view_count_id_idx ON posts (view_count, id)`,
+	`CREATE INDEX IF NOT EXISTS posts_title_id_idx ON posts (title, id)`,
+	`CREATE INDEX IF NOT EXISTS users_created_id_idx ON users (created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS contacts_created_id_idx ON contacts (created_at, id)`,
+}
+
+// postgresMigrations is the Postgres schema history. Never edit a migration
+// that has shipped; add a new one instead.
+var postgresMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial_schema",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS posts (
+				id               TEXT PRIMARY KEY,
+				version          INTEGER NOT NULL DEFAULT 1,
+				title            TEXT NOT NULL DEFAULT '',
+				slug             TEXT NOT NULL DEFAULT '',
+				previous_slugs   JSONB NOT NULL DEFAULT '[]',
+				content          TEXT NOT NULL DEFAULT '',
+				excerpt          TEXT NOT NULL DEFAULT '',
+				author           TEXT NOT NULL DEFAULT '',
+				status           TEXT NOT NULL DEFAULT 'draft',
+				tags             JSONB NOT NULL DEFAULT '[]',
+				categories       JSONB NOT NULL DEFAULT '[]',
+				featured_image   TEXT NOT NULL DEFAULT '',
+				image_alt        TEXT NOT NULL DEFAULT '',
+				meta_title       TEXT NOT NULL DEFAULT '',
+				meta_description TEXT NOT NULL DEFAULT '',
+				reading_time     INTEGER NOT NULL DEFAULT 0,
+				is_featured      BOOLEAN NOT NULL DEFAULT FALSE,
+				view_count       INTEGER NOT NULL DEFAULT 0,
+				created_at       TIMESTAMPTZ NOT NULL,
+				updated_at       TIMESTAMPTZ NOT NULL,
+				published_at     TIMESTAMPTZ,
+				scheduled_at     TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS posts_status_published_idx ON posts (status, published_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS posts_author_created_idx ON posts (author, created_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS posts_featured_status_idx ON posts (is_featured, status)`,
+			`CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (scheduled_at) WHERE status = 'scheduled'`,
+			`CREATE INDEX IF NOT EXISTS posts_tags_idx ON posts USING GIN (tags)`,
+			`CREATE INDEX IF NOT EXISTS posts_categories_idx ON posts USING GIN (categories)`,
+			`CREATE INDEX IF NOT EXISTS posts_previous_slugs_idx ON posts USING GIN (previous_slugs)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS posts_slug_idx ON posts (slug) WHERE slug <> ''`,
+
+			`CREATE TABLE IF NOT EXISTS post_revisions (
+				post_id        TEXT NOT NULL,
+				number         INTEGER NOT NULL,
+				author         TEXT NOT NULL DEFAULT '',
+				created_at     TIMESTAMPTZ NOT NULL,
+				changed_fields JSONB NOT NULL DEFAULT '[]',
+				restored_from  INTEGER NOT NULL DEFAULT 0,
+				snapshot       JSONB NOT NULL,
+				PRIMARY KEY (post_id, number)
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS users (
+				id            TEXT PRIMARY KEY,
+				version       INTEGER NOT NULL DEFAULT 1,
+				username      TEXT NOT NULL,
+				email         TEXT NOT NULL,
+				password_hash TEXT NOT NULL DEFAULT '',
+				role          TEXT NOT NULL DEFAULT '',
+				active        BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at    TIMESTAMPTZ NOT NULL,
+				updated_at    TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_username_idx ON users (username)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email)`,
+			`CREATE INDEX IF NOT EXISTS users_role_active_idx ON users (role, active)`,
+			`CREATE INDEX IF NOT EXISTS users_created_idx ON users (created_at)`,
+
+			`CREATE TABLE IF NOT EXISTS contacts (
+				id         TEXT PRIMARY KEY,
+				version    INTEGER NOT NULL DEFAULT 1,
+				name       TEXT NOT NULL DEFAULT '',
+				email      TEXT NOT NULL DEFAULT '',
+				company    TEXT NOT NULL DEFAULT '',
+				phone      TEXT NOT NULL DEFAULT '',
+				subject    TEXT NOT NULL DEFAULT '',
+				message    TEXT NOT NULL DEFAULT '',
+				status     TEXT NOT NULL DEFAULT 'new',
+				created_at TIMESTAMPTZ NOT NULL,
+				read_at    TIMESTAMPTZ,
+				replied_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS contacts_status_created_idx ON contacts (status, created_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS contacts_email_idx ON contacts (email)`,
+
+			`CREATE TABLE IF NOT EXISTS categories (
+				id          TEXT PRIMARY KEY,
+				version     INTEGER NOT NULL DEFAULT 1,
+				name        TEXT NOT NULL DEFAULT '',
+				slug        TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				color       TEXT NOT NULL DEFAULT '',
+				icon        TEXT NOT NULL DEFAULT '',
+				post_count  INTEGER NOT NULL DEFAULT 0,
+				created_at  TIMESTAMPTZ NOT NULL,
+				updated_at  TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS categories_slug_idx ON categories (slug)`,
+		},
+	},
+	{
+		version:    2,
+		name:       "list_sort_indexes",
+		statements: listSortIndexes,
+	},
+	{
+		version: 3,
+		name:    "media_library",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS media (
+				id          TEXT PRIMARY KEY,
+				version     INTEGER NOT NULL DEFAULT 1,
+				filename    TEXT NOT NULL DEFAULT '',
+				path        TEXT NOT NULL,
+				url         TEXT NOT NULL,
+				mime_type   TEXT NOT NULL DEFAULT '',
+				size        BIGINT NOT NULL DEFAULT 0,
+				width       INTEGER NOT NULL DEFAULT 0,
+				height      INTEGER NOT NULL DEFAULT 0,
+				alt_text    TEXT NOT NULL DEFAULT '',
+				uploaded_by TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMPTZ NOT NULL,
+				updated_at  TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS media_url_idx ON media (url)`,
+			`CREATE INDEX IF NOT EXISTS media_created_id_idx ON media (created_at, id)`,
+			`CREATE INDEX IF NOT EXISTS media_filename_id_idx ON media (filename, id)`,
+			`CREATE INDEX IF NOT EXISTS media_size_id_idx ON media (size, id)`,
+			`CREATE INDEX IF NOT EXISTS media_uploaded_by_idx ON media (uploaded_by)`,
+
+			`CREATE TABLE IF NOT EXISTS media_usage (
+				media_id TEXT NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+				post_id  TEXT NOT NULL,
+				PRIMARY KEY (media_id, post_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS media_usage_post_idx ON media_usage (post_id)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "media_variants",
+		statements: []string{
+			`ALTER TABLE media ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]'`,
+		},
+	},
+	{
+		version: 5,
+		name:    "media_content_hash",
+		statements: []string{
+			`ALTER TABLE media ADD COLUMN IF NOT EXISTS sha256 TEXT NOT NULL DEFAULT ''`,
+			// Deduplicated uploads share a URL
+			`DROP INDEX IF EXISTS media_url_idx`,
+			`CREATE INDEX IF NOT EXISTS media_url_idx ON media (url)`,
+			`CREATE INDEX IF NOT EXISTS media_sha256_idx ON media (sha256)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "two_factor_and_settings",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id        TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				secret         TEXT NOT NULL,
+				enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+				recovery_codes JSONB NOT NULL DEFAULT '[]',
+				last_used_step BIGINT NOT NULL DEFAULT 0,
+				enabled_at     TIMESTAMPTZ,
+				created_at     TIMESTAMPTZ NOT NULL,
+				updated_at     TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS settings (
+				key        TEXT PRIMARY KEY,
+				value      TEXT NOT NULL,
+				updated_by TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "user_email_verification",
+		statements: []string{
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		version: 8,
+		name:    "api_keys",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				key_hash     TEXT NOT NULL,
+				scopes       JSONB NOT NULL DEFAULT '[]',
+				expires_at   TIMESTAMPTZ NOT NULL,
+				last_used_at TIMESTAMPTZ,
+				last_used_ip TEXT NOT NULL DEFAULT '',
+				revoked_at   TIMESTAMPTZ,
+				revoked_by   TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS api_keys_hash_idx ON api_keys (key_hash)`,
+			`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id, created_at)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "audit_events",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_events (
+				id          TEXT PRIMARY KEY,
+				actor_id    TEXT NOT NULL DEFAULT '',
+				actor       TEXT NOT NULL,
+				api_key_id  TEXT NOT NULL DEFAULT '',
+				action      TEXT NOT NULL,
+				target_type TEXT NOT NULL,
+				target_id   TEXT NOT NULL DEFAULT '',
+				changes     JSONB NOT NULL DEFAULT '{}',
+				ip          TEXT NOT NULL DEFAULT '',
+				request_id  TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_created_id_idx ON audit_events (created_at, id)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, created_at)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, created_at)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, created_at)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "password_history",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS password_history (
+				user_id    TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				hashes     JSONB NOT NULL DEFAULT '[]',
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "invitations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS invitations (
+				user_id    TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				token_hash TEXT NOT NULL,
+				invited_by TEXT NOT NULL DEFAULT '',
+				expires_at TIMESTAMPTZ NOT NULL,
+				sent_at    TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS invitations_token_hash_idx ON invitations (token_hash)`,
+			`CREATE INDEX IF NOT EXISTS invitations_created_idx ON invitations (created_at)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "user_identities",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				issuer     TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (issuer, subject)
+			)`,
+			`CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id)`,
+		},
+	},
+}
+
+// sqliteMigrations is the SQLite schema history. It mirrors the Postgres
+// schema with JSON arrays stored as TEXT and without the GIN indexes.
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial_schema",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS posts (
+				id               TEXT PRIMARY KEY,
+				version          INTEGER NOT NULL DEFAULT 1,
+				title            TEXT NOT NULL DEFAULT '',
+				slug             TEXT NOT NULL DEFAULT '',
+				previous_slugs   TEXT NOT NULL DEFAULT '[]',
+				content          TEXT NOT NULL DEFAULT '',
+				excerpt          TEXT NOT NULL DEFAULT '',
+				author           TEXT NOT NULL DEFAULT '',
+				status           TEXT NOT NULL DEFAULT 'draft',
+				tags             TEXT NOT NULL DEFAULT '[]',
+				categories       TEXT NOT NULL DEFAULT '[]',
+				featured_image   TEXT NOT NULL DEFAULT '',
+				image_alt        TEXT NOT NULL DEFAULT '',
+				meta_title       TEXT NOT NULL DEFAULT '',
+				meta_description TEXT NOT NULL DEFAULT '',
+				reading_time     INTEGER NOT NULL DEFAULT 0,
+				is_featured      BOOLEAN NOT NULL DEFAULT FALSE,
+				view_count       INTEGER NOT NULL DEFAULT 0,
+				created_at       TIMESTAMP NOT NULL,
+				updated_at       TIMESTAMP NOT NULL,
+				published_at     TIMESTAMP,
+				scheduled_at     TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS posts_status_published_idx ON posts (status, published_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS posts_author_created_idx ON posts (author, created_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS posts_featured_status_idx ON posts (is_featured, status)`,
+			`CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (scheduled_at) WHERE status = 'scheduled'`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS posts_slug_idx ON posts (slug) WHERE slug <> ''`,
+
+			`CREATE TABLE IF NOT EXISTS post_revisions (
+				post_id        TEXT NOT NULL,
+				number         INTEGER NOT NULL,
+				author         TEXT NOT NULL DEFAULT '',
+				created_at     TIMESTAMP NOT NULL,
+				changed_fields TEXT NOT NULL DEFAULT '[]',
+				restored_from  INTEGER NOT NULL DEFAULT 0,
+				snapshot       TEXT NOT NULL,
+				PRIMARY KEY (post_id, number)
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS users (
+				id            TEXT PRIMARY KEY,
+				version       INTEGER NOT NULL DEFAULT 1,
+				username      TEXT NOT NULL,
+				email         TEXT NOT NULL,
+				password_hash TEXT NOT NULL DEFAULT '',
+				role          TEXT NOT NULL DEFAULT '',
+				active        BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at    TIMESTAMP NOT NULL,
+				updated_at    TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_username_idx ON users (username)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (email)`,
+			`CREATE INDEX IF NOT EXISTS users_role_active_idx ON users (role, active)`,
+			`CREATE INDEX IF NOT EXISTS users_created_idx ON users (created_at)`,
+
+			`CREATE TABLE IF NOT EXISTS contacts (
+				id         TEXT PRIMARY KEY,
+				version    INTEGER NOT NULL DEFAULT 1,
+				name       TEXT NOT NULL DEFAULT '',
+				email      TEXT NOT NULL DEFAULT '',
+				company    TEXT NOT NULL DEFAULT '',
+				phone      TEXT NOT NULL DEFAULT '',
+				subject    TEXT NOT NULL DEFAULT '',
+				message    TEXT NOT NULL DEFAULT '',
+				status     TEXT NOT NULL DEFAULT 'new',
+				created_at TIMESTAMP NOT NULL,
+				read_at    TIMESTAMP,
+				replied_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS contacts_status_created_idx ON contacts (status, created_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS contacts_email_idx ON contacts (email)`,
+
+			`CREATE TABLE IF NOT EXISTS categories (
+				id          TEXT PRIMARY KEY,
+				version     INTEGER NOT NULL DEFAULT 1,
+				name        TEXT NOT NULL DEFAULT '',
+				slug        TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				color       TEXT NOT NULL DEFAULT '',
+				icon        TEXT NOT NULL DEFAULT '',
+				post_count  INTEGER NOT NULL DEFAULT 0,
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS categories_slug_idx ON categories (slug)`,
+		},
+	},
+	{
+		version:    2,
+		name:       "list_sort_indexes",
+		statements: listSortIndexes,
+	},
+	{
+		version: 3,
+		name:    "media_library",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS media (
+				id          TEXT PRIMARY KEY,
+				version     INTEGER NOT NULL DEFAULT 1,
+				filename    TEXT NOT NULL DEFAULT '',
+				path        TEXT NOT NULL,
+				url         TEXT NOT NULL,
+				mime_type   TEXT NOT NULL DEFAULT '',
+				size        BIGINT NOT NULL DEFAULT 0,
+				width       INTEGER NOT NULL DEFAULT 0,
+				height      INTEGER NOT NULL DEFAULT 0,
+				alt_text    TEXT NOT NULL DEFAULT '',
+				uploaded_by TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMP NOT NULL,
+				updated_at  TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS media_url_idx ON media (url)`,
+			`CREATE INDEX IF NOT EXISTS media_created_id_idx ON media (created_at, id)`,
+			`CREATE INDEX IF NOT EXISTS media_filename_id_idx ON media (filename, id)`,
+			`CREATE INDEX IF NOT EXISTS media_size_id_idx ON media (size, id)`,
+			`CREATE INDEX IF NOT EXISTS media_uploaded_by_idx ON media (uploaded_by)`,
+
+			`CREATE TABLE IF NOT EXISTS media_usage (
+				media_id TEXT NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+				post_id  TEXT NOT NULL,
+				PRIMARY KEY (media_id, post_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS media_usage_post_idx ON media_usage (post_id)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "media_variants",
+		statements: []string{
+			`ALTER TABLE media ADD COLUMN variants TEXT NOT NULL DEFAULT '[]'`,
+		},
+	},
+	{
+		version: 5,
+		name:    "media_content_hash",
+		statements: []string{
+			`ALTER TABLE media ADD COLUMN sha256 TEXT NOT NULL DEFAULT ''`,
+			// Deduplicated uploads share a URL
+			`DROP INDEX IF EXISTS media_url_idx`,
+			`CREATE INDEX IF NOT EXISTS media_url_idx ON media (url)`,
+			`CREATE INDEX IF NOT EXISTS media_sha256_idx ON media (sha256)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "two_factor_and_settings",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id        TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				secret         TEXT NOT NULL,
+				enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+				recovery_codes TEXT NOT NULL DEFAULT '[]',
+				last_used_step BIGINT NOT NULL DEFAULT 0,
+				enabled_at     TIMESTAMP,
+				created_at     TIMESTAMP NOT NULL,
+				updated_at     TIMESTAMP NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS settings (
+				key        TEXT PRIMARY KEY,
+				value      TEXT NOT NULL,
+				updated_by TEXT NOT NULL DEFAULT '',
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "user_email_verification",
+		statements: []string{
+			`ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		version: 8,
+		name:    "api_keys",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS api_keys (
+				id           TEXT PRIMARY KEY,
+				user_id      TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				name         TEXT NOT NULL,
+				prefix       TEXT NOT NULL,
+				key_hash     TEXT NOT NULL,
+				scopes       TEXT NOT NULL DEFAULT '[]',
+				expires_at   TIMESTAMP NOT NULL,
+				last_used_at TIMESTAMP,
+				last_used_ip TEXT NOT NULL DEFAULT '',
+				revoked_at   TIMESTAMP,
+				revoked_by   TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS api_keys_hash_idx ON api_keys (key_hash)`,
+			`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id, created_at)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "audit_events",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_events (
+				id          TEXT PRIMARY KEY,
+				actor_id    TEXT NOT NULL DEFAULT '',
+				actor       TEXT NOT NULL,
+				api_key_id  TEXT NOT NULL DEFAULT '',
+				action      TEXT NOT NULL,
+				target_type TEXT NOT NULL,
+				target_id   TEXT NOT NULL DEFAULT '',
+				changes     TEXT NOT NULL DEFAULT '{}',
+				ip          TEXT NOT NULL DEFAULT '',
+				request_id  TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_created_id_idx ON audit_events (created_at, id)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, created_at)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, created_at)`,
+			`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, created_at)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "password_history",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS password_history (
+				user_id    TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				hashes     TEXT NOT NULL DEFAULT '[]',
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "invitations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS invitations (
+				user_id    TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+				email      TEXT NOT NULL,
+				token_hash TEXT NOT NULL,
+				invited_by TEXT NOT NULL DEFAULT '',
+				expires_at TIMESTAMP NOT NULL,
+				sent_at    TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS invitations_token_hash_idx ON invitations (token_hash)`,
+			`CREATE INDEX IF NOT EXISTS invitations_created_idx ON invitations (created_at)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "user_identities",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				issuer     TEXT NOT NULL,
+				subject    TEXT NOT NULL,
+				user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (issuer, subject)
+			)`,
+			`CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id)`,
+		},
+	},
+}
+
+// runMigrations applies every migration of the dialect newer than the
+// recorded schema version, each in its own transaction
+func runMigrations(ctx context.Context, db *sql.DB, d *sqlDialect) error {
+	if _, err := db.ExecContext(ctx, d.migrationTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, m := range d.migrations {
+		if err := applyMigration(ctx, db, d, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, d *sqlDialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if d.migrationLock != "" {
+		if _, err := tx.ExecContext(ctx, d.migrationLock); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	if err := tx.QueryRowContext(ctx,
+		d.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`), m.version,
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		d.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`),
+		d.args([]interface{}{m.version, m.name, time.Now()})...,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresUniqueViolation is the SQLSTATE for a unique constraint violation
+const postgresUniqueViolation = "23505"
+
+// postgresDialect talks to PostgreSQL through the pgx driver. Queries are
+// written in Postgres syntax, so nothing needs translating.
+var postgresDialect = &sqlDialect{
+	name:              "PostgreSQL",
+	open:              openPostgres,
+	rebind:            func(query string) string { return query },
+	args:              func(args []interface{}) []interface{} { return args },
+	jsonContains:      postgresJSONContains,
+	isUniqueViolation: isPostgresUniqueViolation,
+	migrationTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`,
+	migrationLock: `SELECT pg_advisory_xact_lock(724153)`,
+	migrations:    postgresMigrations,
+}
+
+// NewPostgresAdapter creates a new PostgreSQL adapter
+func NewPostgresAdapter(config map[string]interface{}) (DatabaseAdapter, error) {
+	adapter, err := newSQLAdapter(postgresDialect, DatabaseTypePostgres, config)
+	if err != nil {
+		return nil, err
+	}
+	return adapter, nil
+}
+
+// postgresDSN builds a connection URL from the adapter configuration. A
+// complete "dsn" entry takes precedence over the individual settings.
+func postgresDSN(config map[string]interface{}) string {
+	if dsn, ok := config["dsn"].(string); ok && dsn != "" {
+		return dsn
+	}
+
+	get := func(key, fallback string) string {
+		if value, ok := config[key].(string); ok && value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(get("user", "postgres"), get("password", "")),
+		Host:     net.JoinHostPort(get("host", "localhost"), get("port", "5432")),
+		Path:     "/" + get("dbname", "webenable_cms"),
+		RawQuery: url.Values{"sslmode": {get("sslmode", "disable")}}.Encode(),
+	}
+
+	return dsn.String()
+}
+
+func openPostgres(config map[string]interface{}) (*sql.DB, error) {
+	db, err := sql.Open("pgx", postgresDSN(config))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(30 * time.Minute)
+
+	return db, nil
+}
+
+// postgresJSONContains uses containment so that the GIN indexes apply
+func postgresJSONContains(column, param string) string {
+	return column + " @> jsonb_build_array(" + param + "::text)"
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == postgresUniqueViolation
+}
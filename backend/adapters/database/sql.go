@@ -0,0 +1,988 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlDialect holds what differs between the SQL databases. Queries are
+// written for Postgres and translated by rebind and args where needed.
+type sqlDialect struct {
+	name string
+
+	// open creates the connection pool from the adapter configuration
+	open func(config map[string]interface{}) (*sql.DB, error)
+
+	// rebind rewrites the $n placeholders of a query
+	rebind func(query string) string
+
+	// args converts query arguments to what the driver stores
+	args func(args []interface{}) []interface{}
+
+	// jsonContains returns the condition matching rows whose JSON array
+	// column contains the string parameter
+	jsonContains func(column, param string) string
+
+	// isUniqueViolation reports whether err is a unique constraint violation
+	isUniqueViolation func(err error) bool
+
+	// migrationTable creates the schema_migrations table
+	migrationTable string
+
+	// migrationLock, when set, is executed at the start of each migration
+	// transaction to serialize replicas migrating at the same time
+	migrationLock string
+
+	migrations []migration
+}
+
+// SQLAdapter implements DatabaseAdapter on top of database/sql. The
+// dialect decides which database it talks to.
+type SQLAdapter struct {
+	db      *sql.DB
+	q       queryer
+	inTx    bool
+	dialect *sqlDialect
+	config  map[string]interface{}
+}
+
+// newSQLAdapter creates an adapter for dialect and connects it
+func newSQLAdapter(dialect *sqlDialect, dbType string, config map[string]interface{}) (*SQLAdapter, error) {
+	adapter := &SQLAdapter{
+		dialect: dialect,
+		config:  config,
+	}
+
+	if err := adapter.Connect(DatabaseConfig{
+		Type:   dbType,
+		Config: config,
+	}); err != nil {
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+// Connect opens the connection pool and brings the schema up to date
+func (s *SQLAdapter) Connect(config DatabaseConfig) error {
+	db, err := s.dialect.open(config.Config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.dialect.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to ping %s: %w", s.dialect.name, err)
+	}
+
+	if err := runMigrations(context.Background(), db, s.dialect); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to migrate %s schema: %w", s.dialect.name, err)
+	}
+
+	s.db = db
+	s.q = db
+
+	log.Printf("%s adapter connected successfully", s.dialect.name)
+	return nil
+}
+
+// Close closes the connection pool
+func (s *SQLAdapter) Close() error {
+	if s.inTx {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *SQLAdapter) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.q.ExecContext(ctx, s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+func (s *SQLAdapter) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.q.QueryContext(ctx, s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+func (s *SQLAdapter) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.q.QueryRowContext(ctx, s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+// Health checks the health of the connection
+func (s *SQLAdapter) Health() error {
+	return s.db.PingContext(context.Background())
+}
+
+// Post Operations
+
+const postColumns = `id, version, title, slug, previous_slugs, content, excerpt, author, status,
+	tags, categories, featured_image, image_alt, meta_title, meta_description,
+	reading_time, is_featured, view_count, created_at, updated_at, published_at, scheduled_at`
+
+func scanPost(row rowScanner) (*models.Post, error) {
+	var (
+		post                            models.Post
+		version                         int
+		previousSlugs, tags, categories []byte
+		publishedAt, scheduledAt        sql.NullTime
+	)
+
+	if err := row.Scan(
+		&post.ID, &version, &post.Title, &post.Slug, &previousSlugs, &post.Content, &post.Excerpt,
+		&post.Author, &post.Status, &tags, &categories, &post.FeaturedImage, &post.ImageAlt,
+		&post.MetaTitle, &post.MetaDesc, &post.ReadingTime, &post.IsFeatured, &post.ViewCount,
+		&post.CreatedAt, &post.UpdatedAt, &publishedAt, &scheduledAt,
+	); err != nil {
+		return nil, err
+	}
+
+	post.Rev = strconv.Itoa(version)
+	post.PreviousSlugs = decodeStrings(previousSlugs)
+	post.Tags = decodeStrings(tags)
+	post.Categories = decodeStrings(categories)
+	post.PublishedAt = nullTimePtr(publishedAt)
+	post.ScheduledAt = nullTimePtr(scheduledAt)
+
+	return &post, nil
+}
+
+func (s *SQLAdapter) queryPosts(query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+
+	return posts, rows.Err()
+}
+
+// CreatePost creates a new post
+func (s *SQLAdapter) CreatePost(post *models.Post) error {
+	ctx := context.Background()
+
+	if post.ID == "" {
+		post.ID = uuid.New().String()
+	}
+
+	post.CreatedAt = time.Now()
+	post.UpdatedAt = time.Now()
+
+	if post.Status == "published" && post.PublishedAt == nil {
+		now := time.Now()
+		post.PublishedAt = &now
+	}
+
+	_, err := s.exec(ctx, `INSERT INTO posts (`+postColumns+`)
+		VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`,
+		post.ID, post.Title, post.Slug, encodeStrings(post.PreviousSlugs), post.Content, post.Excerpt,
+		post.Author, post.Status, encodeStrings(post.Tags), encodeStrings(post.Categories),
+		post.FeaturedImage, post.ImageAlt, post.MetaTitle, post.MetaDesc, post.ReadingTime,
+		post.IsFeatured, post.ViewCount, post.CreatedAt, post.UpdatedAt, post.PublishedAt, post.ScheduledAt,
+	)
+	if err != nil {
+		// Post IDs are generated, so a clash is on the unique slug index
+		if s.dialect.isUniqueViolation(err) {
+			return fmt.Errorf("failed to create post: %w", ErrSlugTaken)
+		}
+		return fmt.Errorf("failed to create post: %w", err)
+	}
+
+	post.Rev = "1"
+	return nil
+}
+
+// GetPost retrieves a post by ID
+func (s *SQLAdapter) GetPost(id string) (*models.Post, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+postColumns+` FROM posts WHERE id = $1`, id)
+
+	post, err := scanPost(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get post: %w", ErrPostNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post: %w", err)
+	}
+
+	return post, nil
+}
+
+// GetPostBySlug retrieves a post by its current slug
+func (s *SQLAdapter) GetPostBySlug(slug string) (*models.Post, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+postColumns+` FROM posts WHERE slug = $1 AND slug <> ''`, slug)
+
+	post, err := scanPost(row)
+	if err != nil {
+		return nil, fmt.Errorf("post not found: %w", err)
+	}
+
+	return post, nil
+}
+
+// GetPostByPreviousSlug retrieves the post that used to be published under slug
+func (s *SQLAdapter) GetPostByPreviousSlug(slug string) (*models.Post, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+postColumns+` FROM posts WHERE `+s.dialect.jsonContains("previous_slugs", "$1")+` LIMIT 1`, slug)
+
+	post, err := scanPost(row)
+	if err != nil {
+		return nil, fmt.Errorf("post not found: %w", err)
+	}
+
+	return post, nil
+}
+
+// GetPosts retrieves posts with pagination, newest first
+func (s *SQLAdapter) GetPosts(limit, offset int) ([]models.Post, error) {
+	posts, err := s.queryPosts(
+		`SELECT `+postColumns+` FROM posts ORDER BY created_at DESC, id LIMIT $1 OFFSET $2`,
+		limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
+	}
+
+	return posts, nil
+}
+
+// GetScheduledPosts retrieves scheduled posts that are due at or before the given time
+func (s *SQLAdapter) GetScheduledPosts(before time.Time) ([]models.Post, error) {
+	posts, err := s.queryPosts(
+		`SELECT `+postColumns+` FROM posts
+		WHERE status = 'scheduled' AND scheduled_at <= $1
+		ORDER BY scheduled_at`,
+		before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled posts: %w", err)
+	}
+
+	return posts, nil
+}
+
+// UpdatePost updates a post. The publish time is set when a post is first
+// published without one.
+func (s *SQLAdapter) UpdatePost(id string, post *models.Post) error {
+	ctx := context.Background()
+
+	post.ID = id
+	post.UpdatedAt = time.Now()
+
+	var (
+		version     int
+		publishedAt sql.NullTime
+	)
+
+	err := s.queryRow(ctx, `UPDATE posts SET
+			version = version + 1,
+			title = $2, slug = $3, previous_slugs = $4, content = $5, excerpt = $6,
+			author = $7, status = $8, tags = $9, categories = $10, featured_image = $11,
+			image_alt = $12, meta_title = $13, meta_description = $14, reading_time = $15,
+			is_featured = $16, view_count = $17, updated_at = $18, scheduled_at = $20,
+			published_at = CASE
+				WHEN $8 = 'published' AND status <> 'published' AND $19::timestamptz IS NULL THEN $18
+				ELSE $19::timestamptz
+			END
+		WHERE id = $1
+		RETURNING version, created_at, published_at`,
+		id, post.Title, post.Slug, encodeStrings(post.PreviousSlugs), post.Content, post.Excerpt,
+		post.Author, post.Status, encodeStrings(post.Tags), encodeStrings(post.Categories),
+		post.FeaturedImage, post.ImageAlt, post.MetaTitle, post.MetaDesc, post.ReadingTime,
+		post.IsFeatured, post.ViewCount, post.UpdatedAt, post.PublishedAt, post.ScheduledAt,
+	).Scan(&version, &post.CreatedAt, &publishedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get existing post: %w", err)
+		}
+		if s.dialect.isUniqueViolation(err) {
+			return fmt.Errorf("failed to update post: %w", ErrSlugTaken)
+		}
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+
+	post.Rev = strconv.Itoa(version)
+	post.PublishedAt = nullTimePtr(publishedAt)
+	return nil
+}
+
+// DeletePost deletes a post
+func (s *SQLAdapter) DeletePost(id string) error {
+	result, err := s.exec(context.Background(), `DELETE FROM posts WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+
+	return expectAffected(result, "post")
+}
+
+// Post Revision Operations
+
+func scanPostRevision(row rowScanner) (*models.PostRevision, error) {
+	var (
+		revision      models.PostRevision
+		changedFields []byte
+		snapshot      []byte
+	)
+
+	if err := row.Scan(
+		&revision.PostID, &revision.Number, &revision.Author, &revision.CreatedAt,
+		&changedFields, &revision.RestoredFrom, &snapshot,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode revision snapshot: %w", err)
+	}
+
+	revision.ID = revisionDocID(revision.PostID, revision.Number)
+	revision.ChangedFields = decodeStrings(changedFields)
+
+	return &revision, nil
+}
+
+// CreatePostRevision stores a new revision, assigning the next revision
+// number for the post when none is set
+func (s *SQLAdapter) CreatePostRevision(revision *models.PostRevision) error {
+	ctx := context.Background()
+
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode revision snapshot: %w", err)
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		err = s.queryRow(ctx, `INSERT INTO post_revisions
+				(post_id, number, author, created_at, changed_fields, restored_from, snapshot)
+			SELECT $1::text, COALESCE(NULLIF($2::integer, 0), MAX(number) + 1, 1),
+				$3::text, $4::timestamptz, $5::jsonb, $6::integer, $7::jsonb
+			FROM post_revisions WHERE post_id = $1
+			RETURNING number`,
+			revision.PostID, revision.Number, revision.Author, revision.CreatedAt,
+			encodeStrings(revision.ChangedFields), revision.RestoredFrom, snapshot,
+		).Scan(&revision.Number)
+		if err == nil {
+			revision.ID = revisionDocID(revision.PostID, revision.Number)
+			return nil
+		}
+		if !s.dialect.isUniqueViolation(err) || revision.Number != 0 || s.inTx {
+			return fmt.Errorf("failed to create post revision: %w", err)
+		}
+
+		// Another save took this number, try the next one
+	}
+
+	return fmt.Errorf("failed to create post revision: too many conflicts")
+}
+
+// GetPostRevisions retrieves all revisions of a post, oldest first
+func (s *SQLAdapter) GetPostRevisions(postID string) ([]models.PostRevision, error) {
+	rows, err := s.query(context.Background(), `SELECT
+			post_id, number, author, created_at, changed_fields, restored_from, snapshot
+		FROM post_revisions WHERE post_id = $1 ORDER BY number`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.PostRevision
+	for rows.Next() {
+		revision, err := scanPostRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get post revisions: %w", err)
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get post revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetPostRevision retrieves a single revision of a post
+func (s *SQLAdapter) GetPostRevision(postID string, number int) (*models.PostRevision, error) {
+	row := s.queryRow(context.Background(), `SELECT
+			post_id, number, author, created_at, changed_fields, restored_from, snapshot
+		FROM post_revisions WHERE post_id = $1 AND number = $2`, postID, number)
+
+	revision, err := scanPostRevision(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get post revision: %w", err)
+	}
+
+	return revision, nil
+}
+
+// User Operations
+
+const userColumns = `id, version, username, email, email_verified, password_hash, role, active,
+	created_at, updated_at`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var (
+		user    models.User
+		version int
+	)
+
+	if err := row.Scan(
+		&user.ID, &version, &user.Username, &user.Email, &user.EmailVerified, &user.PasswordHash,
+		&user.Role, &user.Active, &user.CreatedAt, &user.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	user.Rev = strconv.Itoa(version)
+	return &user, nil
+}
+
+func (s *SQLAdapter) getUserWhere(condition string, value interface{}) (*models.User, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+userColumns+` FROM users WHERE `+condition, value)
+	return scanUser(row)
+}
+
+// CreateUser creates a new user
+func (s *SQLAdapter) CreateUser(user *models.User) error {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+
+	_, err := s.exec(context.Background(), `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		user.ID, user.Username, user.Email, user.EmailVerified, user.PasswordHash, user.Role, user.Active,
+		user.CreatedAt, user.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	user.Rev = "1"
+	return nil
+}
+
+// GetUser retrieves a user by ID
+func (s *SQLAdapter) GetUser(id string) (*models.User, error) {
+	user, err := s.getUserWhere("id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (s *SQLAdapter) GetUserByUsername(username string) (*models.User, error) {
+	user, err := s.getUserWhere("username = $1", username)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *SQLAdapter) GetUserByEmail(email string) (*models.User, error) {
+	user, err := s.getUserWhere("email = $1", email)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return user, nil
+}
+
+// queryUsers runs a user list query. Password hashes and revisions are
+// never returned in lists.
+func (s *SQLAdapter) queryUsers(query string, args ...interface{}) ([]models.User, error) {
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordHash = ""
+		user.Rev = ""
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUsers retrieves users with pagination
+func (s *SQLAdapter) GetUsers(limit, offset int) ([]models.User, error) {
+	users, err := s.queryUsers(
+		`SELECT `+userColumns+` FROM users ORDER BY created_at, id LIMIT $1 OFFSET $2`,
+		limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	return users, nil
+}
+
+// UpdateUser updates a user. Empty strings leave the stored value unchanged;
+// Active is always written so that it can be set to false. A new email
+// address is unverified.
+func (s *SQLAdapter) UpdateUser(id string, user *models.User) error {
+	row := s.queryRow(context.Background(), `UPDATE users SET
+			version = version + 1,
+			username = COALESCE(NULLIF($2, ''), username),
+			email_verified = CASE WHEN $3 = '' OR $3 = email THEN email_verified ELSE FALSE END,
+			email = COALESCE(NULLIF($3, ''), email),
+			role = COALESCE(NULLIF($4, ''), role),
+			password_hash = COALESCE(NULLIF($5, ''), password_hash),
+			active = $6,
+			updated_at = $7
+		WHERE id = $1
+		RETURNING `+userColumns,
+		id, user.Username, user.Email, user.Role, user.PasswordHash, user.Active, time.Now(),
+	)
+
+	updated, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get existing user: %w", err)
+		}
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	*user = *updated
+	// Don't return password hash and revision
+	user.PasswordHash = ""
+	user.Rev = ""
+
+	return nil
+}
+
+// MarkEmailVerified marks the email address of a user as verified, unless
+// it changed since the verification was requested
+func (s *SQLAdapter) MarkEmailVerified(id, email string) error {
+	result, err := s.exec(context.Background(), `UPDATE users SET
+			version = version + 1,
+			email_verified = TRUE,
+			updated_at = $3
+		WHERE id = $1 AND email = $2`,
+		id, email, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return expectAffected(result, "user")
+}
+
+// DeleteUser deletes a user
+func (s *SQLAdapter) DeleteUser(id string) error {
+	result, err := s.exec(context.Background(), `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return expectAffected(result, "user")
+}
+
+// Contact Operations
+
+const contactColumns = `id, version, name, email, company, phone, subject, message, status,
+	created_at, read_at, replied_at`
+
+func scanContact(row rowScanner) (*models.Contact, error) {
+	var (
+		contact           models.Contact
+		version           int
+		readAt, repliedAt sql.NullTime
+	)
+
+	if err := row.Scan(
+		&contact.ID, &version, &contact.Name, &contact.Email, &contact.Company, &contact.Phone,
+		&contact.Subject, &contact.Message, &contact.Status, &contact.CreatedAt, &readAt, &repliedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	contact.Rev = strconv.Itoa(version)
+	contact.ReadAt = nullTimePtr(readAt)
+	contact.RepliedAt = nullTimePtr(repliedAt)
+
+	return &contact, nil
+}
+
+// CreateContact creates a new contact
+func (s *SQLAdapter) CreateContact(contact *models.Contact) error {
+	if contact.ID == "" {
+		contact.ID = uuid.New().String()
+	}
+
+	contact.CreatedAt = time.Now()
+	contact.Status = "new"
+
+	_, err := s.exec(context.Background(), `INSERT INTO contacts (`+contactColumns+`)
+		VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		contact.ID, contact.Name, contact.Email, contact.Company, contact.Phone, contact.Subject,
+		contact.Message, contact.Status, contact.CreatedAt, contact.ReadAt, contact.RepliedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create contact: %w", err)
+	}
+
+	contact.Rev = "1"
+	return nil
+}
+
+// GetContact retrieves a contact by ID
+func (s *SQLAdapter) GetContact(id string) (*models.Contact, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+contactColumns+` FROM contacts WHERE id = $1`, id)
+
+	contact, err := scanContact(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	return contact, nil
+}
+
+func (s *SQLAdapter) queryContacts(query string, args ...interface{}) ([]models.Contact, error) {
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []models.Contact
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, *contact)
+	}
+
+	return contacts, rows.Err()
+}
+
+// GetContacts retrieves contacts with pagination, newest first
+func (s *SQLAdapter) GetContacts(limit, offset int) ([]models.Contact, error) {
+	contacts, err := s.queryContacts(
+		`SELECT `+contactColumns+` FROM contacts ORDER BY created_at DESC, id LIMIT $1 OFFSET $2`,
+		limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contacts: %w", err)
+	}
+
+	return contacts, nil
+}
+
+// UpdateContact updates a contact
+func (s *SQLAdapter) UpdateContact(id string, contact *models.Contact) error {
+	contact.ID = id
+
+	var version int
+	err := s.queryRow(context.Background(), `UPDATE contacts SET
+			version = version + 1,
+			name = $2, email = $3, company = $4, phone = $5, subject = $6, message = $7,
+			status = $8, read_at = $9, replied_at = $10
+		WHERE id = $1
+		RETURNING version, created_at`,
+		id, contact.Name, contact.Email, contact.Company, contact.Phone, contact.Subject,
+		contact.Message, contact.Status, contact.ReadAt, contact.RepliedAt,
+	).Scan(&version, &contact.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get existing contact: %w", err)
+		}
+		return fmt.Errorf("failed to update contact: %w", err)
+	}
+
+	contact.Rev = strconv.Itoa(version)
+	return nil
+}
+
+// DeleteContact deletes a contact
+func (s *SQLAdapter) DeleteContact(id string) error {
+	result, err := s.exec(context.Background(), `DELETE FROM contacts WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+
+	return expectAffected(result, "contact")
+}
+
+// Category Operations
+
+const categoryColumns = `id, version, name, slug, description, color, icon, post_count, created_at, updated_at`
+
+func scanCategory(row rowScanner) (*models.Category, error) {
+	var (
+		category models.Category
+		version  int
+	)
+
+	if err := row.Scan(
+		&category.ID, &version, &category.Name, &category.Slug, &category.Description,
+		&category.Color, &category.Icon, &category.PostCount, &category.CreatedAt, &category.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	category.Rev = strconv.Itoa(version)
+	return &category, nil
+}
+
+// CreateCategory creates a new category
+func (s *SQLAdapter) CreateCategory(category *models.Category) error {
+	if category.ID == "" {
+		category.ID = uuid.New().String()
+	}
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	_, err := s.exec(context.Background(), `INSERT INTO categories (`+categoryColumns+`)
+		VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		category.ID, category.Name, category.Slug, category.Description, category.Color,
+		category.Icon, category.PostCount, category.CreatedAt, category.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create category: %w", err)
+	}
+
+	category.Rev = "1"
+	return nil
+}
+
+// GetCategory retrieves a category by ID
+func (s *SQLAdapter) GetCategory(id string) (*models.Category, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+categoryColumns+` FROM categories WHERE id = $1`, id)
+
+	category, err := scanCategory(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	return category, nil
+}
+
+// GetCategoryBySlug retrieves a category by slug
+func (s *SQLAdapter) GetCategoryBySlug(slug string) (*models.Category, error) {
+	row := s.queryRow(context.Background(),
+		`SELECT `+categoryColumns+` FROM categories WHERE slug = $1`, slug)
+
+	category, err := scanCategory(row)
+	if err != nil {
+		return nil, fmt.Errorf("category not found: %w", err)
+	}
+
+	return category, nil
+}
+
+// GetCategories retrieves all categories ordered by name
+func (s *SQLAdapter) GetCategories() ([]models.Category, error) {
+	rows, err := s.query(context.Background(),
+		`SELECT `+categoryColumns+` FROM categories ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get categories: %w", err)
+		}
+		categories = append(categories, *category)
+	}
+
+	return categories, rows.Err()
+}
+
+// UpdateCategory updates a category
+func (s *SQLAdapter) UpdateCategory(id string, category *models.Category) error {
+	category.ID = id
+	category.UpdatedAt = time.Now()
+
+	var version int
+	err := s.queryRow(context.Background(), `UPDATE categories SET
+			version = version + 1,
+			name = $2, slug = $3, description = $4, color = $5, icon = $6,
+			post_count = $7, updated_at = $8
+		WHERE id = $1
+		RETURNING version, created_at`,
+		id, category.Name, category.Slug, category.Description, category.Color, category.Icon,
+		category.PostCount, category.UpdatedAt,
+	).Scan(&version, &category.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get existing category: %w", err)
+		}
+		return fmt.Errorf("failed to update category: %w", err)
+	}
+
+	category.Rev = strconv.Itoa(version)
+	return nil
+}
+
+// DeleteCategory deletes a category
+func (s *SQLAdapter) DeleteCategory(id string) error {
+	result, err := s.exec(context.Background(), `DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+
+	return expectAffected(result, "category")
+}
+
+// IncrementCategoryPostCount adjusts the post count of a category by delta.
+// The update is a single statement, so concurrent adjustments don't conflict.
+func (s *SQLAdapter) IncrementCategoryPostCount(slug string, delta int) error {
+	result, err := s.exec(context.Background(), `UPDATE categories SET
+			version = version + 1,
+			post_count = CASE WHEN post_count + $2 < 0 THEN 0 ELSE post_count + $2 END
+		WHERE slug = $1`, slug, delta)
+	if err != nil {
+		return fmt.Errorf("failed to update category post count: %w", err)
+	}
+
+	return expectAffected(result, "category")
+}
+
+// Transaction Support
+
+// BeginTransaction starts a transaction. Operations made through the
+// returned transaction's Database are committed or rolled back together.
+func (s *SQLAdapter) BeginTransaction() (Transaction, error) {
+	if s.inTx {
+		return nil, fmt.Errorf("transaction already in progress")
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return &SQLTransaction{
+		tx:  tx,
+		ctx: ctx,
+		adapter: &SQLAdapter{
+			db:      s.db,
+			q:       tx,
+			inTx:    true,
+			dialect: s.dialect,
+			config:  s.config,
+		},
+	}, nil
+}
+
+// SQLTransaction implements Transaction interface for SQLAdapter
+type SQLTransaction struct {
+	tx      *sql.Tx
+	ctx     context.Context
+	adapter *SQLAdapter
+}
+
+// Commit commits the transaction
+func (t *SQLTransaction) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback rolls back the transaction. Rolling back a committed transaction
+// is a no-op, so Rollback can always be deferred.
+func (t *SQLTransaction) Rollback() error {
+	if err := t.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// Context returns the transaction context
+func (t *SQLTransaction) Context() context.Context {
+	return t.ctx
+}
+
+// Database returns an adapter bound to the transaction
+func (t *SQLTransaction) Database() DatabaseAdapter {
+	return t.adapter
+}
+
+// Helpers
+
+// encodeStrings stores a string list as a JSON array, never null
+func encodeStrings(values []string) []byte {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return data
+}
+
+func decodeStrings(data []byte) []string {
+	var values []string
+	if len(data) > 0 {
+		json.Unmarshal(data, &values)
+	}
+	return values
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// expectAffected turns an update or delete that matched nothing into a not found error
+func expectAffected(result sql.Result, entity string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s not found", entity)
+	}
+	return nil
+}
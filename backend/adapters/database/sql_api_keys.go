@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// API Key Operations
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at,
+	last_used_ip, revoked_at, revoked_by, created_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key        models.APIKey
+		scopes     []byte
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	if err := row.Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.ExpiresAt,
+		&lastUsedAt, &key.LastUsedIP, &revokedAt, &key.RevokedBy, &key.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	key.Scopes = decodeStrings(scopes)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return &key, nil
+}
+
+func (s *SQLAdapter) getAPIKeyWhere(condition string, value interface{}) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.queryRow(context.Background(),
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+condition, value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// CreateAPIKey creates a new API key
+func (s *SQLAdapter) CreateAPIKey(key *models.APIKey) error {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	key.CreatedAt = time.Now()
+
+	_, err := s.exec(context.Background(), `INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, encodeStrings(key.Scopes), key.ExpiresAt,
+		key.LastUsedAt, key.LastUsedIP, key.RevokedAt, key.RevokedBy, key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *SQLAdapter) GetAPIKey(id string) (*models.APIKey, error) {
+	return s.getAPIKeyWhere("id = $1", id)
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its secret
+func (s *SQLAdapter) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	return s.getAPIKeyWhere("key_hash = $1", hash)
+}
+
+// ListAPIKeys lists the API keys of a user, or of every user when userID is
+// empty, newest first
+func (s *SQLAdapter) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC, id`
+	var args []interface{}
+	if userID != "" {
+		query = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC, id`
+		args = append(args, userID)
+	}
+
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records the use of an API key
+func (s *SQLAdapter) TouchAPIKey(id string, usedAt time.Time, ip string) error {
+	result, err := s.exec(context.Background(),
+		`UPDATE api_keys SET last_used_at = $2, last_used_ip = $3 WHERE id = $1`,
+		id, usedAt, ip,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return expectAffected(result, "API key")
+}
+
+// RevokeAPIKey revokes an API key. Revoking a revoked key keeps the
+// original revocation.
+func (s *SQLAdapter) RevokeAPIKey(id, revokedBy string) error {
+	result, err := s.exec(context.Background(), `UPDATE api_keys SET
+			revoked_at = COALESCE(revoked_at, $2),
+			revoked_by = CASE WHEN revoked_at IS NULL THEN $3 ELSE revoked_by END
+		WHERE id = $1`,
+		id, time.Now(), revokedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	return expectAffected(result, "API key")
+}
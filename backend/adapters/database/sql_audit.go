@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+// Audit Operations
+
+const auditColumns = `id, actor_id, actor, api_key_id, action, target_type, target_id, changes,
+	ip, request_id, created_at`
+
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	var (
+		event   models.AuditEvent
+		changes []byte
+	)
+
+	if err := row.Scan(
+		&event.ID, &event.ActorID, &event.Actor, &event.APIKeyID, &event.Action, &event.TargetType,
+		&event.TargetID, &changes, &event.IP, &event.RequestID, &event.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if len(changes) > 0 {
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode audit changes: %w", err)
+		}
+	}
+	return &event, nil
+}
+
+// encodeAuditChanges stores the changes of an event as a JSON object, never
+// null
+func encodeAuditChanges(changes map[string]models.AuditChange) ([]byte, error) {
+	if changes == nil {
+		changes = map[string]models.AuditChange{}
+	}
+	return json.Marshal(changes)
+}
+
+// CreateAuditEvent appends an event to the audit log
+func (s *SQLAdapter) CreateAuditEvent(event *models.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	changes, err := encodeAuditChanges(event.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+
+	_, err = s.exec(context.Background(), `INSERT INTO audit_events (`+auditColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		event.ID, event.ActorID, event.Actor, event.APIKeyID, event.Action, event.TargetType,
+		event.TargetID, changes, event.IP, event.RequestID, event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLAdapter) queryAuditEvents(query string, args ...interface{}) ([]models.AuditEvent, error) {
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, rows.Err()
+}
+
+func auditWhere(query models.AuditQuery) *sqlWhere {
+	where := &sqlWhere{}
+
+	if query.Actor != "" {
+		where.equal("actor", query.Actor)
+	}
+	if query.Action != "" {
+		where.equal("action", query.Action)
+	}
+	if query.TargetType != "" {
+		where.equal("target_type", query.TargetType)
+	}
+	if query.TargetID != "" {
+		where.equal("target_id", query.TargetID)
+	}
+	where.timeRange("created_at", query.Created)
+
+	return where
+}
+
+// ListAuditEvents retrieves one page of audit events matching the query
+func (s *SQLAdapter) ListAuditEvents(query models.AuditQuery) (*models.AuditList, error) {
+	sort, cursor, limit, offset, err := listPage(query.ListOptions, models.AuditSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	where := auditWhere(query)
+	if err := where.after(sort, query.Desc, cursor); err != nil {
+		return nil, err
+	}
+
+	events, err := s.queryAuditEvents(
+		`SELECT `+auditColumns+` FROM audit_events`+where.String()+orderBy(sort, query.Desc, limit, offset),
+		where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	list := &models.AuditList{Events: events}
+	if len(events) > limit {
+		list.Events = events[:limit]
+		last := &list.Events[limit-1]
+		list.NextCursor = keysetCursor(sort, query.Desc, last.CreatedAt, last.ID)
+	}
+
+	return list, nil
+}
+
+// CountAuditEvents counts the audit events matching the query
+func (s *SQLAdapter) CountAuditEvents(query models.AuditQuery) (int, error) {
+	if _, err := listSort(query.ListOptions, models.AuditSortFields); err != nil {
+		return 0, err
+	}
+
+	return s.count("audit_events", auditWhere(query))
+}
+
+// DeleteAuditEventsBefore deletes the audit events created before a time
+// and returns how many were deleted
+func (s *SQLAdapter) DeleteAuditEventsBefore(before time.Time) (int, error) {
+	result, err := s.exec(context.Background(), `DELETE FROM audit_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audit events: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audit events: %w", err)
+	}
+	return int(deleted), nil
+}
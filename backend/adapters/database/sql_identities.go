@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// Identity Operations
+
+// GetUserIdentity retrieves a linked identity, or nil when the identity is
+// not linked to a user
+func (s *SQLAdapter) GetUserIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	identity := models.UserIdentity{Issuer: issuer, Subject: subject}
+	err := s.queryRow(context.Background(),
+		`SELECT user_id, created_at FROM user_identities WHERE issuer = $1 AND subject = $2`,
+		issuer, subject,
+	).Scan(&identity.UserID, &identity.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// LinkUserIdentity links an identity to a user. Identities already linked
+// to a user are not relinked.
+func (s *SQLAdapter) LinkUserIdentity(identity *models.UserIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	_, err := s.exec(context.Background(), `INSERT INTO user_identities (issuer, subject, user_id, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		identity.Issuer, identity.Subject, identity.UserID, identity.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return nil
+}
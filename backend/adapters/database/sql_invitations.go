@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// Invitation Operations
+
+const invitationColumns = `user_id, email, token_hash, invited_by, expires_at, sent_at, created_at`
+
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := row.Scan(
+		&invitation.UserID, &invitation.Email, &invitation.TokenHash, &invitation.InvitedBy,
+		&invitation.ExpiresAt, &invitation.SentAt, &invitation.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetInvitation retrieves the invitation of a user, or nil when the user
+// has none
+func (s *SQLAdapter) GetInvitation(userID string) (*models.Invitation, error) {
+	invitation, err := scanInvitation(s.queryRow(context.Background(),
+		`SELECT `+invitationColumns+` FROM invitations WHERE user_id = $1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// GetInvitationByTokenHash retrieves an invitation by the hash of the token
+// of its link
+func (s *SQLAdapter) GetInvitationByTokenHash(hash string) (*models.Invitation, error) {
+	invitation, err := scanInvitation(s.queryRow(context.Background(),
+		`SELECT `+invitationColumns+` FROM invitations WHERE token_hash = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// ListInvitations lists the invitations, newest first
+func (s *SQLAdapter) ListInvitations() ([]models.Invitation, error) {
+	rows, err := s.query(context.Background(),
+		`SELECT `+invitationColumns+` FROM invitations ORDER BY created_at DESC, user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list invitations: %w", err)
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// SaveInvitation creates or replaces the invitation of a user
+func (s *SQLAdapter) SaveInvitation(invitation *models.Invitation) error {
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	_, err := s.exec(context.Background(), `INSERT INTO invitations (`+invitationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email = excluded.email,
+			token_hash = excluded.token_hash,
+			invited_by = excluded.invited_by,
+			expires_at = excluded.expires_at,
+			sent_at = excluded.sent_at,
+			created_at = excluded.created_at`,
+		invitation.UserID, invitation.Email, invitation.TokenHash, invitation.InvitedBy,
+		invitation.ExpiresAt, invitation.SentAt, invitation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteInvitation deletes the invitation of a user. Deleting an invitation
+// that doesn't exist is not an error.
+func (s *SQLAdapter) DeleteInvitation(userID string) error {
+	if _, err := s.exec(context.Background(), `DELETE FROM invitations WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+	return nil
+}
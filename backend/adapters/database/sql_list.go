@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"webenable-cms-backend/models"
+)
+
+// sqlWhere collects the conditions and arguments of a list query. Arguments
+// are numbered in Postgres style and rebound by the dialect.
+type sqlWhere struct {
+	conditions []string
+	args       []interface{}
+}
+
+// param adds an argument and returns its placeholder
+func (w *sqlWhere) param(value interface{}) string {
+	w.args = append(w.args, value)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *sqlWhere) add(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *sqlWhere) equal(column string, value interface{}) {
+	w.add(column + " = " + w.param(value))
+}
+
+func (w *sqlWhere) timeRange(column string, r models.TimeRange) {
+	if r.From != nil {
+		w.add(column + " >= " + w.param(*r.From))
+	}
+	if r.To != nil {
+		w.add(column + " <= " + w.param(*r.To))
+	}
+}
+
+// after restricts the list to rows that sort after the cursor. Rows with the
+// same sort value are ordered by id.
+func (w *sqlWhere) after(column string, desc bool, cursor *listCursor) error {
+	if cursor == nil {
+		return nil
+	}
+
+	value, err := cursor.sortValue()
+	if err != nil {
+		return err
+	}
+
+	op := ">"
+	if desc {
+		op = "<"
+	}
+
+	v := w.param(value)
+	w.add(fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))", column, op, v, column, v, op, w.param(cursor.ID)))
+	return nil
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+// orderBy builds the ORDER BY and LIMIT clauses of a keyset page. One extra
+// row is fetched to find out whether another page follows.
+func orderBy(column string, desc bool, limit, offset int) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %d OFFSET %d", column, dir, dir, limit+1, offset)
+}
+
+// listPage decodes the cursor of a list query and works out its page
+func listPage(options models.ListOptions, allowed []string) (sort string, cursor *listCursor, limit, offset int, err error) {
+	sort, err = listSort(options, allowed)
+	if err != nil {
+		return "", nil, 0, 0, err
+	}
+
+	cursor, err = decodeCursor(options.Cursor, sort, options.Desc)
+	if err != nil {
+		return "", nil, 0, 0, err
+	}
+
+	offset = options.Offset
+	if cursor != nil || offset < 0 {
+		offset = 0
+	}
+
+	return sort, cursor, listLimit(options), offset, nil
+}
+
+func (s *SQLAdapter) postWhere(query models.PostQuery, sort string) *sqlWhere {
+	where := &sqlWhere{}
+
+	if query.Status != "" {
+		where.equal("status", query.Status)
+	}
+	if query.Author != "" {
+		where.equal("author", query.Author)
+	}
+	if query.Featured != nil {
+		where.equal("is_featured", *query.Featured)
+	}
+	if query.Tag != "" {
+		where.add(s.dialect.jsonContains("tags", where.param(query.Tag)))
+	}
+	if query.Category != "" {
+		where.add(s.dialect.jsonContains("categories", where.param(query.Category)))
+	}
+	where.timeRange("created_at", query.Created)
+	where.timeRange("published_at", query.Published)
+
+	if sort == "published_at" {
+		where.add("published_at IS NOT NULL")
+	}
+
+	return where
+}
+
+// ListPosts retrieves one page of posts matching the query
+func (s *SQLAdapter) ListPosts(query models.PostQuery) (*models.PostList, error) {
+	sort, cursor, limit, offset, err := listPage(query.ListOptions, models.PostSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	where := s.postWhere(query, sort)
+	if err := where.after(sort, query.Desc, cursor); err != nil {
+		return nil, err
+	}
+
+	posts, err := s.queryPosts(
+		`SELECT `+postColumns+` FROM posts`+where.String()+orderBy(sort, query.Desc, limit, offset),
+		where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list posts: %w", err)
+	}
+
+	list := &models.PostList{Posts: posts}
+	if len(posts) > limit {
+		list.Posts = posts[:limit]
+		last := &list.Posts[limit-1]
+		list.NextCursor = keysetCursor(sort, query.Desc, postSortValue(last, sort), last.ID)
+	}
+
+	return list, nil
+}
+
+// CountPosts counts the posts matching the query
+func (s *SQLAdapter) CountPosts(query models.PostQuery) (int, error) {
+	sort, err := listSort(query.ListOptions, models.PostSortFields)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.count("posts", s.postWhere(query, sort))
+}
+
+func userWhere(query models.UserQuery) *sqlWhere {
+	where := &sqlWhere{}
+
+	if query.Role != "" {
+		where.equal("role", query.Role)
+	}
+	if query.Active != nil {
+		where.equal("active", *query.Active)
+	}
+	where.timeRange("created_at", query.Created)
+
+	return where
+}
+
+// ListUsers retrieves one page of users matching the query
+func (s *SQLAdapter) ListUsers(query models.UserQuery) (*models.UserList, error) {
+	sort, cursor, limit, offset, err := listPage(query.ListOptions, models.UserSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	where := userWhere(query)
+	if err := where.after(sort, query.Desc, cursor); err != nil {
+		return nil, err
+	}
+
+	users, err := s.queryUsers(
+		`SELECT `+userColumns+` FROM users`+where.String()+orderBy(sort, query.Desc, limit, offset),
+		where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	list := &models.UserList{Users: users}
+	if len(users) > limit {
+		list.Users = users[:limit]
+		last := &list.Users[limit-1]
+		list.NextCursor = keysetCursor(sort, query.Desc, userSortValue(last, sort), last.ID)
+	}
+
+	return list, nil
+}
+
+// CountUsers counts the users matching the query
+func (s *SQLAdapter) CountUsers(query models.UserQuery) (int, error) {
+	if _, err := listSort(query.ListOptions, models.UserSortFields); err != nil {
+		return 0, err
+	}
+
+	return s.count("users", userWhere(query))
+}
+
+func contactWhere(query models.ContactQuery) *sqlWhere {
+	where := &sqlWhere{}
+
+	if query.Status != "" {
+		where.equal("status", query.Status)
+	}
+	where.timeRange("created_at", query.Created)
+
+	return where
+}
+
+// ListContacts retrieves one page of contacts matching the query
+func (s *SQLAdapter) ListContacts(query models.ContactQuery) (*models.ContactList, error) {
+	sort, cursor, limit, offset, err := listPage(query.ListOptions, models.ContactSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	where := contactWhere(query)
+	if err := where.after(sort, query.Desc, cursor); err != nil {
+		return nil, err
+	}
+
+	contacts, err := s.queryContacts(
+		`SELECT `+contactColumns+` FROM contacts`+where.String()+orderBy(sort, query.Desc, limit, offset),
+		where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contacts: %w", err)
+	}
+
+	list := &models.ContactList{Contacts: contacts}
+	if len(contacts) > limit {
+		list.Contacts = contacts[:limit]
+		last := &list.Contacts[limit-1]
+		list.NextCursor = keysetCursor(sort, query.Desc, last.CreatedAt, last.ID)
+	}
+
+	return list, nil
+}
+
+// CountContacts counts the contacts matching the query
+func (s *SQLAdapter) CountContacts(query models.ContactQuery) (int, error) {
+	if _, err := listSort(query.ListOptions, models.ContactSortFields); err != nil {
+		return 0, err
+	}
+
+	return s.count("contacts", contactWhere(query))
+}
+
+func (s *SQLAdapter) count(table string, where *sqlWhere) (int, error) {
+	var count int
+	if err := s.queryRow(context.Background(),
+		`SELECT COUNT(*) FROM `+table+where.String(), where.args...,
+	).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"webenable-cms-backend/models"
+)
+
+const mediaColumns = `id, version, filename, path, url, mime_type, size, sha256, width, height,
+	alt_text, uploaded_by, variants, created_at, updated_at`
+
+func scanMedia(row rowScanner) (*models.Media, error) {
+	var (
+		media    models.Media
+		version  int
+		variants []byte
+	)
+
+	if err := row.Scan(
+		&media.ID, &version, &media.Filename, &media.Path, &media.URL, &media.MimeType,
+		&media.Size, &media.SHA256, &media.Width, &media.Height, &media.AltText, &media.UploadedBy,
+		&variants, &media.CreatedAt, &media.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if len(variants) > 0 {
+		if err := json.Unmarshal(variants, &media.Variants); err != nil {
+			return nil, fmt.Errorf("failed to decode media variants: %w", err)
+		}
+	}
+
+	media.Rev = strconv.Itoa(version)
+	media.UsedBy = []string{}
+	return &media, nil
+}
+
+// queryMedia runs a media query and loads the usage of every asset returned
+func (s *SQLAdapter) queryMedia(query string, args ...interface{}) ([]models.Media, error) {
+	rows, err := s.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Media
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *media)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadMediaUsage(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// loadMediaUsage fills UsedBy of each asset from the media_usage table
+func (s *SQLAdapter) loadMediaUsage(list []models.Media) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	where := &sqlWhere{}
+	index := make(map[string]int, len(list))
+	placeholders := make([]string, len(list))
+	for i := range list {
+		index[list[i].ID] = i
+		placeholders[i] = where.param(list[i].ID)
+	}
+
+	rows, err := s.query(context.Background(),
+		`SELECT media_id, post_id FROM media_usage WHERE media_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY media_id, post_id`, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaID, postID string
+		if err := rows.Scan(&mediaID, &postID); err != nil {
+			return err
+		}
+		if i, ok := index[mediaID]; ok {
+			list[i].UsedBy = append(list[i].UsedBy, postID)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *SQLAdapter) getMediaWhere(condition string, value interface{}) (*models.Media, error) {
+	list, err := s.queryMedia(`SELECT `+mediaColumns+` FROM media WHERE `+condition, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("media not found")
+	}
+	return &list[0], nil
+}
+
+// CreateMedia creates a new media asset
+func (s *SQLAdapter) CreateMedia(media *models.Media) error {
+	if media.ID == "" {
+		media.ID = uuid.New().String()
+	}
+
+	media.CreatedAt = time.Now()
+	media.UpdatedAt = time.Now()
+
+	_, err := s.exec(context.Background(), `INSERT INTO media (`+mediaColumns+`)
+		VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		media.ID, media.Filename, media.Path, media.URL, media.MimeType, media.Size, media.SHA256,
+		media.Width, media.Height, media.AltText, media.UploadedBy, encodeVariants(media.Variants),
+		media.CreatedAt, media.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create media: %w", err)
+	}
+
+	media.Rev = "1"
+	media.UsedBy = []string{}
+	return nil
+}
+
+// GetMedia retrieves a media asset by ID
+func (s *SQLAdapter) GetMedia(id string) (*models.Media, error) {
+	media, err := s.getMediaWhere("id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	return media, nil
+}
+
+// GetMediaByURL retrieves the media asset served at url, the oldest one
+// when deduplicated uploads share it
+func (s *SQLAdapter) GetMediaByURL(url string) (*models.Media, error) {
+	media, err := s.getMediaWhere("url = $1 ORDER BY created_at, id LIMIT 1", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	return media, nil
+}
+
+// encodeVariants stores the variants of an asset as a JSON array, never null
+func encodeVariants(variants []models.MediaVariant) []byte {
+	if variants == nil {
+		variants = []models.MediaVariant{}
+	}
+	data, _ := json.Marshal(variants)
+	return data
+}
+
+// likeEscaper escapes the LIKE wildcards, for use with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func mediaWhere(query models.MediaQuery) *sqlWhere {
+	where := &sqlWhere{}
+
+	if query.Search != "" {
+		pattern := where.param("%" + likeEscaper.Replace(strings.ToLower(query.Search)) + "%")
+		where.add(`(LOWER(filename) LIKE ` + pattern + ` ESCAPE '\' OR LOWER(alt_text) LIKE ` + pattern + ` ESCAPE '\')`)
+	}
+	if query.MimeType != "" {
+		if strings.HasSuffix(query.MimeType, "/") {
+			where.add(`mime_type LIKE ` + where.param(likeEscaper.Replace(query.MimeType)+"%") + ` ESCAPE '\'`)
+		} else {
+			where.equal("mime_type", query.MimeType)
+		}
+	}
+	if query.UploadedBy != "" {
+		where.equal("uploaded_by", query.UploadedBy)
+	}
+
+	return where
+}
+
+// ListMedia retrieves one page of media matching the query
+func (s *SQLAdapter) ListMedia(query models.MediaQuery) (*models.MediaList, error) {
+	sort, cursor, limit, offset, err := listPage(query.ListOptions, models.MediaSortFields)
+	if err != nil {
+		return nil, err
+	}
+
+	where := mediaWhere(query)
+	if err := where.after(sort, query.Desc, cursor); err != nil {
+		return nil, err
+	}
+
+	media, err := s.queryMedia(
+		`SELECT `+mediaColumns+` FROM media`+where.String()+orderBy(sort, query.Desc, limit, offset),
+		where.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media: %w", err)
+	}
+
+	list := &models.MediaList{Media: media}
+	if len(media) > limit {
+		list.Media = media[:limit]
+		last := &list.Media[limit-1]
+		list.NextCursor = keysetCursor(sort, query.Desc, mediaSortValue(last, sort), last.ID)
+	}
+
+	return list, nil
+}
+
+// CountMedia counts the media matching the query
+func (s *SQLAdapter) CountMedia(query models.MediaQuery) (int, error) {
+	if _, err := listSort(query.ListOptions, models.MediaSortFields); err != nil {
+		return 0, err
+	}
+
+	return s.count("media", mediaWhere(query))
+}
+
+// UpdateMedia updates the metadata of a media asset
+func (s *SQLAdapter) UpdateMedia(id string, media *models.Media) error {
+	media.ID = id
+	media.UpdatedAt = time.Now()
+
+	var version int
+	err := s.queryRow(context.Background(), `UPDATE media SET
+			version = version + 1,
+			filename = $2, path = $3, url = $4, mime_type = $5, size = $6, sha256 = $7,
+			width = $8, height = $9, alt_text = $10, variants = $11, updated_at = $12
+		WHERE id = $1
+		RETURNING version, uploaded_by, created_at`,
+		id, media.Filename, media.Path, media.URL, media.MimeType, media.Size, media.SHA256,
+		media.Width, media.Height, media.AltText, encodeVariants(media.Variants), media.UpdatedAt,
+	).Scan(&version, &media.UploadedBy, &media.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get existing media: %w", err)
+		}
+		return fmt.Errorf("failed to update media: %w", err)
+	}
+
+	media.Rev = strconv.Itoa(version)
+	return nil
+}
+
+// DeleteMedia deletes a media asset and its usage records
+func (s *SQLAdapter) DeleteMedia(id string) error {
+	result, err := s.exec(context.Background(), `DELETE FROM media WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete media: %w", err)
+	}
+
+	return expectAffected(result, "media")
+}
+
+// AddMediaUsage records that a post references a media asset
+func (s *SQLAdapter) AddMediaUsage(id, postID string) error {
+	result, err := s.exec(context.Background(), `INSERT INTO media_usage (media_id, post_id)
+		SELECT id, $2::text FROM media WHERE id = $1
+		ON CONFLICT (media_id, post_id) DO NOTHING`, id, postID)
+	if err != nil {
+		return fmt.Errorf("failed to add media usage: %w", err)
+	}
+
+	// A repeated insert affects no rows either, so only report missing media
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if _, err := s.GetMedia(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMediaUsage removes the record that a post references a media asset
+func (s *SQLAdapter) RemoveMediaUsage(id, postID string) error {
+	if _, err := s.exec(context.Background(),
+		`DELETE FROM media_usage WHERE media_id = $1 AND post_id = $2`, id, postID,
+	); err != nil {
+		return fmt.Errorf("failed to remove media usage: %w", err)
+	}
+	return nil
+}
+
+// GetMediaUsedBy retrieves the media assets a post references
+func (s *SQLAdapter) GetMediaUsedBy(postID string) ([]models.Media, error) {
+	media, err := s.queryMedia(`SELECT `+mediaColumns+` FROM media
+		WHERE id IN (SELECT media_id FROM media_usage WHERE post_id = $1)
+		ORDER BY created_at, id`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media used by post: %w", err)
+	}
+	return media, nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Password History Operations
+
+// GetPasswordHistory retrieves the hashes of the previous passwords of a
+// user, newest first
+func (s *SQLAdapter) GetPasswordHistory(userID string) ([]string, error) {
+	var hashes []byte
+	err := s.queryRow(context.Background(), `SELECT hashes FROM password_history WHERE user_id = $1`, userID).Scan(&hashes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	return decodeStrings(hashes), nil
+}
+
+// SavePasswordHistory replaces the password history of a user
+func (s *SQLAdapter) SavePasswordHistory(userID string, hashes []string) error {
+	_, err := s.exec(context.Background(), `INSERT INTO password_history (user_id, hashes, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			hashes = excluded.hashes,
+			updated_at = excluded.updated_at`,
+		userID, encodeStrings(hashes), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+	return nil
+}
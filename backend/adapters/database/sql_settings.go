@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// Setting Operations
+
+// GetSetting retrieves a setting, or nil when it was never saved
+func (s *SQLAdapter) GetSetting(key string) (*models.Setting, error) {
+	var setting models.Setting
+
+	err := s.queryRow(context.Background(),
+		`SELECT key, value, updated_by, updated_at FROM settings WHERE key = $1`, key,
+	).Scan(&setting.Key, &setting.Value, &setting.UpdatedBy, &setting.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get setting: %w", err)
+	}
+
+	return &setting, nil
+}
+
+// SaveSetting creates or replaces a setting
+func (s *SQLAdapter) SaveSetting(setting *models.Setting) error {
+	setting.UpdatedAt = time.Now()
+
+	_, err := s.exec(context.Background(), `INSERT INTO settings (key, value, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET
+			value = excluded.value,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at`,
+		setting.Key, setting.Value, setting.UpdatedBy, setting.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting: %w", err)
+	}
+
+	return nil
+}
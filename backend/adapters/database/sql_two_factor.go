@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// Two-factor Operations
+
+// GetTwoFactor retrieves the two-factor configuration of a user, or nil
+// when the user has none
+func (s *SQLAdapter) GetTwoFactor(userID string) (*models.TwoFactor, error) {
+	var (
+		twoFactor     models.TwoFactor
+		recoveryCodes []byte
+		enabledAt     sql.NullTime
+	)
+
+	err := s.queryRow(context.Background(), `SELECT user_id, secret, enabled, recovery_codes,
+			last_used_step, enabled_at, created_at, updated_at
+		FROM user_two_factor WHERE user_id = $1`, userID,
+	).Scan(
+		&twoFactor.UserID, &twoFactor.Secret, &twoFactor.Enabled, &recoveryCodes,
+		&twoFactor.LastUsedStep, &enabledAt, &twoFactor.CreatedAt, &twoFactor.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor configuration: %w", err)
+	}
+
+	twoFactor.RecoveryCodes = decodeStrings(recoveryCodes)
+	twoFactor.EnabledAt = nullTimePtr(enabledAt)
+	return &twoFactor, nil
+}
+
+// SaveTwoFactor creates or replaces the two-factor configuration of a user
+func (s *SQLAdapter) SaveTwoFactor(twoFactor *models.TwoFactor) error {
+	now := time.Now()
+	if twoFactor.CreatedAt.IsZero() {
+		twoFactor.CreatedAt = now
+	}
+	twoFactor.UpdatedAt = now
+
+	_, err := s.exec(context.Background(), `INSERT INTO user_two_factor (user_id, secret, enabled,
+			recovery_codes, last_used_step, enabled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = excluded.secret,
+			enabled = excluded.enabled,
+			recovery_codes = excluded.recovery_codes,
+			last_used_step = excluded.last_used_step,
+			enabled_at = excluded.enabled_at,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at`,
+		twoFactor.UserID, twoFactor.Secret, twoFactor.Enabled, encodeStrings(twoFactor.RecoveryCodes),
+		twoFactor.LastUsedStep, twoFactor.EnabledAt, twoFactor.CreatedAt, twoFactor.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save two-factor configuration: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTwoFactor deletes the two-factor configuration of a user. Deleting
+// a configuration that doesn't exist is not an error.
+func (s *SQLAdapter) DeleteTwoFactor(userID string) error {
+	if _, err := s.exec(context.Background(), `DELETE FROM user_two_factor WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete two-factor configuration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlitePlaceholder matches a Postgres placeholder with an optional cast
+var sqlitePlaceholder = regexp.MustCompile(`\$(\d+)(::\w+)?`)
+
+// sqliteDialect runs the shared queries on an embedded SQLite database
+// through the pure-Go modernc driver, so no cgo toolchain is needed
+var sqliteDialect = &sqlDialect{
+	name:              "SQLite",
+	open:              openSQLite,
+	rebind:            rebindSQLite,
+	args:              sqliteArgs,
+	jsonContains:      sqliteJSONContains,
+	isUniqueViolation: isSQLiteUniqueViolation,
+	migrationTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`,
+	migrations: sqliteMigrations,
+}
+
+// NewSQLiteAdapter creates a new SQLite adapter. The database file is
+// taken from the "path" setting and created if it doesn't exist.
+func NewSQLiteAdapter(config map[string]interface{}) (DatabaseAdapter, error) {
+	adapter, err := newSQLAdapter(sqliteDialect, DatabaseTypeSQLite, config)
+	if err != nil {
+		return nil, err
+	}
+	return adapter, nil
+}
+
+// sqlitePath returns the configured database file, ":memory:" included
+func sqlitePath(config map[string]interface{}) string {
+	if path, ok := config["path"].(string); ok && path != "" {
+		return path
+	}
+	return "./data/cms.db"
+}
+
+func openSQLite(config map[string]interface{}) (*sql.DB, error) {
+	path := sqlitePath(config)
+
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	// Writers take the lock up front so concurrent transactions wait on
+	// busy_timeout instead of failing when they upgrade from a read
+	params := url.Values{
+		"_pragma": {
+			"busy_timeout(5000)",
+			"journal_mode(WAL)",
+			"foreign_keys(1)",
+		},
+		"_txlock":      {"immediate"},
+		"_time_format": {"sqlite"},
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to :memory: is a separate database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
+
+// rebindSQLite turns $n placeholders into ?n and drops Postgres casts
+func rebindSQLite(query string) string {
+	return sqlitePlaceholder.ReplaceAllString(query, "?$1")
+}
+
+// sqliteArgs stores times in UTC so that they compare as text, and JSON
+// documents as text so that the json functions can read them
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case time.Time:
+			converted[i] = value.UTC()
+		case *time.Time:
+			if value == nil {
+				converted[i] = nil
+			} else {
+				converted[i] = value.UTC()
+			}
+		case []byte:
+			converted[i] = string(value)
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+func sqliteJSONContains(column, param string) string {
+	return "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE value = " + param + ")"
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteAdapter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "cms.db")
+
+	db, err := NewSQLiteAdapter(map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	defer db.Close()
+
+	testAdapterBehavior(t, db, behaviorOptions{transactional: true})
+
+	// Reopening an existing database must not re-run migrations
+	reopened, err := NewSQLiteAdapter(map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+}
+
+func TestRebindSQLite(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT * FROM posts WHERE id = $1", "SELECT * FROM posts WHERE id = ?1"},
+		{"SELECT $1::text, $12::timestamptz", "SELECT ?1, ?12"},
+		{"WHERE status = 'draft'", "WHERE status = 'draft'"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rebindSQLite(tt.query))
+	}
+}
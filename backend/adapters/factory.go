@@ -28,7 +28,9 @@ func (f *AdapterFactory) CreateDatabaseAdapter() (database.DatabaseAdapter, erro
 	case database.DatabaseTypeCouchDB:
 		return database.NewCouchDBAdapter(f.config.GetDatabaseConfig())
 	case database.DatabaseTypePostgres:
-		return nil, fmt.Errorf("postgres adapter not implemented yet")
+		return database.NewPostgresAdapter(f.config.GetDatabaseConfig())
+	case database.DatabaseTypeSQLite:
+		return database.NewSQLiteAdapter(f.config.GetDatabaseConfig())
 	case database.DatabaseTypeMongoDB:
 		return nil, fmt.Errorf("mongodb adapter not implemented yet")
 	default:
@@ -46,19 +48,20 @@ func (f *AdapterFactory) CreateCacheAdapter() (cache.CacheAdapter, error) {
 	case cache.CacheTypeMemcached:
 		return nil, fmt.Errorf("memcached adapter not implemented yet")
 	case cache.CacheTypeInMemory:
-		return nil, fmt.Errorf("in-memory adapter not implemented yet")
+		return cache.NewMemoryAdapter(f.config.GetCacheConfig())
 	default:
 		return nil, fmt.Errorf("unsupported cache adapter type: %s", f.config.Cache.Type)
 	}
 }
 
-// CreateAuthAdapter creates an auth adapter based on configuration
-func (f *AdapterFactory) CreateAuthAdapter() (auth.AuthAdapter, error) {
+// CreateAuthAdapter creates an auth adapter based on configuration, keeping
+// refresh tokens and revocations in store
+func (f *AdapterFactory) CreateAuthAdapter(store cache.CacheAdapter) (auth.AuthAdapter, error) {
 	switch f.config.Auth.Type {
 	case auth.AuthTypeJWT:
-		return auth.NewJWTAdapter(f.config.GetAuthConfig())
+		return auth.NewJWTAdapter(f.config.GetAuthConfig(), store)
 	case auth.AuthTypeOAuth2:
-		return nil, fmt.Errorf("oauth2 adapter not implemented yet")
+		return auth.NewOIDCAdapter(f.config.GetAuthConfig(), store)
 	case auth.AuthTypeSAML:
 		return nil, fmt.Errorf("saml adapter not implemented yet")
 	case auth.AuthTypeBasic:
@@ -86,19 +89,38 @@ func (f *AdapterFactory) CreateEmailAdapter() (email.EmailAdapter, error) {
 	}
 }
 
-// CreateStorageAdapter creates a storage adapter based on configuration
+// CreateStorageAdapter creates a storage adapter based on configuration,
+// wrapped to store identical uploads once and to generate the configured
+// image variants of uploads
 func (f *AdapterFactory) CreateStorageAdapter() (storage.StorageAdapter, error) {
+	adapter, err := f.createStorageBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	spec, _ := f.config.Storage.Config["image_variants"].(string)
+	if spec == "" {
+		spec = storage.DefaultImageVariants
+	}
+	variants, err := storage.ParseImageVariants(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.NewImageAdapter(storage.NewDedupAdapter(adapter), variants), nil
+}
+
+// createStorageBackend creates the adapter that stores files
+func (f *AdapterFactory) createStorageBackend() (storage.StorageAdapter, error) {
 	switch f.config.Storage.Type {
 	case storage.StorageTypeLocal:
 		return storage.NewLocalAdapter(f.config.GetStorageConfig())
-	case storage.StorageTypeS3:
-		return nil, fmt.Errorf("s3 adapter not implemented yet")
+	case storage.StorageTypeS3, storage.StorageTypeMinIO:
+		return storage.NewS3Adapter(f.config.GetStorageConfig())
 	case storage.StorageTypeGCS:
 		return nil, fmt.Errorf("gcs adapter not implemented yet")
 	case storage.StorageTypeAzureBlob:
 		return nil, fmt.Errorf("azure blob adapter not implemented yet")
-	case storage.StorageTypeMinIO:
-		return nil, fmt.Errorf("minio adapter not implemented yet")
 	default:
 		return nil, fmt.Errorf("unsupported storage adapter type: %s", f.config.Storage.Type)
 	}
@@ -116,7 +138,7 @@ func (f *AdapterFactory) CreateAllAdapters() (*AdapterSet, error) {
 		return nil, fmt.Errorf("failed to create cache adapter: %w", err)
 	}
 
-	auth, err := f.CreateAuthAdapter()
+	auth, err := f.CreateAuthAdapter(cache)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create auth adapter: %w", err)
 	}
@@ -0,0 +1,471 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// blobDirName is the directory holding the blobs of a top-level directory
+	blobDirName = "blobs"
+	// refsRoot holds one marker file per reference to a blob
+	refsRoot = "refs"
+)
+
+// BlobStore is implemented by adapters that store content-addressed blobs
+type BlobStore interface {
+	// Verify rehashes every stored blob and checks that every referenced
+	// blob exists
+	Verify() (*IntegrityReport, error)
+	// CollectGarbage deletes the unreferenced blobs older than minAge and
+	// returns how many were deleted
+	CollectGarbage(minAge time.Duration) (int, error)
+}
+
+// IntegrityReport lists the problems found when verifying stored blobs
+type IntegrityReport struct {
+	// Checked is the number of blobs rehashed
+	Checked int `json:"checked"`
+	// Corrupt lists the blobs whose content no longer matches their hash
+	Corrupt []string `json:"corrupt"`
+	// Missing lists the blobs that are referenced but not stored
+	Missing []string `json:"missing"`
+}
+
+// OK reports whether no problems were found
+func (r *IntegrityReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Missing) == 0
+}
+
+// DedupAdapter wraps a storage adapter to store identical uploads once.
+// Uploads are stored under the SHA-256 of their content, e.g.
+// media/blobs/ab/<sha256>.png for media/2024/05/<id>.png, so blobs never
+// leave the top-level directory they were uploaded to. Each upload adds a
+// reference to its blob and deleting the blob path drops one, the blob is
+// only deleted with its last reference. References are marker files under
+// refs/, which keeps the count consistent across replicas without locking.
+//
+// Files inside a blob directory, such as image variants, are stored as is.
+type DedupAdapter struct {
+	StorageAdapter
+}
+
+// NewDedupAdapter wraps next with content-addressed deduplication
+func NewDedupAdapter(next StorageAdapter) *DedupAdapter {
+	return &DedupAdapter{StorageAdapter: next}
+}
+
+// Unwrap returns the wrapped adapter
+func (a *DedupAdapter) Unwrap() StorageAdapter {
+	return a.StorageAdapter
+}
+
+// Blobs returns the blob store behind adapter, looking through wrappers
+// such as ImageAdapter
+func Blobs(adapter StorageAdapter) (BlobStore, bool) {
+	return findAdapter[BlobStore](adapter)
+}
+
+// Upload stores a file under the hash of its content, or adds a reference
+// to the stored copy. The result metadata holds the hash as "sha256", and
+// "deduplicated" is "true" when the content was already stored.
+func (a *DedupAdapter) Upload(file StorageFile) (*StorageResult, error) {
+	if insideBlobDir(file.Path) {
+		return a.StorageAdapter.Upload(file)
+	}
+
+	data, err := io.ReadAll(file.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	blob := blobPath(file.Path, hash)
+
+	metadata := make(map[string]string, len(file.Metadata)+2)
+	for key, value := range file.Metadata {
+		metadata[key] = value
+	}
+	metadata["sha256"] = hash
+
+	// The reference is added before the blob is looked up, and deletes and
+	// garbage collection check for references right before deleting a
+	// blob. Only a reference added in the instant between that check and
+	// the delete loses its blob, which Verify then reports as missing.
+	ref, err := a.addRef(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := a.StorageAdapter.Exists(blob)
+	if err != nil {
+		a.StorageAdapter.Delete(ref)
+		return nil, err
+	}
+
+	if exists {
+		url, err := a.StorageAdapter.GetPublicURL(blob)
+		if err != nil {
+			a.StorageAdapter.Delete(ref)
+			return nil, err
+		}
+
+		metadata["deduplicated"] = "true"
+		return &StorageResult{
+			Path:       blob,
+			URL:        url,
+			Size:       int64(len(data)),
+			Metadata:   metadata,
+			UploadedAt: time.Now(),
+		}, nil
+	}
+
+	file.Path = blob
+	file.Content = bytes.NewReader(data)
+	file.Size = int64(len(data))
+	file.Metadata = metadata
+	result, err := a.StorageAdapter.Upload(file)
+	if err != nil {
+		a.StorageAdapter.Delete(ref)
+		return nil, err
+	}
+
+	result.Metadata = metadata
+	return result, nil
+}
+
+// Delete drops one reference to a blob and deletes the blob, with the
+// files derived from it, once no references are left. Other paths are
+// deleted directly.
+func (a *DedupAdapter) Delete(filePath string) error {
+	blob := cleanBlobPath(filePath)
+	if _, ok := parseBlobPath(blob); !ok {
+		return a.StorageAdapter.Delete(filePath)
+	}
+
+	refs, err := a.refs(blob)
+	if err != nil {
+		return err
+	}
+
+	// Concurrent deletes may race for the same marker, so try the next one
+	for _, ref := range refs {
+		if err := a.StorageAdapter.Delete(ref.Path); err == nil {
+			break
+		}
+	}
+
+	remaining, err := a.refs(blob)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return nil
+	}
+
+	return a.deleteBlob(blob)
+}
+
+// GetMetadata retrieves metadata for a file, including the hash of blobs
+func (a *DedupAdapter) GetMetadata(filePath string) (*StorageMetadata, error) {
+	metadata, err := a.StorageAdapter.GetMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash, ok := parseBlobPath(cleanBlobPath(filePath)); ok {
+		custom := make(map[string]string, len(metadata.Custom)+1)
+		for key, value := range metadata.Custom {
+			custom[key] = value
+		}
+		custom["sha256"] = hash
+		metadata.Custom = custom
+	}
+	return metadata, nil
+}
+
+// Verify rehashes every stored blob and checks that every referenced blob
+// is stored
+func (a *DedupAdapter) Verify() (*IntegrityReport, error) {
+	report := &IntegrityReport{Corrupt: []string{}, Missing: []string{}}
+
+	err := a.walkBlobs("", func(blob StorageInfo, hash string) error {
+		report.Checked++
+		actual, err := a.hashFile(blob.Path)
+		if err != nil {
+			// Deleted since it was listed
+			if exists, existsErr := a.StorageAdapter.Exists(blob.Path); existsErr == nil && !exists {
+				report.Checked--
+				return nil
+			}
+			return err
+		}
+		if actual != hash {
+			report.Corrupt = append(report.Corrupt, blob.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.walkBlobs(refsRoot, func(refDir StorageInfo, _ string) error {
+		blob := strings.TrimPrefix(refDir.Path, refsRoot+"/")
+		exists, err := a.StorageAdapter.Exists(blob)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			report.Missing = append(report.Missing, blob)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// CollectGarbage deletes the blobs without references. Blobs modified in
+// the last minAge are kept, since an upload may be adding a reference.
+// Walking every blob takes a while, so each unreferenced one is checked
+// again right before it is deleted, as an upload may have added a
+// reference to it in the meantime.
+func (a *DedupAdapter) CollectGarbage(minAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-minAge)
+
+	var unreferenced []string
+	err := a.walkBlobs("", func(blob StorageInfo, _ string) error {
+		if blob.ModifiedAt.After(cutoff) {
+			return nil
+		}
+
+		refs, err := a.refs(blob.Path)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			unreferenced = append(unreferenced, blob.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, blob := range unreferenced {
+		refs, err := a.refs(blob)
+		if err != nil {
+			return deleted, err
+		}
+		if len(refs) > 0 {
+			continue
+		}
+
+		// Deleted, or stored again, since it was listed
+		metadata, err := a.StorageAdapter.GetMetadata(blob)
+		if err != nil || metadata.ModifiedAt.After(cutoff) {
+			continue
+		}
+
+		if err := a.deleteBlob(blob); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// addRef stores a new reference marker for a blob and returns its path
+func (a *DedupAdapter) addRef(blob string) (string, error) {
+	ref := path.Join(refsDir(blob), uuid.New().String())
+	if _, err := a.StorageAdapter.Upload(StorageFile{
+		Path:        ref,
+		Content:     strings.NewReader(blob),
+		ContentType: "text/plain",
+		Size:        int64(len(blob)),
+	}); err != nil {
+		return "", fmt.Errorf("failed to add blob reference: %w", err)
+	}
+	return ref, nil
+}
+
+// refs lists the reference markers of a blob
+func (a *DedupAdapter) refs(blob string) ([]StorageInfo, error) {
+	dir := refsDir(blob)
+	files, err := a.StorageAdapter.ListFiles(dir)
+	if err != nil {
+		// Listing a missing directory fails on local disk
+		if exists, existsErr := a.StorageAdapter.Exists(dir); existsErr == nil && !exists {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list blob references: %w", err)
+	}
+
+	var refs []StorageInfo
+	for _, file := range files {
+		if !file.IsDirectory {
+			refs = append(refs, file)
+		}
+	}
+	return refs, nil
+}
+
+// deleteBlob deletes a blob with the files derived from it and its
+// reference directory
+func (a *DedupAdapter) deleteBlob(blob string) error {
+	if err := a.StorageAdapter.Delete(blob); err != nil {
+		if exists, existsErr := a.StorageAdapter.Exists(blob); existsErr != nil || exists {
+			return err
+		}
+	}
+
+	deleteTree(a.StorageAdapter, derivedDir(blob))
+	deleteTree(a.StorageAdapter, refsDir(blob))
+	return nil
+}
+
+// hashFile returns the SHA-256 of a stored file
+func (a *DedupAdapter) hashFile(filePath string) (string, error) {
+	file, err := a.StorageAdapter.Download(filePath)
+	if err != nil {
+		return "", err
+	}
+	if closer, ok := file.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file.Content); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// walkBlobs calls fn for every entry named after a blob under root, which
+// is "" for the blobs themselves and refsRoot for their reference
+// directories. Blob directories are blobs/ and <dir>/blobs/ for every
+// top-level directory.
+func (a *DedupAdapter) walkBlobs(root string, fn func(entry StorageInfo, hash string) error) error {
+	blobDirs := []string{path.Join(root, blobDirName)}
+
+	top, err := a.listDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range top {
+		name := path.Base(entry.Path)
+		if entry.IsDirectory && name != blobDirName && !(root == "" && name == refsRoot) {
+			blobDirs = append(blobDirs, path.Join(root, name, blobDirName))
+		}
+	}
+
+	for _, dir := range blobDirs {
+		shards, err := a.listDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, shard := range shards {
+			if !shard.IsDirectory {
+				continue
+			}
+			entries, err := a.listDir(path.Join(dir, path.Base(shard.Path)))
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				// Blobs are files, reference directories are directories
+				if entry.IsDirectory != (root != "") {
+					continue
+				}
+				entry.Path = path.Join(dir, path.Base(shard.Path), path.Base(entry.Path))
+				hash, ok := parseBlobPath(strings.TrimPrefix(entry.Path, root+"/"))
+				if !ok {
+					continue
+				}
+				if err := fn(entry, hash); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// listDir lists a directory, which is empty when it does not exist
+func (a *DedupAdapter) listDir(dir string) ([]StorageInfo, error) {
+	files, err := a.StorageAdapter.ListFiles(dir)
+	if err != nil {
+		if exists, existsErr := a.StorageAdapter.Exists(dir); existsErr == nil && !exists {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// blobPath returns where content with the given hash uploaded to
+// uploadPath is stored
+func blobPath(uploadPath, hash string) string {
+	clean := strings.Trim(path.Clean("/"+uploadPath), "/")
+	ext := strings.ToLower(path.Ext(clean))
+
+	top := ""
+	if dir, _, ok := strings.Cut(clean, "/"); ok {
+		top = dir
+	}
+	return path.Join(top, blobDirName, hash[:2], hash+ext)
+}
+
+// refsDir returns the directory holding the reference markers of a blob
+func refsDir(blob string) string {
+	return path.Join(refsRoot, blob)
+}
+
+// cleanBlobPath normalizes a path the way adapters do before parsing it
+func cleanBlobPath(filePath string) string {
+	return strings.Trim(path.Clean("/"+filePath), "/")
+}
+
+// parseBlobPath returns the hash of a blob path
+func parseBlobPath(blob string) (string, bool) {
+	parts := strings.Split(blob, "/")
+	if len(parts) == 4 {
+		parts = parts[1:]
+	}
+	if len(parts) != 3 || parts[0] != blobDirName {
+		return "", false
+	}
+
+	name := parts[2]
+	hash := strings.TrimSuffix(name, path.Ext(name))
+	if len(hash) != sha256.Size*2 || parts[1] != hash[:2] {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil || strings.ToLower(hash) != hash {
+		return "", false
+	}
+	return hash, true
+}
+
+// insideBlobDir reports whether a path is in a blob directory, where files
+// derived from blobs are stored as is
+func insideBlobDir(filePath string) bool {
+	parts := strings.SplitN(cleanBlobPath(filePath), "/", 3)
+	return parts[0] == blobDirName || parts[0] == refsRoot || (len(parts) > 1 && parts[1] == blobDirName)
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDedupBehavior exercises DedupAdapter on top of backend. Files are
+// stored under a fresh top-level directory so the suite can share a bucket.
+func testDedupBehavior(t *testing.T, backend StorageAdapter) {
+	adapter := NewDedupAdapter(backend)
+	dir := "dedup-" + uuid.New().String()
+
+	upload := func(name, content string) *StorageResult {
+		t.Helper()
+		result, err := adapter.Upload(StorageFile{
+			Path:        dir + "/" + name,
+			Content:     strings.NewReader(content),
+			ContentType: "text/plain",
+			Size:        int64(len(content)),
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	sum := sha256.Sum256([]byte("same logo"))
+	hash := hex.EncodeToString(sum[:])
+
+	t.Run("Identical uploads share a blob", func(t *testing.T) {
+		first := upload("2024/05/a.txt", "same logo")
+		second := upload("2024/06/b.TXT", "same logo")
+
+		assert.Equal(t, dir+"/blobs/"+hash[:2]+"/"+hash+".txt", first.Path)
+		assert.Equal(t, first.Path, second.Path)
+		assert.Equal(t, first.URL, second.URL)
+		assert.Equal(t, hash, first.Metadata["sha256"])
+		assert.Empty(t, first.Metadata["deduplicated"])
+		assert.Equal(t, "true", second.Metadata["deduplicated"])
+		assert.Equal(t, int64(9), second.Size)
+
+		metadata, err := adapter.GetMetadata(first.Path)
+		require.NoError(t, err)
+		assert.Equal(t, hash, metadata.Custom["sha256"])
+
+		// The blob is deleted with its last reference
+		require.NoError(t, adapter.Delete(first.Path))
+		exists, err := adapter.Exists(first.Path)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, adapter.Delete(second.Path))
+		exists, err = adapter.Exists(first.Path)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Derived files are stored as is", func(t *testing.T) {
+		result := upload("photo.txt", "original")
+		derived, err := adapter.Upload(StorageFile{
+			Path:        derivedDir(result.Path) + "/thumbnail.txt",
+			Content:     strings.NewReader("thumbnail"),
+			ContentType: "text/plain",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, derivedDir(result.Path)+"/thumbnail.txt", derived.Path)
+
+		require.NoError(t, adapter.Delete(result.Path))
+		exists, err := adapter.Exists(derived.Path)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Verify reports corrupt and missing blobs", func(t *testing.T) {
+		intact := upload("intact.txt", "intact")
+		corrupt := upload("corrupt.txt", "corrupt")
+		missing := upload("missing.txt", "missing")
+		defer adapter.Delete(intact.Path)
+		defer adapter.Delete(corrupt.Path)
+		defer adapter.Delete(missing.Path)
+
+		_, err := backend.Upload(StorageFile{
+			Path:        corrupt.Path,
+			Content:     strings.NewReader("tampered"),
+			ContentType: "text/plain",
+			Size:        8,
+		})
+		require.NoError(t, err)
+		require.NoError(t, backend.Delete(missing.Path))
+
+		report, err := adapter.Verify()
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.GreaterOrEqual(t, report.Checked, 2)
+		assert.Contains(t, report.Corrupt, corrupt.Path)
+		assert.NotContains(t, report.Corrupt, intact.Path)
+		assert.Contains(t, report.Missing, missing.Path)
+		assert.NotContains(t, report.Missing, intact.Path)
+	})
+
+	t.Run("Garbage collection deletes unreferenced blobs", func(t *testing.T) {
+		kept := upload("kept.txt", "kept")
+		orphan := upload("orphan.txt", "orphan")
+		defer adapter.Delete(kept.Path)
+
+		deleteTree(backend, refsDir(orphan.Path))
+
+		deleted, err := adapter.CollectGarbage(0)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, 1)
+
+		exists, err := adapter.Exists(orphan.Path)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = adapter.Exists(kept.Path)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
+
+func TestDedupAdapter(t *testing.T) {
+	backend, err := NewLocalAdapter(map[string]interface{}{
+		"base_path": t.TempDir(),
+		"base_url":  "http://localhost:8080/uploads",
+	})
+	require.NoError(t, err)
+
+	testDedupBehavior(t, backend)
+
+	wrapped := NewImageAdapter(NewDedupAdapter(backend), nil)
+	_, ok := Blobs(wrapped)
+	assert.True(t, ok)
+	_, ok = Blobs(backend)
+	assert.False(t, ok)
+}
+
+// listHook calls onList once after the first successful listing of a path
+// with the given prefix
+type listHook struct {
+	StorageAdapter
+	prefix string
+	onList func()
+	once   sync.Once
+}
+
+func (h *listHook) ListFiles(dir string) ([]StorageInfo, error) {
+	files, err := h.StorageAdapter.ListFiles(dir)
+	if err == nil && strings.HasPrefix(dir, h.prefix) {
+		h.once.Do(h.onList)
+	}
+	return files, err
+}
+
+func TestDedupGarbageCollectionRace(t *testing.T) {
+	backend, err := NewLocalAdapter(map[string]interface{}{
+		"base_path": t.TempDir(),
+		"base_url":  "http://localhost:8080/uploads",
+	})
+	require.NoError(t, err)
+
+	hooked := &listHook{StorageAdapter: backend, prefix: refsRoot + "/"}
+	adapter := NewDedupAdapter(hooked)
+	upload := func(name string) *StorageResult {
+		result, err := adapter.Upload(StorageFile{
+			Path:        "media/" + name,
+			Content:     strings.NewReader("shared"),
+			ContentType: "text/plain",
+			Size:        6,
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	orphan := upload("orphan.txt")
+	refs, err := backend.ListFiles(refsDir(orphan.Path))
+	require.NoError(t, err)
+	for _, ref := range refs {
+		require.NoError(t, backend.Delete(ref.Path))
+	}
+
+	// The same content is uploaded again right after the collector found
+	// the blob unreferenced
+	var again *StorageResult
+	hooked.onList = func() { again = upload("again.txt") }
+
+	deleted, err := adapter.CollectGarbage(0)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	require.NotNil(t, again)
+	assert.Equal(t, "true", again.Metadata["deduplicated"])
+	exists, err := adapter.Exists(again.Path)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	report, err := adapter.Verify()
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+}
+
+func TestParseBlobPath(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"media/blobs/ab/" + hash + ".png", true},
+		{"blobs/ab/" + hash, true},
+		{"media/blobs/cd/" + hash + ".png", false},
+		{"media/blobs/ab/" + strings.ToUpper(hash) + ".png", false},
+		{"media/blobs/ab/" + hash + "/thumbnail.png", false},
+		{"media/2024/05/" + hash + ".png", false},
+		{"media/blobs/ab/abc.png", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			parsed, ok := parseBlobPath(tt.path)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, hash, parsed)
+			}
+		})
+	}
+
+	assert.Equal(t, "media/blobs/ab/"+hash+".png", blobPath("/media/../media/2024/logo.PNG", hash))
+	assert.Equal(t, "blobs/ab/"+hash+".png", blobPath("logo.png", hash))
+	assert.True(t, insideBlobDir("media/blobs/ab/"+hash+"/thumbnail.png"))
+	assert.False(t, insideBlobDir("media/2024/05/logo.png"))
+}
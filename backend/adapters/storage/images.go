@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"webenable-cms-backend/imaging"
+)
+
+// DefaultImageVariants is the variant spec used when none is configured
+const DefaultImageVariants = "thumbnail:150x150:cover,medium:640x0,large:1280x0,webp:0x0:webp"
+
+// ImageVariant describes a resized copy generated for every uploaded image
+type ImageVariant struct {
+	Name   string
+	Width  int
+	Height int
+	Fit    imaging.Fit
+	// Format is the output format, empty to keep the format of the upload
+	Format string
+}
+
+// ImageVariantResult describes a stored image variant
+type ImageVariantResult struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// ImageTransformer is implemented by storage adapters that can serve
+// resized copies of stored images
+type ImageTransformer interface {
+	Transform(path string, width, height int, fit imaging.Fit) (*StorageFile, error)
+}
+
+// MaxCachedTransforms limits how many resized copies of an image are
+// generated and kept
+const MaxCachedTransforms = 100
+
+// ErrTooManyTransforms is returned by Transform for a new size of an image
+// that already has MaxCachedTransforms copies
+var ErrTooManyTransforms = errors.New("too many transforms of this image")
+
+// ParseImageVariants parses a comma separated variant spec. Each variant is
+// written name:WIDTHxHEIGHT followed by an optional :fit and :format, where
+// a zero side is unconstrained, e.g. "thumbnail:150x150:cover,webp:0x0:webp".
+func ParseImageVariants(spec string) ([]ImageVariant, error) {
+	var variants []ImageVariant
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid image variant %q, expected name:WIDTHxHEIGHT", entry)
+		}
+
+		variant := ImageVariant{Name: parts[0], Fit: imaging.FitContain}
+		if seen[variant.Name] || strings.ContainsAny(variant.Name, "/.") {
+			return nil, fmt.Errorf("invalid image variant name %q", variant.Name)
+		}
+		seen[variant.Name] = true
+
+		width, height, ok := strings.Cut(parts[1], "x")
+		var err error
+		if variant.Width, err = strconv.Atoi(width); !ok || err != nil || variant.Width < 0 {
+			return nil, fmt.Errorf("invalid size in image variant %q", entry)
+		}
+		if variant.Height, err = strconv.Atoi(height); err != nil || variant.Height < 0 {
+			return nil, fmt.Errorf("invalid size in image variant %q", entry)
+		}
+
+		for _, option := range parts[2:] {
+			switch option {
+			case "jpeg", "png", "webp":
+				variant.Format = option
+			default:
+				if variant.Fit, err = imaging.ParseFit(option); err != nil {
+					return nil, fmt.Errorf("invalid image variant %q: %w", entry, err)
+				}
+			}
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// ImageAdapter wraps a storage adapter to process uploaded images. The
+// original is stored with its metadata stripped and each configured
+// variant is stored next to it. Derived files of an image live in a
+// directory named after it, e.g. media/2024/05/<id>/thumbnail.jpg for
+// media/2024/05/<id>.jpg, and are deleted with it.
+type ImageAdapter struct {
+	StorageAdapter
+	variants []ImageVariant
+}
+
+// NewImageAdapter wraps next with image processing
+func NewImageAdapter(next StorageAdapter, variants []ImageVariant) *ImageAdapter {
+	return &ImageAdapter{
+		StorageAdapter: next,
+		variants:       variants,
+	}
+}
+
+// Unwrap returns the wrapped adapter
+func (a *ImageAdapter) Unwrap() StorageAdapter {
+	return a.StorageAdapter
+}
+
+// processableImages are the content types the adapter can decode. Animated
+// GIFs are stored as uploaded and their variants show the first frame.
+var processableImages = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Upload stores a file, processing it first if it is an image. The result
+// lists the stored variants, and its metadata holds the width and height of
+// the upright original.
+func (a *ImageAdapter) Upload(file StorageFile) (*StorageResult, error) {
+	format, ok := processableImages[file.ContentType]
+	if !ok {
+		return a.StorageAdapter.Upload(file)
+	}
+
+	data, err := io.ReadAll(file.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	data, err = imaging.StripMetadata(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to strip image metadata: %w", err)
+	}
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Content = bytes.NewReader(data)
+	file.Size = int64(len(data))
+	result, err := a.StorageAdapter.Upload(file)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string, len(result.Metadata)+2)
+	for key, value := range result.Metadata {
+		metadata[key] = value
+	}
+	metadata["width"] = strconv.Itoa(img.Bounds().Dx())
+	metadata["height"] = strconv.Itoa(img.Bounds().Dy())
+	result.Metadata = metadata
+
+	// Deduplicated content already has its variants
+	existing := result.Metadata["deduplicated"] == "true"
+	for _, variant := range a.variants {
+		stored, err := a.storeVariant(result.Path, img, format, variant, existing)
+		if err != nil {
+			a.Delete(result.Path)
+			return nil, fmt.Errorf("failed to create %s variant: %w", variant.Name, err)
+		}
+		if stored != nil {
+			result.Variants = append(result.Variants, *stored)
+		}
+	}
+
+	return result, nil
+}
+
+// storeVariant resizes and stores one variant of an image. Variants that
+// would be neither smaller nor in another format are skipped, and so are
+// variants that are already stored when existing is set.
+func (a *ImageAdapter) storeVariant(original string, img image.Image, format string, variant ImageVariant, existing bool) (*ImageVariantResult, error) {
+	resized := imaging.Resize(img, variant.Width, variant.Height, variant.Fit)
+
+	sourceFormat := imaging.OutputFormat(format)
+	outputFormat := sourceFormat
+	if variant.Format != "" {
+		outputFormat = variant.Format
+	}
+	if resized.Bounds().Size() == img.Bounds().Size() && outputFormat == sourceFormat {
+		return nil, nil
+	}
+
+	variantPath := path.Join(derivedDir(original), variant.Name+imaging.Extension(outputFormat))
+	if existing {
+		if stored, err := a.storedVariant(variantPath, variant, resized.Bounds()); err == nil {
+			stored.ContentType = imaging.ContentType(outputFormat)
+			return stored, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, resized, outputFormat); err != nil {
+		return nil, err
+	}
+
+	result, err := a.StorageAdapter.Upload(StorageFile{
+		Path:        variantPath,
+		Content:     &buf,
+		ContentType: imaging.ContentType(outputFormat),
+		Size:        int64(buf.Len()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageVariantResult{
+		Name:        variant.Name,
+		Path:        result.Path,
+		URL:         result.URL,
+		ContentType: imaging.ContentType(outputFormat),
+		Size:        result.Size,
+		Width:       resized.Bounds().Dx(),
+		Height:      resized.Bounds().Dy(),
+	}, nil
+}
+
+// storedVariant describes a variant that is already stored
+func (a *ImageAdapter) storedVariant(variantPath string, variant ImageVariant, bounds image.Rectangle) (*ImageVariantResult, error) {
+	metadata, err := a.GetMetadata(variantPath)
+	if err != nil {
+		return nil, err
+	}
+	url, err := a.GetPublicURL(variantPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageVariantResult{
+		Name:   variant.Name,
+		Path:   variantPath,
+		URL:    url,
+		Size:   metadata.Size,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}, nil
+}
+
+// Transform returns a resized copy of a stored image. Copies are cached in
+// storage, so each size is only generated once, and at most
+// MaxCachedTransforms sizes are.
+func (a *ImageAdapter) Transform(original string, width, height int, fit imaging.Fit) (*StorageFile, error) {
+	format, ok := processableImages[contentTypeByExtension(original)]
+	if !ok {
+		return nil, fmt.Errorf("not an image: %s", original)
+	}
+	outputFormat := imaging.OutputFormat(format)
+
+	cacheDir := path.Join(derivedDir(original), "cache")
+	cached := path.Join(cacheDir, fmt.Sprintf("%dx%d-%s%s", width, height, fit, imaging.Extension(outputFormat)))
+	if exists, err := a.Exists(cached); err == nil && exists {
+		return a.Download(cached)
+	}
+	// A directory that can't be listed has no copies yet
+	if files, err := a.ListFiles(cacheDir); err == nil && len(files) >= MaxCachedTransforms {
+		return nil, ErrTooManyTransforms
+	}
+
+	file, err := a.Download(original)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file.Content)
+	if closer, ok := file.Content.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, imaging.Resize(img, width, height, fit), outputFormat); err != nil {
+		return nil, err
+	}
+	encoded := buf.Bytes()
+
+	if _, err := a.StorageAdapter.Upload(StorageFile{
+		Path:        cached,
+		Content:     bytes.NewReader(encoded),
+		ContentType: imaging.ContentType(outputFormat),
+		Size:        int64(len(encoded)),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to cache transformed image: %w", err)
+	}
+
+	return &StorageFile{
+		Path:        cached,
+		Content:     bytes.NewReader(encoded),
+		ContentType: imaging.ContentType(outputFormat),
+		Size:        int64(len(encoded)),
+	}, nil
+}
+
+// Delete deletes a file together with its variants and cached transforms.
+// They are kept while the file itself is, which is the case for a
+// deduplicated file that is still referenced.
+func (a *ImageAdapter) Delete(path string) error {
+	if err := a.StorageAdapter.Delete(path); err != nil {
+		return err
+	}
+
+	if _, ok := processableImages[contentTypeByExtension(path)]; ok {
+		if exists, err := a.Exists(path); err == nil && !exists {
+			deleteTree(a.StorageAdapter, derivedDir(path))
+		}
+	}
+	return nil
+}
+
+// deleteTree deletes a directory and everything in it, ignoring errors
+// since it may not exist
+func deleteTree(adapter StorageAdapter, dir string) {
+	files, err := adapter.ListFiles(dir)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDirectory {
+			deleteTree(adapter, file.Path)
+		} else {
+			adapter.Delete(file.Path)
+		}
+	}
+	adapter.Delete(dir)
+}
+
+// derivedDir returns the directory holding the files derived from an image
+func derivedDir(original string) string {
+	return strings.TrimSuffix(original, path.Ext(original))
+}
+
+// contentTypeByExtension returns the image content type of a stored path
+func contentTypeByExtension(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"webenable-cms-backend/imaging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageVariants(t *testing.T) {
+	variants, err := ParseImageVariants(DefaultImageVariants)
+	require.NoError(t, err)
+	assert.Equal(t, []ImageVariant{
+		{Name: "thumbnail", Width: 150, Height: 150, Fit: imaging.FitCover},
+		{Name: "medium", Width: 640, Fit: imaging.FitContain},
+		{Name: "large", Width: 1280, Fit: imaging.FitContain},
+		{Name: "webp", Fit: imaging.FitContain, Format: "webp"},
+	}, variants)
+
+	variants, err = ParseImageVariants(" hero:1920x600:webp:cover , ")
+	require.NoError(t, err)
+	assert.Equal(t, []ImageVariant{{Name: "hero", Width: 1920, Height: 600, Fit: imaging.FitCover, Format: "webp"}}, variants)
+
+	for _, spec := range []string{
+		"thumbnail",
+		"thumbnail:150",
+		"thumbnail:-1x150",
+		"thumbnail:150x150:stretch",
+		"../thumbnail:150x150",
+		"small:100x0,small:200x0",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParseImageVariants(spec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTransformLimit(t *testing.T) {
+	local, err := NewLocalAdapter(map[string]interface{}{
+		"base_path": t.TempDir(),
+		"base_url":  "http://localhost:8080/uploads",
+	})
+	require.NoError(t, err)
+	adapter := NewImageAdapter(local, nil)
+
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+	_, err = adapter.Upload(StorageFile{
+		Path:        "media/photo.png",
+		Content:     bytes.NewReader(encoded.Bytes()),
+		ContentType: "image/png",
+		Size:        int64(encoded.Len()),
+	})
+	require.NoError(t, err)
+
+	for size := 1; size <= MaxCachedTransforms; size++ {
+		_, err := adapter.Transform("media/photo.png", size, 0, imaging.FitContain)
+		require.NoError(t, err)
+	}
+
+	_, err = adapter.Transform("media/photo.png", MaxCachedTransforms+1, 0, imaging.FitContain)
+	assert.ErrorIs(t, err, ErrTooManyTransforms)
+
+	// Sizes already made are still served
+	_, err = adapter.Transform("media/photo.png", 1, 0, imaging.FitContain)
+	assert.NoError(t, err)
+}
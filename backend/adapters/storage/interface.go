@@ -45,6 +45,7 @@ type StorageResult struct {
 	URL        string            `json:"url"`
 	Size       int64             `json:"size"`
 	Metadata   map[string]string `json:"metadata"`
+	Variants   []ImageVariantResult `json:"variants,omitempty"`
 	UploadedAt time.Time         `json:"uploaded_at"`
 }
 
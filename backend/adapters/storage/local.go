@@ -1,19 +1,35 @@
 package storage
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// LocalAdapter implements StorageAdapter for local file system
+// Signed URL errors
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature expired")
+)
+
+// LocalAdapter implements StorageAdapter for local file system. Files under
+// the public prefixes are served to anyone, all others only through signed
+// URLs.
 type LocalAdapter struct {
-	basePath string
-	baseURL  string
-	config   map[string]interface{}
+	basePath       string
+	baseURL        string
+	signingKey     []byte
+	publicPrefixes []string
+	config         map[string]interface{}
 }
 
 // NewLocalAdapter creates a new local file system adapter
@@ -32,6 +48,27 @@ func NewLocalAdapter(config map[string]interface{}) (StorageAdapter, error) {
 	return adapter, nil
 }
 
+// LocalFiles returns the local adapter behind adapter, looking through
+// wrappers such as ImageAdapter, if files are stored on local disk
+func LocalFiles(adapter StorageAdapter) (*LocalAdapter, bool) {
+	return findAdapter[*LocalAdapter](adapter)
+}
+
+// findAdapter returns the first adapter of type T in a chain of wrappers
+func findAdapter[T any](adapter StorageAdapter) (T, bool) {
+	for {
+		if found, ok := adapter.(T); ok {
+			return found, true
+		}
+		wrapper, ok := adapter.(interface{ Unwrap() StorageAdapter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		adapter = wrapper.Unwrap()
+	}
+}
+
 // Configure configures the local storage adapter
 func (l *LocalAdapter) Configure(config StorageConfig) error {
 	basePath, ok := config.Config["base_path"].(string)
@@ -44,6 +81,13 @@ func (l *LocalAdapter) Configure(config StorageConfig) error {
 		baseURL = "http://localhost:8080/uploads"
 	}
 
+	signingKey, _ := config.Config["signing_key"].(string)
+
+	publicPrefixes, ok := config.Config["public_prefixes"].(string)
+	if !ok {
+		publicPrefixes = "media/"
+	}
+
 	// Ensure base path exists
 	if err := os.MkdirAll(basePath, 0755); err != nil {
 		return fmt.Errorf("failed to create base directory: %w", err)
@@ -51,6 +95,13 @@ func (l *LocalAdapter) Configure(config StorageConfig) error {
 
 	l.basePath = basePath
 	l.baseURL = baseURL
+	l.signingKey = []byte(signingKey)
+	l.publicPrefixes = nil
+	for _, prefix := range strings.Split(publicPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			l.publicPrefixes = append(l.publicPrefixes, strings.TrimPrefix(prefix, "/"))
+		}
+	}
 	return nil
 }
 
@@ -248,11 +299,70 @@ func (l *LocalAdapter) GetPublicURL(path string) (string, error) {
 	return url, nil
 }
 
-// GetSignedURL returns a signed URL (local storage doesn't support signed URLs)
+// GetSignedURL returns the public URL of a file with an expiry time and an
+// HMAC signature of both, which grants access to files outside the public
+// prefixes until it expires
 func (l *LocalAdapter) GetSignedURL(path string, expiration time.Duration) (string, error) {
-	// Local storage doesn't support signed URLs
-	// Return the public URL instead
-	return l.GetPublicURL(path)
+	if len(l.signingKey) == 0 {
+		return "", fmt.Errorf("local storage signing key not configured")
+	}
+	if expiration <= 0 {
+		return "", fmt.Errorf("expiration must be positive")
+	}
+
+	publicURL, err := l.GetPublicURL(path)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(expiration).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {l.sign(l.sanitizePath(path), expires)},
+	}
+	return publicURL + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature query parameters of a
+// URL returned by GetSignedURL for path
+func (l *LocalAdapter) VerifySignedURL(path string, query url.Values) error {
+	if len(l.signingKey) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expires := query.Get("expires")
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := l.sign(l.sanitizePath(path), expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+// IsPublic reports whether a file may be served without a signed URL
+func (l *LocalAdapter) IsPublic(path string) bool {
+	cleanPath := filepath.ToSlash(l.sanitizePath(path))
+	for _, prefix := range l.publicPrefixes {
+		if strings.HasPrefix(cleanPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sign returns the URL signature of a sanitized path and expiry time
+func (l *LocalAdapter) sign(cleanPath, expires string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte(filepath.ToSlash(cleanPath) + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
 // Health checks the health of the local storage
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// defaultPartSize is the multipart upload part size. Files larger than one
+// part are uploaded in parts, S3 requires at least 5 MiB per part.
+const defaultPartSize = 16 << 20
+
+// maxSignedURLExpiration is the longest expiration S3 accepts for presigned URLs
+const maxSignedURLExpiration = 7 * 24 * time.Hour
+
+// S3Adapter implements StorageAdapter for Amazon S3 and S3-compatible
+// services such as MinIO. Files are stored as objects under an optional key
+// prefix; directories are key prefixes and don't exist on their own.
+type S3Adapter struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	baseURL  string
+	partSize uint64
+	config   map[string]interface{}
+}
+
+// NewS3Adapter creates a new S3-compatible storage adapter
+func NewS3Adapter(config map[string]interface{}) (StorageAdapter, error) {
+	adapter := &S3Adapter{
+		config: config,
+	}
+
+	if err := adapter.Configure(StorageConfig{
+		Type:   StorageTypeS3,
+		Config: config,
+	}); err != nil {
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+// Configure configures the S3 storage adapter. Without an access key the
+// credentials come from the AWS environment variables or the IAM role of
+// the pod or instance.
+func (s *S3Adapter) Configure(config StorageConfig) error {
+	endpoint := configString(config.Config, "endpoint", "s3.amazonaws.com")
+	bucket := configString(config.Config, "bucket", "")
+	if bucket == "" {
+		return fmt.Errorf("s3 bucket is required")
+	}
+
+	useSSL, err := strconv.ParseBool(configString(config.Config, "use_ssl", "true"))
+	if err != nil {
+		return fmt.Errorf("invalid use_ssl: %w", err)
+	}
+	pathStyle, err := strconv.ParseBool(configString(config.Config, "path_style", "false"))
+	if err != nil {
+		return fmt.Errorf("invalid path_style: %w", err)
+	}
+
+	partSize := uint64(defaultPartSize)
+	if value := configString(config.Config, "part_size_mb", ""); value != "" {
+		mb, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || mb < 5 {
+			return fmt.Errorf("invalid part_size_mb %q, must be at least 5", value)
+		}
+		partSize = mb << 20
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.IAM{},
+	})
+	if accessKey := configString(config.Config, "access_key", ""); accessKey != "" {
+		creds = credentials.NewStaticV4(accessKey, configString(config.Config, "secret_key", ""), "")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if pathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       useSSL,
+		Region:       configString(config.Config, "region", ""),
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	s.client = client
+	s.bucket = bucket
+	s.prefix = strings.Trim(configString(config.Config, "prefix", ""), "/")
+	s.baseURL = strings.TrimSuffix(configString(config.Config, "base_url", ""), "/")
+	s.partSize = partSize
+	return nil
+}
+
+// Upload uploads a file, in parts when it is larger than the part size or
+// its size is unknown
+func (s *S3Adapter) Upload(file StorageFile) (*StorageResult, error) {
+	cleanPath := sanitizeKey(file.Path)
+	if cleanPath == "" {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidPath, file.Path)
+	}
+
+	size := file.Size
+	if size <= 0 {
+		size = -1
+	}
+
+	info, err := s.client.PutObject(context.Background(), s.bucket, s.key(cleanPath), file.Content, size, minio.PutObjectOptions{
+		ContentType:  file.ContentType,
+		UserMetadata: file.Metadata,
+		PartSize:     s.partSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	url, err := s.GetPublicURL(cleanPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StorageResult{
+		Path:       cleanPath,
+		URL:        url,
+		Size:       info.Size,
+		Metadata:   file.Metadata,
+		UploadedAt: time.Now(),
+	}, nil
+}
+
+// Download downloads a file. The content is streamed from S3 and must be
+// closed by the caller.
+func (s *S3Adapter) Download(path string) (*StorageFile, error) {
+	cleanPath := sanitizeKey(path)
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.key(cleanPath), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	// GetObject is lazy, Stat makes the request and reports missing files
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if isNoSuchKey(err) {
+			return nil, fmt.Errorf("file not found: %s", path)
+		}
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return &StorageFile{
+		Path:        cleanPath,
+		Content:     object,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		Metadata:    userMetadata(info),
+	}, nil
+}
+
+// Delete deletes a file. Deleting a missing file is not an error in S3.
+func (s *S3Adapter) Delete(path string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, s.key(sanitizeKey(path)), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// Exists checks if a file exists
+func (s *S3Adapter) Exists(path string) (bool, error) {
+	_, err := s.client.StatObject(context.Background(), s.bucket, s.key(sanitizeKey(path)), minio.StatObjectOptions{})
+	if err != nil {
+		if isNoSuchKey(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check file existence: %w", err)
+	}
+	return true, nil
+}
+
+// CreateDirectory is a no-op, S3 directories are key prefixes that exist as
+// soon as a file is stored under them
+func (s *S3Adapter) CreateDirectory(path string) error {
+	return nil
+}
+
+// ListFiles lists the files and subdirectories directly under a prefix
+func (s *S3Adapter) ListFiles(path string) ([]StorageInfo, error) {
+	prefix := s.key(sanitizeKey(path))
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var files []StorageInfo
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", object.Err)
+		}
+
+		isDirectory := strings.HasSuffix(object.Key, "/")
+		files = append(files, StorageInfo{
+			Path:        strings.TrimSuffix(s.relative(object.Key), "/"),
+			Size:        object.Size,
+			ContentType: object.ContentType,
+			ModifiedAt:  object.LastModified,
+			Metadata:    make(map[string]string),
+			IsDirectory: isDirectory,
+		})
+	}
+
+	return files, nil
+}
+
+// GetMetadata retrieves metadata for a file: the user metadata headers set
+// at upload, overlaid with the object tags written by SetMetadata
+func (s *S3Adapter) GetMetadata(path string) (*StorageMetadata, error) {
+	ctx := context.Background()
+	key := s.key(sanitizeKey(path))
+
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, fmt.Errorf("file not found: %s", path)
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	custom := userMetadata(info)
+	if info.UserTagCount > 0 {
+		objectTags, err := s.client.GetObjectTagging(ctx, s.bucket, key, minio.GetObjectTaggingOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file tags: %w", err)
+		}
+		for name, value := range objectTags.ToMap() {
+			custom[name] = value
+		}
+	}
+
+	return &StorageMetadata{
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		ModifiedAt:  info.LastModified,
+		Custom:      custom,
+	}, nil
+}
+
+// SetMetadata stores metadata as object tags, which unlike metadata headers
+// can change without rewriting the object. S3 allows at most 10 tags per
+// object and replaces all of them on every call.
+func (s *S3Adapter) SetMetadata(path string, metadata map[string]string) error {
+	objectTags, err := tags.NewTags(metadata, true)
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	if err := s.client.PutObjectTagging(context.Background(), s.bucket, s.key(sanitizeKey(path)), objectTags, minio.PutObjectTaggingOptions{}); err != nil {
+		if isNoSuchKey(err) {
+			return fmt.Errorf("file not found: %s", path)
+		}
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+	return nil
+}
+
+// GetPublicURL returns the public URL for a file, under base_url when one is
+// configured (e.g. a CDN) and in the bucket otherwise
+func (s *S3Adapter) GetPublicURL(path string) (string, error) {
+	cleanPath := sanitizeKey(path)
+	if s.baseURL != "" {
+		return s.baseURL + "/" + escapeKey(cleanPath), nil
+	}
+
+	endpoint := s.client.EndpointURL()
+	return fmt.Sprintf("%s://%s/%s/%s", endpoint.Scheme, endpoint.Host, s.bucket, escapeKey(s.key(cleanPath))), nil
+}
+
+// GetSignedURL returns a presigned URL granting read access to a file
+func (s *S3Adapter) GetSignedURL(path string, expiration time.Duration) (string, error) {
+	if expiration <= 0 || expiration > maxSignedURLExpiration {
+		return "", fmt.Errorf("expiration must be between 1s and %s", maxSignedURLExpiration)
+	}
+
+	signed, err := s.client.PresignedGetObject(context.Background(), s.bucket, s.key(sanitizeKey(path)), expiration, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign url: %w", err)
+	}
+	return signed.String(), nil
+}
+
+// Health checks that the bucket is reachable
+func (s *S3Adapter) Health() error {
+	exists, err := s.client.BucketExists(context.Background(), s.bucket)
+	if err != nil {
+		return fmt.Errorf("bucket not accessible: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+// key returns the object key of a sanitized path
+func (s *S3Adapter) key(cleanPath string) string {
+	if s.prefix == "" {
+		return cleanPath
+	}
+	if cleanPath == "" {
+		return s.prefix
+	}
+	return s.prefix + "/" + cleanPath
+}
+
+// relative returns the path of an object key
+func (s *S3Adapter) relative(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, s.prefix+"/")
+}
+
+// sanitizeKey turns a path into a relative object key, resolving any
+// directory traversal against the root
+func sanitizeKey(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// escapeKey escapes each segment of an object key for use in a URL
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func isNoSuchKey(err error) bool {
+	return minio.ToErrorResponse(err).Code == minio.NoSuchKey
+}
+
+// userMetadata returns the user metadata headers of an object with lower
+// case names, as they were given at upload
+func userMetadata(info minio.ObjectInfo) map[string]string {
+	metadata := make(map[string]string, len(info.UserMetadata))
+	for name, value := range info.UserMetadata {
+		metadata[strings.ToLower(name)] = value
+	}
+	return metadata
+}
+
+// configString returns a string setting, or fallback when it is unset
+func configString(config map[string]interface{}, name, fallback string) string {
+	switch value := config[name].(type) {
+	case string:
+		if value != "" {
+			return value
+		}
+	case bool:
+		return strconv.FormatBool(value)
+	case int:
+		return strconv.Itoa(value)
+	}
+	return fallback
+}
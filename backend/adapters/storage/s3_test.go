@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestS3Adapter runs against a real server when S3_TEST_ENDPOINT is set, e.g.
+// a local MinIO started with
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// and S3_TEST_ENDPOINT=localhost:9000. The bucket (S3_TEST_BUCKET, default
+// webenable-cms-test) is created when missing.
+func TestS3Adapter(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	config := map[string]interface{}{
+		"endpoint":     endpoint,
+		"bucket":       getTestEnv("S3_TEST_BUCKET", "webenable-cms-test"),
+		"region":       getTestEnv("S3_TEST_REGION", "us-east-1"),
+		"access_key":   getTestEnv("S3_TEST_ACCESS_KEY", "minioadmin"),
+		"secret_key":   getTestEnv("S3_TEST_SECRET_KEY", "minioadmin"),
+		"use_ssl":      getTestEnv("S3_TEST_USE_SSL", "false"),
+		"path_style":   "true",
+		"prefix":       "tests",
+		"part_size_mb": "5",
+	}
+	adapter, err := NewS3Adapter(config)
+	require.NoError(t, err)
+
+	s3 := adapter.(*S3Adapter)
+	ctx := context.Background()
+	exists, err := s3.client.BucketExists(ctx, s3.bucket)
+	require.NoError(t, err)
+	if !exists {
+		require.NoError(t, s3.client.MakeBucket(ctx, s3.bucket, minio.MakeBucketOptions{Region: config["region"].(string)}))
+	}
+
+	testStorageBehavior(t, adapter, behaviorOptions{customMetadata: true})
+	t.Run("Deduplication", func(t *testing.T) {
+		testDedupBehavior(t, adapter)
+	})
+
+	t.Run("Multipart upload", func(t *testing.T) {
+		content := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+		result, err := adapter.Upload(StorageFile{
+			Path:        "multipart-" + uuid.New().String() + ".bin",
+			Content:     bytes.NewReader(content),
+			ContentType: "application/octet-stream",
+			Size:        int64(len(content)),
+			Metadata:    map[string]string{"source": "test"},
+		})
+		require.NoError(t, err)
+		defer adapter.Delete(result.Path)
+		assert.Equal(t, int64(len(content)), result.Size)
+
+		// Multipart ETags end with the number of parts
+		info, err := s3.client.StatObject(ctx, s3.bucket, s3.key(result.Path), minio.StatObjectOptions{})
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(info.ETag, "-3"), info.ETag)
+
+		metadata, err := adapter.GetMetadata(result.Path)
+		require.NoError(t, err)
+		assert.Equal(t, "test", metadata.Custom["source"])
+	})
+
+	t.Run("Presigned URL", func(t *testing.T) {
+		result, err := adapter.Upload(StorageFile{
+			Path:        "signed-" + uuid.New().String() + ".txt",
+			Content:     strings.NewReader("private"),
+			ContentType: "text/plain",
+			Size:        7,
+		})
+		require.NoError(t, err)
+		defer adapter.Delete(result.Path)
+
+		signed, err := adapter.GetSignedURL(result.Path, time.Minute)
+		require.NoError(t, err)
+
+		response, err := http.Get(signed)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "private", string(body))
+
+		_, err = adapter.GetSignedURL(result.Path, 8*24*time.Hour)
+		assert.Error(t, err)
+	})
+}
+
+func TestS3PublicURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]interface{}
+		path     string
+		expected string
+	}{
+		{
+			name:     "Bucket URL",
+			config:   map[string]interface{}{"endpoint": "minio:9000", "bucket": "cms", "use_ssl": "false"},
+			path:     "media/2024/05/a b.jpg",
+			expected: "http://minio:9000/cms/media/2024/05/a%20b.jpg",
+		},
+		{
+			name:     "Bucket URL with prefix",
+			config:   map[string]interface{}{"endpoint": "s3.amazonaws.com", "bucket": "cms", "prefix": "/uploads/"},
+			path:     "/media/../logo.png",
+			expected: "https://s3.amazonaws.com/cms/uploads/logo.png",
+		},
+		{
+			name:     "CDN base URL skips the prefix",
+			config:   map[string]interface{}{"bucket": "cms", "prefix": "uploads", "base_url": "https://cdn.example.com/"},
+			path:     "media/logo.png",
+			expected: "https://cdn.example.com/media/logo.png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := NewS3Adapter(tt.config)
+			require.NoError(t, err)
+
+			url, err := adapter.GetPublicURL(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, url)
+		})
+	}
+
+	_, err := NewS3Adapter(map[string]interface{}{"endpoint": "minio:9000"})
+	assert.Error(t, err)
+	_, err = NewS3Adapter(map[string]interface{}{"bucket": "cms", "part_size_mb": "1"})
+	assert.Error(t, err)
+}
+
+func getTestEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// behaviorOptions describes the optional features of an adapter
+type behaviorOptions struct {
+	// customMetadata is set when SetMetadata is supported
+	customMetadata bool
+}
+
+// testStorageBehavior exercises the StorageAdapter contract. Every file is
+// stored under a fresh directory so the suite can share a bucket.
+func testStorageBehavior(t *testing.T, adapter StorageAdapter, options behaviorOptions) {
+	dir := "behavior-" + uuid.New().String()
+
+	upload := func(name, content string) *StorageResult {
+		t.Helper()
+		result, err := adapter.Upload(StorageFile{
+			Path:        dir + "/" + name,
+			Content:     strings.NewReader(content),
+			ContentType: "text/plain",
+			Size:        int64(len(content)),
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	result := upload("notes/readme.txt", "hello storage")
+	assert.Equal(t, dir+"/notes/readme.txt", result.Path)
+	assert.Equal(t, int64(13), result.Size)
+	assert.True(t, strings.HasSuffix(result.URL, result.Path), result.URL)
+	upload("notes/drafts/todo.txt", "later")
+
+	publicURL, err := adapter.GetPublicURL(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, result.URL, publicURL)
+
+	signedURL, err := adapter.GetSignedURL(result.Path, time.Hour)
+	require.NoError(t, err)
+	assert.Contains(t, signedURL, result.Path)
+
+	exists, err := adapter.Exists(result.Path)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = adapter.Exists(dir + "/notes/missing.txt")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	file, err := adapter.Download(result.Path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file.Content)
+	require.NoError(t, err)
+	if closer, ok := file.Content.(io.Closer); ok {
+		closer.Close()
+	}
+	assert.Equal(t, "hello storage", string(content))
+	assert.Equal(t, int64(13), file.Size)
+	assert.Equal(t, "text/plain", strings.Split(file.ContentType, ";")[0])
+
+	_, err = adapter.Download(dir + "/notes/missing.txt")
+	assert.Error(t, err)
+
+	files, err := adapter.ListFiles(dir + "/notes")
+	require.NoError(t, err)
+	listed := make(map[string]bool)
+	for _, info := range files {
+		listed[filepath.ToSlash(info.Path)] = info.IsDirectory
+	}
+	assert.Equal(t, map[string]bool{
+		dir + "/notes/readme.txt": false,
+		dir + "/notes/drafts":     true,
+	}, listed)
+
+	metadata, err := adapter.GetMetadata(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), metadata.Size)
+	assert.False(t, metadata.ModifiedAt.IsZero())
+
+	if options.customMetadata {
+		require.NoError(t, adapter.SetMetadata(result.Path, map[string]string{"reviewed": "yes"}))
+		metadata, err = adapter.GetMetadata(result.Path)
+		require.NoError(t, err)
+		assert.Equal(t, "yes", metadata.Custom["reviewed"])
+	}
+
+	// Traversal stays inside the storage root
+	escaped := upload("../../escape.txt", "contained")
+	assert.False(t, strings.Contains(escaped.Path, ".."), escaped.Path)
+	require.NoError(t, adapter.Delete(escaped.Path))
+
+	require.NoError(t, adapter.Delete(result.Path))
+	require.NoError(t, adapter.Delete(dir+"/notes/drafts/todo.txt"))
+	exists, err = adapter.Exists(result.Path)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, adapter.Health())
+}
+
+func TestLocalAdapter(t *testing.T) {
+	adapter, err := NewLocalAdapter(map[string]interface{}{
+		"base_path":   t.TempDir(),
+		"base_url":    "http://localhost:8080/uploads",
+		"signing_key": "secret",
+	})
+	require.NoError(t, err)
+
+	testStorageBehavior(t, adapter, behaviorOptions{})
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	adapter, err := NewLocalAdapter(map[string]interface{}{
+		"base_path":       t.TempDir(),
+		"base_url":        "http://localhost:8080/uploads",
+		"signing_key":     "secret",
+		"public_prefixes": "media/, /public/",
+	})
+	require.NoError(t, err)
+	local := adapter.(*LocalAdapter)
+
+	signed, err := local.GetSignedURL("private/report.pdf", time.Minute)
+	require.NoError(t, err)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/uploads/private/report.pdf", parsed.Path)
+
+	query := parsed.Query()
+	assert.NoError(t, local.VerifySignedURL("private/report.pdf", query))
+	assert.NoError(t, local.VerifySignedURL("/private/./report.pdf", query))
+	assert.ErrorIs(t, local.VerifySignedURL("private/other.pdf", query), ErrInvalidSignature)
+
+	expired := url.Values{"expires": {"1000"}, "signature": {local.sign("private/report.pdf", "1000")}}
+	assert.ErrorIs(t, local.VerifySignedURL("private/report.pdf", expired), ErrExpiredSignature)
+	assert.ErrorIs(t, local.VerifySignedURL("private/report.pdf", url.Values{}), ErrInvalidSignature)
+
+	assert.True(t, local.IsPublic("media/a.jpg"))
+	assert.True(t, local.IsPublic("public/a.jpg"))
+	assert.False(t, local.IsPublic("media/../private/report.pdf"))
+	assert.False(t, local.IsPublic("private/report.pdf"))
+
+	unsigned, err := NewLocalAdapter(map[string]interface{}{"base_path": t.TempDir()})
+	require.NoError(t, err)
+	_, err = unsigned.GetSignedURL("private/report.pdf", time.Minute)
+	assert.Error(t, err)
+
+	wrapped := NewImageAdapter(adapter, nil)
+	found, ok := LocalFiles(wrapped)
+	assert.True(t, ok)
+	assert.Same(t, local, found)
+}
@@ -0,0 +1,120 @@
+// Package audit works out the changes recorded in audit events. Records are
+// compared field by field through their JSON encoding, so the changes name
+// fields the way the API does.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"webenable-cms-backend/models"
+)
+
+// Redacted stands in for the values of secret fields, which are recorded as
+// changed without what they changed from or to
+const Redacted = "[redacted]"
+
+// ignored are the fields that change with every save and tell nothing
+// about the change itself
+var ignored = map[string]bool{
+	"_rev":       true,
+	"rev":        true,
+	"updated_at": true,
+}
+
+// secret are the fields whose values are never recorded
+var secret = map[string]bool{
+	"password":       true,
+	"password_hash":  true,
+	"key_hash":       true,
+	"secret":         true,
+	"recovery_codes": true,
+}
+
+// Diff returns the fields that differ between two versions of a record.
+// before is nil for created records and after is nil for deleted ones, so
+// every field of the record shows up as changed.
+func Diff(before, after interface{}) (map[string]models.AuditChange, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.AuditChange{}
+	for name := range old {
+		if _, ok := updated[name]; !ok {
+			updated[name] = nil
+		}
+	}
+	for name, value := range updated {
+		previous := old[name]
+		if ignored[name] || bytes.Equal(previous, value) {
+			continue
+		}
+
+		change := models.AuditChange{Before: decode(previous), After: decode(value)}
+		if secret[name] {
+			change = models.AuditChange{Before: redact(previous), After: redact(value)}
+		}
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+		changes[name] = change
+	}
+
+	return changes, nil
+}
+
+// fields encodes the fields of a record, leaving out empty ones
+func fields(record interface{}) (map[string]json.RawMessage, error) {
+	values := map[string]json.RawMessage{}
+	if record == nil {
+		return values, nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record: %w", err)
+	}
+
+	for name, value := range values {
+		if isEmpty(value) {
+			delete(values, name)
+		}
+	}
+	return values, nil
+}
+
+// isEmpty reports whether a field holds no value, so a missing field and a
+// null or empty one compare equal
+func isEmpty(value json.RawMessage) bool {
+	switch string(value) {
+	case "", "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
+
+func decode(value json.RawMessage) interface{} {
+	if value == nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(value, &v)
+	return v
+}
+
+func redact(value json.RawMessage) interface{} {
+	if value == nil {
+		return nil
+	}
+	return Redacted
+}
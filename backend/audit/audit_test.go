@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Title        string   `json:"title"`
+	Tags         []string `json:"tags"`
+	Count        int      `json:"count"`
+	PasswordHash string   `json:"password_hash,omitempty"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  interface{}
+		after   interface{}
+		changes map[string]models.AuditChange
+	}{
+		{
+			name:    "Unchanged",
+			before:  record{Title: "Hello", UpdatedAt: "monday"},
+			after:   record{Title: "Hello", UpdatedAt: "tuesday"},
+			changes: map[string]models.AuditChange{},
+		},
+		{
+			name:   "Changed fields",
+			before: record{Title: "Hello", Tags: []string{"go"}, Count: 1},
+			after:  record{Title: "Hello", Tags: []string{"go", "cms"}, Count: 2},
+			changes: map[string]models.AuditChange{
+				"tags":  {Before: []interface{}{"go"}, After: []interface{}{"go", "cms"}},
+				"count": {Before: float64(1), After: float64(2)},
+			},
+		},
+		{
+			name:  "Created",
+			after: record{Title: "Hello"},
+			changes: map[string]models.AuditChange{
+				"title": {Before: nil, After: "Hello"},
+				"count": {Before: nil, After: float64(0)},
+			},
+		},
+		{
+			name:   "Deleted",
+			before: record{Title: "Hello", Count: 3},
+			changes: map[string]models.AuditChange{
+				"title": {Before: "Hello", After: nil},
+				"count": {Before: float64(3), After: nil},
+			},
+		},
+		{
+			name:   "Secret fields",
+			before: record{PasswordHash: "old"},
+			after:  record{PasswordHash: "new"},
+			changes: map[string]models.AuditChange{
+				"password_hash": {Before: Redacted, After: Redacted},
+			},
+		},
+		{
+			name:   "Maps",
+			before: map[string]string{"type": "ip"},
+			after:  map[string]string{"type": "all"},
+			changes: map[string]models.AuditChange{
+				"type": {Before: "ip", After: "all"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tt.before, tt.after)
+			require.NoError(t, err)
+			assert.Equal(t, tt.changes, changes)
+		})
+	}
+}
@@ -16,7 +16,7 @@ type AdapterConfig struct {
 
 // DatabaseAdapterConfig holds configuration for database adapters
 type DatabaseAdapterConfig struct {
-	Type   string                 `json:"type"`   // "couchdb", "postgres", "mongodb"
+	Type   string                 `json:"type"`   // "couchdb", "postgres", "sqlite", "mongodb"
 	Config map[string]interface{} `json:"config"`
 }
 
@@ -63,7 +63,8 @@ func InitAdapterConfig() *AdapterConfig {
 			Type: getEnvOrDefault("AUTH_ADAPTER", "jwt"),
 			Config: map[string]interface{}{
 				"secret":     getRequiredEnv("JWT_SECRET"),
-				"expiration": getEnvOrDefault("JWT_EXPIRATION", "24h"),
+				"expiration": getEnvOrDefault("JWT_EXPIRATION", "15m"),
+				"refresh_expiration": getEnvOrDefault("JWT_REFRESH_EXPIRATION", "720h"),
 			},
 		},
 		Email: EmailAdapterConfig{
@@ -81,6 +82,11 @@ func InitAdapterConfig() *AdapterConfig {
 			Config: map[string]interface{}{
 				"base_path": getEnvOrDefault("STORAGE_BASE_PATH", "./uploads"),
 				"base_url":  getEnvOrDefault("STORAGE_BASE_URL", "http://localhost:8080/uploads"),
+				// name:WIDTHxHEIGHT[:fit][:format],... empty for the default variants
+				"image_variants": os.Getenv("STORAGE_IMAGE_VARIANTS"),
+				// Local files outside these prefixes need a signed URL
+				"public_prefixes": getEnvOrDefault("STORAGE_PUBLIC_PREFIXES", "media/"),
+				"signing_key":     getEnvOrDefault("STORAGE_SIGNING_KEY", os.Getenv("JWT_SECRET")),
 			},
 		},
 	}
@@ -101,6 +107,11 @@ func (c *AdapterConfig) GetDatabaseConfig() map[string]interface{} {
 			"password": getEnvOrDefault("POSTGRES_PASSWORD", "password"),
 			"dbname":   getEnvOrDefault("POSTGRES_DB", "webenable_cms"),
 			"sslmode":  getEnvOrDefault("POSTGRES_SSLMODE", "disable"),
+			"dsn":      getEnvOrDefault("POSTGRES_DSN", ""),
+		}
+	case "sqlite":
+		return map[string]interface{}{
+			"path": getEnvOrDefault("SQLITE_PATH", "./data/cms.db"),
 		}
 	case "mongodb":
 		return map[string]interface{}{
@@ -139,13 +150,21 @@ func (c *AdapterConfig) GetAuthConfig() map[string]interface{} {
 		return map[string]interface{}{
 			"secret":     c.Auth.Config["secret"],
 			"expiration": c.Auth.Config["expiration"],
+			"refresh_expiration": c.Auth.Config["refresh_expiration"],
 		}
 	case "oauth2":
 		return map[string]interface{}{
-			"client_id":     getEnvOrDefault("OAUTH2_CLIENT_ID", ""),
-			"client_secret": getEnvOrDefault("OAUTH2_CLIENT_SECRET", ""),
-			"redirect_url":  getEnvOrDefault("OAUTH2_REDIRECT_URL", ""),
-			"scopes":        strings.Split(getEnvOrDefault("OAUTH2_SCOPES", "read,write"), ","),
+			"secret":             c.Auth.Config["secret"],
+			"expiration":         c.Auth.Config["expiration"],
+			"refresh_expiration": c.Auth.Config["refresh_expiration"],
+			"issuer_url":         getEnvOrDefault("OAUTH2_ISSUER_URL", ""),
+			"client_id":          getEnvOrDefault("OAUTH2_CLIENT_ID", ""),
+			"client_secret":      getEnvOrDefault("OAUTH2_CLIENT_SECRET", ""),
+			"redirect_url":       getEnvOrDefault("OAUTH2_REDIRECT_URL", ""),
+			"scopes":             strings.Split(getEnvOrDefault("OAUTH2_SCOPES", "openid,profile,email"), ","),
+			"role_claim":         getEnvOrDefault("OAUTH2_ROLE_CLAIM", "groups"),
+			"role_mapping":       getEnvOrDefault("OAUTH2_ROLE_MAPPING", ""),
+			"default_role":       getEnvOrDefault("OAUTH2_DEFAULT_ROLE", ""),
 		}
 	case "saml":
 		return map[string]interface{}{
@@ -191,15 +210,36 @@ func (c *AdapterConfig) GetStorageConfig() map[string]interface{} {
 	switch c.Storage.Type {
 	case "local":
 		return map[string]interface{}{
-			"base_path": c.Storage.Config["base_path"],
-			"base_url":  c.Storage.Config["base_url"],
+			"base_path":       c.Storage.Config["base_path"],
+			"base_url":        c.Storage.Config["base_url"],
+			"public_prefixes": c.Storage.Config["public_prefixes"],
+			"signing_key":     c.Storage.Config["signing_key"],
 		}
 	case "s3":
 		return map[string]interface{}{
-			"bucket":     getEnvOrDefault("S3_BUCKET", ""),
-			"region":     getEnvOrDefault("AWS_REGION", "us-east-1"),
-			"access_key": getEnvOrDefault("AWS_ACCESS_KEY_ID", ""),
-			"secret_key": getEnvOrDefault("AWS_SECRET_ACCESS_KEY", ""),
+			"endpoint":     getEnvOrDefault("S3_ENDPOINT", "s3.amazonaws.com"),
+			"bucket":       getEnvOrDefault("S3_BUCKET", ""),
+			"region":       getEnvOrDefault("AWS_REGION", "us-east-1"),
+			"access_key":   getEnvOrDefault("AWS_ACCESS_KEY_ID", ""),
+			"secret_key":   getEnvOrDefault("AWS_SECRET_ACCESS_KEY", ""),
+			"use_ssl":      getEnvOrDefault("S3_USE_SSL", "true"),
+			"path_style":   getEnvOrDefault("S3_PATH_STYLE", "false"),
+			"prefix":       getEnvOrDefault("S3_PREFIX", ""),
+			"base_url":     getEnvOrDefault("S3_PUBLIC_URL", ""),
+			"part_size_mb": getEnvOrDefault("S3_PART_SIZE_MB", "16"),
+		}
+	case "minio":
+		return map[string]interface{}{
+			"endpoint":     getEnvOrDefault("MINIO_ENDPOINT", "localhost:9000"),
+			"bucket":       getEnvOrDefault("MINIO_BUCKET", "webenable-cms"),
+			"region":       getEnvOrDefault("MINIO_REGION", "us-east-1"),
+			"access_key":   getEnvOrDefault("MINIO_ACCESS_KEY", "minioadmin"),
+			"secret_key":   getEnvOrDefault("MINIO_SECRET_KEY", "minioadmin"),
+			"use_ssl":      getEnvOrDefault("MINIO_USE_SSL", "false"),
+			"path_style":   "true",
+			"prefix":       getEnvOrDefault("MINIO_PREFIX", ""),
+			"base_url":     getEnvOrDefault("MINIO_PUBLIC_URL", ""),
+			"part_size_mb": getEnvOrDefault("MINIO_PART_SIZE_MB", "16"),
 		}
 	case "gcs":
 		return map[string]interface{}{
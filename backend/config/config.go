@@ -3,7 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -19,6 +21,44 @@ type Config struct {
 	SMTPPass       string
 	SessionDomain  string
 	SessionSecure  bool
+
+	// AppURL is the address of the frontend that links in account emails
+	// point to
+	AppURL string
+
+	// Background jobs
+	SchedulerInterval time.Duration
+
+	// Search
+	SearchBackend         string
+	SearchReindexInterval time.Duration
+
+	// Storage
+	StorageVerifyInterval time.Duration
+
+	// Login lockout; after LoginLockoutThreshold failed logins in a row an
+	// account is locked for LoginLockoutDuration
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+
+	// Audit log; events are kept for AuditRetentionDays, or forever when 0
+	AuditRetentionDays int
+	AuditPurgeInterval time.Duration
+
+	// Password hashing; hashes made with other settings are upgraded when
+	// their user logs in
+	PasswordHashAlgorithm string
+	PasswordBcryptCost    int
+	PasswordArgon2Time    int
+	PasswordArgon2Memory  int
+	PasswordArgon2Threads int
+
+	// Password policy; PasswordBreachedDir holds a k-anonymity prefix list
+	// of breached password hashes, none when empty
+	PasswordMinLength   int
+	PasswordMinEntropy  int
+	PasswordHistory     int
+	PasswordBreachedDir string
 	
 	// Adapter configuration
 	Adapters *AdapterConfig
@@ -40,6 +80,36 @@ func Init() {
 		SMTPPass:       os.Getenv("SMTP_PASS"),
 		SessionDomain:  getEnvOrDefault("SESSION_DOMAIN", ""),
 		SessionSecure:  getEnvOrDefault("SESSION_SECURE", "false") == "true",
+		AppURL:         getEnvOrDefault("APP_URL", "http://localhost:3000"),
+
+		// Background jobs
+		SchedulerInterval: getDurationOrDefault("SCHEDULER_INTERVAL", time.Minute),
+
+		// Search
+		SearchBackend:         getEnvOrDefault("SEARCH_BACKEND", "memory"),
+		SearchReindexInterval: getDurationOrDefault("SEARCH_REINDEX_INTERVAL", 10*time.Minute),
+
+		// Storage
+		StorageVerifyInterval: getDurationOrDefault("STORAGE_VERIFY_INTERVAL", 24*time.Hour),
+
+		// Login lockout
+		LoginLockoutThreshold: getIntOrDefault("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginLockoutDuration:  getDurationOrDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+
+		// Audit log
+		AuditRetentionDays: getIntOrDefault("AUDIT_RETENTION_DAYS", 365),
+		AuditPurgeInterval: getDurationOrDefault("AUDIT_PURGE_INTERVAL", 24*time.Hour),
+
+		// Passwords
+		PasswordHashAlgorithm: getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		PasswordBcryptCost:    getIntOrDefault("PASSWORD_BCRYPT_COST", 14),
+		PasswordArgon2Time:    getIntOrDefault("PASSWORD_ARGON2_TIME", 2),
+		PasswordArgon2Memory:  getIntOrDefault("PASSWORD_ARGON2_MEMORY", 19456),
+		PasswordArgon2Threads: getIntOrDefault("PASSWORD_ARGON2_THREADS", 1),
+		PasswordMinLength:     getIntOrDefault("PASSWORD_MIN_LENGTH", 12),
+		PasswordMinEntropy:    getIntOrDefault("PASSWORD_MIN_ENTROPY", 50),
+		PasswordHistory:       getIntOrDefault("PASSWORD_HISTORY", 5),
+		PasswordBreachedDir:   getEnvOrDefault("PASSWORD_BREACHED_DIR", ""),
 		
 		// Initialize adapter configuration
 		Adapters: InitAdapterConfig(),
@@ -60,3 +130,23 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("Invalid number for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
@@ -34,6 +34,15 @@ func NewContainer(config *config.AdapterConfig) (*Container, error) {
 	return container, nil
 }
 
+// NewContainerWithAdapters creates a service container around adapters that
+// were created elsewhere, e.g. by tests
+func NewContainerWithAdapters(adapters *adapters.AdapterSet, config *config.AdapterConfig) *Container {
+	return &Container{
+		adapters: adapters,
+		config:   config,
+	}
+}
+
 // Database returns the database adapter
 func (c *Container) Database() database.DatabaseAdapter {
 	return c.adapters.Database
@@ -17,10 +17,11 @@ import (
 // OptimizedDB provides an optimized database layer with connection pooling,
 // indexing, and query optimization
 type OptimizedDB struct {
-	Client     *kivik.Client
-	PostsDB    *kivik.DB
-	UsersDB    *kivik.DB
-	ContactsDB *kivik.DB
+	Client       *kivik.Client
+	PostsDB      *kivik.DB
+	UsersDB      *kivik.DB
+	ContactsDB   *kivik.DB
+	CategoriesDB *kivik.DB
 
 	// Connection pool settings
 	maxConnections int
@@ -89,7 +90,7 @@ func InitOptimized() error {
 
 	utils.LogInfo("Optimized database initialized successfully", logrus.Fields{
 		"connection_pool_size": OptimizedInstance.maxConnections,
-		"databases":            []string{"posts", "users", "contacts"},
+		"databases":            []string{"posts", "users", "contacts", "categories"},
 	})
 
 	return nil
@@ -132,7 +133,7 @@ func (db *OptimizedDB) returnConnection(conn *kivik.Client) {
 func (db *OptimizedDB) setupDatabases() error {
 	ctx := context.Background()
 
-	databases := []string{"posts", "users", "contacts"}
+	databases := []string{"posts", "users", "contacts", "categories"}
 
 	for _, dbName := range databases {
 		if exists, _ := db.Client.DBExists(ctx, dbName); !exists {
@@ -147,6 +148,7 @@ func (db *OptimizedDB) setupDatabases() error {
 	db.PostsDB = db.Client.DB("posts")
 	db.UsersDB = db.Client.DB("users")
 	db.ContactsDB = db.Client.DB("contacts")
+	db.CategoriesDB = db.Client.DB("categories")
 
 	return nil
 }
@@ -192,6 +194,20 @@ func (db *OptimizedDB) createIndexes() error {
 			"name": "featured-status-index",
 			"type": "json",
 		},
+		{
+			"index": map[string]interface{}{
+				"fields": []string{"slug"},
+			},
+			"name": "slug-index",
+			"type": "json",
+		},
+		{
+			"index": map[string]interface{}{
+				"fields": []string{"previous_slugs"},
+			},
+			"name": "previous-slugs-index",
+			"type": "json",
+		},
 	}
 
 	for _, index := range postsIndexes {
@@ -286,6 +302,31 @@ func (db *OptimizedDB) createIndexes() error {
 		}
 	}
 
+	// Categories indexes
+	categoriesIndexes := []map[string]interface{}{
+		{
+			"index": map[string]interface{}{
+				"fields": []string{"slug"},
+			},
+			"name": "slug-index",
+			"type": "json",
+		},
+	}
+
+	for _, index := range categoriesIndexes {
+		indexName := index["name"].(string)
+		indexDef := index["index"]
+		if err := db.CategoriesDB.CreateIndex(ctx, "", indexName, indexDef); err != nil {
+			utils.LogError(err, "Failed to create categories index", logrus.Fields{
+				"index": indexName,
+			})
+		} else {
+			utils.LogInfo("Created categories index", logrus.Fields{
+				"index": indexName,
+			})
+		}
+	}
+
 	return nil
 }
 
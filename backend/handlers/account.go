@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/adapters/email"
+	"webenable-cms-backend/config"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	passwordResetPurpose     = "password_reset"
+	passwordResetTTL         = time.Hour
+	emailVerificationPurpose = "email_verification"
+	emailVerificationTTL     = 24 * time.Hour
+)
+
+// Responses of the account endpoints that look up users by email address
+// are the same whether or not the address is known, so they can't be used
+// to find out who has an account
+const (
+	passwordResetSent     = "If an account with that email address exists, a password reset link has been sent"
+	verificationEmailSent = "If an unverified account with that email address exists, a verification link has been sent"
+)
+
+var errInvalidAccountToken = errors.New("invalid or expired token")
+
+// accountToken is what a password reset or email verification token stands
+// for. The email address it was sent to must still be the user's for the
+// token to be accepted.
+type accountToken struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func accountTokenKey(purpose, hash string) string {
+	return "account_token:" + purpose + ":" + hash
+}
+
+func accountTokenUsedKey(purpose, hash string) string {
+	return "account_token_used:" + purpose + ":" + hash
+}
+
+func accountTokenUserKey(purpose, userID string) string {
+	return "account_token_user:" + purpose + ":" + userID
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAccountToken generates the secret of an emailed link, and the hash of
+// it to store
+func newAccountToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashAccountToken(token), nil
+}
+
+// issueAccountToken stores a new single-use token for user in the cache.
+// Only the newest token of a user is valid for each purpose.
+func issueAccountToken(purpose string, user *models.User, ttl time.Duration) (string, error) {
+	token, hash, err := newAccountToken()
+	if err != nil {
+		return "", err
+	}
+
+	cache := globalContainer.Cache()
+	var previous string
+	if err := cache.Get(accountTokenUserKey(purpose, user.ID), &previous); err == nil {
+		cache.Delete(accountTokenKey(purpose, previous))
+	}
+
+	if err := cache.Set(accountTokenKey(purpose, hash), accountToken{UserID: user.ID, Email: user.Email}, ttl); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+	if err := cache.Set(accountTokenUserKey(purpose, user.ID), hash, ttl); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return token, nil
+}
+
+// lookupAccountToken returns what a token stands for without redeeming it
+func lookupAccountToken(purpose, token string) (*accountToken, error) {
+	if token == "" {
+		return nil, errInvalidAccountToken
+	}
+
+	var record accountToken
+	if err := globalContainer.Cache().Get(accountTokenKey(purpose, hashAccountToken(token)), &record); err != nil {
+		return nil, errInvalidAccountToken
+	}
+	return &record, nil
+}
+
+// consumeAccountToken redeems a token. A token is accepted once, even when
+// it is redeemed concurrently.
+func consumeAccountToken(purpose, token string) (*accountToken, error) {
+	record, err := lookupAccountToken(purpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := globalContainer.Cache()
+	hash := hashAccountToken(token)
+
+	uses, err := cache.IncrementCounter(accountTokenUsedKey(purpose, hash), time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem token: %w", err)
+	}
+	if uses > 1 {
+		return nil, errInvalidAccountToken
+	}
+
+	cache.Delete(accountTokenKey(purpose, hash))
+	cache.Delete(accountTokenUserKey(purpose, record.UserID))
+	return record, nil
+}
+
+// accountLink returns the frontend link carrying token
+func accountLink(path, token string) string {
+	base := ""
+	if config.AppConfig != nil {
+		base = strings.TrimRight(config.AppConfig.AppURL, "/")
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendAccountEmail sends an account email in the background, so the time a
+// request takes doesn't tell whether an email was sent
+func sendAccountEmail(to, subject, body string) {
+	emailAdapter := globalContainer.Email()
+	if emailAdapter == nil || !emailAdapter.IsConfigured() {
+		utils.LogWarning("Email not configured, account email not sent", logrus.Fields{
+			"subject": subject,
+		})
+		return
+	}
+
+	go func() {
+		if err := emailAdapter.SendEmail(email.EmailMessage{
+			To:      []string{to},
+			Subject: subject,
+			Body:    body,
+		}); err != nil {
+			utils.LogError(err, "Failed to send account email", logrus.Fields{
+				"subject": subject,
+			})
+		}
+	}()
+}
+
+// sendPasswordReset emails a password reset link to user
+func sendPasswordReset(user *models.User) error {
+	token, err := issueAccountToken(passwordResetPurpose, user, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	sendAccountEmail(user.Email, "Reset your password", fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your WebEnable account. To choose a new password, open this link within %s:
+
+%s
+
+If you didn't ask for this, you can ignore this email. Your password stays unchanged.
+
+WebEnable Team`, user.Username, passwordResetTTL, accountLink("/reset-password", token)))
+	return nil
+}
+
+// sendEmailVerification emails a verification link to the address of user
+func sendEmailVerification(user *models.User) error {
+	token, err := issueAccountToken(emailVerificationPurpose, user, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendAccountEmail(user.Email, "Verify your email address", fmt.Sprintf(`Hi %s,
+
+Please confirm that this is the email address of your WebEnable account by opening this link within %s:
+
+%s
+
+If you don't have an account with us, you can ignore this email.
+
+WebEnable Team`, user.Username, emailVerificationTTL, accountLink("/verify-email", token)))
+	return nil
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Request a password reset
+//	@Description	Email a single-use password reset link to the address, if it belongs to an active account. The response is the same either way.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.ForgotPasswordRequest	true	"Email address"
+//	@Success		202		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Router			/auth/password/forgot [post]
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := globalContainer.Database().GetUserByEmail(req.Email)
+	if err == nil && user.Active {
+		if err := sendPasswordReset(user); err != nil {
+			utils.LogError(err, "Failed to send password reset", logrus.Fields{
+				"user_id": user.ID,
+			})
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: passwordResetSent})
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset password
+//	@Description	Set a new password with a password reset token. The token works once, and the reset signs the user out everywhere. The password must meet the password policy and not be a recent one; a rejected password leaves the token usable.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.ResetPasswordRequest	true	"Reset token and new password"
+//	@Success		200		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/password/reset [post]
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is redeemed once the password passes the policy, so a
+	// rejected password can be corrected with the same link
+	token, err := lookupAccountToken(passwordResetPurpose, req.Token)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	user, err := db.GetUser(token.UserID)
+	if err != nil || !user.Active || user.Email != token.Email {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	if !checkNewPassword(w, user, req.Password) {
+		return
+	}
+
+	if _, err := consumeAccountToken(passwordResetPurpose, req.Token); err != nil {
+		if !errors.Is(err, errInvalidAccountToken) {
+			utils.LogError(err, "Failed to redeem password reset token", logrus.Fields{})
+		}
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	updates := &models.User{Active: user.Active}
+	if err := updates.SetPassword(req.Password); err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if err := db.UpdateUser(user.ID, updates); err != nil {
+		utils.LogError(err, "Failed to reset password", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	rememberPassword(user.ID, user.PasswordHash)
+
+	// The link reached the user's inbox, which verifies the address
+	if !user.EmailVerified {
+		if err := db.MarkEmailVerified(user.ID, user.Email); err != nil {
+			utils.LogWarning("Failed to mark email verified", logrus.Fields{
+				"user_id": user.ID,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	if err := signOutUser(user.ID); err != nil {
+		utils.LogError(err, "Failed to revoke user tokens", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("Password reset", logrus.Fields{
+		"user_id": user.ID,
+	})
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Password has been reset"})
+}
+
+// VerifyEmail godoc
+//
+//	@Summary		Verify email address
+//	@Description	Confirm the email address of an account with a verification token
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.VerifyEmailRequest	true	"Verification token"
+//	@Success		200		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Router			/auth/email/verify [post]
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := consumeAccountToken(emailVerificationPurpose, req.Token)
+	if err != nil {
+		if !errors.Is(err, errInvalidAccountToken) {
+			utils.LogError(err, "Failed to redeem email verification token", logrus.Fields{})
+		}
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// Fails when the address changed since the link was sent
+	if err := globalContainer.Database().MarkEmailVerified(token.UserID, token.Email); err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Email address verified"})
+}
+
+// ResendVerification godoc
+//
+//	@Summary		Resend email verification
+//	@Description	Email a new verification link to the address, if it belongs to an active account that isn't verified yet. The response is the same either way.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.ResendVerificationRequest	true	"Email address"
+//	@Success		202		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Router			/auth/email/verify/resend [post]
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := globalContainer.Database().GetUserByEmail(req.Email)
+	if err == nil && user.Active && !user.EmailVerified {
+		if err := sendEmailVerification(user); err != nil {
+			utils.LogError(err, "Failed to send email verification", logrus.Fields{
+				"user_id": user.ID,
+			})
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: verificationEmailSent})
+}
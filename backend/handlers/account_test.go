@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters"
+	"webenable-cms-backend/adapters/email"
+	"webenable-cms-backend/container"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emailRecorder is an email adapter that keeps the messages it sends
+type emailRecorder struct {
+	email.EmailAdapter
+	sent chan email.EmailMessage
+}
+
+func (e *emailRecorder) SendEmail(message email.EmailMessage) error {
+	e.sent <- message
+	return nil
+}
+
+func (e *emailRecorder) IsConfigured() bool { return true }
+
+// next waits for the next email and returns it
+func (e *emailRecorder) next(t *testing.T) email.EmailMessage {
+	t.Helper()
+	select {
+	case message := <-e.sent:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email sent")
+		return email.EmailMessage{}
+	}
+}
+
+// none checks that no email was sent
+func (e *emailRecorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case message := <-e.sent:
+		t.Fatalf("unexpected email to %v", message.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+var tokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+// linkToken returns the token of the link in message
+func linkToken(t *testing.T, message email.EmailMessage) string {
+	t.Helper()
+	match := tokenPattern.FindStringSubmatch(message.Body)
+	require.NotNil(t, match, "no link in %q", message.Body)
+	return match[1]
+}
+
+// recordEmails adds an email recorder to the test container
+func recordEmails(t *testing.T) *emailRecorder {
+	t.Helper()
+
+	recorder := &emailRecorder{sent: make(chan email.EmailMessage, 10)}
+	SetServiceContainer(container.NewContainerWithAdapters(&adapters.AdapterSet{
+		Database: globalContainer.Database(),
+		Cache:    globalContainer.Cache(),
+		Auth:     globalContainer.Auth(),
+		Storage:  globalContainer.Storage(),
+		Email:    recorder,
+	}, nil))
+	return recorder
+}
+
+func TestPasswordReset(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+	session := login(t)
+
+	forgot := func(address string) int {
+		req := httptest.NewRequest("POST", "/api/auth/password/forgot", nil)
+		var response models.SuccessResponse
+		status := callJSON(t, ForgotPassword, req, models.ForgotPasswordRequest{Email: address}, &response)
+		// Known and unknown addresses get the same answer
+		assert.Equal(t, passwordResetSent, response.Message)
+		return status
+	}
+	reset := func(token, password string) int {
+		req := httptest.NewRequest("POST", "/api/auth/password/reset", nil)
+		return callJSON(t, ResetPassword, req, models.ResetPasswordRequest{Token: token, Password: password}, nil)
+	}
+
+	assert.Equal(t, http.StatusAccepted, forgot("nobody@example.com"))
+	emails.none(t)
+
+	require.Equal(t, http.StatusAccepted, forgot("admin@example.com"))
+	message := emails.next(t)
+	assert.Equal(t, []string{"admin@example.com"}, message.To)
+	superseded := linkToken(t, message)
+
+	// Only the newest link works
+	require.Equal(t, http.StatusAccepted, forgot("admin@example.com"))
+	token := linkToken(t, emails.next(t))
+	assert.Equal(t, http.StatusBadRequest, reset(superseded, "new password"))
+
+	assert.Equal(t, http.StatusBadRequest, reset(token, ""))
+	require.Equal(t, http.StatusOK, reset(token, "new password"))
+	assert.Equal(t, http.StatusBadRequest, reset(token, "other password"))
+
+	user, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+	assert.True(t, user.CheckPassword("new password"))
+	assert.True(t, user.EmailVerified)
+
+	// The reset signs the user out everywhere
+	assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+
+	// Inactive users get no link
+	require.NoError(t, db.UpdateUser(user.ID, &models.User{Active: false}))
+	assert.Equal(t, http.StatusAccepted, forgot("admin@example.com"))
+	emails.none(t)
+}
+
+func TestEmailVerification(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+
+	verify := func(token string) int {
+		req := httptest.NewRequest("POST", "/api/auth/email/verify", nil)
+		return callJSON(t, VerifyEmail, req, models.VerifyEmailRequest{Token: token}, nil)
+	}
+	resend := func(address string) int {
+		req := httptest.NewRequest("POST", "/api/auth/email/verify/resend", nil)
+		var response models.SuccessResponse
+		status := callJSON(t, ResendVerification, req, models.ResendVerificationRequest{Email: address}, &response)
+		assert.Equal(t, verificationEmailSent, response.Message)
+		return status
+	}
+
+	var user models.User
+	req := asUser(httptest.NewRequest("POST", "/api/users", nil), "admin", "admin")
+	require.Equal(t, http.StatusCreated, callJSON(t, CreateUser, req, map[string]interface{}{
+		"username": "editor",
+		"email":    "editor@example.com",
+		"password": "correct horse battery",
+		"role":     "editor",
+		"active":   true,
+	}, &user))
+	assert.False(t, user.EmailVerified)
+
+	message := emails.next(t)
+	assert.Equal(t, []string{"editor@example.com"}, message.To)
+	require.Equal(t, http.StatusOK, verify(linkToken(t, message)))
+
+	verified, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+
+	// Verified and unknown addresses get no link
+	assert.Equal(t, http.StatusAccepted, resend("editor@example.com"))
+	assert.Equal(t, http.StatusAccepted, resend("nobody@example.com"))
+	emails.none(t)
+
+	// A new address has to be verified again
+	req = asUser(httptest.NewRequest("PUT", "/api/users/"+user.ID, nil), "admin", "admin")
+	req = mux.SetURLVars(req, map[string]string{"id": user.ID})
+	require.Equal(t, http.StatusOK, callJSON(t, UpdateUser, req, map[string]interface{}{"email": "editor@example.org"}, nil))
+	message = emails.next(t)
+	assert.Equal(t, []string{"editor@example.org"}, message.To)
+	stale := linkToken(t, message)
+
+	changed, err := db.GetUser(user.ID)
+	require.NoError(t, err)
+	assert.False(t, changed.EmailVerified)
+
+	// Links sent to an address the user no longer has are void
+	require.NoError(t, db.UpdateUser(user.ID, &models.User{Email: "editor@example.net", Active: true}))
+	assert.Equal(t, http.StatusBadRequest, verify(stale))
+
+	assert.Equal(t, http.StatusAccepted, resend("editor@example.net"))
+	token := linkToken(t, emails.next(t))
+	require.Equal(t, http.StatusOK, verify(token))
+	assert.Equal(t, http.StatusBadRequest, verify(token))
+}
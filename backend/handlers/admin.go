@@ -5,14 +5,14 @@ import (
 	"net/http"
 	"strings"
 
-	"webenable-cms-backend/middleware"
 	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
 )
 
 // ResetRateLimit godoc
 //
 //	@Summary		Reset rate limit
-//	@Description	Reset rate limit for specific identifier or all limits (admin only)
+//	@Description	Reset rate limit for specific identifier or all limits (needs system:update)
 //	@Tags			Admin
 //	@Accept			json
 //	@Produce		json
@@ -28,16 +28,7 @@ import (
 func ResetRateLimit(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
-		return
-	}
-
-	// Only admin can reset rate limits
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	if _, ok := authorize(w, r, permissions.System, permissions.Update); !ok {
 		return
 	}
 
@@ -95,6 +86,16 @@ func ResetRateLimit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Resets of a whole kind of limit have no single target
+	targetID := target
+	if targetID == "" {
+		targetID = strings.ToLower(resetType)
+	}
+	recordAudit(r, "rate_limit.reset", "rate_limit", targetID, nil, map[string]string{
+		"type":   strings.ToLower(resetType),
+		"target": target,
+	})
+
 	response := models.SuccessResponse{Message: message}
 	json.NewEncoder(w).Encode(response)
 }
@@ -102,7 +103,7 @@ func ResetRateLimit(w http.ResponseWriter, r *http.Request) {
 // GetRateLimitStatus godoc
 //
 //	@Summary		Get rate limit status
-//	@Description	Get current rate limit status for an IP or user (admin only)
+//	@Description	Get current rate limit status for an IP or user (needs system:read)
 //	@Tags			Admin
 //	@Accept			json
 //	@Produce		json
@@ -118,16 +119,7 @@ func ResetRateLimit(w http.ResponseWriter, r *http.Request) {
 func GetRateLimitStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
-		return
-	}
-
-	// Only admin can check rate limit status
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	if _, ok := authorize(w, r, permissions.System, permissions.Read); !ok {
 		return
 	}
 
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	apiKeyDefaultDays = 90
+	apiKeyMaxDays     = 365
+	apiKeyMaxName     = 100
+	// apiKeyPrefixLength is how much of a key is kept in the clear to tell
+	// keys apart
+	apiKeyPrefixLength = 8
+)
+
+// newAPIKey generates a new API key and the stored form of it
+func newAPIKey() (string, string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := middleware.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	prefix := key[:len(middleware.APIKeyPrefix)+apiKeyPrefixLength]
+	return key, prefix, middleware.HashAPIKey(key), nil
+}
+
+// GetAPIKeys godoc
+//
+//	@Summary		List API keys
+//	@Description	List the API keys of the current user, including expired and revoked ones
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.APIKey
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/api-keys [get]
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := globalContainer.Database().ListAPIKeys(user.ID)
+	if err != nil {
+		utils.LogError(err, "Failed to list API keys", logrus.Fields{"user_id": user.ID})
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey godoc
+//
+//	@Summary		Create API key
+//	@Description	Create a named API key for the current user. Requests that send it as a bearer token act as the user, limited to the scopes of the key, which must be within the permissions of the user's role. Keys expire after expires_in_days, 90 by default and at most 365. The key is only returned here.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		models.CreateAPIKeyRequest	true	"API key"
+//	@Success		201		{object}	models.CreateAPIKeyResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/api-keys [post]
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > apiKeyMaxName {
+		http.Error(w, fmt.Sprintf("Name is required and must be at most %d characters", apiKeyMaxName), http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if err := permissions.Validate(scope); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = apiKeyDefaultDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > apiKeyMaxDays {
+		http.Error(w, fmt.Sprintf("expires_in_days must be between 1 and %d", apiKeyMaxDays), http.StatusBadRequest)
+		return
+	}
+
+	set, err := rolePermissions(user.Role)
+	if err != nil {
+		utils.LogError(err, "Failed to load role permissions", logrus.Fields{"role": user.Role})
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
+	if !set.Covers(req.Scopes) {
+		http.Error(w, "Scopes exceed the permissions of your role", http.StatusForbidden)
+		return
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		utils.LogError(err, "Failed to generate API key", logrus.Fields{})
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+	}
+	if err := globalContainer.Database().CreateAPIKey(&apiKey); err != nil {
+		utils.LogError(err, "Failed to create API key", logrus.Fields{"user_id": user.ID})
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("API key created", logrus.Fields{
+		"key_id":   apiKey.ID,
+		"username": user.Username,
+		"scopes":   apiKey.Scopes,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKey godoc
+//
+//	@Summary		Revoke API key
+//	@Description	Revoke an API key of the current user. It stops working right away.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"API key ID"
+//	@Success		200	{object}	models.APIKey
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/api-keys/{id} [delete]
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	revokeAPIKey(w, r, mux.Vars(r)["id"], user.ID, user.Username)
+}
+
+// GetAllAPIKeys godoc
+//
+//	@Summary		List all API keys
+//	@Description	List the API keys of every user, or of one user (needs users:read)
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			user_id	query		string	false	"Only keys of this user"
+//	@Success		200		{array}		models.APIKey
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/admin/api-keys [get]
+func GetAllAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
+		return
+	}
+
+	keys, err := globalContainer.Database().ListAPIKeys(r.URL.Query().Get("user_id"))
+	if err != nil {
+		utils.LogError(err, "Failed to list API keys", logrus.Fields{})
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeUserAPIKey godoc
+//
+//	@Summary		Revoke any API key
+//	@Description	Revoke the API key of any user (needs users:update). It stops working right away.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"API key ID"
+//	@Success		200	{object}	models.APIKey
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/api-keys/{id} [delete]
+func RevokeUserAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Update)
+	if !ok {
+		return
+	}
+
+	revokeAPIKey(w, r, mux.Vars(r)["id"], "", claims.Username)
+}
+
+// revokeAPIKey revokes a key and writes it to the response. Keys of other
+// users than userID are not found, unless userID is empty.
+func revokeAPIKey(w http.ResponseWriter, r *http.Request, id, userID, revokedBy string) {
+	db := globalContainer.Database()
+
+	key, err := db.GetAPIKey(id)
+	if err != nil || (userID != "" && key.UserID != userID) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.RevokeAPIKey(id, revokedBy); err != nil {
+		utils.LogError(err, "Failed to revoke API key", logrus.Fields{"key_id": id})
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := db.GetAPIKey(id)
+	if err != nil {
+		http.Error(w, "Failed to load API key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("API key revoked", logrus.Fields{
+		"key_id":     id,
+		"user_id":    key.UserID,
+		"revoked_by": revokedBy,
+	})
+	recordAudit(r, "api_key.revoke", "api_key", id, key, revoked)
+
+	json.NewEncoder(w).Encode(revoked)
+}
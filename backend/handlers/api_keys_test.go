@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withAPIKey serves req through the auth middleware with key as the bearer
+// token
+func withAPIKey(t *testing.T, handler http.HandlerFunc, req *http.Request, key string, body, out interface{}) int {
+	t.Helper()
+	req.Header.Set("Authorization", "Bearer "+key)
+	return callJSON(t, middleware.AuthMiddleware(handler).ServeHTTP, req, body, out)
+}
+
+func TestAPIKeys(t *testing.T) {
+	db := setupTestContainer(t)
+	middleware.SetServiceContainer(globalContainer)
+	t.Cleanup(func() { middleware.SetServiceContainer(nil) })
+
+	writer := &models.User{Username: "writer", Email: "writer@example.com", Role: "author", Active: true}
+	require.NoError(t, writer.SetPassword("password"))
+	require.NoError(t, db.CreateUser(writer))
+
+	create := func(username, role string, req models.CreateAPIKeyRequest) (int, models.CreateAPIKeyResponse) {
+		var response models.CreateAPIKeyResponse
+		r := asUser(httptest.NewRequest("POST", "/api/auth/api-keys", nil), username, role)
+		return callJSON(t, CreateAPIKey, r, req, &response), response
+	}
+
+	t.Run("Validation", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			req    models.CreateAPIKeyRequest
+			status int
+		}{
+			{"Missing name", models.CreateAPIKeyRequest{Scopes: []string{"posts:read"}}, http.StatusBadRequest},
+			{"Missing scopes", models.CreateAPIKeyRequest{Name: "ci"}, http.StatusBadRequest},
+			{"Invalid scope", models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"pages:read"}}, http.StatusBadRequest},
+			{"Too long", models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"posts:read"}, ExpiresInDays: 400}, http.StatusBadRequest},
+			{"Beyond role", models.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"posts:*"}}, http.StatusForbidden},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				status, _ := create("writer", "author", tt.req)
+				assert.Equal(t, tt.status, status)
+			})
+		}
+	})
+
+	status, created := create("writer", "author", models.CreateAPIKeyRequest{
+		Name:   "import script",
+		Scopes: []string{"posts:create", "posts:read"},
+	})
+	require.Equal(t, http.StatusCreated, status)
+	key := created.Key
+	assert.True(t, strings.HasPrefix(key, created.Prefix))
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), created.ExpiresAt, time.Minute)
+
+	// Only the hash is stored
+	stored, err := db.GetAPIKey(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, middleware.HashAPIKey(key), stored.KeyHash)
+	assert.NotContains(t, stored.KeyHash, key)
+	assert.Nil(t, stored.LastUsedAt)
+
+	t.Run("Acts as its user within its scopes", func(t *testing.T) {
+		var post models.Post
+		req := httptest.NewRequest("POST", "/api/posts", nil)
+		require.Equal(t, http.StatusCreated, withAPIKey(t, CreatePost, req, key, models.Post{Title: "Imported"}, &post))
+		assert.Equal(t, "writer", post.Author)
+
+		// The role may read media, the key may not
+		req = httptest.NewRequest("GET", "/api/media", nil)
+		assert.Equal(t, http.StatusForbidden, withAPIKey(t, GetMediaList, req, key, nil, nil))
+
+		var me models.CurrentUserResponse
+		req = httptest.NewRequest("GET", "/api/auth/me", nil)
+		require.Equal(t, http.StatusOK, withAPIKey(t, GetCurrentUser, req, key, nil, &me))
+		assert.Equal(t, []string{"posts:create", "posts:read"}, me.Permissions)
+
+		// Keys can't manage keys
+		req = httptest.NewRequest("POST", "/api/auth/api-keys", nil)
+		assert.Equal(t, http.StatusForbidden, withAPIKey(t, CreateAPIKey, req, key, models.CreateAPIKeyRequest{
+			Name:   "copy",
+			Scopes: []string{"posts:read"},
+		}, nil))
+
+		used, err := db.GetAPIKey(created.ID)
+		require.NoError(t, err)
+		require.NotNil(t, used.LastUsedAt)
+		assert.Equal(t, "192.0.2.1", used.LastUsedIP)
+	})
+
+	t.Run("Listing", func(t *testing.T) {
+		var keys []models.APIKey
+		req := asUser(httptest.NewRequest("GET", "/api/auth/api-keys", nil), "writer", "author")
+		require.Equal(t, http.StatusOK, callJSON(t, GetAPIKeys, req, nil, &keys))
+		require.Len(t, keys, 1)
+		assert.Equal(t, created.ID, keys[0].ID)
+
+		req = asUser(httptest.NewRequest("GET", "/api/admin/api-keys?user_id="+writer.ID, nil), "admin", "admin")
+		require.Equal(t, http.StatusOK, callJSON(t, GetAllAPIKeys, req, nil, &keys))
+		assert.Len(t, keys, 1)
+
+		req = asUser(httptest.NewRequest("GET", "/api/admin/api-keys", nil), "chief", "editor")
+		assert.Equal(t, http.StatusForbidden, callJSON(t, GetAllAPIKeys, req, nil, nil))
+	})
+
+	t.Run("Revocation", func(t *testing.T) {
+		revoke := func(handler http.HandlerFunc, username, role string) int {
+			req := asUser(httptest.NewRequest("DELETE", "/api/api-keys/"+created.ID, nil), username, role)
+			req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+			return callJSON(t, handler, req, nil, nil)
+		}
+
+		assert.Equal(t, http.StatusNotFound, revoke(RevokeAPIKey, "admin", "admin"))
+		assert.Equal(t, http.StatusForbidden, revoke(RevokeUserAPIKey, "chief", "editor"))
+		require.Equal(t, http.StatusOK, revoke(RevokeUserAPIKey, "admin", "admin"))
+
+		revoked, err := db.GetAPIKey(created.ID)
+		require.NoError(t, err)
+		require.NotNil(t, revoked.RevokedAt)
+		assert.Equal(t, "admin", revoked.RevokedBy)
+
+		req := httptest.NewRequest("GET", "/api/auth/me", nil)
+		assert.Equal(t, http.StatusUnauthorized, withAPIKey(t, GetCurrentUser, req, key, nil, nil))
+	})
+
+	t.Run("Expired keys and inactive users", func(t *testing.T) {
+		expired, prefix, hash, err := newAPIKey()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateAPIKey(&models.APIKey{
+			UserID:    writer.ID,
+			Name:      "expired",
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    []string{"posts:read"},
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+		req := httptest.NewRequest("GET", "/api/auth/me", nil)
+		assert.Equal(t, http.StatusUnauthorized, withAPIKey(t, GetCurrentUser, req, expired, nil, nil))
+
+		status, active := create("writer", "author", models.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{"posts:read"}})
+		require.Equal(t, http.StatusCreated, status)
+		req = httptest.NewRequest("GET", "/api/auth/me", nil)
+		require.Equal(t, http.StatusOK, withAPIKey(t, GetCurrentUser, req, active.Key, nil, nil))
+
+		require.NoError(t, db.UpdateUser(writer.ID, &models.User{Active: false}))
+		req = httptest.NewRequest("GET", "/api/auth/me", nil)
+		assert.Equal(t, http.StatusUnauthorized, withAPIKey(t, GetCurrentUser, req, active.Key, nil, nil))
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webenable-cms-backend/audit"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordAudit records a mutation made through r in the audit log. before
+// and after are the target as it was and as it is now, nil for created and
+// deleted targets. The mutation has happened by then, so failing to record
+// it is logged rather than failing the request.
+func recordAudit(r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         middleware.ClientIP(r),
+		RequestID:  middleware.GetRequestID(r),
+	}
+	if claims, ok := r.Context().Value("user").(*middleware.Claims); ok {
+		event.ActorID = claims.Subject
+		event.Actor = claims.Username
+		event.APIKeyID = claims.APIKeyID
+	}
+
+	saveAuditEvent(event, before, after)
+}
+
+// recordJobAudit records a mutation made by a background job
+func recordJobAudit(job, action, targetType, targetID string, before, after interface{}) {
+	saveAuditEvent(&models.AuditEvent{
+		Actor:      job,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}, before, after)
+}
+
+func saveAuditEvent(event *models.AuditEvent, before, after interface{}) {
+	if globalContainer == nil {
+		return
+	}
+
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		utils.LogError(err, "Failed to compute audit changes", logrus.Fields{
+			"action":    event.Action,
+			"target_id": event.TargetID,
+		})
+	}
+	event.Changes = changes
+
+	if err := globalContainer.Database().CreateAuditEvent(event); err != nil {
+		utils.LogError(err, "Failed to record audit event", logrus.Fields{
+			"action":     event.Action,
+			"actor":      event.Actor,
+			"target_id":  event.TargetID,
+			"request_id": event.RequestID,
+		})
+	}
+}
+
+// getAuditQuery reads the filters of an audit log request
+func getAuditQuery(r *http.Request, options models.ListOptions) (models.AuditQuery, error) {
+	params := r.URL.Query()
+	query := models.AuditQuery{
+		Actor:       params.Get("actor"),
+		Action:      params.Get("action"),
+		TargetType:  params.Get("target_type"),
+		TargetID:    params.Get("target_id"),
+		ListOptions: options,
+	}
+
+	var err error
+	query.Created, err = getTimeRange(r, "created")
+	return query, err
+}
+
+// GetAuditEvents godoc
+//
+//	@Summary		List audit events
+//	@Description	List who changed what, with filters and page or cursor pagination (needs audit:read). Changes hold the value of each changed field before and after; secret fields are redacted.
+//	@Tags			Audit
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			actor			query		string	false	"Filter by the username of the actor, or the name of a background job like scheduler"
+//	@Param			action			query		string	false	"Filter by action, like post.delete or user.update"
+//	@Param			target_type		query		string	false	"Filter by target type, like post, user, contact or rate_limit"
+//	@Param			target_id		query		string	false	"Filter by target ID"
+//	@Param			created_after	query		string	false	"Only events at or after this RFC 3339 time"
+//	@Param			created_before	query		string	false	"Only events at or before this RFC 3339 time"
+//	@Param			sort			query		string	false	"Sort field (created_at), prefix with - for descending (default: -created_at)"
+//	@Param			cursor			query		string	false	"Cursor from meta.next_cursor of the previous page"
+//	@Param			page			query		int		false	"Page number (default: 1)"
+//	@Param			limit			query		int		false	"Items per page (default: 10, max: 100)"
+//	@Success		200				{object}	models.PaginatedAuditResponse
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		500				{object}	models.ErrorResponse
+//	@Router			/admin/audit [get]
+func GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Audit, permissions.Read); !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+
+	list := getListRequest(r, "-created_at")
+	query, err := getAuditQuery(r, list.options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := db.ListAuditEvents(query)
+	if isListQueryError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to list audit events", logrus.Fields{})
+		http.Error(w, "Failed to fetch audit events", http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := list.meta(events.NextCursor, func() (int, error) { return db.CountAuditEvents(query) })
+	if err != nil {
+		utils.LogError(err, "Failed to count audit events", logrus.Fields{})
+		http.Error(w, "Failed to fetch audit events", http.StatusInternalServerError)
+		return
+	}
+
+	data := events.Events
+	if data == nil {
+		data = []models.AuditEvent{}
+	}
+
+	json.NewEncoder(w).Encode(models.PaginatedAuditResponse{
+		Data: data,
+		Meta: meta,
+	})
+}
+
+// ExportAuditEvents godoc
+//
+//	@Summary		Export audit events
+//	@Description	Download the audit events matching the filters as JSON Lines, one event per line, oldest first (needs audit:read)
+//	@Tags			Audit
+//	@Produce		application/x-ndjson
+//	@Security		BearerAuth
+//	@Param			actor			query		string	false	"Filter by the username of the actor, or the name of a background job like scheduler"
+//	@Param			action			query		string	false	"Filter by action, like post.delete or user.update"
+//	@Param			target_type		query		string	false	"Filter by target type, like post, user, contact or rate_limit"
+//	@Param			target_id		query		string	false	"Filter by target ID"
+//	@Param			created_after	query		string	false	"Only events at or after this RFC 3339 time"
+//	@Param			created_before	query		string	false	"Only events at or before this RFC 3339 time"
+//	@Success		200				{string}	string	"One JSON encoded models.AuditEvent per line"
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		500				{object}	models.ErrorResponse
+//	@Router			/admin/audit/export [get]
+func ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, permissions.Audit, permissions.Read); !ok {
+		return
+	}
+
+	query, err := getAuditQuery(r, models.ListOptions{Sort: "created_at", Limit: loadBatchSize})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	// The first page is loaded before the headers are written, so a broken
+	// query still gets an error status
+	page, err := db.ListAuditEvents(query)
+	if err != nil {
+		utils.LogError(err, "Failed to list audit events", logrus.Fields{})
+		http.Error(w, "Failed to export audit events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="audit-%s.jsonl"`, time.Now().UTC().Format("20060102-150405")))
+
+	encoder := json.NewEncoder(w)
+	for {
+		for i := range page.Events {
+			if err := encoder.Encode(&page.Events[i]); err != nil {
+				return
+			}
+		}
+		if page.NextCursor == "" {
+			return
+		}
+
+		query.Cursor = page.NextCursor
+		if page, err = db.ListAuditEvents(query); err != nil {
+			// The status is sent; the export ends short
+			utils.LogError(err, "Failed to list audit events", logrus.Fields{})
+			return
+		}
+	}
+}
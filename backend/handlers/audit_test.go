@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/audit"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	db := setupTestContainer(t)
+
+	// Requests go through the request ID middleware like they do in main
+	call := func(handler http.HandlerFunc, req *http.Request, body, out interface{}) int {
+		req.Header.Set(middleware.RequestIDHeader, "req-"+req.Method)
+		return callJSON(t, middleware.RequestID(handler).ServeHTTP, req, body, out)
+	}
+	events := func(query string) []models.AuditEvent {
+		var response models.PaginatedAuditResponse
+		req := asUser(httptest.NewRequest("GET", "/api/admin/audit?"+query, nil), "admin", "admin")
+		require.Equal(t, http.StatusOK, callJSON(t, GetAuditEvents, req, nil, &response))
+		return response.Data
+	}
+
+	var user models.User
+	req := asUser(httptest.NewRequest("POST", "/api/admin/users", nil), "admin", "admin")
+	require.Equal(t, http.StatusCreated, call(CreateUser, req, map[string]interface{}{
+		"username": "editor",
+		"email":    "editor@example.com",
+		"password": "correct horse battery",
+		"role":     "editor",
+		"active":   true,
+	}, &user))
+
+	req = mux.SetURLVars(asUser(httptest.NewRequest("PUT", "/api/admin/users/"+user.ID, nil), "admin", "admin"),
+		map[string]string{"id": user.ID})
+	require.Equal(t, http.StatusOK, call(UpdateUser, req, map[string]interface{}{
+		"role":     "author",
+		"password": "staple lamp river moon",
+	}, nil))
+
+	contact := &models.Contact{Name: "Jane", Email: "jane@example.com", Subject: "Hi", Message: "Hello", Status: "new"}
+	require.NoError(t, db.CreateContact(contact))
+	req = mux.SetURLVars(asUser(httptest.NewRequest("PUT", "/api/admin/contacts/"+contact.ID, nil), "admin", "admin"),
+		map[string]string{"id": contact.ID})
+	require.Equal(t, http.StatusOK, call(UpdateContactStatus, req, map[string]string{"status": "read"}, nil))
+	req = mux.SetURLVars(asUser(httptest.NewRequest("DELETE", "/api/admin/contacts/"+contact.ID, nil), "admin", "admin"),
+		map[string]string{"id": contact.ID})
+	require.Equal(t, http.StatusNoContent, call(DeleteContact, req, nil, nil))
+
+	t.Run("Records users", func(t *testing.T) {
+		logged := events("target_type=user&target_id=" + user.ID + "&sort=created_at")
+		require.Len(t, logged, 2)
+
+		created := logged[0]
+		assert.Equal(t, "user.create", created.Action)
+		assert.Equal(t, "admin", created.Actor)
+		assert.Equal(t, "req-POST", created.RequestID)
+		assert.Equal(t, "192.0.2.1", created.IP)
+		assert.Equal(t, "editor", created.Changes["username"].After)
+		assert.Equal(t, models.AuditChange{After: audit.Redacted}, created.Changes["password_hash"])
+
+		updated := logged[1]
+		assert.Equal(t, "user.update", updated.Action)
+		assert.Equal(t, "req-PUT", updated.RequestID)
+		assert.Equal(t, models.AuditChange{Before: "editor", After: "author"}, updated.Changes["role"])
+		assert.Equal(t, models.AuditChange{Before: audit.Redacted, After: audit.Redacted}, updated.Changes["password_hash"])
+		assert.NotContains(t, updated.Changes, "username")
+	})
+
+	t.Run("Records contacts", func(t *testing.T) {
+		logged := events("target_id=" + contact.ID + "&sort=created_at")
+		require.Len(t, logged, 2)
+		assert.Equal(t, "contact.update", logged[0].Action)
+		assert.Equal(t, models.AuditChange{Before: "new", After: "read"}, logged[0].Changes["status"])
+		assert.Equal(t, "contact.delete", logged[1].Action)
+		assert.Equal(t, "jane@example.com", logged[1].Changes["email"].Before)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		assert.Len(t, events("action=contact.delete"), 1)
+		assert.Len(t, events("actor=admin"), 4)
+		assert.Empty(t, events("actor=nobody"))
+		assert.Empty(t, events("created_before=2000-01-01T00:00:00Z"))
+
+		req := asUser(httptest.NewRequest("GET", "/api/admin/audit?created_after=yesterday", nil), "admin", "admin")
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, GetAuditEvents, req, nil, nil))
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		req := asUser(httptest.NewRequest("GET", "/api/admin/audit/export?actor=admin", nil), "admin", "admin")
+		rr := httptest.NewRecorder()
+		ExportAuditEvents(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), ".jsonl")
+
+		var actions []string
+		lines := bufio.NewScanner(rr.Body)
+		for lines.Scan() {
+			var event models.AuditEvent
+			require.NoError(t, json.Unmarshal(lines.Bytes(), &event))
+			actions = append(actions, event.Action)
+		}
+		assert.Equal(t, []string{"user.create", "user.update", "contact.update", "contact.delete"}, actions)
+	})
+
+	t.Run("Admins only", func(t *testing.T) {
+		for _, handler := range []http.HandlerFunc{GetAuditEvents, ExportAuditEvents} {
+			req := asUser(httptest.NewRequest("GET", "/api/admin/audit", nil), "editor", "editor")
+			assert.Equal(t, http.StatusForbidden, callJSON(t, handler, req, nil, nil))
+		}
+	})
+}
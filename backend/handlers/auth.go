@@ -2,28 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
+	"strings"
 
-	"webenable-cms-backend/config"
-	"webenable-cms-backend/database"
+	"webenable-cms-backend/adapters/auth"
 	"webenable-cms-backend/middleware"
 	"webenable-cms-backend/models"
+	"webenable-cms-backend/utils"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 )
 
 // Login godoc
 //
 //	@Summary		User login
-//	@Description	Authenticate user and return JWT token
+//	@Description	Authenticate user and return a short-lived JWT access token with a refresh token. Users with two-factor authentication enabled, or required for their role, get a challenge instead, to complete through /auth/login/2fa. After a few failed logins in a row with a username, further attempts are refused for a doubling delay, and after more the account is locked for a while.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			credentials	body		models.LoginRequest	true	"User credentials"
 //	@Success		200			{object}	models.LoginResponse
+//	@Success		202			{object}	models.TwoFactorChallenge	"Second factor required"
 //	@Failure		400			{object}	models.ErrorResponse
 //	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		429			{object}	models.ErrorResponse	"Too many failed logins with this username"
 //	@Router			/auth/login [post]
 func Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -34,60 +37,201 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user from database
-	user, err := database.GetUserByUsername(loginReq.Username)
-	if err != nil {
-		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	if user == nil || !user.CheckPassword(loginReq.Password) || !user.Active {
+	if refuseLockedLogin(w, loginReq.Username) {
+		return
+	}
+
+	// Get user from database. Every failure gets the same response in the
+	// same time, whether or not the username exists.
+	user, err := globalContainer.Database().GetUserByUsername(loginReq.Username)
+	if err != nil {
+		user = nil
+	}
+	if !checkLoginPassword(user, loginReq.Password) || !user.Active {
+		recordLoginFailure(r, loginReq.Username, user)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	upgradePasswordHash(user, loginReq.Password)
 
-	// Create JWT token
-	claims := &middleware.Claims{
+	challenge, err := twoFactorChallenge(r, user)
+	if errors.Is(err, errLoginLocked) {
+		writeLoginLocked(w, user.Username)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to check two-factor authentication", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to check two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	// Create tokens through the auth adapter so the middleware can validate them
+	result, err := globalContainer.Auth().IssueTokens(auth.AuthClaims{
+		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		Email:    user.Email,
+	})
+	if err != nil {
+		utils.LogError(err, "Failed to issue tokens", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	clearLoginFailures(user.Username)
+	startSession(r, result, user)
+
+	json.NewEncoder(w).Encode(loginResponse(result, user))
+}
+
+// RefreshToken godoc
+//
+//	@Summary		Refresh access token
+//	@Description	Redeem a refresh token for a new access token and refresh token. Each refresh token can be used once; reusing one revokes every token of its login.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.RefreshTokenRequest	true	"Refresh token"
+//	@Success		200		{object}	models.LoginResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Router			/auth/refresh [post]
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	authAdapter := globalContainer.Auth()
+	claims, err := authAdapter.RefreshToken(req.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		utils.LogWarning("Refresh token reused, revoked its session", logrus.Fields{
+			"remote_addr": r.RemoteAddr,
+		})
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrRevoked), errors.Is(err, auth.ErrUnknownToken):
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		utils.LogError(err, "Failed to redeem refresh token", logrus.Fields{})
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	// Signed out sessions can't be renewed
+	if sessionRevoked(claims.SessionID) {
+		if err := authAdapter.RevokeToken(req.RefreshToken); err != nil {
+			utils.LogError(err, "Failed to revoke refresh token", logrus.Fields{
+				"user_id": claims.UserID,
+			})
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Users deactivated or deleted since login lose their session
+	user, err := globalContainer.Database().GetUser(claims.UserID)
+	if err != nil || !user.Active {
+		if err := authAdapter.RevokeToken(req.RefreshToken); err != nil {
+			utils.LogError(err, "Failed to revoke refresh token", logrus.Fields{
+				"user_id": claims.UserID,
+			})
+		}
+		http.Error(w, "User not found or inactive", http.StatusUnauthorized)
+		return
+	}
+
+	// Sessions from before two-factor authentication became required for
+	// the user end here, so the next login sets it up
+	missing, err := missingRequiredTwoFactor(user)
+	if err != nil {
+		utils.LogError(err, "Failed to check two-factor authentication", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	if missing {
+		if err := authAdapter.RevokeToken(req.RefreshToken); err != nil {
+			utils.LogError(err, "Failed to revoke refresh token", logrus.Fields{
+				"user_id": user.ID,
+			})
+		}
+		http.Error(w, "Two-factor authentication required", http.StatusUnauthorized)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(config.AppConfig.JWTSecret)
+	// The role may have changed since login
+	result, err := authAdapter.IssueTokens(auth.AuthClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Email:     user.Email,
+		SessionID: claims.SessionID,
+	})
 	if err != nil {
+		utils.LogError(err, "Failed to issue tokens", logrus.Fields{
+			"user_id": user.ID,
+		})
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	response := models.LoginResponse{
-		Token: tokenString,
+	json.NewEncoder(w).Encode(loginResponse(result, user))
+}
+
+// loginResponse builds the response for newly issued tokens
+func loginResponse(result *auth.AuthResult, user *models.User) models.LoginResponse {
+	expiresAt := result.ExpiresAt
+	return models.LoginResponse{
+		Token:        result.Token,
+		RefreshToken: result.RefreshToken,
+		ExpiresAt:    &expiresAt,
 		User: models.User{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-			Active:   user.Active,
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			Role:          user.Role,
+			Active:        user.Active,
 		},
 	}
-
-	json.NewEncoder(w).Encode(response)
 }
 
 // GetCurrentUser godoc
 //
 //	@Summary		Get current user
-//	@Description	Get current authenticated user information
+//	@Description	Get current authenticated user information with the effective permissions of their role, limited to the scopes of the API key when one is used
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Security		BearerAuth
-//	@Success		200	{object}	models.LoginResponse
+//	@Success		200	{object}	models.CurrentUserResponse
 //	@Failure		401	{object}	models.ErrorResponse
-//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
 //	@Router			/auth/me [get]
 //
 // GetCurrentUser returns the current authenticated user from JWT claims
@@ -101,27 +245,37 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
 	// Verify user still exists and is active
-	user, err := database.GetUserByUsername(claims.Username)
-	if err != nil || user == nil || !user.Active {
+	user, err := globalContainer.Database().GetUserByUsername(claims.Username)
+	if err != nil || !user.Active {
 		http.Error(w, "User not found or inactive", http.StatusUnauthorized)
 		return
 	}
 
-	// Ensure user has admin role
-	if user.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	set, err := claimPermissions(claims)
+	if err != nil {
+		utils.LogError(err, "Failed to load role permissions", logrus.Fields{
+			"role": claims.Role,
+		})
+		http.Error(w, "Failed to load permissions", http.StatusInternalServerError)
 		return
 	}
 
-	response := models.LoginResponse{
+	response := models.CurrentUserResponse{
 		User: models.User{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-			Active:   user.Active,
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			Role:          user.Role,
+			Active:        user.Active,
 		},
+		Permissions: set.Effective(),
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -130,17 +284,49 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 // Logout godoc
 //
 //	@Summary		User logout
-//	@Description	Logout user (client-side token invalidation)
+//	@Description	Revoke the bearer access token and the refresh token in the body, if any, together with every other token of the same login
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	models.SuccessResponse
+//	@Param			request	body		models.RefreshTokenRequest	false	"Refresh token"
+//	@Success		200		{object}	models.SuccessResponse
+//	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/auth/logout [post]
 //
-// Logout for cookieless auth simply returns success
-// Token invalidation is handled client-side
+// Logout revokes the tokens it is given. Invalid or expired tokens are
+// ignored, so logging out always succeeds for the client.
 func Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+
+	var tokens []string
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		tokens = append(tokens, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	var req models.RefreshTokenRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.RefreshToken != "" {
+			tokens = append(tokens, req.RefreshToken)
+		}
+	}
+
+	if len(tokens) > 0 && globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	for _, token := range tokens {
+		if err := endSession(token); err != nil {
+			utils.LogError(err, "Failed to end session", logrus.Fields{})
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		if err := globalContainer.Auth().RevokeToken(token); err != nil && !errors.Is(err, auth.ErrUnknownToken) {
+			utils.LogError(err, "Failed to revoke token", logrus.Fields{})
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
 }
@@ -3,16 +3,138 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
+	"webenable-cms-backend/adapters"
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/adapters/cache"
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/adapters/storage"
+	"webenable-cms-backend/container"
+	"webenable-cms-backend/middleware"
 	"webenable-cms-backend/models"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// setupTestContainer points the handlers at a container backed by a fresh
+// SQLite database, an in-memory cache and local storage, seeded with an
+// active admin user
+func setupTestContainer(t *testing.T) database.DatabaseAdapter {
+	t.Helper()
+
+	db, err := database.NewSQLiteAdapter(map[string]interface{}{
+		"path": filepath.Join(t.TempDir(), "cms.db"),
+	})
+	require.NoError(t, err)
+
+	cacheAdapter, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+	authAdapter, err := auth.NewJWTAdapter(map[string]interface{}{
+		"secret": "test-secret",
+	}, cacheAdapter)
+	require.NoError(t, err)
+
+	localStorage, err := storage.NewLocalAdapter(map[string]interface{}{
+		"base_path":   filepath.Join(t.TempDir(), "uploads"),
+		"base_url":    "http://localhost:8080/uploads",
+		"signing_key": "test-secret",
+	})
+	require.NoError(t, err)
+	variants, err := storage.ParseImageVariants(storage.DefaultImageVariants)
+	require.NoError(t, err)
+	storageAdapter := storage.NewImageAdapter(storage.NewDedupAdapter(localStorage), variants)
+
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Role: "admin", Active: true}
+	require.NoError(t, admin.SetPassword("/juk+vfdbNk6TICg"))
+	require.NoError(t, db.CreateUser(admin))
+
+	previous := globalContainer
+	SetServiceContainer(container.NewContainerWithAdapters(&adapters.AdapterSet{
+		Database: db,
+		Cache:    cacheAdapter,
+		Auth:     authAdapter,
+		Storage:  storageAdapter,
+	}, nil))
+
+	t.Cleanup(func() {
+		SetServiceContainer(previous)
+		db.Close()
+	})
+
+	return db
+}
+
+// useDatabase points the handlers at db, keeping the other adapters of the
+// test container, until the test ends
+func useDatabase(t *testing.T, db database.DatabaseAdapter) {
+	t.Helper()
+
+	previous := globalContainer
+	SetServiceContainer(container.NewContainerWithAdapters(&adapters.AdapterSet{
+		Database: db,
+		Cache:    previous.Cache(),
+		Auth:     previous.Auth(),
+		Storage:  previous.Storage(),
+	}, nil))
+	t.Cleanup(func() { SetServiceContainer(previous) })
+}
+
+// errUnreachable is what unreachableDB fails with
+var errUnreachable = errors.New("connection refused")
+
+// unreachableDB fails the post, category and contact operations the way a
+// database that went away would. Users and media still work, so requests get
+// past authentication and media lookups.
+type unreachableDB struct {
+	database.DatabaseAdapter
+}
+
+func (unreachableDB) GetPost(id string) (*models.Post, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) UpdatePost(id string, post *models.Post) error {
+	return errUnreachable
+}
+
+func (unreachableDB) ListPosts(query models.PostQuery) (*models.PostList, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) CountPosts(query models.PostQuery) (int, error) {
+	return 0, errUnreachable
+}
+
+func (unreachableDB) GetCategories() ([]models.Category, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) CreateContact(contact *models.Contact) error {
+	return errUnreachable
+}
+
+func (unreachableDB) ListContacts(query models.ContactQuery) (*models.ContactList, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableDB) UpdateContact(id string, contact *models.Contact) error {
+	return errUnreachable
+}
+
+func (unreachableDB) DeleteContact(id string) error {
+	return errUnreachable
+}
+
 func TestLogin(t *testing.T) {
+	setupTestContainer(t)
+
 	tests := []struct {
 		name           string
 		requestBody    models.LoginRequest
@@ -92,6 +214,8 @@ func TestLogin(t *testing.T) {
 				err := json.Unmarshal(rr.Body.Bytes(), &response)
 				assert.NoError(t, err)
 				assert.NotEmpty(t, response.Token)
+				assert.NotEmpty(t, response.RefreshToken)
+				assert.NotNil(t, response.ExpiresAt)
 				assert.Equal(t, tt.requestBody.Username, response.User.Username)
 			}
 		})
@@ -124,3 +248,145 @@ func TestLogout(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Logged out successfully", response["message"])
 }
+
+// login logs in as the seeded admin and returns the issued tokens
+func login(t *testing.T) models.LoginResponse {
+	t.Helper()
+
+	body, err := json.Marshal(models.LoginRequest{Username: "admin", Password: "/juk+vfdbNk6TICg"})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	Login(rr, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.LoginResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response
+}
+
+// refresh redeems a refresh token and returns the response
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.RefreshTokenRequest{RefreshToken: refreshToken})
+	rr := httptest.NewRecorder()
+	RefreshToken(rr, httptest.NewRequest("POST", "/api/auth/refresh", bytes.NewReader(body)))
+	return rr
+}
+
+// authorized reports whether the auth middleware accepts token
+func authorized(token string) bool {
+	handler := middleware.AuthMiddlewareWithAdapter(globalContainer.Auth())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code == http.StatusNoContent
+}
+
+func TestRefreshToken(t *testing.T) {
+	t.Run("Rotates the refresh token", func(t *testing.T) {
+		setupTestContainer(t)
+		session := login(t)
+
+		rr := refresh(session.RefreshToken)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var rotated models.LoginResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rotated))
+		assert.NotEqual(t, session.RefreshToken, rotated.RefreshToken)
+		assert.Equal(t, "admin", rotated.User.Username)
+		assert.True(t, authorized(rotated.Token))
+
+		assert.Equal(t, http.StatusOK, refresh(rotated.RefreshToken).Code)
+	})
+
+	t.Run("Reuse revokes the token family", func(t *testing.T) {
+		setupTestContainer(t)
+		session := login(t)
+		other := login(t)
+
+		rr := refresh(session.RefreshToken)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var rotated models.LoginResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rotated))
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(rotated.RefreshToken).Code)
+		assert.False(t, authorized(session.Token))
+		assert.False(t, authorized(rotated.Token))
+
+		// Other logins of the same user are unaffected
+		assert.True(t, authorized(other.Token))
+		assert.Equal(t, http.StatusOK, refresh(other.RefreshToken).Code)
+	})
+
+	t.Run("Rejects unknown tokens", func(t *testing.T) {
+		setupTestContainer(t)
+		assert.Equal(t, http.StatusUnauthorized, refresh("not-a-token").Code)
+		assert.Equal(t, http.StatusBadRequest, refresh("").Code)
+	})
+
+	t.Run("Rejects deactivated users", func(t *testing.T) {
+		db := setupTestContainer(t)
+		session := login(t)
+
+		admin, err := db.GetUserByUsername("admin")
+		require.NoError(t, err)
+		admin.Active = false
+		require.NoError(t, db.UpdateUser(admin.ID, admin))
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+	})
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	setupTestContainer(t)
+	session := login(t)
+	other := login(t)
+
+	body, err := json.Marshal(models.RefreshTokenRequest{RefreshToken: session.RefreshToken})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/api/auth/logout", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	rr := httptest.NewRecorder()
+	Logout(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.False(t, authorized(session.Token))
+	assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+	assert.True(t, authorized(other.Token))
+
+	// Logging out twice or with a bogus token still succeeds
+	req = httptest.NewRequest("POST", "/api/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer bogus")
+	rr = httptest.NewRecorder()
+	Logout(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestDeactivationRevokesTokens(t *testing.T) {
+	db := setupTestContainer(t)
+	editor := &models.User{Username: "editor", Email: "editor@example.com", Role: "editor", Active: true}
+	require.NoError(t, editor.SetPassword("kL9#vQ2!mZp4xR7w"))
+	require.NoError(t, db.CreateUser(editor))
+
+	result, err := globalContainer.Auth().IssueTokens(auth.AuthClaims{
+		UserID:   editor.ID,
+		Username: editor.Username,
+		Role:     editor.Role,
+	})
+	require.NoError(t, err)
+	require.True(t, authorized(result.Token))
+
+	body, err := json.Marshal(map[string]interface{}{"active": false})
+	require.NoError(t, err)
+	req := httptest.NewRequest("PUT", "/api/users/"+editor.ID, bytes.NewReader(body))
+	req = mux.SetURLVars(asUser(req, "admin", "admin"), map[string]string{"id": editor.ID})
+	rr := httptest.NewRecorder()
+	UpdateUser(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.False(t, authorized(result.Token))
+	assert.Equal(t, http.StatusUnauthorized, refresh(result.RefreshToken).Code)
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// GetCategories godoc
+//
+//	@Summary		Get all categories
+//	@Description	Get all post categories ordered by name
+//	@Tags			Categories
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		models.Category
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/categories [get]
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := globalContainer.Database().GetCategories()
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+
+	if categories == nil {
+		categories = []models.Category{}
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	json.NewEncoder(w).Encode(categories)
+}
+
+// GetCategory godoc
+//
+//	@Summary		Get category
+//	@Description	Get a single category by slug or ID
+//	@Tags			Categories
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		string	true	"Category slug or ID"
+//	@Success		200	{object}	models.Category
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Router			/categories/{id} [get]
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	db := globalContainer.Database()
+	category, err := db.GetCategoryBySlug(id)
+	if err != nil {
+		category, err = db.GetCategory(id)
+		if err != nil {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+// CreateCategory godoc
+//
+//	@Summary		Create category
+//	@Description	Create a new post category (admin and editor only)
+//	@Tags			Categories
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			category	body		models.Category	true	"Category data"
+//	@Success		201			{object}	models.Category
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		409			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/admin/categories [post]
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Categories, permissions.Create); !ok {
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if category.Name == "" {
+		http.Error(w, "Category name is required", http.StatusBadRequest)
+		return
+	}
+
+	if category.Slug == "" {
+		category.Slug = category.Name
+	}
+	category.Slug = utils.Slugify(category.Slug)
+	if category.Slug == "" {
+		http.Error(w, "Invalid category slug", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	// Check if slug already exists
+	if existing, err := db.GetCategoryBySlug(category.Slug); err == nil && existing != nil {
+		http.Error(w, "Category slug already exists", http.StatusConflict)
+		return
+	}
+
+	// Post counts are maintained by the posts handlers
+	category.ID = ""
+	category.PostCount = 0
+
+	if err := db.CreateCategory(&category); err != nil {
+		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// UpdateCategory godoc
+//
+//	@Summary		Update category
+//	@Description	Update an existing category (admin and editor only). The slug cannot change while posts of any status use the category.
+//	@Tags			Categories
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		string			true	"Category ID"
+//	@Param			category	body		models.Category	true	"Category data"
+//	@Success		200			{object}	models.Category
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		404			{object}	models.ErrorResponse
+//	@Failure		409			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/admin/categories/{id} [put]
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Categories, permissions.Update); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req models.Category
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	existing, err := db.GetCategory(id)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Name != "" {
+		existing.Name = req.Name
+	}
+	existing.Description = req.Description
+	existing.Color = req.Color
+	existing.Icon = req.Icon
+
+	if req.Slug != "" {
+		slug := utils.Slugify(req.Slug)
+		if slug == "" {
+			http.Error(w, "Invalid category slug", http.StatusBadRequest)
+			return
+		}
+
+		if slug != existing.Slug {
+			// Posts reference categories by slug, so renaming would orphan them
+			inUse, err := categoryInUse(existing.Slug)
+			if err != nil {
+				http.Error(w, "Failed to update category", http.StatusInternalServerError)
+				return
+			}
+			if inUse {
+				http.Error(w, "Cannot change the slug of a category that has posts", http.StatusConflict)
+				return
+			}
+			if other, err := db.GetCategoryBySlug(slug); err == nil && other != nil {
+				http.Error(w, "Category slug already exists", http.StatusConflict)
+				return
+			}
+			existing.Slug = slug
+		}
+	}
+
+	if err := db.UpdateCategory(id, existing); err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(existing)
+}
+
+// DeleteCategory godoc
+//
+//	@Summary		Delete category
+//	@Description	Delete a category that no post of any status uses (admin and editor only)
+//	@Tags			Categories
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Category ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		409	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/categories/{id} [delete]
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Categories, permissions.Delete); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	db := globalContainer.Database()
+
+	category, err := db.GetCategory(id)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	inUse, err := categoryInUse(category.Slug)
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+	if inUse {
+		http.Error(w, "Cannot delete a category that has posts", http.StatusConflict)
+		return
+	}
+
+	if err := db.DeleteCategory(id); err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted successfully"})
+}
+
+// categoryInUse reports whether any post uses a category. PostCount only
+// counts published posts, but drafts and scheduled posts would be left with
+// an unknown category just the same.
+func categoryInUse(slug string) (bool, error) {
+	count, err := globalContainer.Database().CountPosts(models.PostQuery{Category: slug})
+	if err != nil {
+		utils.LogError(err, "Failed to count posts of category", logrus.Fields{
+			"category": slug,
+		})
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// normalizeCategories de-duplicates the category slugs of a post and checks
+// that every one of them exists
+func normalizeCategories(slugs []string) ([]string, error) {
+	if len(slugs) == 0 {
+		return slugs, nil
+	}
+
+	if globalContainer == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	db := globalContainer.Database()
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(slugs))
+
+	for _, slug := range slugs {
+		if slug == "" || seen[slug] {
+			continue
+		}
+		if _, err := db.GetCategoryBySlug(slug); err != nil {
+			return nil, fmt.Errorf("unknown category: %s", slug)
+		}
+		seen[slug] = true
+		normalized = append(normalized, slug)
+	}
+
+	return normalized, nil
+}
+
+// updateCategoryCounts keeps Category.PostCount in step with the number of
+// published posts in each category. Either post may be nil when a post is
+// created or deleted.
+func updateCategoryCounts(before, after *models.Post) {
+	if globalContainer == nil {
+		return
+	}
+
+	deltas := make(map[string]int)
+	if before != nil && before.Status == "published" {
+		for _, slug := range before.Categories {
+			deltas[slug]--
+		}
+	}
+	if after != nil && after.Status == "published" {
+		for _, slug := range after.Categories {
+			deltas[slug]++
+		}
+	}
+
+	db := globalContainer.Database()
+	for slug, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		if err := db.IncrementCategoryPostCount(slug, delta); err != nil {
+			utils.LogError(err, "Failed to update category post count", logrus.Fields{
+				"category": slug,
+				"delta":    delta,
+			})
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategoriesUsedByDrafts(t *testing.T) {
+	db := setupTestContainer(t)
+
+	category := &models.Category{Name: "News", Slug: "news"}
+	require.NoError(t, db.CreateCategory(category))
+	require.NoError(t, db.CreatePost(&models.Post{
+		Title:      "Draft",
+		Slug:       "draft",
+		Content:    "Not yet",
+		Author:     "admin",
+		Status:     "draft",
+		Categories: []string{"news"},
+	}))
+
+	onCategory := func(handler http.HandlerFunc, method string, body interface{}) int {
+		r := mux.SetURLVars(asUser(httptest.NewRequest(method, "/api/admin/categories/"+category.ID, nil), "admin", "admin"),
+			map[string]string{"id": category.ID})
+		return callJSON(t, handler, r, body, nil)
+	}
+
+	// Only published posts are counted, but drafts still use the category
+	stored, err := db.GetCategory(category.ID)
+	require.NoError(t, err)
+	require.Zero(t, stored.PostCount)
+
+	assert.Equal(t, http.StatusConflict, onCategory(UpdateCategory, "PUT", models.Category{Slug: "updates"}))
+	assert.Equal(t, http.StatusConflict, onCategory(DeleteCategory, "DELETE", nil))
+
+	assert.Equal(t, http.StatusOK, onCategory(UpdateCategory, "PUT", models.Category{Name: "Latest news"}))
+	_, err = db.GetCategoryBySlug("news")
+	assert.NoError(t, err)
+}
+
+func TestCategoryHandlers(t *testing.T) {
+	db := setupTestContainer(t)
+
+	news := &models.Category{Name: "News", Slug: "news"}
+	require.NoError(t, db.CreateCategory(news))
+	require.NoError(t, db.CreateCategory(&models.Category{Name: "Guides", Slug: "guides"}))
+
+	get := func(id string) (int, models.Category) {
+		var category models.Category
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/categories/"+id, nil), map[string]string{"id": id})
+		return callJSON(t, GetCategory, req, nil, &category), category
+	}
+	create := func(role string, category models.Category) (int, models.Category) {
+		var created models.Category
+		req := asUser(httptest.NewRequest("POST", "/api/admin/categories", nil), "chief", role)
+		return callJSON(t, CreateCategory, req, category, &created), created
+	}
+	onCategory := func(handler http.HandlerFunc, method, id string, body interface{}) int {
+		req := asUser(httptest.NewRequest(method, "/api/admin/categories/"+id, nil), "chief", "editor")
+		return callJSON(t, handler, mux.SetURLVars(req, map[string]string{"id": id}), body, nil)
+	}
+
+	t.Run("Lists categories by name", func(t *testing.T) {
+		var categories []models.Category
+		require.Equal(t, http.StatusOK, callJSON(t, GetCategories, httptest.NewRequest("GET", "/api/categories", nil), nil, &categories))
+		require.Len(t, categories, 2)
+		assert.Equal(t, "Guides", categories[0].Name)
+		assert.Equal(t, "News", categories[1].Name)
+	})
+
+	t.Run("Gets categories by slug or ID", func(t *testing.T) {
+		status, category := get("news")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, news.ID, category.ID)
+
+		status, category = get(news.ID)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "news", category.Slug)
+
+		status, _ = get("missing")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Creating validates the category", func(t *testing.T) {
+		status, _ := create("author", models.Category{Name: "Events"})
+		assert.Equal(t, http.StatusForbidden, status)
+		status, _ = create("editor", models.Category{Slug: "events"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = create("editor", models.Category{Name: "Events", Slug: "!!!"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = create("editor", models.Category{Name: "More news", Slug: "News"})
+		assert.Equal(t, http.StatusConflict, status)
+
+		status, created := create("editor", models.Category{Name: "Events & Talks", PostCount: 7})
+		require.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, "events-talks", created.Slug)
+		assert.Zero(t, created.PostCount)
+	})
+
+	t.Run("Updating checks the slug", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, onCategory(UpdateCategory, "PUT", "missing", models.Category{Name: "Gone"}))
+		assert.Equal(t, http.StatusBadRequest, onCategory(UpdateCategory, "PUT", news.ID, models.Category{Slug: "!!!"}))
+		assert.Equal(t, http.StatusConflict, onCategory(UpdateCategory, "PUT", news.ID, models.Category{Slug: "guides"}))
+
+		assert.Equal(t, http.StatusOK, onCategory(UpdateCategory, "PUT", news.ID, models.Category{Slug: "updates"}))
+		stored, err := db.GetCategory(news.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "updates", stored.Slug)
+		assert.Equal(t, "News", stored.Name)
+	})
+
+	t.Run("Categories that can't be checked aren't changed", func(t *testing.T) {
+		useDatabase(t, unreachableDB{db})
+
+		assert.Equal(t, http.StatusInternalServerError, callJSON(t, GetCategories, httptest.NewRequest("GET", "/api/categories", nil), nil, nil))
+		assert.Equal(t, http.StatusInternalServerError, onCategory(UpdateCategory, "PUT", news.ID, models.Category{Slug: "latest"}))
+		assert.Equal(t, http.StatusInternalServerError, onCategory(DeleteCategory, "DELETE", news.ID, nil))
+
+		stored, err := db.GetCategory(news.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "updates", stored.Slug)
+	})
+
+	t.Run("Deletes unused categories", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, onCategory(DeleteCategory, "DELETE", "missing", nil))
+		assert.Equal(t, http.StatusOK, onCategory(DeleteCategory, "DELETE", news.ID, nil))
+		_, err := db.GetCategory(news.ID)
+		assert.Error(t, err)
+	})
+}
@@ -1,18 +1,17 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
-	"webenable-cms-backend/database"
 	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
 
-	"github.com/go-kivik/kivik/v4"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 // SubmitContact godoc
@@ -32,6 +31,11 @@ import (
 func SubmitContact(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
 	var contact models.Contact
 	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -39,82 +43,130 @@ func SubmitContact(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set default values
+	contact.ID = ""
 	contact.Status = "new"
 	contact.CreatedAt = time.Now()
+	contact.ReadAt = nil
+	contact.RepliedAt = nil
 
-	// Generate a UUID for the document ID
-	contactID := uuid.New().String()
-	contact.ID = contactID
-
-	// Create a document map with proper CouchDB fields
-	doc := map[string]interface{}{
-		"_id":        contactID,
-		"name":       contact.Name,
-		"email":      contact.Email,
-		"company":    contact.Company,
-		"phone":      contact.Phone,
-		"subject":    contact.Subject,
-		"message":    contact.Message,
-		"status":     contact.Status,
-		"created_at": contact.CreatedAt,
-	}
-
-	ctx := context.Background()
-	rev, err := database.Instance.ContactsDB.Put(ctx, contactID, doc)
-	if err != nil {
+	if err := globalContainer.Database().CreateContact(&contact); err != nil {
 		http.Error(w, "Failed to submit contact form", http.StatusInternalServerError)
 		return
 	}
 
-	contact.Rev = rev
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Contact form submitted successfully",
-		"id":      contactID,
+		"id":      contact.ID,
 	})
 }
 
 // Protected endpoints - require authentication
+
+// GetContacts godoc
+//
+//	@Summary		Get contacts
+//	@Description	Get contact form submissions. All matching contacts are returned unless page, limit or cursor is given.
+//	@Tags			Contact
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			status			query		string	false	"Filter by status (new, read, replied)"
+//	@Param			created_after	query		string	false	"Only contacts created at or after this RFC 3339 time"
+//	@Param			created_before	query		string	false	"Only contacts created at or before this RFC 3339 time"
+//	@Param			sort			query		string	false	"Sort field (created_at), prefix with - for descending (default: -created_at)"
+//	@Param			cursor			query		string	false	"Cursor from meta.next_cursor of the previous page"
+//	@Param			page			query		int		false	"Page number"
+//	@Param			limit			query		int		false	"Items per page (max: 100)"
+//	@Success		200				{object}	map[string]interface{}
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		500				{object}	models.ErrorResponse
+//	@Router			/contacts [get]
 func GetContacts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if _, ok := authorize(w, r, permissions.Contacts, permissions.Read); !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	params := r.URL.Query()
+
 	// Get status filter from query parameters
-	statusFilter := r.URL.Query().Get("status")
+	statusFilter := params.Get("status")
+
+	list := getListRequest(r, "-created_at")
+	query := models.ContactQuery{
+		Status:      statusFilter,
+		ListOptions: list.options,
+	}
+
+	var err error
+	if query.Created, err = getTimeRange(r, "created"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	ctx := context.Background()
-	rows := database.Instance.ContactsDB.AllDocs(ctx, kivik.Param("include_docs", true))
-	defer rows.Close()
+	// Without paging parameters the whole list is returned, as the admin
+	// panel expects
+	paged := params.Has("page") || params.Has("limit") || params.Has("cursor")
+	if !paged {
+		query.Limit = loadBatchSize
+	}
 
 	var contacts []models.Contact
-	for rows.Next() {
-		var contact models.Contact
-		if err := rows.ScanDoc(&contact); err != nil {
-			continue
+	var nextCursor string
+	for {
+		page, err := db.ListContacts(query)
+		if isListQueryError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-
-		// Ensure the document ID and revision are set properly
-		if id, err := rows.ID(); err == nil && id != "" {
-			contact.ID = id
+		if err != nil {
+			utils.LogError(err, "Failed to list contacts", logrus.Fields{})
+			http.Error(w, "Failed to fetch contacts", http.StatusInternalServerError)
+			return
 		}
-		if rev, err := rows.Rev(); err == nil && rev != "" {
-			contact.Rev = rev
+
+		contacts = append(contacts, page.Contacts...)
+		nextCursor = page.NextCursor
+		if paged || nextCursor == "" {
+			break
 		}
+		query.Cursor = nextCursor
+	}
+
+	meta := map[string]interface{}{
+		"total":         len(contacts),
+		"status_filter": statusFilter,
+		"sort":          list.sort,
+	}
 
-		// Filter by status if specified
-		if statusFilter != "" && contact.Status != statusFilter {
-			continue
+	if paged {
+		pagination, err := list.meta(nextCursor, func() (int, error) { return db.CountContacts(query) })
+		if err != nil {
+			utils.LogError(err, "Failed to count contacts", logrus.Fields{})
+			http.Error(w, "Failed to fetch contacts", http.StatusInternalServerError)
+			return
 		}
 
-		contacts = append(contacts, contact)
+		meta["page"] = pagination.Page
+		meta["limit"] = pagination.Limit
+		meta["total"] = pagination.Total
+		meta["total_pages"] = pagination.TotalPages
+		meta["has_next"] = pagination.HasNext
+		meta["has_prev"] = pagination.HasPrev
+		if pagination.NextCursor != "" {
+			meta["next_cursor"] = pagination.NextCursor
+		}
 	}
 
 	// Return data in the expected format for frontend
 	response := map[string]interface{}{
 		"data": contacts,
-		"meta": map[string]interface{}{
-			"total":         len(contacts),
-			"status_filter": statusFilter,
-		},
+		"meta": meta,
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -123,30 +175,29 @@ func GetContacts(w http.ResponseWriter, r *http.Request) {
 func GetContact(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if _, ok := authorize(w, r, permissions.Contacts, permissions.Read); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	ctx := context.Background()
-	row := database.Instance.ContactsDB.Get(ctx, id)
-
-	var contact models.Contact
-	if err := row.ScanDoc(&contact); err != nil {
+	contact, err := globalContainer.Database().GetContact(id)
+	if err != nil {
 		http.Error(w, "Contact not found", http.StatusNotFound)
 		return
 	}
 
-	// Ensure the document ID and revision are set properly
-	contact.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		contact.Rev = rev
-	}
-
 	json.NewEncoder(w).Encode(contact)
 }
 
 func UpdateContactStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if _, ok := authorize(w, r, permissions.Contacts, permissions.Update); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -158,21 +209,16 @@ func UpdateContactStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	db := globalContainer.Database()
 
 	// Get existing contact
-	row := database.Instance.ContactsDB.Get(ctx, id)
-	var existingContact models.Contact
-	if err := row.ScanDoc(&existingContact); err != nil {
+	existingContact, err := db.GetContact(id)
+	if err != nil {
 		http.Error(w, "Contact not found", http.StatusNotFound)
 		return
 	}
 
-	// Ensure the document ID and revision are set properly
-	existingContact.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		existingContact.Rev = rev
-	}
+	before := *existingContact
 
 	// Update status and timestamps
 	existingContact.Status = updateData.Status
@@ -185,73 +231,54 @@ func UpdateContactStatus(w http.ResponseWriter, r *http.Request) {
 		existingContact.RepliedAt = &now
 	}
 
-	// Create a document map with proper CouchDB fields
-	doc := map[string]interface{}{
-		"_id":        existingContact.ID,
-		"_rev":       existingContact.Rev,
-		"name":       existingContact.Name,
-		"email":      existingContact.Email,
-		"company":    existingContact.Company,
-		"phone":      existingContact.Phone,
-		"subject":    existingContact.Subject,
-		"message":    existingContact.Message,
-		"status":     existingContact.Status,
-		"created_at": existingContact.CreatedAt,
-	}
-
-	if existingContact.ReadAt != nil {
-		doc["read_at"] = existingContact.ReadAt
-	}
-	if existingContact.RepliedAt != nil {
-		doc["replied_at"] = existingContact.RepliedAt
-	}
-
 	// Update in database
-	rev, err := database.Instance.ContactsDB.Put(ctx, id, doc)
-	if err != nil {
+	if err := db.UpdateContact(id, existingContact); err != nil {
 		http.Error(w, "Failed to update contact", http.StatusInternalServerError)
 		return
 	}
 
-	existingContact.Rev = rev
+	recordAudit(r, "contact.update", "contact", id, &before, existingContact)
+
 	json.NewEncoder(w).Encode(existingContact)
 }
 
 func DeleteContact(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if _, ok := authorize(w, r, permissions.Contacts, permissions.Delete); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	ctx := context.Background()
+	db := globalContainer.Database()
 
-	// Get existing contact to get revision
-	row := database.Instance.ContactsDB.Get(ctx, id)
-	var contact models.Contact
-	if err := row.ScanDoc(&contact); err != nil {
+	// Make sure the contact exists
+	contact, err := db.GetContact(id)
+	if err != nil {
 		http.Error(w, "Contact not found", http.StatusNotFound)
 		return
 	}
 
-	// Ensure we have the proper revision
-	contact.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		contact.Rev = rev
-	}
-
 	// Delete the contact
-	_, err := database.Instance.ContactsDB.Delete(ctx, id, contact.Rev)
-	if err != nil {
+	if err := db.DeleteContact(id); err != nil {
 		http.Error(w, "Failed to delete contact", http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(r, "contact.delete", "contact", id, contact, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func ReplyToContact(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if _, ok := authorize(w, r, permissions.Contacts, permissions.Update); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -265,53 +292,29 @@ func ReplyToContact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	row := database.Instance.ContactsDB.Get(ctx, id)
-	var contact models.Contact
-	if err := row.ScanDoc(&contact); err != nil {
+	db := globalContainer.Database()
+
+	contact, err := db.GetContact(id)
+	if err != nil {
 		http.Error(w, "Contact not found", http.StatusNotFound)
 		return
 	}
 
-	// Ensure the document ID and revision are set properly
-	contact.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		contact.Rev = rev
-	}
-
 	// Send email reply using the email service (optional in development)
 	if err := SendEmailReply(contact.Email, contact.Name, replyData.Subject, replyData.Message); err != nil {
 		// Log the error but don't fail the request in development
 		fmt.Printf("Email sending failed (continuing anyway): %v\n", err)
 	}
 
+	before := *contact
+
 	// Update contact status to "replied"
 	contact.Status = "replied"
 	now := time.Now()
 	contact.RepliedAt = &now
 
-	// Create a document map with proper CouchDB fields
-	doc := map[string]interface{}{
-		"_id":        contact.ID,
-		"_rev":       contact.Rev,
-		"name":       contact.Name,
-		"email":      contact.Email,
-		"company":    contact.Company,
-		"phone":      contact.Phone,
-		"subject":    contact.Subject,
-		"message":    contact.Message,
-		"status":     contact.Status,
-		"created_at": contact.CreatedAt,
-		"replied_at": contact.RepliedAt,
-	}
-
-	if contact.ReadAt != nil {
-		doc["read_at"] = contact.ReadAt
-	}
-
 	// Update in database
-	_, err := database.Instance.ContactsDB.Put(ctx, id, doc)
-	if err != nil {
+	if err := db.UpdateContact(id, contact); err != nil {
 		// Email was sent but couldn't update status - that's ok
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -320,6 +323,8 @@ func ReplyToContact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, "contact.reply", "contact", id, &before, contact)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Reply sent successfully and contact marked as replied",
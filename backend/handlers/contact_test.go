@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactHandlers(t *testing.T) {
+	db := setupTestContainer(t)
+	t.Setenv("SMTP_USER", "")
+	t.Setenv("SMTP_PASS", "")
+
+	submit := func(contact models.Contact) (int, string) {
+		var created struct {
+			ID string `json:"id"`
+		}
+		req := httptest.NewRequest("POST", "/api/contact", nil)
+		return callJSON(t, SubmitContact, req, contact, &created), created.ID
+	}
+	list := func(query, role string) (int, []models.Contact) {
+		var response struct {
+			Data []models.Contact `json:"data"`
+		}
+		req := asUser(httptest.NewRequest("GET", "/api/admin/contacts"+query, nil), "chief", role)
+		return callJSON(t, GetContacts, req, nil, &response), response.Data
+	}
+	onContact := func(handler http.HandlerFunc, method, id string, body, out interface{}) int {
+		req := asUser(httptest.NewRequest(method, "/api/admin/contacts/"+id, nil), "chief", "editor")
+		return callJSON(t, handler, mux.SetURLVars(req, map[string]string{"id": id}), body, out)
+	}
+
+	status, id := submit(models.Contact{
+		ID:      "chosen",
+		Name:    "Jane",
+		Email:   "jane@example.com",
+		Subject: "Quote",
+		Message: "How much?",
+		Status:  "replied",
+	})
+	require.Equal(t, http.StatusCreated, status)
+	require.NotEmpty(t, id)
+
+	t.Run("Submissions start out new", func(t *testing.T) {
+		assert.NotEqual(t, "chosen", id)
+		stored, err := db.GetContact(id)
+		require.NoError(t, err)
+		assert.Equal(t, "new", stored.Status)
+		assert.Nil(t, stored.RepliedAt)
+
+		req := httptest.NewRequest("POST", "/api/contact", strings.NewReader("{"))
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, SubmitContact, req, nil, nil))
+	})
+
+	t.Run("Listing needs contacts:read", func(t *testing.T) {
+		status, contacts := list("", "editor")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, contacts, 1)
+		assert.Equal(t, id, contacts[0].ID)
+
+		status, contacts = list("?status=replied", "editor")
+		require.Equal(t, http.StatusOK, status)
+		assert.Empty(t, contacts)
+
+		status, _ = list("?created_after=yesterday", "editor")
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = list("", "author")
+		assert.Equal(t, http.StatusForbidden, status)
+		req := httptest.NewRequest("GET", "/api/admin/contacts", nil)
+		assert.Equal(t, http.StatusUnauthorized, callJSON(t, GetContacts, req, nil, nil))
+	})
+
+	t.Run("Updates the status", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, onContact(GetContact, "GET", "missing", nil, nil))
+		assert.Equal(t, http.StatusNotFound, onContact(UpdateContactStatus, "PUT", "missing", map[string]string{"status": "read"}, nil))
+
+		req := asUser(httptest.NewRequest("PUT", "/api/admin/contacts/"+id, strings.NewReader("{")), "chief", "editor")
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, UpdateContactStatus, mux.SetURLVars(req, map[string]string{"id": id}), nil, nil))
+
+		var updated models.Contact
+		require.Equal(t, http.StatusOK, onContact(UpdateContactStatus, "PUT", id, map[string]string{"status": "read"}, &updated))
+		assert.Equal(t, "read", updated.Status)
+		assert.NotNil(t, updated.ReadAt)
+
+		var stored models.Contact
+		require.Equal(t, http.StatusOK, onContact(GetContact, "GET", id, nil, &stored))
+		assert.Equal(t, "read", stored.Status)
+	})
+
+	t.Run("Replies mark the contact replied", func(t *testing.T) {
+		reply := map[string]string{"subject": "Re: Quote", "message": "Let's talk"}
+		assert.Equal(t, http.StatusNotFound, onContact(ReplyToContact, "POST", "missing", reply, nil))
+		require.Equal(t, http.StatusOK, onContact(ReplyToContact, "POST", id, reply, nil))
+
+		stored, err := db.GetContact(id)
+		require.NoError(t, err)
+		assert.Equal(t, "replied", stored.Status)
+		assert.NotNil(t, stored.RepliedAt)
+	})
+
+	t.Run("Contacts that can't be stored report failure", func(t *testing.T) {
+		useDatabase(t, unreachableDB{db})
+
+		status, _ := submit(models.Contact{Name: "Joe", Email: "joe@example.com", Subject: "Hi", Message: "Hello"})
+		assert.Equal(t, http.StatusInternalServerError, status)
+		status, _ = list("", "editor")
+		assert.Equal(t, http.StatusInternalServerError, status)
+		assert.Equal(t, http.StatusInternalServerError, onContact(UpdateContactStatus, "PUT", id, map[string]string{"status": "new"}, nil))
+		assert.Equal(t, http.StatusInternalServerError, onContact(DeleteContact, "DELETE", id, nil, nil))
+
+		stored, err := db.GetContact(id)
+		require.NoError(t, err)
+		assert.Equal(t, "replied", stored.Status)
+	})
+
+	t.Run("Deletes contacts", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, onContact(DeleteContact, "DELETE", "missing", nil, nil))
+		assert.Equal(t, http.StatusNoContent, onContact(DeleteContact, "DELETE", id, nil, nil))
+		_, err := db.GetContact(id)
+		assert.Error(t, err)
+	})
+}
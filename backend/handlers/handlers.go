@@ -6,6 +6,8 @@ import (
 	"webenable-cms-backend/cache"
 	"webenable-cms-backend/container"
 	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/passwords"
+	"webenable-cms-backend/search"
 )
 
 // Handlers holds dependencies for all handlers
@@ -31,15 +33,13 @@ func NewHandlersWithContainer(valkeyClient *cache.ValkeyClient, container *conta
 
 // Global variables for backward compatibility
 var (
-	globalCache       *cache.ValkeyClient
 	globalRateLimiter *middleware.RateLimiter
 	globalContainer   *container.Container
-)
+	globalSearch      search.Index
+	globalSessions    *middleware.SessionManager
 
-// SetGlobalCache sets the global cache instance
-func SetGlobalCache(cache *cache.ValkeyClient) {
-	globalCache = cache
-}
+	globalPasswordPolicy = passwords.DefaultPolicy
+)
 
 // SetGlobalRateLimiter sets the global rate limiter instance
 func SetGlobalRateLimiter(rateLimiter *middleware.RateLimiter) {
@@ -51,6 +51,21 @@ func SetServiceContainer(container *container.Container) {
 	globalContainer = container
 }
 
+// SetSearchIndex sets the global search index instance
+func SetSearchIndex(index search.Index) {
+	globalSearch = index
+}
+
+// SetSessionManager sets the session manager that records logins
+func SetSessionManager(sessions *middleware.SessionManager) {
+	globalSessions = sessions
+}
+
+// SetPasswordPolicy sets the policy new passwords are checked against
+func SetPasswordPolicy(policy passwords.Policy) {
+	globalPasswordPolicy = policy
+}
+
 // GetServiceContainer returns the global service container instance
 func GetServiceContainer() *container.Container {
 	return globalContainer
@@ -75,3 +90,24 @@ func getPaginationParams(r *http.Request) (page, limit int) {
 
 	return page, limit
 }
+
+// loadBatchSize is the number of records loaded per database call by loadAll
+const loadBatchSize = 100
+
+// loadAll pages through a paginated adapter method and returns every record
+func loadAll[T any](fetch func(limit, offset int) ([]T, error)) ([]T, error) {
+	var all []T
+
+	for offset := 0; ; offset += loadBatchSize {
+		batch, err := fetch(loadBatchSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, batch...)
+
+		if len(batch) < loadBatchSize {
+			return all, nil
+		}
+	}
+}
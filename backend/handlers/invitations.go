@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	invitationPurpose = "invitation"
+	invitationTTL     = 7 * 24 * time.Hour
+)
+
+// pendingInvitation joins an invitation with its user
+func pendingInvitation(invitation *models.Invitation, user *models.User) models.PendingInvitation {
+	return models.PendingInvitation{
+		Invitation: *invitation,
+		Username:   user.Username,
+		Role:       user.Role,
+		Expired:    invitation.Expired(time.Now()),
+	}
+}
+
+// sendInvitation gives an invitation a new link, which replaces any earlier
+// one, and emails it to the invited user
+func sendInvitation(invitation *models.Invitation, user *models.User, invitedBy string) error {
+	token, hash, err := newAccountToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Email = user.Email
+	invitation.TokenHash = hash
+	invitation.InvitedBy = invitedBy
+	invitation.ExpiresAt = now.Add(invitationTTL)
+	invitation.SentAt = now
+	if err := globalContainer.Database().SaveInvitation(invitation); err != nil {
+		return err
+	}
+
+	sendAccountEmail(user.Email, "You're invited to WebEnable", fmt.Sprintf(`Hi %s,
+
+%s has invited you to join WebEnable as %s. To choose your password and activate your account, open this link within %s:
+
+%s
+
+If you weren't expecting this invitation, you can ignore this email.
+
+WebEnable Team`, user.Username, invitedBy, user.Role, invitationTTL, accountLink("/accept-invitation", token)))
+	return nil
+}
+
+// emailConfigured reports whether account emails can be sent, writing the
+// error response when they can't
+func emailConfigured(w http.ResponseWriter) bool {
+	emailAdapter := globalContainer.Email()
+	if emailAdapter == nil || !emailAdapter.IsConfigured() {
+		http.Error(w, "Email is not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// loadInvitation returns the invitation of the user in the path with the
+// user, writing the error response when there is none. Only admins manage
+// invitations of admins.
+func loadInvitation(w http.ResponseWriter, r *http.Request, claims *middleware.Claims) (*models.Invitation, *models.User, bool) {
+	db := globalContainer.Database()
+	userID := mux.Vars(r)["id"]
+
+	invitation, err := db.GetInvitation(userID)
+	if err != nil {
+		utils.LogError(err, "Failed to get invitation", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to get invitation", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if invitation == nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	if user.Role == permissions.AdminRole && claims.Role != permissions.AdminRole {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	return invitation, user, true
+}
+
+// GetInvitations godoc
+//
+//	@Summary		List pending invitations
+//	@Description	List the invitations not accepted yet, newest first, including expired ones (needs users:read)
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.PendingInvitation
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/invitations [get]
+func GetInvitations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	invitations, err := db.ListInvitations()
+	if err != nil {
+		utils.LogError(err, "Failed to list invitations", logrus.Fields{})
+		http.Error(w, "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+
+	pending := make([]models.PendingInvitation, 0, len(invitations))
+	for i := range invitations {
+		user, err := db.GetUser(invitations[i].UserID)
+		if err != nil {
+			utils.LogWarning("Invitation without user", logrus.Fields{
+				"user_id": invitations[i].UserID,
+			})
+			continue
+		}
+		pending = append(pending, pendingInvitation(&invitations[i], user))
+	}
+
+	json.NewEncoder(w).Encode(pending)
+}
+
+// CreateInvitation godoc
+//
+//	@Summary		Invite user
+//	@Description	Create an inactive user without a password and email them a single-use link, valid for 7 days, to choose their password with (needs users:create; only admins invite admins)
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			invitation	body		models.CreateInvitationRequest	true	"User to invite"
+//	@Success		201			{object}	models.PendingInvitation
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		409			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Failure		503			{object}	models.ErrorResponse
+//	@Router			/admin/invitations [post]
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Create)
+	if !ok {
+		return
+	}
+
+	var req models.CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.Email == "" || req.Role == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	valid, err := validRole(db, req.Role)
+	if err != nil {
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Only admins make admins
+	if req.Role == permissions.AdminRole && claims.Role != permissions.AdminRole {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	if existing, err := db.GetUserByUsername(req.Username); err == nil && existing != nil {
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	if existing, err := db.GetUserByEmail(req.Email); err == nil && existing != nil {
+		http.Error(w, "Email already exists", http.StatusConflict)
+		return
+	}
+
+	if !emailConfigured(w) {
+		return
+	}
+
+	// The user stays inactive, and can't log in, until they accept
+	user := &models.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Role:     req.Role,
+		Active:   false,
+	}
+	if err := db.CreateUser(user); err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	invitation := &models.Invitation{UserID: user.ID}
+	if err := sendInvitation(invitation, user, claims.Username); err != nil {
+		utils.LogError(err, "Failed to create invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+		if err := db.DeleteUser(user.ID); err != nil {
+			utils.LogError(err, "Failed to delete invited user", logrus.Fields{
+				"user_id": user.ID,
+			})
+		}
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "invitation.create", "user", user.ID, nil, user)
+
+	utils.LogInfo("User invited", logrus.Fields{
+		"user_id":    user.ID,
+		"invited_by": claims.Username,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pendingInvitation(invitation, user))
+}
+
+// ResendInvitation godoc
+//
+//	@Summary		Resend invitation
+//	@Description	Email a new invitation link, valid for 7 days, to an invited user. Earlier links stop working. (needs users:create)
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.PendingInvitation
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		503	{object}	models.ErrorResponse
+//	@Router			/admin/invitations/{id}/resend [post]
+func ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Create)
+	if !ok {
+		return
+	}
+
+	invitation, user, ok := loadInvitation(w, r, claims)
+	if !ok {
+		return
+	}
+
+	if !emailConfigured(w) {
+		return
+	}
+
+	before := *invitation
+	if err := sendInvitation(invitation, user, claims.Username); err != nil {
+		utils.LogError(err, "Failed to resend invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to resend invitation", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "invitation.resend", "user", user.ID, before, invitation)
+
+	json.NewEncoder(w).Encode(pendingInvitation(invitation, user))
+}
+
+// RevokeInvitation godoc
+//
+//	@Summary		Revoke invitation
+//	@Description	Revoke an invitation, deleting the invited user. The link stops working right away. (needs users:delete)
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/invitations/{id} [delete]
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Delete)
+	if !ok {
+		return
+	}
+
+	_, user, ok := loadInvitation(w, r, claims)
+	if !ok {
+		return
+	}
+
+	// The invitation goes with its user
+	if err := globalContainer.Database().DeleteUser(user.ID); err != nil {
+		utils.LogError(err, "Failed to revoke invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to revoke invitation", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "invitation.revoke", "user", user.ID, user, nil)
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Invitation revoked"})
+}
+
+// AcceptInvitation godoc
+//
+//	@Summary		Accept invitation
+//	@Description	Set the password of an invited user with the token of their invitation link, which activates the account. The link works once; a password rejected by the password policy leaves it usable.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.AcceptInvitationRequest	true	"Invitation token and password"
+//	@Success		200		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/invitations/accept [post]
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	db := globalContainer.Database()
+	hash := hashAccountToken(req.Token)
+	invitation, err := db.GetInvitationByTokenHash(hash)
+	if err != nil || invitation.Expired(time.Now()) {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUser(invitation.UserID)
+	if err != nil || user.Email != invitation.Email {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+
+	if !checkNewPassword(w, user, req.Password) {
+		return
+	}
+
+	// Accepted once, even when accepted concurrently
+	uses, err := globalContainer.Cache().IncrementCounter(accountTokenUsedKey(invitationPurpose, hash), invitationTTL)
+	if err != nil {
+		utils.LogError(err, "Failed to redeem invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		return
+	}
+	if uses > 1 {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+
+	updates := &models.User{Active: true}
+	if err := updates.SetPassword(req.Password); err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if err := db.UpdateUser(user.ID, updates); err != nil {
+		utils.LogError(err, "Failed to accept invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.DeleteInvitation(user.ID); err != nil {
+		utils.LogError(err, "Failed to delete invitation", logrus.Fields{
+			"user_id": user.ID,
+		})
+	}
+
+	// The link reached the user's inbox, which verifies the address
+	if err := db.MarkEmailVerified(user.ID, user.Email); err != nil {
+		utils.LogWarning("Failed to mark email verified", logrus.Fields{
+			"user_id": user.ID,
+			"error":   err.Error(),
+		})
+	}
+
+	utils.LogInfo("Invitation accepted", logrus.Fields{
+		"user_id": user.ID,
+	})
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Invitation accepted; you can now log in"})
+}
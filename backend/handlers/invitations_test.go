@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitations(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+
+	invite := func(role string, req models.CreateInvitationRequest) (int, models.PendingInvitation) {
+		var invitation models.PendingInvitation
+		r := asUser(httptest.NewRequest("POST", "/api/admin/invitations", nil), role, role)
+		return callJSON(t, CreateInvitation, r, req, &invitation), invitation
+	}
+	list := func() []models.PendingInvitation {
+		var invitations []models.PendingInvitation
+		r := asUser(httptest.NewRequest("GET", "/api/admin/invitations", nil), "admin", "admin")
+		require.Equal(t, http.StatusOK, callJSON(t, GetInvitations, r, nil, &invitations))
+		return invitations
+	}
+	onInvitation := func(handler http.HandlerFunc, method, path, userID string, out interface{}) int {
+		r := mux.SetURLVars(asUser(httptest.NewRequest(method, "/api/admin/invitations/"+userID+path, nil), "admin", "admin"),
+			map[string]string{"id": userID})
+		return callJSON(t, handler, r, nil, out)
+	}
+	accept := func(token, password string) int {
+		r := httptest.NewRequest("POST", "/api/auth/invitations/accept", nil)
+		return callJSON(t, AcceptInvitation, r, models.AcceptInvitationRequest{Token: token, Password: password}, nil)
+	}
+	loginAs := func(username, password string) int {
+		body, err := json.Marshal(models.LoginRequest{Username: username, Password: password})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	jane := models.CreateInvitationRequest{Username: "jane", Email: "jane@example.com", Role: "editor"}
+
+	t.Run("Only admins invite admins", func(t *testing.T) {
+		status, _ := invite("editor", models.CreateInvitationRequest{Username: "boss", Email: "boss@example.com", Role: "admin"})
+		assert.Equal(t, http.StatusForbidden, status)
+		emails.none(t)
+	})
+
+	status, invitation := invite("admin", jane)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "jane", invitation.Username)
+	assert.Equal(t, "editor", invitation.Role)
+	assert.Equal(t, "admin", invitation.InvitedBy)
+	assert.False(t, invitation.Expired)
+	assert.WithinDuration(t, time.Now().Add(invitationTTL), invitation.ExpiresAt, 5*time.Second)
+
+	message := emails.next(t)
+	assert.Equal(t, []string{"jane@example.com"}, message.To)
+	assert.Equal(t, "You're invited to WebEnable", message.Subject)
+	firstToken := linkToken(t, message)
+
+	t.Run("Invited users are pending", func(t *testing.T) {
+		user, err := db.GetUser(invitation.UserID)
+		require.NoError(t, err)
+		assert.False(t, user.Active)
+		assert.Empty(t, user.PasswordHash)
+
+		status, _ := invite("admin", jane)
+		assert.Equal(t, http.StatusConflict, status)
+
+		invitations := list()
+		require.Len(t, invitations, 1)
+		assert.Equal(t, invitation.UserID, invitations[0].UserID)
+	})
+
+	t.Run("Resending replaces the link", func(t *testing.T) {
+		var resent models.PendingInvitation
+		require.Equal(t, http.StatusOK, onInvitation(ResendInvitation, "POST", "/resend", invitation.UserID, &resent))
+		assert.Equal(t, invitation.CreatedAt.Unix(), resent.CreatedAt.Unix())
+
+		token := linkToken(t, emails.next(t))
+		assert.Equal(t, http.StatusBadRequest, accept(firstToken, "correct horse battery"))
+
+		// A rejected password keeps the link usable
+		assert.Equal(t, http.StatusBadRequest, accept(token, "password"))
+		require.Equal(t, http.StatusOK, accept(token, "correct horse battery"))
+		assert.Equal(t, http.StatusBadRequest, accept(token, "staple lamp river moon"))
+
+		user, err := db.GetUser(invitation.UserID)
+		require.NoError(t, err)
+		assert.True(t, user.Active)
+		assert.True(t, user.EmailVerified)
+		assert.Equal(t, http.StatusOK, loginAs("jane", "correct horse battery"))
+
+		assert.Empty(t, list())
+		assert.Equal(t, http.StatusNotFound, onInvitation(ResendInvitation, "POST", "/resend", invitation.UserID, nil))
+	})
+
+	t.Run("Revoking deletes the invited user", func(t *testing.T) {
+		status, invitation := invite("admin", models.CreateInvitationRequest{Username: "joe", Email: "joe@example.com", Role: "author"})
+		require.Equal(t, http.StatusCreated, status)
+		token := linkToken(t, emails.next(t))
+
+		require.Equal(t, http.StatusOK, onInvitation(RevokeInvitation, "DELETE", "", invitation.UserID, nil))
+		_, err := db.GetUser(invitation.UserID)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, accept(token, "correct horse battery"))
+		assert.Equal(t, http.StatusNotFound, onInvitation(RevokeInvitation, "DELETE", "", invitation.UserID, nil))
+	})
+
+	t.Run("Expired links don't work", func(t *testing.T) {
+		status, invitation := invite("admin", models.CreateInvitationRequest{Username: "ann", Email: "ann@example.com", Role: "author"})
+		require.Equal(t, http.StatusCreated, status)
+		token := linkToken(t, emails.next(t))
+
+		stored, err := db.GetInvitation(invitation.UserID)
+		require.NoError(t, err)
+		stored.ExpiresAt = time.Now().Add(-time.Minute)
+		require.NoError(t, db.SaveInvitation(stored))
+
+		assert.Equal(t, http.StatusBadRequest, accept(token, "correct horse battery"))
+		invitations := list()
+		require.Len(t, invitations, 1)
+		assert.True(t, invitations[0].Expired)
+	})
+}
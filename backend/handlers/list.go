@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+)
+
+// listRequest holds the paging parameters of a list request. Lists are
+// either paged with page/limit or followed with the opaque cursor returned
+// in the previous response.
+type listRequest struct {
+	page    int
+	sort    string
+	options models.ListOptions
+}
+
+// getListRequest extracts sort, cursor and pagination parameters. sort is
+// a field name, prefixed with "-" for descending order.
+func getListRequest(r *http.Request, defaultSort string) listRequest {
+	page, limit := getPaginationParams(r)
+
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+
+	options := models.ListOptions{
+		Sort:   strings.TrimPrefix(sort, "-"),
+		Desc:   strings.HasPrefix(sort, "-"),
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if options.Cursor == "" {
+		options.Offset = (page - 1) * limit
+	}
+
+	return listRequest{page: page, sort: sort, options: options}
+}
+
+// meta builds the pagination metadata of a list response. The total is only
+// counted for page based requests.
+func (l listRequest) meta(nextCursor string, count func() (int, error)) (models.PaginationMeta, error) {
+	meta := models.PaginationMeta{
+		Limit:      l.options.Limit,
+		Sort:       l.sort,
+		NextCursor: nextCursor,
+		HasNext:    nextCursor != "",
+	}
+
+	if l.options.Cursor != "" {
+		meta.HasPrev = true
+		return meta, nil
+	}
+
+	total, err := count()
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Page = l.page
+	meta.Total = total
+	meta.TotalPages = int(math.Ceil(float64(total) / float64(l.options.Limit)))
+	meta.HasPrev = l.page > 1
+	if l.page >= meta.TotalPages {
+		meta.HasNext = false
+		meta.NextCursor = ""
+	}
+
+	return meta, nil
+}
+
+// getTimeRange parses the <name>_after and <name>_before RFC 3339 parameters
+func getTimeRange(r *http.Request, name string) (models.TimeRange, error) {
+	var timeRange models.TimeRange
+
+	for _, bound := range []struct {
+		param  string
+		target **time.Time
+	}{
+		{name + "_after", &timeRange.From},
+		{name + "_before", &timeRange.To},
+	} {
+		value := r.URL.Query().Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return timeRange, fmt.Errorf("invalid %s: expected an RFC 3339 time", bound.param)
+		}
+		*bound.target = &t
+	}
+
+	return timeRange, nil
+}
+
+// getBoolParam parses an optional boolean parameter
+func getBoolParam(r *http.Request, name string) (*bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected true or false", name)
+	}
+	return &b, nil
+}
+
+// isListQueryError reports whether a list failed because of the request
+// rather than the database
+func isListQueryError(err error) bool {
+	return errors.Is(err, database.ErrInvalidCursor) || errors.Is(err, database.ErrInvalidSort)
+}
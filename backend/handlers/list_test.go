@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetListRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected models.ListOptions
+	}{
+		{
+			name:     "Defaults",
+			query:    "",
+			expected: models.ListOptions{Sort: "created_at", Desc: true, Limit: 10},
+		},
+		{
+			name:     "Ascending sort with page",
+			query:    "sort=title&page=3&limit=5",
+			expected: models.ListOptions{Sort: "title", Limit: 5, Offset: 10},
+		},
+		{
+			name:     "Descending sort",
+			query:    "sort=-view_count",
+			expected: models.ListOptions{Sort: "view_count", Desc: true, Limit: 10},
+		},
+		{
+			name:     "Cursor ignores page",
+			query:    "cursor=abc&page=4",
+			expected: models.ListOptions{Sort: "created_at", Desc: true, Limit: 10, Cursor: "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/posts?"+tt.query, nil)
+			assert.Equal(t, tt.expected, getListRequest(r, "-created_at").options)
+		})
+	}
+}
+
+func TestGetUsersPagination(t *testing.T) {
+	db := setupTestContainer(t)
+
+	for _, username := range []string{"carol", "bob", "dave"} {
+		require.NoError(t, db.CreateUser(&models.User{
+			Username: username, Email: username + "@example.com", Role: "editor", Active: true,
+		}))
+	}
+
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/users?"+params.Encode(), nil)
+		w := httptest.NewRecorder()
+		GetUsers(w, asUser(r, "admin", "admin"))
+		return w
+	}
+
+	var usernames []string
+	params := url.Values{"sort": {"username"}, "limit": {"3"}}
+	for page := 0; page < 3; page++ {
+		w := get(params)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response models.PaginatedUsersResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		for _, user := range response.Data {
+			usernames = append(usernames, user.Username)
+		}
+
+		assert.Equal(t, "username", response.Meta.Sort)
+		if page == 0 {
+			assert.Equal(t, 4, response.Meta.Total)
+			assert.Equal(t, 2, response.Meta.TotalPages)
+		}
+		if response.Meta.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", response.Meta.NextCursor)
+	}
+	assert.Equal(t, []string{"admin", "bob", "carol", "dave"}, usernames)
+
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{"Unknown sort field", url.Values{"sort": {"password_hash"}}},
+		{"Malformed cursor", url.Values{"cursor": {"!!"}}},
+		{"Cursor from another sort", url.Values{"sort": {"-created_at"}, "cursor": {params.Get("cursor")}}},
+		{"Invalid active flag", url.Values{"active": {"maybe"}}},
+		{"Invalid time", url.Values{"created_after": {"yesterday"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, get(tt.params).Code)
+		})
+	}
+}
+
+func TestGetPostsStatus(t *testing.T) {
+	db := setupTestContainer(t)
+
+	require.NoError(t, db.CreatePost(&models.Post{Title: "Live", Slug: "live", Status: "published"}))
+	require.NoError(t, db.CreatePost(&models.Post{Title: "Secret", Slug: "secret", Status: "draft"}))
+
+	list := func(r *http.Request) (int, []string) {
+		var response models.PaginatedPostsResponse
+		code := callJSON(t, GetPosts, r, nil, &response)
+		titles := make([]string, 0, len(response.Data))
+		for _, post := range response.Data {
+			titles = append(titles, post.Title)
+		}
+		return code, titles
+	}
+
+	code, titles := list(httptest.NewRequest("GET", "/api/posts?status=draft", nil))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Live"}, titles, "anonymous callers only see published posts")
+
+	code, _ = list(asUser(httptest.NewRequest("GET", "/api/posts?status=draft", nil), "guest", "guest"))
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, titles = list(asUser(httptest.NewRequest("GET", "/api/posts?status=draft", nil), "chief", "editor"))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Secret"}, titles)
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"webenable-cms-backend/config"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// loginFreeAttempts is the number of failed logins in a row before each
+	// further one delays the next attempt
+	loginFreeAttempts = 3
+	// loginBaseDelay is the first delay, doubled with every further failure
+	loginBaseDelay = time.Second
+	// loginFailureTTL is how long failed logins are remembered after the
+	// last one
+	loginFailureTTL = 24 * time.Hour
+
+	defaultLockoutThreshold = 10
+	defaultLockoutDuration  = 15 * time.Minute
+)
+
+const loginLockedMessage = "Too many failed login attempts, try again later"
+
+// errLoginLocked is returned when a login step is refused because logins
+// with its username are locked
+var errLoginLocked = errors.New("logins are locked")
+
+// Failed logins are tracked by username whether or not an account has it,
+// so the responses don't tell which usernames exist. Usernames are hashed
+// into the keys, which keeps them short and free of pattern characters.
+func loginFailuresKey(username string) string {
+	return "login_failures:" + hashAccountToken(strings.ToLower(username))
+}
+
+func loginLockKey(username string) string {
+	return "login_lock:" + hashAccountToken(strings.ToLower(username))
+}
+
+func loginChallengesKey(username string) string {
+	return "login_challenges:" + hashAccountToken(strings.ToLower(username))
+}
+
+// lockoutSettings returns after how many failed logins an account is
+// locked and for how long. A threshold of 0 turns lockout off.
+func lockoutSettings() (int, time.Duration) {
+	if config.AppConfig == nil {
+		return defaultLockoutThreshold, defaultLockoutDuration
+	}
+	return config.AppConfig.LoginLockoutThreshold, config.AppConfig.LoginLockoutDuration
+}
+
+// loginDelay returns how long logins are refused after the given number of
+// failed logins in a row: not at all for the first few, then for a doubling
+// delay up to the lockout at threshold
+func loginDelay(failures int64, threshold int, lockout time.Duration) time.Duration {
+	if threshold <= 0 {
+		return 0
+	}
+	if failures >= int64(threshold) {
+		return lockout
+	}
+	if failures < loginFreeAttempts {
+		return 0
+	}
+
+	exponent := float64(failures - loginFreeAttempts)
+	delay := time.Duration(float64(loginBaseDelay) * math.Pow(2, exponent))
+	if delay > lockout || delay <= 0 {
+		return lockout
+	}
+	return delay
+}
+
+// loginLockedUntil returns until when logins with username are refused, or
+// the zero time
+func loginLockedUntil(username string) time.Time {
+	var until time.Time
+	if err := globalContainer.Cache().Get(loginLockKey(username), &until); err != nil || time.Now().After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// refuseLockedLogin answers a login attempt with username while logins with
+// it are refused and reports whether it did
+func refuseLockedLogin(w http.ResponseWriter, username string) bool {
+	until := loginLockedUntil(username)
+	if until.IsZero() {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, loginLockedMessage, http.StatusTooManyRequests)
+	return true
+}
+
+// writeLoginLocked answers a login step that was refused with
+// errLoginLocked
+func writeLoginLocked(w http.ResponseWriter, username string) {
+	// The lock may have just run out
+	if !refuseLockedLogin(w, username) {
+		http.Error(w, loginLockedMessage, http.StatusTooManyRequests)
+	}
+}
+
+// recordLoginFailure counts a failed login with username and refuses the
+// next attempts for as long as loginDelay says. user is nil for unknown
+// usernames; known users get an email when their account is locked.
+func recordLoginFailure(r *http.Request, username string, user *models.User) {
+	cache := globalContainer.Cache()
+
+	failures, err := cache.IncrementCounter(loginFailuresKey(username), loginFailureTTL)
+	if err != nil {
+		// Like the rate limits, lockout fails open when the cache is down
+		utils.LogError(err, "Failed to record failed login", logrus.Fields{})
+		return
+	}
+
+	threshold, lockout := lockoutSettings()
+	delay := loginDelay(failures, threshold, lockout)
+	if delay == 0 {
+		return
+	}
+
+	until := time.Now().Add(delay)
+	if err := cache.Set(loginLockKey(username), until, delay); err != nil {
+		utils.LogError(err, "Failed to delay logins", logrus.Fields{})
+		return
+	}
+
+	if failures != int64(threshold) || user == nil {
+		return
+	}
+
+	utils.LogWarning("Account locked after failed logins", logrus.Fields{
+		"user_id":     user.ID,
+		"failures":    failures,
+		"locked_for":  delay.String(),
+		"remote_addr": middleware.ClientIP(r),
+	})
+	sendLockoutEmail(user, until, middleware.ClientIP(r))
+}
+
+// recordLoginChallenge counts a second-factor challenge issued to user.
+// Each challenge allows a few guesses of the code, so an account is locked
+// like after failed logins once more challenges than the lockout threshold
+// were issued without a completed login. It returns errLoginLocked when
+// logins with the user are locked.
+func recordLoginChallenge(r *http.Request, user *models.User) error {
+	if !loginLockedUntil(user.Username).IsZero() {
+		return errLoginLocked
+	}
+
+	threshold, lockout := lockoutSettings()
+	if threshold <= 0 {
+		return nil
+	}
+
+	cache := globalContainer.Cache()
+	challenges, err := cache.IncrementCounter(loginChallengesKey(user.Username), loginFailureTTL)
+	if err != nil {
+		utils.LogError(err, "Failed to record login challenge", logrus.Fields{})
+		return nil
+	}
+	if challenges <= int64(threshold) {
+		return nil
+	}
+
+	until := time.Now().Add(lockout)
+	if err := cache.Set(loginLockKey(user.Username), until, lockout); err != nil {
+		utils.LogError(err, "Failed to delay logins", logrus.Fields{})
+		return nil
+	}
+
+	if challenges == int64(threshold)+1 {
+		utils.LogWarning("Account locked after unfinished two-factor logins", logrus.Fields{
+			"user_id":     user.ID,
+			"challenges":  challenges,
+			"locked_for":  lockout.String(),
+			"remote_addr": middleware.ClientIP(r),
+		})
+		sendLockoutEmail(user, until, middleware.ClientIP(r))
+	}
+	return errLoginLocked
+}
+
+// clearLoginFailures forgets the failed logins and unfinished challenges
+// with username after a successful login or an unlock
+func clearLoginFailures(username string) {
+	cache := globalContainer.Cache()
+	cache.Delete(loginFailuresKey(username))
+	cache.Delete(loginChallengesKey(username))
+	cache.Delete(loginLockKey(username))
+}
+
+// loginLockout returns the failed login state of username
+func loginLockout(username string) models.LoginLockout {
+	var lockout models.LoginLockout
+	globalContainer.Cache().Get(loginFailuresKey(username), &lockout.FailedAttempts)
+	if until := loginLockedUntil(username); !until.IsZero() {
+		lockout.LockedUntil = &until
+	}
+	return lockout
+}
+
+// timingUser has a password nobody knows. Logins with unknown usernames
+// check it, so they take as long as logins with a wrong password.
+var timingUser = sync.OnceValue(func() *models.User {
+	user := &models.User{}
+	if err := user.SetPassword(hashAccountToken(time.Now().String())); err != nil {
+		utils.LogError(err, "Failed to hash timing password", logrus.Fields{})
+	}
+	return user
+})
+
+// checkLoginPassword reports whether password is the password of user,
+// taking the same time when user is nil or has no password
+func checkLoginPassword(user *models.User, password string) bool {
+	if user == nil || user.PasswordHash == "" {
+		timingUser().CheckPassword(password)
+		return false
+	}
+	return user.CheckPassword(password)
+}
+
+// sendLockoutEmail tells a user that their account has been locked
+func sendLockoutEmail(user *models.User, until time.Time, ip string) {
+	sendAccountEmail(user.Email, "Your account has been locked", fmt.Sprintf(`Hi %s,
+
+There were too many failed attempts to sign in to your WebEnable account, the last one from %s, so signing in is blocked until %s.
+
+If this was you, you can sign in again after that time or reset your password. If it wasn't, someone may be guessing your password; an administrator can unlock your account and you can choose a stronger password.
+
+WebEnable Team`, user.Username, ip, until.UTC().Format(time.RFC1123)))
+}
+
+// GetUserLockout godoc
+//
+//	@Summary		Get the login lockout of a user
+//	@Description	Get the number of failed logins in a row of a user and until when their logins are refused (needs users:read)
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.LoginLockout
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Router			/admin/users/{id}/lockout [get]
+func GetUserLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
+		return
+	}
+
+	user, err := globalContainer.Database().GetUser(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(loginLockout(user.Username))
+}
+
+// UnlockUser godoc
+//
+//	@Summary		Unlock a user
+//	@Description	Forget the failed logins of a user, so they can sign in right away (needs users:update)
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Router			/admin/users/{id}/lockout [delete]
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Update)
+	if !ok {
+		return
+	}
+
+	user, err := globalContainer.Database().GetUser(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	before := loginLockout(user.Username)
+	clearLoginFailures(user.Username)
+
+	utils.LogInfo("User unlocked", logrus.Fields{
+		"user_id":     user.ID,
+		"unlocked_by": claims.Username,
+	})
+	recordAudit(r, "user.unlock", "user", user.ID, before, models.LoginLockout{})
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "User unlocked"})
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/config"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int64
+		threshold int
+		delay     time.Duration
+	}{
+		{"First failures", 2, 10, 0},
+		{"First delay", 3, 10, time.Second},
+		{"Doubling", 6, 10, 8 * time.Second},
+		{"Locked", 10, 10, 15 * time.Minute},
+		{"Still locked", 12, 10, 15 * time.Minute},
+		{"Capped by lockout", 40, 100, 15 * time.Minute},
+		{"Lockout off", 12, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.delay, loginDelay(tt.failures, tt.threshold, 15*time.Minute))
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+
+	config.AppConfig = &config.Config{LoginLockoutThreshold: 4, LoginLockoutDuration: time.Minute}
+	t.Cleanup(func() { config.AppConfig = nil })
+
+	admin, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+
+	attempt := func(username, password string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(models.LoginRequest{Username: username, Password: password})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		Login(rr, httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body)))
+		return rr
+	}
+	// waitOut skips the delay on logins with username
+	waitOut := func(username string) {
+		require.NoError(t, globalContainer.Cache().Delete(loginLockKey(username)))
+	}
+	lockout := func() models.LoginLockout {
+		var lockout models.LoginLockout
+		req := mux.SetURLVars(asUser(httptest.NewRequest("GET", "/api/admin/users/"+admin.ID+"/lockout", nil), "admin", "admin"),
+			map[string]string{"id": admin.ID})
+		require.Equal(t, http.StatusOK, callJSON(t, GetUserLockout, req, nil, &lockout))
+		return lockout
+	}
+
+	t.Run("Delays logins", func(t *testing.T) {
+		for i := 0; i < loginFreeAttempts; i++ {
+			assert.Equal(t, http.StatusUnauthorized, attempt("admin", "wrong").Code)
+		}
+
+		rr := attempt("admin", "wrong")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), loginLockedMessage)
+
+		// The right password doesn't help while logins are delayed
+		assert.Equal(t, http.StatusTooManyRequests, attempt("admin", "/juk+vfdbNk6TICg").Code)
+		assert.Equal(t, loginFreeAttempts, lockout().FailedAttempts)
+	})
+
+	t.Run("Unknown usernames get the same responses", func(t *testing.T) {
+		for i := 0; i < loginFreeAttempts; i++ {
+			assert.Equal(t, http.StatusUnauthorized, attempt("ghost", "wrong").Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, attempt("ghost", "wrong").Code)
+	})
+
+	t.Run("Locks and emails the user", func(t *testing.T) {
+		waitOut("admin")
+		assert.Equal(t, http.StatusUnauthorized, attempt("admin", "wrong").Code)
+
+		state := lockout()
+		assert.Equal(t, 4, state.FailedAttempts)
+		require.NotNil(t, state.LockedUntil)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), *state.LockedUntil, 5*time.Second)
+
+		message := emails.next(t)
+		assert.Equal(t, []string{"admin@example.com"}, message.To)
+		assert.Equal(t, "Your account has been locked", message.Subject)
+
+		waitOut("ghost")
+		assert.Equal(t, http.StatusUnauthorized, attempt("ghost", "wrong").Code)
+		assert.Equal(t, http.StatusTooManyRequests, attempt("ghost", "wrong").Code)
+		emails.none(t)
+	})
+
+	t.Run("Admins unlock users", func(t *testing.T) {
+		req := mux.SetURLVars(asUser(httptest.NewRequest("DELETE", "/api/admin/users/"+admin.ID+"/lockout", nil), "editor", "editor"),
+			map[string]string{"id": admin.ID})
+		assert.Equal(t, http.StatusForbidden, callJSON(t, UnlockUser, req, nil, nil))
+
+		req = mux.SetURLVars(asUser(httptest.NewRequest("DELETE", "/api/admin/users/"+admin.ID+"/lockout", nil), "admin", "admin"),
+			map[string]string{"id": admin.ID})
+		require.Equal(t, http.StatusOK, callJSON(t, UnlockUser, req, nil, nil))
+		assert.Equal(t, models.LoginLockout{}, lockout())
+
+		login(t)
+	})
+
+	t.Run("Logins clear failures", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, attempt("admin", "wrong").Code)
+		assert.Equal(t, 1, lockout().FailedAttempts)
+
+		login(t)
+		assert.Equal(t, models.LoginLockout{}, lockout())
+	})
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+	secret, _ := enableTwoFactor(t)
+
+	config.AppConfig = &config.Config{LoginLockoutThreshold: 4, LoginLockoutDuration: time.Minute}
+	t.Cleanup(func() { config.AppConfig = nil })
+
+	admin, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+
+	verify := func(challenge, code string) int {
+		req := httptest.NewRequest("POST", "/api/auth/login/2fa", nil)
+		return callJSON(t, VerifyTwoFactorLogin, req, models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: code}, nil)
+	}
+	// waitOut skips the delay on logins as the admin
+	waitOut := func() {
+		require.NoError(t, globalContainer.Cache().Delete(loginLockKey("admin")))
+	}
+	unlock := func() {
+		req := mux.SetURLVars(asUser(httptest.NewRequest("DELETE", "/api/admin/users/"+admin.ID+"/lockout", nil), "admin", "admin"),
+			map[string]string{"id": admin.ID})
+		require.Equal(t, http.StatusOK, callJSON(t, UnlockUser, req, nil, nil))
+	}
+
+	t.Run("Wrong codes across challenges lock the account", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			waitOut()
+			status, challenge := passwordLogin(t)
+			require.Equal(t, http.StatusAccepted, status)
+			require.Equal(t, http.StatusUnauthorized, verify(challenge.ChallengeToken, "000000"))
+		}
+
+		status, _ := passwordLogin(t)
+		assert.Equal(t, http.StatusTooManyRequests, status)
+		assert.Equal(t, "Your account has been locked", emails.next(t).Subject)
+		assert.Equal(t, 4, loginLockout("admin").FailedAttempts)
+	})
+
+	t.Run("Locked accounts can't use open challenges", func(t *testing.T) {
+		unlock()
+		status, challenge := passwordLogin(t)
+		require.Equal(t, http.StatusAccepted, status)
+
+		require.NoError(t, globalContainer.Cache().Set(loginLockKey("admin"), time.Now().Add(time.Minute), time.Minute))
+		assert.Equal(t, http.StatusTooManyRequests, verify(challenge.ChallengeToken, codeAt(t, secret, 1)))
+	})
+
+	t.Run("Unfinished challenges lock the account", func(t *testing.T) {
+		unlock()
+		for i := 0; i < 4; i++ {
+			status, _ := passwordLogin(t)
+			require.Equal(t, http.StatusAccepted, status)
+		}
+
+		status, _ := passwordLogin(t)
+		assert.Equal(t, http.StatusTooManyRequests, status)
+		assert.Equal(t, "Your account has been locked", emails.next(t).Subject)
+
+		// Completed logins start the count again
+		unlock()
+		status, challenge := passwordLogin(t)
+		require.Equal(t, http.StatusAccepted, status)
+		require.Equal(t, http.StatusOK, verify(challenge.ChallengeToken, codeAt(t, secret, 1)))
+		for i := 0; i < 4; i++ {
+			status, _ := passwordLogin(t)
+			assert.Equal(t, http.StatusAccepted, status)
+		}
+	})
+}
@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/adapters/storage"
+	"webenable-cms-backend/imaging"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	_ "golang.org/x/image/webp"
+)
+
+// maxMediaUploadSize limits the size of a single media upload
+const maxMediaUploadSize = 20 << 20
+
+// maxTransformSize limits the width and height of on-the-fly image transforms
+const maxTransformSize = 2560
+
+// transformSizes are the widths and heights on-the-fly image transforms are
+// made in. Other sizes are rounded up to the next one, so anonymous requests
+// can't make an image generate and store a copy in every size.
+var transformSizes = []int{48, 64, 96, 128, 150, 200, 256, 320, 480, 640, 768, 1024, 1280, 1536, 1920, maxTransformSize}
+
+// mediaExtensions maps the content types accepted by the media library to
+// the extension files are stored with. Anything a browser could execute,
+// such as HTML or SVG, is rejected.
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+}
+
+// UploadMedia godoc
+//
+//	@Summary		Upload media
+//	@Description	Upload a file to the media library as multipart form data (needs media:create). Files with identical content are stored once and share a URL.
+//	@Tags			Media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			file		formData	file	true	"File to upload (max 20 MB)"
+//	@Param			alt_text	formData	string	false	"Alternative text for images"
+//	@Success		201			{object}	models.Media
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		413			{object}	models.ErrorResponse
+//	@Failure		415			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/media [post]
+func UploadMedia(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Media, permissions.Create)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxMediaUploadSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxMediaUploadSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	// Trust the content, not the name or the client supplied type
+	mimeType := http.DetectContentType(data)
+	extension, ok := mediaExtensions[mimeType]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported file type: %s", mimeType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	media := &models.Media{
+		ID:         uuid.New().String(),
+		Filename:   path.Base(strings.ReplaceAll(header.Filename, `\`, "/")),
+		MimeType:   mimeType,
+		Size:       int64(len(data)),
+		AltText:    strings.TrimSpace(r.FormValue("alt_text")),
+		UploadedBy: claims.Username,
+	}
+
+	if media.IsImage() {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			http.Error(w, "Invalid image", http.StatusBadRequest)
+			return
+		}
+		if err := imaging.CheckSize(config.Width, config.Height); err != nil {
+			http.Error(w, fmt.Sprintf("Image too large, at most %d megapixels", imaging.MaxPixels/1_000_000), http.StatusRequestEntityTooLarge)
+			return
+		}
+		media.Width = config.Width
+		media.Height = config.Height
+	}
+
+	store := globalContainer.Storage()
+	result, err := store.Upload(storage.StorageFile{
+		Path:        fmt.Sprintf("media/%s/%s%s", time.Now().Format("2006/01"), media.ID, extension),
+		Content:     bytes.NewReader(data),
+		ContentType: mimeType,
+		Size:        media.Size,
+	})
+	if err != nil {
+		utils.LogError(err, "Failed to store media", logrus.Fields{"filename": media.Filename})
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+	media.Path = result.Path
+	media.URL = result.URL
+	media.Size = result.Size
+	media.SHA256 = result.Metadata["sha256"]
+
+	// Image processing may have stripped metadata and turned the image upright
+	if width, err := strconv.Atoi(result.Metadata["width"]); err == nil {
+		media.Width = width
+	}
+	if height, err := strconv.Atoi(result.Metadata["height"]); err == nil {
+		media.Height = height
+	}
+	for _, variant := range result.Variants {
+		media.Variants = append(media.Variants, models.MediaVariant{
+			Name:     variant.Name,
+			Path:     variant.Path,
+			URL:      variant.URL,
+			MimeType: variant.ContentType,
+			Size:     variant.Size,
+			Width:    variant.Width,
+			Height:   variant.Height,
+		})
+	}
+
+	if err := globalContainer.Database().CreateMedia(media); err != nil {
+		utils.LogError(err, "Failed to create media", logrus.Fields{"path": media.Path})
+		store.Delete(media.Path)
+		http.Error(w, "Failed to create media", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(media)
+}
+
+// GetMediaList godoc
+//
+//	@Summary		List media
+//	@Description	List and search the media library with page or cursor pagination (needs media:read)
+//	@Tags			Media
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			q			query		string	false	"Search filenames and alt text"
+//	@Param			type		query		string	false	"Filter by MIME type, or by prefix such as image/"
+//	@Param			uploaded_by	query		string	false	"Filter by uploader username"
+//	@Param			sort		query		string	false	"Sort field (created_at, filename, size), prefix with - for descending (default: -created_at)"
+//	@Param			cursor		query		string	false	"Cursor from meta.next_cursor of the previous page"
+//	@Param			page		query		int		false	"Page number (default: 1)"
+//	@Param			limit		query		int		false	"Items per page (default: 10, max: 100)"
+//	@Success		200			{object}	models.PaginatedMediaResponse
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/media [get]
+func GetMediaList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Media, permissions.Read); !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	params := r.URL.Query()
+
+	list := getListRequest(r, "-created_at")
+	query := models.MediaQuery{
+		Search:      params.Get("q"),
+		MimeType:    params.Get("type"),
+		UploadedBy:  params.Get("uploaded_by"),
+		ListOptions: list.options,
+	}
+
+	media, err := db.ListMedia(query)
+	if isListQueryError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to list media", logrus.Fields{})
+		http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := list.meta(media.NextCursor, func() (int, error) { return db.CountMedia(query) })
+	if err != nil {
+		utils.LogError(err, "Failed to count media", logrus.Fields{})
+		http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+		return
+	}
+
+	data := media.Media
+	if data == nil {
+		data = []models.Media{}
+	}
+
+	json.NewEncoder(w).Encode(models.PaginatedMediaResponse{
+		Data: data,
+		Meta: meta,
+	})
+}
+
+// GetMedia godoc
+//
+//	@Summary		Get media
+//	@Description	Get a single media asset with the posts that use it (needs media:read)
+//	@Tags			Media
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Media ID"
+//	@Success		200	{object}	models.Media
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/media/{id} [get]
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Media, permissions.Read); !ok {
+		return
+	}
+
+	media, err := globalContainer.Database().GetMedia(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(media)
+}
+
+// GetMediaImage godoc
+//
+//	@Summary		Get a resized image
+//	@Description	Serve an image from the media library resized to fit w by h. Sizes are rounded up to the next of 48, 64, 96, 128, 150, 200, 256, 320, 480, 640, 768, 1024, 1280, 1536, 1920 and 2560 pixels. Each size is generated once and cached in storage, up to a limit of sizes per image.
+//	@Tags			Media
+//	@Produce		image/jpeg
+//	@Produce		image/png
+//	@Produce		image/webp
+//	@Param			id	path		string	true	"Media ID"
+//	@Param			w	query		int		false	"Maximum width in pixels (max: 2560)"
+//	@Param			h	query		int		false	"Maximum height in pixels (max: 2560)"
+//	@Param			fit	query		string	false	"contain (default), cover or fill"
+//	@Success		200	{file}		binary
+//	@Failure		400	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse	"Too many sizes of this image"
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		501	{object}	models.ErrorResponse
+//	@Router			/media/{id}/image [get]
+func GetMediaImage(w http.ResponseWriter, r *http.Request) {
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	params := r.URL.Query()
+	width, err := getTransformSize(params.Get("w"))
+	if err != nil {
+		http.Error(w, "Invalid width: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	height, err := getTransformSize(params.Get("h"))
+	if err != nil {
+		http.Error(w, "Invalid height: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if width == 0 && height == 0 {
+		http.Error(w, "w or h is required", http.StatusBadRequest)
+		return
+	}
+	fit, err := imaging.ParseFit(params.Get("fit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	media, err := globalContainer.Database().GetMedia(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	if !media.IsImage() {
+		http.Error(w, "Media is not an image", http.StatusBadRequest)
+		return
+	}
+
+	transformer, ok := globalContainer.Storage().(storage.ImageTransformer)
+	if !ok {
+		http.Error(w, "Image transforms are not available", http.StatusNotImplemented)
+		return
+	}
+
+	file, err := transformer.Transform(media.Path, width, height, fit)
+	if errors.Is(err, storage.ErrTooManyTransforms) {
+		http.Error(w, "Too many sizes of this image", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to transform image", logrus.Fields{
+			"media_id": media.ID,
+			"path":     media.Path,
+		})
+		http.Error(w, "Failed to transform image", http.StatusInternalServerError)
+		return
+	}
+	if closer, ok := file.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Stored files never change, so neither does a transform of one
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, file.Content)
+}
+
+// getTransformSize parses a transform width or height, rounded up to the
+// next of transformSizes, 0 when not given
+func getTransformSize(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 || size > maxTransformSize {
+		return 0, fmt.Errorf("must be between 1 and %d", maxTransformSize)
+	}
+	for _, allowed := range transformSizes {
+		if size <= allowed {
+			return allowed, nil
+		}
+	}
+	return maxTransformSize, nil
+}
+
+// UpdateMedia godoc
+//
+//	@Summary		Update media
+//	@Description	Update the filename or alt text of a media asset (needs media:update, or media:update:own for its uploader)
+//	@Tags			Media
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id		path		string						true	"Media ID"
+//	@Param			media	body		models.MediaUpdateRequest	true	"Fields to update"
+//	@Success		200		{object}	models.Media
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/media/{id} [put]
+func UpdateMedia(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	var req models.MediaUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	id := mux.Vars(r)["id"]
+
+	media, err := db.GetMedia(id)
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	if !permit(w, claims, permissions.Media, permissions.Update, media.UploadedBy == claims.Username) {
+		return
+	}
+
+	if req.Filename != nil {
+		filename := strings.TrimSpace(*req.Filename)
+		if filename == "" {
+			http.Error(w, "filename cannot be empty", http.StatusBadRequest)
+			return
+		}
+		media.Filename = filename
+	}
+	if req.AltText != nil {
+		media.AltText = strings.TrimSpace(*req.AltText)
+	}
+
+	if err := db.UpdateMedia(id, media); err != nil {
+		http.Error(w, "Failed to update media", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(media)
+}
+
+// DeleteMedia godoc
+//
+//	@Summary		Delete media
+//	@Description	Delete a media asset and its file (needs media:delete, or media:delete:own for its uploader). Assets used by a published or scheduled post can't be deleted.
+//	@Tags			Media
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Media ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		409	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/media/{id} [delete]
+func DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	db := globalContainer.Database()
+	id := mux.Vars(r)["id"]
+
+	media, err := db.GetMedia(id)
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	if !permit(w, claims, permissions.Media, permissions.Delete, media.UploadedBy == claims.Username) {
+		return
+	}
+
+	// Posts that no longer exist don't hold on to the asset, and scheduled
+	// ones would go live without it
+	var live []string
+	for _, postID := range media.UsedBy {
+		post, err := db.GetPost(postID)
+		if errors.Is(err, database.ErrPostNotFound) {
+			continue
+		}
+		if err != nil {
+			utils.LogError(err, "Failed to check media usage", logrus.Fields{
+				"media_id": id,
+				"post_id":  postID,
+			})
+			http.Error(w, "Failed to check media usage", http.StatusInternalServerError)
+			return
+		}
+		if isLiveStatus(post.Status) {
+			live = append(live, postID)
+		}
+	}
+	if len(live) > 0 {
+		http.Error(w, fmt.Sprintf("Media is used by published or scheduled posts: %s", strings.Join(live, ", ")), http.StatusConflict)
+		return
+	}
+
+	if err := db.DeleteMedia(id); err != nil {
+		http.Error(w, "Failed to delete media", http.StatusInternalServerError)
+		return
+	}
+
+	if err := globalContainer.Storage().Delete(media.Path); err != nil {
+		utils.LogError(err, "Failed to delete media file", logrus.Fields{
+			"media_id": id,
+			"path":     media.Path,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Media deleted successfully"})
+}
+
+// updateMediaUsage records which media assets a post references. The
+// stored usage is compared with the post as a whole, so references missed
+// earlier are picked up on the next save. post is nil when it was deleted.
+func updateMediaUsage(postID string, post *models.Post) {
+	if globalContainer == nil {
+		return
+	}
+
+	db := globalContainer.Database()
+
+	current, err := db.GetMediaUsedBy(postID)
+	if err != nil {
+		utils.LogError(err, "Failed to load media usage", logrus.Fields{"post_id": postID})
+		return
+	}
+
+	wanted := make(map[string]bool)
+	if post != nil {
+		for _, url := range post.MediaReferences() {
+			media, err := db.GetMediaByURL(url)
+			if err != nil {
+				// Not a media library URL
+				continue
+			}
+			wanted[media.ID] = true
+		}
+	}
+
+	for _, media := range current {
+		if wanted[media.ID] {
+			delete(wanted, media.ID)
+			continue
+		}
+		if err := db.RemoveMediaUsage(media.ID, postID); err != nil {
+			utils.LogError(err, "Failed to remove media usage", logrus.Fields{
+				"media_id": media.ID,
+				"post_id":  postID,
+			})
+		}
+	}
+
+	for mediaID := range wanted {
+		if err := db.AddMediaUsage(mediaID, postID); err != nil {
+			utils.LogError(err, "Failed to add media usage", logrus.Fields{
+				"media_id": mediaID,
+				"post_id":  postID,
+			})
+		}
+	}
+}
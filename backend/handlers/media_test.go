@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asUser attaches JWT claims to a request the way AuthMiddleware does
+func asUser(r *http.Request, username, role string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), "user", &middleware.Claims{Username: username, Role: role}))
+}
+
+func uploadRequest(t *testing.T, filename string, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, form.WriteField("alt_text", "A tiny test image"))
+	require.NoError(t, form.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/media", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestMediaLibrary(t *testing.T) {
+	db := setupTestContainer(t)
+
+	var pngData bytes.Buffer
+	require.NoError(t, png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 800, 400))))
+
+	w := httptest.NewRecorder()
+	UploadMedia(w, asUser(uploadRequest(t, "photo.png", pngData.Bytes()), "writer", "author"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var media models.Media
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &media))
+	assert.Equal(t, "photo.png", media.Filename)
+	assert.Equal(t, "image/png", media.MimeType)
+	assert.Equal(t, 800, media.Width)
+	assert.Equal(t, 400, media.Height)
+	assert.Equal(t, "writer", media.UploadedBy)
+	assert.Equal(t, "A tiny test image", media.AltText)
+	assert.Contains(t, media.URL, media.Path)
+	assert.Len(t, media.SHA256, 64)
+
+	exists, err := globalContainer.Storage().Exists(media.Path)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	cached := strings.TrimSuffix(media.Path, ".png") + "/cache/200x200-cover.png"
+
+	// The image is smaller than the large variant, so that one is skipped
+	variants := make(map[string]models.MediaVariant)
+	for _, variant := range media.Variants {
+		variants[variant.Name] = variant
+		exists, err := globalContainer.Storage().Exists(variant.Path)
+		require.NoError(t, err)
+		assert.True(t, exists, variant.Path)
+	}
+	require.Len(t, variants, 3)
+	assert.Equal(t, [2]int{150, 150}, [2]int{variants["thumbnail"].Width, variants["thumbnail"].Height})
+	assert.Equal(t, [2]int{640, 320}, [2]int{variants["medium"].Width, variants["medium"].Height})
+	assert.Equal(t, "image/webp", variants["webp"].MimeType)
+	assert.Equal(t, 800, variants["webp"].Width)
+
+	t.Run("Transforms", func(t *testing.T) {
+		transform := func(query string) *httptest.ResponseRecorder {
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/media/"+media.ID+"/image?"+query, nil),
+				map[string]string{"id": media.ID})
+			w := httptest.NewRecorder()
+			GetMediaImage(w, r)
+			return w
+		}
+
+		for i := 0; i < 2; i++ {
+			w := transform("w=200&h=200&fit=cover")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+
+			config, err := png.DecodeConfig(w.Body)
+			require.NoError(t, err)
+			assert.Equal(t, 200, config.Width)
+			assert.Equal(t, 200, config.Height)
+
+			exists, err := globalContainer.Storage().Exists(cached)
+			require.NoError(t, err)
+			assert.True(t, exists)
+		}
+
+		// Sizes are rounded up to a fixed step and share its copy
+		w := transform("w=190&h=170&fit=cover")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		config, err := png.DecodeConfig(w.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 200, config.Width)
+		assert.Equal(t, 200, config.Height)
+		files, err := globalContainer.Storage().ListFiles(path.Dir(cached))
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{"No size", "fit=cover"},
+			{"Too large", "w=10000"},
+			{"Not a number", "w=wide"},
+			{"Unknown fit", "w=100&fit=stretch"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, http.StatusBadRequest, transform(tt.query).Code)
+			})
+		}
+	})
+
+	t.Run("Rejects executable content", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		UploadMedia(w, asUser(uploadRequest(t, "photo.png", []byte("<html><script>alert(1)</script></html>")), "writer", "author"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("Lists by type", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		GetMediaList(w, asUser(httptest.NewRequest(http.MethodGet, "/media?type=image/&q=tiny", nil), "writer", "author"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.PaginatedMediaResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Data, 1)
+		assert.Equal(t, media.ID, response.Data[0].ID)
+		assert.Equal(t, 1, response.Meta.Total)
+	})
+
+	t.Run("Duplicates share the stored file", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		UploadMedia(w, asUser(uploadRequest(t, "copy.png", pngData.Bytes()), "other", "author"))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var duplicate models.Media
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &duplicate))
+		assert.NotEqual(t, media.ID, duplicate.ID)
+		assert.Equal(t, media.SHA256, duplicate.SHA256)
+		assert.Equal(t, media.URL, duplicate.URL)
+		assert.Equal(t, media.Variants, duplicate.Variants)
+
+		r := httptest.NewRequest(http.MethodDelete, "/media/"+duplicate.ID, nil)
+		r = mux.SetURLVars(asUser(r, "other", "author"), map[string]string{"id": duplicate.ID})
+		w = httptest.NewRecorder()
+		DeleteMedia(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// The original still holds a reference
+		for _, path := range []string{media.Path, variants["thumbnail"].Path} {
+			exists, err := globalContainer.Storage().Exists(path)
+			require.NoError(t, err)
+			assert.True(t, exists, path)
+		}
+	})
+
+	// A published post uses the image as its featured image
+	post := &models.Post{Title: "Uses media", Status: "published", FeaturedImage: media.URL}
+	require.NoError(t, db.CreatePost(post))
+	updateMediaUsage(post.ID, post)
+
+	stored, err := db.GetMedia(media.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{post.ID}, stored.UsedBy)
+
+	deleteMedia := func(username, role string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodDelete, "/media/"+media.ID, nil)
+		r = mux.SetURLVars(asUser(r, username, role), map[string]string{"id": media.ID})
+		w := httptest.NewRecorder()
+		DeleteMedia(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, deleteMedia("someone", "author").Code)
+	assert.Equal(t, http.StatusConflict, deleteMedia("writer", "author").Code)
+
+	// Moving the image into the body keeps it in use
+	post.FeaturedImage = ""
+	post.Content = `<p><img src="` + media.URL + `" alt=""></p>`
+	require.NoError(t, db.UpdatePost(post.ID, post))
+	updateMediaUsage(post.ID, post)
+	assert.Equal(t, http.StatusConflict, deleteMedia("writer", "author").Code)
+
+	// Neither does scheduling the post
+	scheduledAt := time.Now().Add(time.Hour)
+	post.Status = "scheduled"
+	post.ScheduledAt = &scheduledAt
+	require.NoError(t, db.UpdatePost(post.ID, post))
+	assert.Equal(t, http.StatusConflict, deleteMedia("writer", "author").Code)
+
+	// Nor does failing to look the post up
+	t.Run("Usage that can't be checked", func(t *testing.T) {
+		useDatabase(t, unreachableDB{db})
+		assert.Equal(t, http.StatusInternalServerError, deleteMedia("writer", "author").Code)
+	})
+	_, err = db.GetMedia(media.ID)
+	require.NoError(t, err)
+
+	// Drafts and deleted posts don't block deletion
+	post.Status = "draft"
+	post.ScheduledAt = nil
+	require.NoError(t, db.UpdatePost(post.ID, post))
+	deleted := &models.Post{Title: "Deleted", Status: "published", FeaturedImage: media.URL}
+	require.NoError(t, db.CreatePost(deleted))
+	updateMediaUsage(deleted.ID, deleted)
+	require.NoError(t, db.DeletePost(deleted.ID))
+	require.Equal(t, http.StatusOK, deleteMedia("writer", "author").Code)
+
+	_, err = db.GetMedia(media.ID)
+	assert.Error(t, err)
+	// Variants and cached transforms go with the original
+	for _, path := range []string{media.Path, variants["thumbnail"].Path, cached} {
+		exists, err = globalContainer.Storage().Exists(path)
+		require.NoError(t, err)
+		assert.False(t, exists, path)
+	}
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/config"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// usernameMinLength and usernameMaxLength bound the usernames of
+	// provisioned users like the validation of models.User
+	usernameMinLength = 3
+	usernameMaxLength = 20
+)
+
+const (
+	// oidcLoginCookie holds the binding of the login the browser started.
+	// Only the browser holding it can complete the login.
+	oidcLoginCookie     = "webenable_oidc_login"
+	oidcLoginCookiePath = "/api/auth/oidc"
+)
+
+// setOIDCLoginCookie sets the login cookie, or clears it when maxAge is
+// negative
+func setOIDCLoginCookie(w http.ResponseWriter, value string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    value,
+		Path:     oidcLoginCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if config.AppConfig != nil {
+		cookie.Domain = config.AppConfig.SessionDomain
+		cookie.Secure = config.AppConfig.SessionSecure
+	}
+	http.SetCookie(w, cookie)
+}
+
+// oidcProvider returns the auth adapter when it signs users in with an
+// OpenID Connect provider
+func oidcProvider(w http.ResponseWriter) (auth.OIDCProvider, bool) {
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return nil, false
+	}
+	provider, ok := globalContainer.Auth().(auth.OIDCProvider)
+	if !ok {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+// BeginOIDCLogin godoc
+//
+//	@Summary		Start single sign-on
+//	@Description	Start a login with the configured OpenID Connect provider. Send the user to the authorization URL; the provider sends them back to the redirect URL with a code and the state, to complete through /auth/oidc/callback within ten minutes. The response sets an HttpOnly cookie that the callback has to be sent with, so only this browser can complete the login.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	auth.OIDCLogin
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/oidc/login [get]
+func BeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	provider, ok := oidcProvider(w)
+	if !ok {
+		return
+	}
+
+	login, err := provider.BeginLogin()
+	if err != nil {
+		utils.LogError(err, "Failed to start OIDC login", logrus.Fields{})
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	setOIDCLoginCookie(w, login.Binding, int(time.Until(login.ExpiresAt).Seconds()))
+
+	json.NewEncoder(w).Encode(login)
+}
+
+// CompleteOIDCLogin godoc
+//
+//	@Summary		Complete single sign-on
+//	@Description	Complete a login with the code and state the OpenID Connect provider returned, sent with the cookie set by /auth/oidc/login. Users are matched by the issuer and subject of their identity and created on their first login, with the role their claims map to; the role of these users follows the mapping, except to or from admin. Identities whose email address belongs to another account are refused. Users with two-factor authentication enabled, or required for their role, get a challenge instead, to complete through /auth/login/2fa.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.OIDCCallbackRequest	true	"Code and state from the provider"
+//	@Success		200		{object}	models.LoginResponse
+//	@Success		202		{object}	models.TwoFactorChallenge	"Second factor required"
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse	"Email address of another account"
+//	@Failure		429		{object}	models.ErrorResponse	"Too many failed logins of this user"
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/oidc/callback [post]
+func CompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	provider, ok := oidcProvider(w)
+	if !ok {
+		return
+	}
+
+	// Logins started by another browser have a different cookie or none
+	var binding string
+	if cookie, err := r.Cookie(oidcLoginCookie); err == nil {
+		binding = cookie.Value
+	}
+
+	identity, err := provider.CompleteLogin(r.Context(), req.State, binding, req.Code)
+	// The cookie is done with once its login was redeemed, but a rejected
+	// callback keeps the login of this browser going
+	if !errors.Is(err, auth.ErrUnknownToken) {
+		setOIDCLoginCookie(w, "", -1)
+	}
+	switch {
+	case errors.Is(err, auth.ErrUnknownToken):
+		http.Error(w, "Invalid or expired login", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrOIDCNoRole), errors.Is(err, auth.ErrOIDCEmailUnverified):
+		utils.LogWarning("OIDC login rejected", logrus.Fields{
+			"reason": err.Error(),
+		})
+		http.Error(w, "Not allowed to sign in", http.StatusForbidden)
+		return
+	case err != nil:
+		utils.LogError(err, "Failed to complete OIDC login", logrus.Fields{})
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	valid, err := validRole(db, identity.Role)
+	if err != nil {
+		utils.LogError(err, "Failed to load roles", logrus.Fields{})
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		utils.LogWarning("OIDC role mapping names an unknown role", logrus.Fields{
+			"role":    identity.Role,
+			"subject": identity.Subject,
+		})
+		http.Error(w, "Not allowed to sign in", http.StatusForbidden)
+		return
+	}
+
+	user, err := oidcUser(identity)
+	if errors.Is(err, errOIDCAccountExists) {
+		utils.LogWarning("OIDC login matches an existing account", logrus.Fields{
+			"email":   identity.Email,
+			"subject": identity.Subject,
+		})
+		http.Error(w, "An account with this email address already exists; sign in with its password", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to provision OIDC user", logrus.Fields{
+			"email": identity.Email,
+		})
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	if !user.Active {
+		http.Error(w, "Not allowed to sign in", http.StatusForbidden)
+		return
+	}
+
+	challenge, err := twoFactorChallenge(r, user)
+	if errors.Is(err, errLoginLocked) {
+		writeLoginLocked(w, user.Username)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to check two-factor authentication", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to check two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	result, err := globalContainer.Auth().IssueTokens(auth.AuthClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Email:    user.Email,
+	})
+	if err != nil {
+		utils.LogError(err, "Failed to issue tokens", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	startSession(r, result, user)
+
+	json.NewEncoder(w).Encode(loginResponse(result, user))
+}
+
+// errOIDCAccountExists is returned for identities whose email address
+// belongs to an account that wasn't created by signing in with the provider
+var errOIDCAccountExists = errors.New("an account with this email address already exists")
+
+// oidcUser returns the user linked to a verified identity by its issuer and
+// subject. Unknown identities get a new user, with a password nobody knows,
+// unless their email address is taken: local accounts are never taken over
+// by an identity that merely shares their address. The role of linked users
+// follows the provider, but never to or from admin.
+func oidcUser(identity *auth.OIDCIdentity) (*models.User, error) {
+	db := globalContainer.Database()
+
+	linked, err := db.GetUserIdentity(identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		user, err := db.GetUser(linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.Active || user.Role == identity.Role {
+			return user, nil
+		}
+		if user.Role == permissions.AdminRole || identity.Role == permissions.AdminRole {
+			utils.LogWarning("Kept admin role of OIDC user out of the role mapping", logrus.Fields{
+				"user_id":     user.ID,
+				"role":        user.Role,
+				"mapped_role": identity.Role,
+			})
+			return user, nil
+		}
+		if err := db.UpdateUser(user.ID, &models.User{Role: identity.Role, Active: true}); err != nil {
+			return nil, err
+		}
+		user.Role = identity.Role
+		utils.LogInfo("Updated role of OIDC user", logrus.Fields{
+			"user_id": user.ID,
+			"role":    identity.Role,
+		})
+		return user, nil
+	}
+
+	if _, err := db.GetUserByEmail(identity.Email); err == nil {
+		return nil, errOIDCAccountExists
+	}
+
+	username, err := availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	user := &models.User{
+		Username:      username,
+		Email:         identity.Email,
+		EmailVerified: true,
+		Role:          identity.Role,
+		Active:        true,
+	}
+	if err := user.SetPassword(base64.RawURLEncoding.EncodeToString(password)); err != nil {
+		return nil, err
+	}
+	if err := db.CreateUser(user); err != nil {
+		return nil, err
+	}
+	if err := db.LinkUserIdentity(&models.UserIdentity{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		UserID:  user.ID,
+	}); err != nil {
+		// Another login of the identity linked its own user first
+		db.DeleteUser(user.ID)
+		return nil, err
+	}
+
+	utils.LogInfo("Provisioned OIDC user", logrus.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+	})
+	return user, nil
+}
+
+// availableUsername derives an unused username from the preferred username
+// or the email address of an identity
+func availableUsername(identity *auth.OIDCIdentity) (string, error) {
+	base := usernameFrom(identity.PreferredUsername)
+	if len(base) < usernameMinLength {
+		local, _, _ := strings.Cut(identity.Email, "@")
+		base = usernameFrom(local)
+	}
+	for len(base) < usernameMinLength {
+		base += "_"
+	}
+
+	db := globalContainer.Database()
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			suffix := fmt.Sprintf("%d", i)
+			username = base[:min(len(base), usernameMaxLength-len(suffix))] + suffix
+		}
+		if _, err := db.GetUserByUsername(username); err != nil {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no username available for %q", base)
+}
+
+// usernameFrom keeps the letters, digits, dots, dashes and underscores of s,
+// up to the maximum username length
+func usernameFrom(s string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(s) {
+		if b.Len() == usernameMaxLength {
+			break
+		}
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
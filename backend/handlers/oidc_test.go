@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/adapters"
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/adapters/auth/oidctest"
+	"webenable-cms-backend/container"
+	"webenable-cms-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useOIDC signs users in with a mock OpenID Connect provider
+func useOIDC(t *testing.T) *oidctest.Provider {
+	t.Helper()
+
+	provider, err := oidctest.NewProvider()
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	authAdapter, err := auth.NewOIDCAdapter(map[string]interface{}{
+		"secret":        "test-secret",
+		"issuer_url":    provider.URL,
+		"client_id":     provider.ClientID,
+		"client_secret": provider.ClientSecret,
+		"redirect_url":  "http://localhost:3000/auth/oidc/callback",
+		"role_mapping":  "cms-admins=admin,cms-editors=editor,cms-authors=author",
+		"http_client":   provider.Client(),
+	}, globalContainer.Cache())
+	require.NoError(t, err)
+
+	SetServiceContainer(container.NewContainerWithAdapters(&adapters.AdapterSet{
+		Database: globalContainer.Database(),
+		Cache:    globalContainer.Cache(),
+		Auth:     authAdapter,
+		Storage:  globalContainer.Storage(),
+	}, nil))
+	return provider
+}
+
+func TestOIDCLogin(t *testing.T) {
+	db := setupTestContainer(t)
+
+	t.Run("Not configured", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/auth/oidc/login", nil)
+		assert.Equal(t, http.StatusNotFound, callJSON(t, BeginOIDCLogin, req, nil, nil))
+	})
+
+	provider := useOIDC(t)
+
+	// start starts a login, signs in at the provider with claims and
+	// returns the callback with the login cookie of the browser
+	start := func(claims map[string]interface{}) (models.OIDCCallbackRequest, *http.Cookie) {
+		t.Helper()
+		provider.SetClaims(claims)
+
+		rr := httptest.NewRecorder()
+		BeginOIDCLogin(rr, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var login auth.OIDCLogin
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &login))
+
+		var cookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == oidcLoginCookie {
+				cookie = c
+			}
+		}
+		require.NotNil(t, cookie)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+		code, state, err := provider.Authorize(login.AuthorizationURL)
+		require.NoError(t, err)
+		return models.OIDCCallbackRequest{Code: code, State: state}, cookie
+	}
+	complete := func(callback models.OIDCCallbackRequest, cookie *http.Cookie, out interface{}) int {
+		req := httptest.NewRequest("POST", "/api/auth/oidc/callback", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return callJSON(t, CompleteOIDCLogin, req, callback, out)
+	}
+	// signIn signs in at the provider with claims and completes the login
+	signIn := func(claims map[string]interface{}) (int, models.OIDCCallbackRequest, models.LoginResponse) {
+		t.Helper()
+		callback, cookie := start(claims)
+		var response models.LoginResponse
+		return complete(callback, cookie, &response), callback, response
+	}
+	staff := func(sub, email, username string, groups ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"sub":                sub,
+			"email":              email,
+			"email_verified":     true,
+			"preferred_username": username,
+			"groups":             groups,
+		}
+	}
+
+	t.Run("Provisions new users", func(t *testing.T) {
+		status, callback, response := signIn(staff("staff-1", "jane@example.com", "Jane", "cms-editors"))
+		require.Equal(t, http.StatusOK, status)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.Equal(t, "jane", response.User.Username)
+		assert.Equal(t, "editor", response.User.Role)
+
+		user, err := db.GetUserByEmail("jane@example.com")
+		require.NoError(t, err)
+		assert.True(t, user.Active)
+		assert.True(t, user.EmailVerified)
+		assert.Equal(t, "editor", user.Role)
+
+		// The callback works once
+		req := httptest.NewRequest("POST", "/api/auth/oidc/callback", nil)
+		assert.Equal(t, http.StatusUnauthorized, callJSON(t, CompleteOIDCLogin, req, callback, nil))
+	})
+
+	t.Run("Only the browser that started a login completes it", func(t *testing.T) {
+		// An attacker signs in as themselves and hands the callback to a
+		// victim, whose browser has no login cookie or one of its own
+		attacker, attackerCookie := start(staff("staff-7", "mallory@example.com", "mallory", "cms-editors"))
+		_, victimCookie := start(staff("staff-8", "victim@example.com", "victim", "cms-editors"))
+
+		assert.Equal(t, http.StatusUnauthorized, complete(attacker, nil, nil))
+		assert.Equal(t, http.StatusUnauthorized, complete(attacker, victimCookie, nil))
+		_, err := db.GetUserByEmail("mallory@example.com")
+		assert.Error(t, err)
+
+		// The rejected callbacks don't spoil the login
+		assert.Equal(t, http.StatusOK, complete(attacker, attackerCookie, nil))
+	})
+
+	t.Run("Linked users follow the role mapping", func(t *testing.T) {
+		status, _, response := signIn(staff("staff-1", "jane@example.com", "jane", "cms-authors"))
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "jane", response.User.Username)
+		assert.Equal(t, "author", response.User.Role)
+
+		user, err := db.GetUserByEmail("jane@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "author", user.Role)
+
+		// The mapping doesn't make admins
+		status, _, response = signIn(staff("staff-1", "jane@example.com", "jane", "cms-admins"))
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "author", response.User.Role)
+
+		// Nor does it demote them
+		require.NoError(t, db.UpdateUser(user.ID, &models.User{Role: "admin", Active: true}))
+		status, _, response = signIn(staff("staff-1", "jane@example.com", "jane", "cms-editors"))
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "admin", response.User.Role)
+		user, err = db.GetUserByEmail("jane@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", user.Role)
+	})
+
+	t.Run("Existing accounts aren't taken over by email address", func(t *testing.T) {
+		admin, err := db.GetUserByUsername("admin")
+		require.NoError(t, err)
+
+		status, _, _ := signIn(staff("staff-9", admin.Email, "admin", "cms-editors"))
+		assert.Equal(t, http.StatusConflict, status)
+
+		admin, err = db.GetUserByUsername("admin")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", admin.Role)
+
+		// Nor by another identity with the address of a linked user
+		status, _, _ = signIn(staff("staff-10", "jane@example.com", "jane", "cms-admins"))
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("Picks an unused username", func(t *testing.T) {
+		status, _, response := signIn(staff("staff-2", "boss@example.com", "admin", "cms-editors"))
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "admin2", response.User.Username)
+
+		status, _, response = signIn(staff("staff-3", "ed@example.com", "", "cms-editors"))
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ed_", response.User.Username)
+	})
+
+	t.Run("Rejected identities", func(t *testing.T) {
+		status, _, _ := signIn(staff("staff-4", "guest@example.com", "guest", "staff"))
+		assert.Equal(t, http.StatusForbidden, status)
+		_, err := db.GetUserByEmail("guest@example.com")
+		assert.Error(t, err)
+
+		unverified := staff("staff-5", "admin@example.com", "admin", "cms-admins")
+		unverified["email_verified"] = false
+		status, _, _ = signIn(unverified)
+		assert.Equal(t, http.StatusForbidden, status)
+
+		status, _, response := signIn(staff("staff-6", "former@example.com", "former", "cms-editors"))
+		require.Equal(t, http.StatusOK, status)
+		require.NoError(t, db.UpdateUser(response.User.ID, &models.User{Role: "editor", Active: false}))
+		status, _, _ = signIn(staff("staff-6", "former@example.com", "former", "cms-editors"))
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+}
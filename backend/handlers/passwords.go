@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/passwords"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkNewPassword checks a new password of user against the password
+// policy, including that it is neither the current password nor one of
+// the previous ones. For users yet to be created user only needs the
+// username and email address. It writes the error response and reports
+// whether the password may be set.
+func checkNewPassword(w http.ResponseWriter, user *models.User, password string) bool {
+	policy := globalPasswordPolicy
+
+	personal := []string{user.Username}
+	if local, _, ok := strings.Cut(user.Email, "@"); ok {
+		personal = append(personal, local)
+	}
+
+	err := policy.Check(password, personal...)
+	var policyErr *passwords.PolicyError
+	if errors.As(err, &policyErr) {
+		http.Error(w, policyErr.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to check password", logrus.Fields{})
+		http.Error(w, "Failed to check password", http.StatusInternalServerError)
+		return false
+	}
+
+	if user.ID == "" {
+		return true
+	}
+
+	previous := []string{user.PasswordHash}
+	if policy.History > 0 {
+		history, err := globalContainer.Database().GetPasswordHistory(user.ID)
+		if err != nil {
+			utils.LogError(err, "Failed to load password history", logrus.Fields{
+				"user_id": user.ID,
+			})
+			http.Error(w, "Failed to check password", http.StatusInternalServerError)
+			return false
+		}
+		if len(history) > policy.History {
+			history = history[:policy.History]
+		}
+		previous = append(previous, history...)
+	}
+
+	if passwords.Reused(password, previous) {
+		http.Error(w, "Password was used recently; choose another one", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// rememberPassword adds the hash of a replaced password to the password
+// history of a user. The new password is set by then, so failing to record
+// the old one is logged rather than failing the request.
+func rememberPassword(userID, previousHash string) {
+	limit := globalPasswordPolicy.History
+	if limit <= 0 || previousHash == "" {
+		return
+	}
+
+	db := globalContainer.Database()
+	history, err := db.GetPasswordHistory(userID)
+	if err != nil {
+		utils.LogError(err, "Failed to load password history", logrus.Fields{
+			"user_id": userID,
+		})
+		return
+	}
+
+	history = append([]string{previousHash}, history...)
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	if err := db.SavePasswordHistory(userID, history); err != nil {
+		utils.LogError(err, "Failed to save password history", logrus.Fields{
+			"user_id": userID,
+		})
+	}
+}
+
+// upgradePasswordHash rehashes the password of a user who just logged in
+// with it when the stored hash was made with other parameters than the
+// current ones, like bcrypt hashes after a switch to argon2id
+func upgradePasswordHash(user *models.User, password string) {
+	if !passwords.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		utils.LogError(err, "Failed to rehash password", logrus.Fields{
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	if err := globalContainer.Database().UpdateUser(user.ID, &models.User{
+		PasswordHash: hash,
+		Active:       user.Active,
+	}); err != nil {
+		utils.LogError(err, "Failed to upgrade password hash", logrus.Fields{
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	user.PasswordHash = hash
+	utils.LogInfo("Password hash upgraded", logrus.Fields{
+		"user_id":   user.ID,
+		"algorithm": passwords.CurrentParams().Algorithm,
+	})
+}
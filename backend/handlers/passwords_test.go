@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/passwords"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	db := setupTestContainer(t)
+	emails := recordEmails(t)
+
+	create := func(password string) (int, models.User) {
+		var user models.User
+		req := asUser(httptest.NewRequest("POST", "/api/admin/users", nil), "admin", "admin")
+		return callJSON(t, CreateUser, req, map[string]interface{}{
+			"username": "editor",
+			"email":    "jane.doe@example.com",
+			"password": password,
+			"role":     "editor",
+			"active":   true,
+		}, &user), user
+	}
+
+	t.Run("New users need a strong password", func(t *testing.T) {
+		for _, password := range []string{"password", "aaaaaaaaaaaaaaaa", "my-editor-password", "jane.doe-7#Kq!z"} {
+			status, _ := create(password)
+			assert.Equal(t, http.StatusBadRequest, status, password)
+		}
+	})
+
+	status, user := create("correct horse battery")
+	require.Equal(t, http.StatusCreated, status)
+	emails.next(t)
+
+	update := func(password string) int {
+		req := mux.SetURLVars(asUser(httptest.NewRequest("PUT", "/api/admin/users/"+user.ID, nil), "admin", "admin"),
+			map[string]string{"id": user.ID})
+		return callJSON(t, UpdateUser, req, map[string]interface{}{"password": password}, nil)
+	}
+
+	t.Run("Recent passwords can't be reused", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, update("correct horse battery"))
+		require.Equal(t, http.StatusOK, update("staple lamp river moon"))
+		assert.Equal(t, http.StatusBadRequest, update("correct horse battery"))
+
+		history, err := db.GetPasswordHistory(user.ID)
+		require.NoError(t, err)
+		assert.Len(t, history, 1)
+
+		SetPasswordPolicy(passwords.Policy{MinLength: 12, MinEntropy: 50, History: 0})
+		t.Cleanup(func() { SetPasswordPolicy(passwords.DefaultPolicy) })
+		assert.Equal(t, http.StatusOK, update("correct horse battery"))
+	})
+
+	t.Run("Rejected reset passwords keep the link", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/auth/password/forgot", nil)
+		require.Equal(t, http.StatusAccepted, callJSON(t, ForgotPassword, req, models.ForgotPasswordRequest{Email: "jane.doe@example.com"}, nil))
+		token := linkToken(t, emails.next(t))
+
+		reset := func(password string) int {
+			req := httptest.NewRequest("POST", "/api/auth/password/reset", nil)
+			return callJSON(t, ResetPassword, req, models.ResetPasswordRequest{Token: token, Password: password}, nil)
+		}
+		assert.Equal(t, http.StatusBadRequest, reset("short"))
+		require.Equal(t, http.StatusOK, reset("quiet orange kettle"))
+
+		stored, err := db.GetUser(user.ID)
+		require.NoError(t, err)
+		assert.True(t, stored.CheckPassword("quiet orange kettle"))
+	})
+}
+
+func TestPasswordHashUpgrade(t *testing.T) {
+	db := setupTestContainer(t)
+
+	admin, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+
+	// Hash the password the way it was hashed before argon2id
+	hash, err := bcrypt.GenerateFromPassword([]byte("/juk+vfdbNk6TICg"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateUser(admin.ID, &models.User{PasswordHash: string(hash), Active: true}))
+
+	login(t)
+
+	upgraded, err := db.GetUser(admin.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(upgraded.PasswordHash, "$argon2id$"), upgraded.PasswordHash)
+	assert.False(t, passwords.NeedsRehash(upgraded.PasswordHash))
+	assert.True(t, upgraded.CheckPassword("/juk+vfdbNk6TICg"))
+
+	// Current hashes are left alone
+	login(t)
+	again, err := db.GetUser(admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, upgraded.PasswordHash, again.PasswordHash)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxSlugSuffix bounds the number of "-n" suffixes tried when a slug is taken
+	maxSlugSuffix = 100
+
+	// maxSlugRetries bounds how often a post is saved again when a concurrent
+	// save took its generated slug first
+	maxSlugRetries = 5
+
+	// slugBackfillLock keeps replicas starting together from backfilling slugs twice
+	slugBackfillLock = "post_slug_backfill"
+	slugBackfillTTL  = 10 * time.Minute
+	slugBackfillPage = 100
+)
+
+var (
+	// errSlugTaken is returned when an explicitly requested slug belongs to another post
+	errSlugTaken = errors.New("slug already in use")
+
+	// errInvalidSlug is returned when nothing is left of a requested slug
+	errInvalidSlug = errors.New("invalid slug")
+
+	// errNoFreeSlug is returned when every suffix of a generated slug is taken
+	errNoFreeSlug = errors.New("no free slug")
+)
+
+// GetPostBySlug godoc
+//
+//	@Summary		Get post by slug
+//	@Description	Get a single post by its slug. Slugs that a post has since been moved away from return 301 with the current slug.
+//	@Tags			Posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			slug	path		string	true	"Post slug"
+//	@Success		200		{object}	models.Post
+//	@Success		301		{object}	models.SlugRedirectResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/posts/by-slug/{slug} [get]
+func GetPostBySlug(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	slug := vars["slug"]
+
+	// Check if this is an authenticated request (admin access)
+	isAuthenticated := r.Context().Value("user") != nil
+
+	db := globalContainer.Database()
+
+	post, err := db.GetPostBySlug(slug)
+	if err != nil {
+		moved, err := db.GetPostByPreviousSlug(slug)
+		if err != nil || moved.Slug == "" || (!isAuthenticated && moved.Status != "published") {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+
+		location := "/api/posts/by-slug/" + moved.Slug
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusMovedPermanently)
+		json.NewEncoder(w).Encode(models.SlugRedirectResponse{
+			Status:   http.StatusMovedPermanently,
+			Slug:     moved.Slug,
+			Location: location,
+		})
+		return
+	}
+
+	// Only return published posts for public (non-authenticated) access
+	if !isAuthenticated && post.Status != "published" {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// resolvePostSlug works out the slug a post should be saved with. An
+// explicitly requested slug must be free, otherwise errSlugTaken is returned;
+// slugs generated from the title get a numeric suffix on collision.
+func resolvePostSlug(requested, title, postID string) (string, error) {
+	if globalContainer == nil {
+		return "", fmt.Errorf("database not available")
+	}
+
+	if requested != "" {
+		slug := utils.Slugify(requested)
+		if slug == "" {
+			return "", errInvalidSlug
+		}
+		if !postSlugAvailable(slug, postID) {
+			return "", errSlugTaken
+		}
+		return slug, nil
+	}
+
+	return uniquePostSlug(title, postID)
+}
+
+// uniquePostSlug generates a slug from title that no other post is using
+func uniquePostSlug(title, postID string) (string, error) {
+	base := utils.Slugify(title)
+	if base == "" {
+		base = "post"
+	}
+
+	for i := 1; i <= maxSlugSuffix; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		if postSlugAvailable(candidate, postID) {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w for %q", errNoFreeSlug, base)
+}
+
+// postSlugAvailable reports whether slug is unused by any post other than
+// postID, counting slugs kept for redirects
+func postSlugAvailable(slug, postID string) bool {
+	db := globalContainer.Database()
+
+	if post, err := db.GetPostBySlug(slug); err == nil && post.ID != postID {
+		return false
+	}
+	if post, err := db.GetPostByPreviousSlug(slug); err == nil && post.ID != postID {
+		return false
+	}
+
+	return true
+}
+
+// setPostSlug moves a post to a new slug, keeping the old one for redirects.
+// A post moving back to one of its earlier slugs takes it out of the history.
+func setPostSlug(post *models.Post, slug string) {
+	if post.Slug == slug {
+		return
+	}
+
+	history := make([]string, 0, len(post.PreviousSlugs)+1)
+	for _, previous := range post.PreviousSlugs {
+		if previous != slug && previous != post.Slug {
+			history = append(history, previous)
+		}
+	}
+	if post.Slug != "" {
+		history = append(history, post.Slug)
+	}
+
+	post.Slug = slug
+	post.PreviousSlugs = history
+}
+
+// savePostSlug gives post the slug resolved from requested and its title,
+// using assign, and stores it with save. When a concurrent save took a
+// generated slug first, the next free one is tried; a requested slug that was
+// taken fails with errSlugTaken. A nil assign keeps the current slug.
+func savePostSlug(post *models.Post, requested string, assign func(slug string), save func() error) error {
+	for attempt := 0; ; attempt++ {
+		if assign != nil {
+			slug, err := resolvePostSlug(requested, post.Title, post.ID)
+			if err != nil {
+				return err
+			}
+			assign(slug)
+		}
+
+		err := save()
+		if !errors.Is(err, database.ErrSlugTaken) {
+			return err
+		}
+		if assign == nil || requested != "" || attempt == maxSlugRetries {
+			return errSlugTaken
+		}
+	}
+}
+
+// writeSlugError reports a post that could not be saved under its slug
+func writeSlugError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errSlugTaken):
+		http.Error(w, "Post slug already exists", http.StatusConflict)
+	case errors.Is(err, errInvalidSlug), errors.Is(err, errNoFreeSlug):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// BackfillPostSlugs gives posts saved before slugs existed a slug generated
+// from their title, so they can be found by slug, and returns how many were
+// updated. Replicas starting together leave it to the one that gets the lock.
+func BackfillPostSlugs() (int, error) {
+	if globalContainer == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	cache := globalContainer.Cache()
+	owner := uuid.New().String()
+	acquired, err := cache.AcquireLock(slugBackfillLock, owner, slugBackfillTTL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock slug backfill: %w", err)
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer cache.ReleaseLock(slugBackfillLock, owner)
+
+	db := globalContainer.Database()
+
+	// Collect the posts first; paging while saving could skip some
+	var missing []models.Post
+	for offset := 0; ; offset += slugBackfillPage {
+		posts, err := db.GetPosts(slugBackfillPage, offset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list posts: %w", err)
+		}
+		for _, post := range posts {
+			if post.Slug == "" {
+				missing = append(missing, post)
+			}
+		}
+		if len(posts) < slugBackfillPage {
+			break
+		}
+	}
+
+	updated := 0
+	for i := range missing {
+		post := &missing[i]
+		err := savePostSlug(post, "", func(slug string) {
+			setPostSlug(post, slug)
+		}, func() error {
+			return db.UpdatePost(post.ID, post)
+		})
+		if err != nil {
+			return updated, fmt.Errorf("failed to set slug of post %s: %w", post.ID, err)
+		}
+
+		invalidatePostCaches(post.ID)
+		indexPost(post)
+		updated++
+	}
+
+	return updated, nil
+}
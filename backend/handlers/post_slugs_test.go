@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPostSlug(t *testing.T) {
+	tests := []struct {
+		name            string
+		slug            string
+		previous        []string
+		newSlug         string
+		expectedHistory []string
+	}{
+		{
+			name:            "First slug has no history",
+			slug:            "",
+			newSlug:         "hello-world",
+			expectedHistory: []string{},
+		},
+		{
+			name:            "Rename keeps old slug",
+			slug:            "hello-world",
+			newSlug:         "hello-go",
+			expectedHistory: []string{"hello-world"},
+		},
+		{
+			name:            "Moving back drops slug from history",
+			slug:            "hello-go",
+			previous:        []string{"hello-world"},
+			newSlug:         "hello-world",
+			expectedHistory: []string{"hello-go"},
+		},
+		{
+			name:            "Unchanged slug is a no-op",
+			slug:            "hello-go",
+			previous:        []string{"hello-world"},
+			newSlug:         "hello-go",
+			expectedHistory: []string{"hello-world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &models.Post{Slug: tt.slug, PreviousSlugs: tt.previous}
+			setPostSlug(post, tt.newSlug)
+
+			assert.Equal(t, tt.newSlug, post.Slug)
+			assert.Equal(t, tt.expectedHistory, post.PreviousSlugs)
+		})
+	}
+}
+
+func TestSavePostSlug(t *testing.T) {
+	db := setupTestContainer(t)
+
+	t.Run("Generated slugs taken meanwhile get the next suffix", func(t *testing.T) {
+		post := &models.Post{ID: uuid.New().String(), Title: "Launch day", Status: "draft"}
+		saves := 0
+		err := savePostSlug(post, "", func(slug string) {
+			post.Slug = slug
+		}, func() error {
+			saves++
+			if saves == 1 {
+				// Another editor saves a post with the same title first
+				require.NoError(t, db.CreatePost(&models.Post{Title: "Launch day", Slug: post.Slug, Status: "draft"}))
+			}
+			return db.CreatePost(post)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, saves)
+		assert.Equal(t, "launch-day-2", post.Slug)
+	})
+
+	t.Run("Requested slugs taken meanwhile conflict", func(t *testing.T) {
+		post := &models.Post{ID: uuid.New().String(), Title: "Roadmap", Status: "draft"}
+		err := savePostSlug(post, "roadmap", func(slug string) {
+			post.Slug = slug
+		}, func() error {
+			require.NoError(t, db.CreatePost(&models.Post{Title: "Other", Slug: "roadmap", Status: "draft"}))
+			return db.CreatePost(post)
+		})
+		assert.ErrorIs(t, err, errSlugTaken)
+	})
+}
+
+func TestBackfillPostSlugs(t *testing.T) {
+	db := setupTestContainer(t)
+
+	var legacy []string
+	for _, title := range []string{"Hello world", "Hello world", ""} {
+		post := &models.Post{Title: title, Status: "published"}
+		require.NoError(t, db.CreatePost(post))
+		legacy = append(legacy, post.ID)
+	}
+	kept := &models.Post{Title: "Hello world", Slug: "greetings", Status: "published"}
+	require.NoError(t, db.CreatePost(kept))
+
+	updated, err := BackfillPostSlugs()
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated)
+
+	var slugs []string
+	for _, id := range legacy {
+		post, err := db.GetPost(id)
+		require.NoError(t, err)
+		slugs = append(slugs, post.Slug)
+
+		bySlug, err := db.GetPostBySlug(post.Slug)
+		require.NoError(t, err)
+		assert.Equal(t, id, bySlug.ID)
+	}
+	assert.ElementsMatch(t, []string{"hello-world", "hello-world-2", "post"}, slugs)
+
+	post, err := db.GetPost(kept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "greetings", post.Slug)
+
+	// Later starts find nothing to do
+	updated, err = BackfillPostSlugs()
+	require.NoError(t, err)
+	assert.Zero(t, updated)
+}
@@ -1,18 +1,16 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"time"
 
-	"webenable-cms-backend/database"
+	"webenable-cms-backend/adapters/database"
 	"webenable-cms-backend/models"
 	"webenable-cms-backend/utils"
 
-	"github.com/go-kivik/kivik/v4"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
@@ -20,115 +18,114 @@ import (
 // GetPosts godoc
 //
 //	@Summary		Get all posts
-//	@Description	Get all published posts with optional status filter and pagination
+//	@Description	Get published posts with optional filters, sorting and page or cursor pagination
 //	@Tags			Posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			status	query		string	false	"Filter by post status (published, draft, scheduled)"
-//	@Param			page	query		int		false	"Page number (default: 1)"
-//	@Param			limit	query		int		false	"Items per page (default: 10, max: 100)"
-//	@Success		200		{object}	models.PaginatedPostsResponse
-//	@Failure		500		{object}	models.ErrorResponse
+//	@Param			status				query		string	false	"Filter by post status (published, draft, scheduled); other than published needs posts:read"
+//	@Param			tag					query		string	false	"Filter by tag"
+//	@Param			category			query		string	false	"Filter by category"
+//	@Param			author				query		string	false	"Filter by author"
+//	@Param			featured			query		bool	false	"Filter by featured flag"
+//	@Param			created_after		query		string	false	"Only posts created at or after this RFC 3339 time"
+//	@Param			created_before		query		string	false	"Only posts created at or before this RFC 3339 time"
+//	@Param			published_after		query		string	false	"Only posts published at or after this RFC 3339 time"
+//	@Param			published_before	query		string	false	"Only posts published at or before this RFC 3339 time"
+//	@Param			sort				query		string	false	"Sort field (created_at, published_at, view_count, title), prefix with - for descending (default: -created_at)"
+//	@Param			cursor				query		string	false	"Cursor from meta.next_cursor of the previous page"
+//	@Param			page				query		int		false	"Page number (default: 1)"
+//	@Param			limit				query		int		false	"Items per page (default: 10, max: 100)"
+//	@Success		200					{object}	models.PaginatedPostsResponse
+//	@Failure		400					{object}	models.ErrorResponse
+//	@Failure		403					{object}	models.ErrorResponse
+//	@Failure		500					{object}	models.ErrorResponse
 //	@Router			/posts [get]
 func GetPosts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get pagination parameters
-	page, limit := getPaginationParams(r)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
 
-	// Get status filter from query parameters
-	statusFilter := r.URL.Query().Get("status")
+	cache := globalContainer.Cache()
+	db := globalContainer.Database()
 
-	// Check if this is an authenticated request (admin access)
-	isAuthenticated := r.Context().Value("user") != nil
+	list := getListRequest(r, "-created_at")
+	params := r.URL.Query()
 
-	// Default to "published" only for public (non-authenticated) access
-	if statusFilter == "" && !isAuthenticated {
-		statusFilter = "published"
+	query := models.PostQuery{
+		Status:      params.Get("status"),
+		Tag:         params.Get("tag"),
+		Category:    params.Get("category"),
+		Author:      params.Get("author"),
+		ListOptions: list.options,
 	}
 
-	// Create cache key based on query parameters
-	cacheKey := fmt.Sprintf("posts_list_status_%s_page_%d_limit_%d", statusFilter, page, limit)
-
-	// Try to get from cache first
-	if globalCache != nil {
-		var cachedResponse models.PaginatedPostsResponse
-		err := globalCache.GetCachedPostsList(cacheKey, &cachedResponse)
-		if err == nil {
-			w.Header().Set("X-Cache", "HIT")
-			json.NewEncoder(w).Encode(cachedResponse)
-			return
-		}
+	var err error
+	if query.Featured, err = getBoolParam(r, "featured"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Created, err = getTimeRange(r, "created"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Published, err = getTimeRange(r, "published"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	ctx := context.Background()
-	rows := database.Instance.PostsDB.AllDocs(ctx, kivik.Param("include_docs", true))
-	defer rows.Close()
-
-	var allPosts []models.Post
-	for rows.Next() {
-		var post models.Post
-		if err := rows.ScanDoc(&post); err != nil {
-			continue
-		}
-
-		// Ensure the document ID and revision are set properly
-		if id, err := rows.ID(); err == nil && id != "" {
-			post.ID = id
-		}
-		if rev, err := rows.Rev(); err == nil && rev != "" {
-			post.Rev = rev
-		}
+	status, ok := postStatusFilter(w, r, query.Status)
+	if !ok {
+		return
+	}
+	query.Status = status
 
-		// Filter by status if specified, or if public access (non-authenticated)
-		if statusFilter != "" && post.Status != statusFilter {
-			continue
-		}
+	// Create cache key based on query parameters
+	params.Set("status", query.Status)
+	cacheKey := fmt.Sprintf("posts_list_%s_page_%d", params.Encode(), list.page)
 
-		allPosts = append(allPosts, post)
+	// Try to get from cache first
+	var cachedResponse models.PaginatedPostsResponse
+	if err := cache.GetCachedPostsList(cacheKey, &cachedResponse); err == nil {
+		w.Header().Set("X-Cache", "HIT")
+		json.NewEncoder(w).Encode(cachedResponse)
+		return
 	}
 
-	// Calculate pagination
-	total := len(allPosts)
-	totalPages := int(math.Ceil(float64(total) / float64(limit)))
-	offset := (page - 1) * limit
-
-	// Get the slice for current page
-	var posts []models.Post
-	if offset < total {
-		end := offset + limit
-		if end > total {
-			end = total
-		}
-		posts = allPosts[offset:end]
+	posts, err := db.ListPosts(query)
+	if isListQueryError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to list posts", logrus.Fields{})
+		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+		return
 	}
 
-	// Create pagination metadata
-	meta := models.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      total,
-		TotalPages: totalPages,
-		HasNext:    page < totalPages,
-		HasPrev:    page > 1,
+	meta, err := list.meta(posts.NextCursor, func() (int, error) { return db.CountPosts(query) })
+	if err != nil {
+		utils.LogError(err, "Failed to count posts", logrus.Fields{})
+		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+		return
 	}
 
 	response := models.PaginatedPostsResponse{
-		Data: posts,
+		Data: posts.Posts,
 		Meta: meta,
 	}
 
 	// Cache the result for 10 minutes
-	if globalCache != nil {
-		go func() {
-			err := globalCache.CachePostsList(cacheKey, response, 10*time.Minute)
-			if err != nil {
-				utils.LogError(err, "Failed to cache posts list", logrus.Fields{
-					"cache_key": cacheKey,
-				})
-			}
-		}()
-	}
+	go func() {
+		err := cache.CachePostsList(cacheKey, response, 10*time.Minute)
+		if err != nil {
+			utils.LogError(err, "Failed to cache posts list", logrus.Fields{
+				"cache_key": cacheKey,
+			})
+		}
+	}()
 
 	w.Header().Set("X-Cache", "MISS")
 	json.NewEncoder(w).Encode(response)
@@ -149,56 +146,70 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
 func GetPost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	cache := globalContainer.Cache()
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// Try to get from cache first
-	if globalCache != nil {
-		var cachedPost models.Post
-		err := globalCache.GetCachedPost(id, &cachedPost)
-		if err == nil {
-			w.Header().Set("X-Cache", "HIT")
-			json.NewEncoder(w).Encode(cachedPost)
+	// Check if this is an authenticated request (admin access)
+	isAuthenticated := r.Context().Value("user") != nil
+
+	// Try to get from cache first; posts cached for admins may be drafts
+	var cachedPost models.Post
+	if err := cache.GetCachedPost(id, &cachedPost); err == nil {
+		if !isAuthenticated && cachedPost.Status != "published" {
+			http.Error(w, "Post not found", http.StatusNotFound)
 			return
 		}
+		w.Header().Set("X-Cache", "HIT")
+		json.NewEncoder(w).Encode(cachedPost)
+		return
 	}
 
-	ctx := context.Background()
-	row := database.Instance.PostsDB.Get(ctx, id)
-
-	var post models.Post
-	if err := row.ScanDoc(&post); err != nil {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	post, ok := loadPost(w, id)
+	if !ok {
 		return
 	}
 
-	// Check if this is an authenticated request (admin access)
-	isAuthenticated := r.Context().Value("user") != nil
-
 	// Only return published posts for public (non-authenticated) access
 	if !isAuthenticated && post.Status != "published" {
 		http.Error(w, "Post not found", http.StatusNotFound)
 		return
 	}
 
-	// Ensure the document ID and revision are set properly
-	post.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		post.Rev = rev
-	}
-
 	// Cache the post for 30 minutes
-	if globalCache != nil {
-		go func() {
-			err := globalCache.CachePost(id, post, 30*time.Minute)
-			if err != nil {
-				utils.LogError(err, "Failed to cache post", logrus.Fields{
-					"post_id": id,
-				})
-			}
-		}()
-	}
+	go func() {
+		err := cache.CachePost(id, post, 30*time.Minute)
+		if err != nil {
+			utils.LogError(err, "Failed to cache post", logrus.Fields{
+				"post_id": id,
+			})
+		}
+	}()
 
 	w.Header().Set("X-Cache", "MISS")
 	json.NewEncoder(w).Encode(post)
 }
+
+// loadPost loads the post with id, writing 404 when it doesn't exist and 500
+// when it can't be read
+func loadPost(w http.ResponseWriter, id string) (*models.Post, bool) {
+	post, err := globalContainer.Database().GetPost(id)
+	if errors.Is(err, database.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to load post", logrus.Fields{
+			"post_id": id,
+		})
+		http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+		return nil, false
+	}
+	return post, true
+}
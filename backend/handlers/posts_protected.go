@@ -1,15 +1,13 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"time"
 
-	"webenable-cms-backend/database"
 	"webenable-cms-backend/middleware"
 	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -18,7 +16,7 @@ import (
 // CreatePost godoc
 //
 //	@Summary		Create new post
-//	@Description	Create a new post (authenticated users only)
+//	@Description	Create a new post (needs posts:create). Creating it published or scheduled also needs posts:publish.
 //	@Tags			Posts
 //	@Accept			json
 //	@Produce		json
@@ -27,19 +25,23 @@ import (
 //	@Success		201		{object}	models.Post
 //	@Failure		400		{object}	models.ErrorResponse
 //	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/posts [post]
 func CreatePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	claims, ok := authorize(w, r, permissions.Posts, permissions.Create)
+	if !ok {
+		return
+	}
+
 	var post models.Post
 	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Get user from context (set by auth middleware)
-	claims := r.Context().Value("user").(*middleware.Claims)
 	post.Author = claims.Username
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = time.Now()
@@ -48,46 +50,44 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		post.Status = "draft"
 	}
 
-	// Generate a UUID for the document ID
-	postID := uuid.New().String()
-	post.ID = postID
-
-	// Create a document map with proper CouchDB fields
-	doc := map[string]interface{}{
-		"_id":        postID,
-		"title":      post.Title,
-		"content":    post.Content,
-		"excerpt":    post.Excerpt,
-		"author":     post.Author,
-		"status":     post.Status,
-		"tags":       post.Tags,
-		"created_at": post.CreatedAt,
-		"updated_at": post.UpdatedAt,
+	if post.Status == "scheduled" && post.ScheduledAt == nil {
+		http.Error(w, "scheduled_at is required for scheduled posts", http.StatusBadRequest)
+		return
 	}
 
-	if post.PublishedAt != nil {
-		doc["published_at"] = post.PublishedAt
+	if isLiveStatus(post.Status) && !permit(w, claims, permissions.Posts, permissions.Publish, true) {
+		return
 	}
 
-	ctx := context.Background()
-	rev, err := database.Instance.PostsDB.Put(ctx, postID, doc)
+	categories, err := normalizeCategories(post.Categories)
 	if err != nil {
-		http.Error(w, "Failed to create post", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	post.Categories = categories
 
-	post.Rev = rev
+	// Generate a UUID for the document ID
+	postID := uuid.New().String()
+	post.ID = postID
 
-	// Invalidate posts list cache
-	if globalCache != nil {
-		go func() {
-			err := globalCache.InvalidatePostsListCache()
-			if err != nil {
-				fmt.Printf("Failed to invalidate posts list cache: %v\n", err)
-			}
-		}()
+	err = savePostSlug(&post, post.Slug, func(slug string) {
+		post.Slug = slug
+		post.PreviousSlugs = nil
+	}, func() error {
+		return globalContainer.Database().CreatePost(&post)
+	})
+	if err != nil {
+		writeSlugError(w, err, "Failed to create post")
+		return
 	}
 
+	updateCategoryCounts(nil, &post)
+	updateMediaUsage(postID, &post)
+	invalidatePostCaches(postID)
+	recordPostRevision(nil, &post, claims.Username, 0)
+	indexPost(&post)
+	recordAudit(r, "post.create", "post", postID, nil, &post)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(post)
 }
@@ -95,7 +95,7 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 // UpdatePost godoc
 //
 //	@Summary		Update post
-//	@Description	Update an existing post (authenticated users only)
+//	@Description	Update an existing post (needs posts:update, or posts:update:own for its author). Changing a published or scheduled post, or publishing one, also needs posts:publish.
 //	@Tags			Posts
 //	@Accept			json
 //	@Produce		json
@@ -105,12 +105,24 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 //	@Success		200		{object}	models.Post
 //	@Failure		400		{object}	models.ErrorResponse
 //	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
 //	@Failure		404		{object}	models.ErrorResponse
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/posts/{id} [put]
 func UpdatePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -120,28 +132,43 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	db := globalContainer.Database()
 
 	// Get existing post
-	row := database.Instance.PostsDB.Get(ctx, id)
-	var existingPost models.Post
-	if err := row.ScanDoc(&existingPost); err != nil {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	stored, ok := loadPost(w, id)
+	if !ok {
+		return
+	}
+	existingPost := *stored
+
+	if !permitPost(w, claims, permissions.Update, stored, isLiveStatus(stored.Status) || isLiveStatus(updatedPost.Status)) {
 		return
 	}
 
-	// Ensure the document ID and revision are set properly
-	existingPost.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		existingPost.Rev = rev
+	if updatedPost.Status == "scheduled" && updatedPost.ScheduledAt == nil {
+		http.Error(w, "scheduled_at is required for scheduled posts", http.StatusBadRequest)
+		return
 	}
 
+	categories, err := normalizeCategories(updatedPost.Categories)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep a copy of the stored post for category counts and revision history
+	previousPost := existingPost
+
 	// Update fields
 	existingPost.Title = updatedPost.Title
 	existingPost.Content = updatedPost.Content
 	existingPost.Excerpt = updatedPost.Excerpt
 	existingPost.Status = updatedPost.Status
 	existingPost.Tags = updatedPost.Tags
+	existingPost.Categories = categories
+	existingPost.FeaturedImage = updatedPost.FeaturedImage
+	existingPost.ImageAlt = updatedPost.ImageAlt
+	existingPost.ScheduledAt = updatedPost.ScheduledAt
 	existingPost.UpdatedAt = time.Now()
 
 	if updatedPost.Status == "published" && existingPost.PublishedAt == nil {
@@ -149,48 +176,31 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 		existingPost.PublishedAt = &now
 	}
 
-	// Create a document map with proper CouchDB fields
-	doc := map[string]interface{}{
-		"_id":        existingPost.ID,
-		"_rev":       existingPost.Rev,
-		"title":      existingPost.Title,
-		"content":    existingPost.Content,
-		"excerpt":    existingPost.Excerpt,
-		"author":     existingPost.Author,
-		"status":     existingPost.Status,
-		"tags":       existingPost.Tags,
-		"created_at": existingPost.CreatedAt,
-		"updated_at": existingPost.UpdatedAt,
-	}
-
-	if existingPost.PublishedAt != nil {
-		doc["published_at"] = existingPost.PublishedAt
+	// Keep the slug unless one was requested or the title changed
+	var assignSlug func(slug string)
+	if updatedPost.Slug != "" || existingPost.Slug == "" || updatedPost.Title != previousPost.Title {
+		assignSlug = func(slug string) {
+			existingPost.Slug = previousPost.Slug
+			existingPost.PreviousSlugs = previousPost.PreviousSlugs
+			setPostSlug(&existingPost, slug)
+		}
 	}
 
 	// Update in database
-	rev, err := database.Instance.PostsDB.Put(ctx, id, doc)
+	err = savePostSlug(&existingPost, updatedPost.Slug, assignSlug, func() error {
+		return db.UpdatePost(id, &existingPost)
+	})
 	if err != nil {
-		http.Error(w, "Failed to update post", http.StatusInternalServerError)
+		writeSlugError(w, err, "Failed to update post")
 		return
 	}
 
-	existingPost.Rev = rev
-
-	// Invalidate caches
-	if globalCache != nil {
-		go func() {
-			// Invalidate specific post cache
-			err := globalCache.InvalidatePostCache(id)
-			if err != nil {
-				fmt.Printf("Failed to invalidate post cache for %s: %v\n", id, err)
-			}
-			// Invalidate posts list cache
-			err = globalCache.InvalidatePostsListCache()
-			if err != nil {
-				fmt.Printf("Failed to invalidate posts list cache: %v\n", err)
-			}
-		}()
-	}
+	updateCategoryCounts(&previousPost, &existingPost)
+	updateMediaUsage(id, &existingPost)
+	invalidatePostCaches(id)
+	recordPostRevision(&previousPost, &existingPost, claims.Username, 0)
+	indexPost(&existingPost)
+	recordAudit(r, "post.update", "post", id, &previousPost, &existingPost)
 
 	json.NewEncoder(w).Encode(existingPost)
 }
@@ -198,7 +208,7 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 // DeletePost godoc
 //
 //	@Summary		Delete post
-//	@Description	Delete a post (authenticated users only)
+//	@Description	Delete a post (needs posts:delete, or posts:delete:own for its author). Deleting a published or scheduled post also needs posts:publish.
 //	@Tags			Posts
 //	@Accept			json
 //	@Produce		json
@@ -206,54 +216,73 @@ func UpdatePost(w http.ResponseWriter, r *http.Request) {
 //	@Param			id	path		string	true	"Post ID"
 //	@Success		200	{object}	models.SuccessResponse
 //	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
 //	@Failure		404	{object}	models.ErrorResponse
 //	@Failure		500	{object}	models.ErrorResponse
 //	@Router			/posts/{id} [delete]
 func DeletePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	ctx := context.Background()
+	db := globalContainer.Database()
 
-	// Get existing post to get revision
-	row := database.Instance.PostsDB.Get(ctx, id)
-	var post models.Post
-	if err := row.ScanDoc(&post); err != nil {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	// Get existing post for the category counts
+	post, ok := loadPost(w, id)
+	if !ok {
 		return
 	}
 
-	// Ensure we have the proper revision
-	post.ID = id
-	if rev, err := row.Rev(); err == nil && rev != "" {
-		post.Rev = rev
+	// Deleting a live post unpublishes it
+	if !permitPost(w, claims, permissions.Delete, post, isLiveStatus(post.Status)) {
+		return
 	}
 
 	// Delete the post
-	_, err := database.Instance.PostsDB.Delete(ctx, id, post.Rev)
-	if err != nil {
+	if err := db.DeletePost(id); err != nil {
 		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 		return
 	}
 
-	// Invalidate caches
-	if globalCache != nil {
-		go func() {
-			// Invalidate specific post cache
-			err := globalCache.InvalidatePostCache(id)
-			if err != nil {
-				fmt.Printf("Failed to invalidate post cache for %s: %v\n", id, err)
-			}
-			// Invalidate posts list cache
-			err = globalCache.InvalidatePostsListCache()
-			if err != nil {
-				fmt.Printf("Failed to invalidate posts list cache: %v\n", err)
-			}
-		}()
-	}
+	updateCategoryCounts(post, nil)
+	updateMediaUsage(id, nil)
+	invalidatePostCaches(id)
+	unindexPost(id)
+	recordAudit(r, "post.delete", "post", id, post, nil)
 
 	response := map[string]string{"message": "Post deleted successfully"}
 	json.NewEncoder(w).Encode(response)
 }
+
+// isLiveStatus reports whether posts with status are public, or will be
+// once their publishing time comes
+func isLiveStatus(status string) bool {
+	return status == "published" || status == "scheduled"
+}
+
+// permitPost reports whether the user may take action on post, and writes
+// the error response when not. Changes to posts that are live, or that make
+// them live, also take the publish permission, so authors who may only
+// update their own posts work on their drafts.
+func permitPost(w http.ResponseWriter, claims *middleware.Claims, action string, post *models.Post, live bool) bool {
+	owner := post.Author == claims.Username
+	if !permit(w, claims, permissions.Posts, action, owner) {
+		return false
+	}
+	if live && action != permissions.Publish {
+		return permit(w, claims, permissions.Posts, permissions.Publish, owner)
+	}
+	return true
+}
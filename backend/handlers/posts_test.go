@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostHandlers(t *testing.T) {
+	db := setupTestContainer(t)
+
+	get := func(id string, r *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		GetPost(rr, mux.SetURLVars(r, map[string]string{"id": id}))
+		return rr
+	}
+	onPost := func(handler http.HandlerFunc, method, id, username, role string, body interface{}, out interface{}) int {
+		req := asUser(httptest.NewRequest(method, "/api/posts/"+id, nil), username, role)
+		return callJSON(t, handler, mux.SetURLVars(req, map[string]string{"id": id}), body, out)
+	}
+	create := func(post models.Post) int {
+		req := asUser(httptest.NewRequest("POST", "/api/posts", nil), "chief", "editor")
+		return callJSON(t, CreatePost, req, post, nil)
+	}
+
+	live := &models.Post{Title: "Live", Slug: "live", Author: "chief", Status: "published"}
+	require.NoError(t, db.CreatePost(live))
+	draft := &models.Post{Title: "Draft", Slug: "draft", Author: "chief", Status: "draft"}
+	require.NoError(t, db.CreatePost(draft))
+
+	t.Run("Anonymous readers get published posts", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, get(live.ID, httptest.NewRequest("GET", "/api/posts/"+live.ID, nil)).Code)
+		assert.Equal(t, http.StatusNotFound, get(draft.ID, httptest.NewRequest("GET", "/api/posts/"+draft.ID, nil)).Code)
+		assert.Equal(t, http.StatusNotFound, get("missing", httptest.NewRequest("GET", "/api/posts/missing", nil)).Code)
+	})
+
+	t.Run("Drafts cached for editors stay hidden", func(t *testing.T) {
+		rr := get(draft.ID, asUser(httptest.NewRequest("GET", "/api/posts/"+draft.ID, nil), "chief", "editor"))
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "MISS", rr.Header().Get("X-Cache"))
+
+		require.Eventually(t, func() bool {
+			var cached models.Post
+			return globalContainer.Cache().GetCachedPost(draft.ID, &cached) == nil
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, http.StatusNotFound, get(draft.ID, httptest.NewRequest("GET", "/api/posts/"+draft.ID, nil)).Code)
+		rr = get(draft.ID, asUser(httptest.NewRequest("GET", "/api/posts/"+draft.ID, nil), "chief", "editor"))
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "HIT", rr.Header().Get("X-Cache"))
+	})
+
+	t.Run("Creating validates the post", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/posts", nil)
+		assert.Equal(t, http.StatusUnauthorized, callJSON(t, CreatePost, req, models.Post{Title: "Anonymous"}, nil))
+
+		req = asUser(httptest.NewRequest("POST", "/api/posts", strings.NewReader("{")), "chief", "editor")
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, CreatePost, req, nil, nil))
+
+		assert.Equal(t, http.StatusBadRequest, create(models.Post{Title: "Later", Status: "scheduled"}))
+		assert.Equal(t, http.StatusBadRequest, create(models.Post{Title: "Odd", Slug: "!!!"}))
+		assert.Equal(t, http.StatusBadRequest, create(models.Post{Title: "Filed", Categories: []string{"unknown"}}))
+		assert.Equal(t, http.StatusConflict, create(models.Post{Title: "Copy", Slug: "live"}))
+
+		req = asUser(httptest.NewRequest("POST", "/api/posts", nil), "writer", "author")
+		assert.Equal(t, http.StatusForbidden, callJSON(t, CreatePost, req, models.Post{Title: "Straight out", Status: "published"}, nil))
+	})
+
+	t.Run("Updating checks the post", func(t *testing.T) {
+		update := models.Post{Title: "Draft", Content: "Edited", Status: "draft"}
+		assert.Equal(t, http.StatusNotFound, onPost(UpdatePost, "PUT", "missing", "chief", "editor", update, nil))
+		assert.Equal(t, http.StatusForbidden, onPost(UpdatePost, "PUT", draft.ID, "writer", "author", update, nil))
+		assert.Equal(t, http.StatusConflict, onPost(UpdatePost, "PUT", draft.ID, "chief", "editor", models.Post{Title: "Draft", Slug: "live", Status: "draft"}, nil))
+
+		req := asUser(httptest.NewRequest("PUT", "/api/posts/"+draft.ID, strings.NewReader("{")), "chief", "editor")
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, UpdatePost, mux.SetURLVars(req, map[string]string{"id": draft.ID}), nil, nil))
+
+		var updated models.Post
+		require.Equal(t, http.StatusOK, onPost(UpdatePost, "PUT", draft.ID, "chief", "editor", update, &updated))
+		assert.Equal(t, "Edited", updated.Content)
+		assert.Equal(t, "draft", updated.Slug)
+	})
+
+	t.Run("Posts that can't be read aren't reported missing", func(t *testing.T) {
+		uncached := &models.Post{Title: "Uncached", Slug: "uncached", Author: "chief", Status: "published"}
+		require.NoError(t, db.CreatePost(uncached))
+		useDatabase(t, unreachableDB{db})
+
+		assert.Equal(t, http.StatusInternalServerError, get(uncached.ID, httptest.NewRequest("GET", "/api/posts/"+uncached.ID, nil)).Code)
+		assert.Equal(t, http.StatusInternalServerError, onPost(UpdatePost, "PUT", live.ID, "chief", "editor", models.Post{Title: "Live", Status: "published"}, nil))
+		assert.Equal(t, http.StatusInternalServerError, onPost(DeletePost, "DELETE", live.ID, "chief", "editor", nil, nil))
+
+		req := httptest.NewRequest("GET", "/api/posts", nil)
+		assert.Equal(t, http.StatusInternalServerError, callJSON(t, GetPosts, req, nil, nil))
+	})
+
+	t.Run("Deleting checks the post", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, onPost(DeletePost, "DELETE", "missing", "chief", "editor", nil, nil))
+		assert.Equal(t, http.StatusForbidden, onPost(DeletePost, "DELETE", live.ID, "writer", "author", nil, nil))
+
+		require.Equal(t, http.StatusOK, onPost(DeletePost, "DELETE", live.ID, "chief", "editor", nil, nil))
+		_, err := db.GetPost(live.ID)
+		assert.ErrorIs(t, err, database.ErrPostNotFound)
+		assert.Equal(t, http.StatusNotFound, onPost(DeletePost, "DELETE", live.ID, "chief", "editor", nil, nil))
+	})
+
+	t.Run("Listing rejects bad filters", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/posts?featured=maybe", nil)
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, GetPosts, req, nil, nil))
+		req = httptest.NewRequest("GET", "/api/posts?created_after=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, GetPosts, req, nil, nil))
+	})
+}
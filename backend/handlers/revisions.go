@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// GetPostRevisions godoc
+//
+//	@Summary		List post revisions
+//	@Description	List every saved revision of a post, oldest first (needs posts:read)
+//	@Tags			Revisions
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Post ID"
+//	@Success		200	{array}		models.PostRevision
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/posts/{id}/revisions [get]
+func GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Posts, permissions.Read); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	revisions, err := globalContainer.Database().GetPostRevisions(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+
+	if revisions == nil {
+		revisions = []models.PostRevision{}
+	}
+
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetPostRevision godoc
+//
+//	@Summary		Get post revision
+//	@Description	Get a single revision of a post (needs posts:read)
+//	@Tags			Revisions
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		string	true	"Post ID"
+//	@Param			revision	path		int		true	"Revision number"
+//	@Success		200			{object}	models.PostRevision
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		404			{object}	models.ErrorResponse
+//	@Router			/posts/{id}/revisions/{revision} [get]
+func GetPostRevision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Posts, permissions.Read); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil || number < 1 {
+		http.Error(w, "Invalid revision number", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := globalContainer.Database().GetPostRevision(id, number)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(revision)
+}
+
+// DiffPostRevisions godoc
+//
+//	@Summary		Diff post revisions
+//	@Description	Show the field-level differences between two revisions of a post (needs posts:read)
+//	@Tags			Revisions
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id		path		string	true	"Post ID"
+//	@Param			from	query		int		true	"Base revision number"
+//	@Param			to		query		int		true	"Target revision number"
+//	@Success		200		{object}	models.PostRevisionDiff
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Router			/posts/{id}/revisions/diff [get]
+func DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Posts, permissions.Read); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil || from < 1 || to < 1 {
+		http.Error(w, "Query parameters 'from' and 'to' must be revision numbers", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	fromRevision, err := db.GetPostRevision(id, from)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	toRevision, err := db.GetPostRevision(id, to)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.PostRevisionDiff{
+		PostID:  id,
+		From:    from,
+		To:      to,
+		Changes: models.DiffSnapshots(fromRevision.Snapshot, toRevision.Snapshot),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// RestorePostRevision godoc
+//
+//	@Summary		Restore post revision
+//	@Description	Restore the content and slug of an old revision as a new revision. Publishing state (status and schedule) is left unchanged, and a slug now used by another post returns 409. Needs the same permissions as updating the post.
+//	@Tags			Revisions
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		string	true	"Post ID"
+//	@Param			revision	path		int		true	"Revision number to restore"
+//	@Success		200			{object}	models.Post
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		404			{object}	models.ErrorResponse
+//	@Failure		409			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/posts/{id}/revisions/{revision}/restore [post]
+func RestorePostRevision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil || number < 1 {
+		http.Error(w, "Invalid revision number", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	post, ok := loadPost(w, id)
+	if !ok {
+		return
+	}
+
+	// The restored content goes live right away on published posts
+	if !permitPost(w, claims, permissions.Update, post, isLiveStatus(post.Status)) {
+		return
+	}
+
+	revision, err := db.GetPostRevision(id, number)
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	previousPost := *post
+
+	// Publishing state is managed through the publish/schedule endpoints
+	snapshot := revision.Snapshot
+	snapshot.Status = post.Status
+	snapshot.ScheduledAt = post.ScheduledAt
+
+	categories, err := normalizeCategories(snapshot.Categories)
+	if err != nil {
+		http.Error(w, "Revision references a category that no longer exists", http.StatusConflict)
+		return
+	}
+	snapshot.Categories = categories
+
+	snapshot.ApplyTo(post)
+
+	// The old slug comes back if it's free; revisions recorded before posts
+	// had slugs keep the current one
+	var assignSlug func(slug string)
+	if snapshot.Slug != "" && snapshot.Slug != previousPost.Slug {
+		assignSlug = func(slug string) {
+			post.Slug = previousPost.Slug
+			post.PreviousSlugs = previousPost.PreviousSlugs
+			setPostSlug(post, slug)
+		}
+	}
+
+	err = savePostSlug(post, snapshot.Slug, assignSlug, func() error {
+		return db.UpdatePost(id, post)
+	})
+	if err != nil {
+		writeSlugError(w, err, "Failed to restore revision")
+		return
+	}
+
+	updateCategoryCounts(&previousPost, post)
+	updateMediaUsage(id, post)
+	invalidatePostCaches(id)
+	recordPostRevision(&previousPost, post, claims.Username, number)
+	indexPost(post)
+	recordAudit(r, "post.restore", "post", id, &previousPost, post)
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// recordPostRevision stores an immutable revision for a save of a post.
+// before is nil for newly created posts. Saves that change nothing are not
+// recorded unless they restore an older revision.
+func recordPostRevision(before, after *models.Post, author string, restoredFrom int) {
+	if globalContainer == nil {
+		return
+	}
+
+	db := globalContainer.Database()
+	snapshot := models.SnapshotPost(after)
+
+	var changes []models.FieldChange
+	if before == nil {
+		changes = models.DiffSnapshots(models.PostSnapshot{}, snapshot)
+	} else {
+		previous := models.SnapshotPost(before)
+		changes = models.DiffSnapshots(previous, snapshot)
+		if len(changes) == 0 && restoredFrom == 0 {
+			return
+		}
+
+		// Posts written before revision history existed get a baseline
+		// revision so that their original content can still be restored
+		if existing, err := db.GetPostRevisions(after.ID); err == nil && len(existing) == 0 {
+			baseline := &models.PostRevision{
+				PostID:        after.ID,
+				Author:        before.Author,
+				CreatedAt:     before.UpdatedAt,
+				ChangedFields: models.ChangedFieldNames(models.DiffSnapshots(models.PostSnapshot{}, previous)),
+				Snapshot:      previous,
+			}
+			if err := db.CreatePostRevision(baseline); err != nil {
+				utils.LogError(err, "Failed to record baseline post revision", logrus.Fields{
+					"post_id": after.ID,
+				})
+			}
+		}
+	}
+
+	revision := &models.PostRevision{
+		PostID:        after.ID,
+		Author:        author,
+		ChangedFields: models.ChangedFieldNames(changes),
+		RestoredFrom:  restoredFrom,
+		Snapshot:      snapshot,
+	}
+
+	if err := db.CreatePostRevision(revision); err != nil {
+		utils.LogError(err, "Failed to record post revision", logrus.Fields{
+			"post_id": after.ID,
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostRevisions(t *testing.T) {
+	db := setupTestContainer(t)
+
+	var post models.Post
+	req := asUser(httptest.NewRequest("POST", "/api/posts", nil), "chief", "editor")
+	require.Equal(t, http.StatusCreated, callJSON(t, CreatePost, req, models.Post{Title: "First title", Content: "One"}, &post))
+	require.Equal(t, "first-title", post.Slug)
+
+	req = mux.SetURLVars(asUser(httptest.NewRequest("PUT", "/api/posts/"+post.ID, nil), "chief", "editor"), map[string]string{"id": post.ID})
+	require.Equal(t, http.StatusOK, callJSON(t, UpdatePost, req, models.Post{Title: "Second title", Content: "Two", Status: "draft"}, &post))
+	require.Equal(t, "second-title", post.Slug)
+
+	list := func(username, role string) (int, []models.PostRevision) {
+		var revisions []models.PostRevision
+		req := asUser(httptest.NewRequest("GET", "/api/posts/"+post.ID+"/revisions", nil), username, role)
+		return callJSON(t, GetPostRevisions, mux.SetURLVars(req, map[string]string{"id": post.ID}), nil, &revisions), revisions
+	}
+	get := func(number string) (int, models.PostRevision) {
+		var revision models.PostRevision
+		req := asUser(httptest.NewRequest("GET", "/api/posts/"+post.ID+"/revisions/"+number, nil), "chief", "editor")
+		req = mux.SetURLVars(req, map[string]string{"id": post.ID, "revision": number})
+		return callJSON(t, GetPostRevision, req, nil, &revision), revision
+	}
+	diff := func(query string) (int, models.PostRevisionDiff) {
+		var diff models.PostRevisionDiff
+		req := asUser(httptest.NewRequest("GET", "/api/posts/"+post.ID+"/revisions/diff?"+query, nil), "chief", "editor")
+		return callJSON(t, DiffPostRevisions, mux.SetURLVars(req, map[string]string{"id": post.ID}), nil, &diff), diff
+	}
+	restore := func(id string, number int, username, role string) (int, models.Post) {
+		var restored models.Post
+		req := asUser(httptest.NewRequest("POST", "/api/posts/"+id+"/revisions/"+strconv.Itoa(number)+"/restore", nil), username, role)
+		req = mux.SetURLVars(req, map[string]string{"id": id, "revision": strconv.Itoa(number)})
+		return callJSON(t, RestorePostRevision, req, nil, &restored), restored
+	}
+
+	t.Run("Lists revisions oldest first", func(t *testing.T) {
+		status, revisions := list("chief", "editor")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, 1, revisions[0].Number)
+		assert.Equal(t, "first-title", revisions[0].Snapshot.Slug)
+		assert.Equal(t, 2, revisions[1].Number)
+		assert.Equal(t, "second-title", revisions[1].Snapshot.Slug)
+		assert.Equal(t, "chief", revisions[1].Author)
+	})
+
+	t.Run("Gets single revisions", func(t *testing.T) {
+		status, revision := get("1")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "First title", revision.Snapshot.Title)
+		assert.Equal(t, "One", revision.Snapshot.Content)
+
+		status, _ = get("0")
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = get("9")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Diffs revisions", func(t *testing.T) {
+		status, changes := diff("from=1&to=2")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"title", "slug", "content"}, models.ChangedFieldNames(changes.Changes))
+		assert.Equal(t, "first-title", changes.Changes[1].From)
+		assert.Equal(t, "second-title", changes.Changes[1].To)
+
+		status, _ = diff("from=1")
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = diff("from=1&to=9")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Reading revisions needs posts:read", func(t *testing.T) {
+		status, _ := list("visitor", "guest")
+		assert.Equal(t, http.StatusForbidden, status)
+
+		req := httptest.NewRequest("GET", "/api/posts/"+post.ID+"/revisions", nil)
+		assert.Equal(t, http.StatusUnauthorized, callJSON(t, GetPostRevisions, mux.SetURLVars(req, map[string]string{"id": post.ID}), nil, nil))
+
+		req = asUser(httptest.NewRequest("GET", "/api/posts/"+post.ID+"/revisions/diff?from=1&to=2", nil), "visitor", "guest")
+		assert.Equal(t, http.StatusForbidden, callJSON(t, DiffPostRevisions, mux.SetURLVars(req, map[string]string{"id": post.ID}), nil, nil))
+	})
+
+	t.Run("Restoring needs update permission on the post", func(t *testing.T) {
+		status, _ := restore(post.ID, 1, "writer", "author")
+		assert.Equal(t, http.StatusForbidden, status)
+
+		status, _ = restore("missing", 1, "chief", "editor")
+		assert.Equal(t, http.StatusNotFound, status)
+		status, _ = restore(post.ID, 9, "chief", "editor")
+		assert.Equal(t, http.StatusNotFound, status)
+
+		stored, err := db.GetPost(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Second title", stored.Title)
+	})
+
+	t.Run("Restores content and slug as a new revision", func(t *testing.T) {
+		status, restored := restore(post.ID, 1, "chief", "editor")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "First title", restored.Title)
+		assert.Equal(t, "One", restored.Content)
+		assert.Equal(t, "first-title", restored.Slug)
+		assert.Equal(t, []string{"second-title"}, restored.PreviousSlugs)
+
+		bySlug, err := db.GetPostBySlug("first-title")
+		require.NoError(t, err)
+		assert.Equal(t, post.ID, bySlug.ID)
+
+		status, revisions := list("chief", "editor")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, revisions, 3)
+		assert.Equal(t, 1, revisions[2].RestoredFrom)
+		assert.Equal(t, "first-title", revisions[2].Snapshot.Slug)
+	})
+
+	t.Run("Revisions without a slug keep the current one", func(t *testing.T) {
+		legacy := &models.Post{Title: "Legacy", Slug: "legacy", Content: "Old", Author: "chief", Status: "draft"}
+		require.NoError(t, db.CreatePost(legacy))
+		require.NoError(t, db.CreatePostRevision(&models.PostRevision{
+			PostID:   legacy.ID,
+			Author:   "chief",
+			Snapshot: models.PostSnapshot{Title: "Legacy", Content: "Older", Status: "draft"},
+		}))
+
+		status, restored := restore(legacy.ID, 1, "chief", "editor")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "Older", restored.Content)
+		assert.Equal(t, "legacy", restored.Slug)
+		assert.Empty(t, restored.PreviousSlugs)
+	})
+}
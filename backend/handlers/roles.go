@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loadRoles returns the configured roles, or the default roles when they
+// were never changed
+func loadRoles(db database.DatabaseAdapter) (permissions.Roles, error) {
+	setting, err := db.GetSetting(models.RoleSettingsKey)
+	if err != nil {
+		return nil, err
+	}
+	if setting == nil {
+		return permissions.DefaultRoles(), nil
+	}
+
+	var roles permissions.Roles
+	if err := json.Unmarshal([]byte(setting.Value), &roles); err != nil {
+		return nil, fmt.Errorf("failed to decode roles: %w", err)
+	}
+	return roles, nil
+}
+
+// rolePermissions returns the permissions of a role. Unknown roles have
+// none.
+func rolePermissions(role string) (permissions.Set, error) {
+	roles, err := loadRoles(globalContainer.Database())
+	if err != nil {
+		return nil, err
+	}
+	return roles[role], nil
+}
+
+// claimPermissions returns the permissions of a request. Requests made
+// with an API key are limited to its scopes.
+func claimPermissions(claims *middleware.Claims) (permissions.Set, error) {
+	set, err := rolePermissions(claims.Role)
+	if err != nil {
+		return nil, err
+	}
+	if claims.APIKeyID != "" {
+		set = set.Limit(claims.Scopes)
+	}
+	return set, nil
+}
+
+// permit reports whether the user may take action on resource, and writes
+// the error response when not. owner tells whether the user owns the
+// resource.
+func permit(w http.ResponseWriter, claims *middleware.Claims, resource, action string, owner bool) bool {
+	set, err := claimPermissions(claims)
+	if err != nil {
+		utils.LogError(err, "Failed to load role permissions", logrus.Fields{
+			"role": claims.Role,
+		})
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return false
+	}
+
+	if !set.Allows(resource, action, owner) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorize returns the claims of the request when its user may take
+// action on resource, and writes the error response otherwise. Resources
+// with an owner are checked with permit once they are loaded.
+func authorize(w http.ResponseWriter, r *http.Request, resource, action string) (*middleware.Claims, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !permit(w, claims, resource, action, false) {
+		return nil, false
+	}
+	return claims, true
+}
+
+// postStatusFilter returns the status that a listing of posts filters on
+// for status, the one the caller asked for. Only callers who may read posts
+// see posts that aren't published: asking for another status takes
+// posts:read, with the error response written when missing, and without a
+// status the others only see published posts.
+func postStatusFilter(w http.ResponseWriter, r *http.Request, status string) (string, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok || status == "published" {
+		return "published", true
+	}
+
+	if status != "" {
+		if _, ok := authorize(w, r, permissions.Posts, permissions.Read); !ok {
+			return "", false
+		}
+		return status, true
+	}
+
+	set, err := claimPermissions(claims)
+	if err != nil || !set.Allows(permissions.Posts, permissions.Read, false) {
+		return "published", true
+	}
+	return "", true
+}
+
+// RequirePermission is a middleware that only lets requests through whose
+// user may take action on resource
+func RequirePermission(resource, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := authorize(w, r, resource, action); !ok {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validRole reports whether role is one of the configured roles
+func validRole(db database.DatabaseAdapter, role string) (bool, error) {
+	roles, err := loadRoles(db)
+	if err != nil {
+		return false, err
+	}
+	_, ok := roles[role]
+	return ok, nil
+}
+
+// GetRoles godoc
+//
+//	@Summary		Get roles
+//	@Description	Get the roles and their permissions. A permission names an action on a resource, like "posts:publish"; the ":own" suffix limits it to the user's own posts or media, and "*" matches everything.
+//	@Tags			Settings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	models.RoleSettings
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/settings/roles [get]
+func GetRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Settings, permissions.Read); !ok {
+		return
+	}
+
+	roles, err := loadRoles(globalContainer.Database())
+	if err != nil {
+		utils.LogError(err, "Failed to load roles", logrus.Fields{})
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(roleSettings(roles))
+}
+
+// UpdateRoles godoc
+//
+//	@Summary		Update roles
+//	@Description	Replace the roles and their permissions. The admin role must keep the "*" permission, and roles that users still have can't be removed. Changes apply to signed in users right away.
+//	@Tags			Settings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			roles	body		models.RoleSettings	true	"Roles"
+//	@Success		200		{object}	models.RoleSettings
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/admin/settings/roles [put]
+func UpdateRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Settings, permissions.Update)
+	if !ok {
+		return
+	}
+
+	var req models.RoleSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	roles := make(permissions.Roles, len(req.Roles))
+	for name, set := range req.Roles {
+		if set == nil {
+			set = []string{}
+		}
+		roles[name] = set
+	}
+	if err := roles.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	current, err := loadRoles(db)
+	if err != nil {
+		utils.LogError(err, "Failed to load roles", logrus.Fields{})
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+
+	// Users must keep a role
+	for name := range current {
+		if _, ok := roles[name]; ok {
+			continue
+		}
+		count, err := db.CountUsers(models.UserQuery{Role: name})
+		if err != nil {
+			http.Error(w, "Failed to count users", http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, fmt.Sprintf("Role %s is assigned to %d users", name, count), http.StatusConflict)
+			return
+		}
+	}
+
+	value, err := json.Marshal(roles)
+	if err != nil {
+		http.Error(w, "Failed to encode roles", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.SaveSetting(&models.Setting{
+		Key:       models.RoleSettingsKey,
+		Value:     string(value),
+		UpdatedBy: claims.Username,
+	}); err != nil {
+		utils.LogError(err, "Failed to save roles", logrus.Fields{})
+		http.Error(w, "Failed to save roles", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("Roles updated", logrus.Fields{
+		"updated_by": claims.Username,
+	})
+	recordAudit(r, "settings.update", "settings", models.RoleSettingsKey, current, roles)
+
+	json.NewEncoder(w).Encode(roleSettings(roles))
+}
+
+func roleSettings(roles permissions.Roles) models.RoleSettings {
+	settings := models.RoleSettings{Roles: make(map[string][]string, len(roles))}
+	for name, set := range roles {
+		settings.Roles[name] = set
+	}
+	return settings
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setRoles replaces the roles as the seeded admin and returns the status
+func setRoles(t *testing.T, roles map[string][]string) int {
+	t.Helper()
+	req := asUser(httptest.NewRequest("PUT", "/api/admin/settings/roles", nil), "admin", "admin")
+	return callJSON(t, UpdateRoles, req, models.RoleSettings{Roles: roles}, nil)
+}
+
+func TestPostPermissions(t *testing.T) {
+	setupTestContainer(t)
+
+	create := func(username, role, status string) (int, models.Post) {
+		var post models.Post
+		req := asUser(httptest.NewRequest("POST", "/api/posts", nil), username, role)
+		code := callJSON(t, CreatePost, req, models.Post{Title: "Post by " + username, Status: status}, &post)
+		return code, post
+	}
+	update := func(username, role, id, status string) int {
+		req := asUser(httptest.NewRequest("PUT", "/api/posts/"+id, nil), username, role)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		return callJSON(t, UpdatePost, req, models.Post{Title: "Updated", Status: status}, nil)
+	}
+	remove := func(username, role, id string) int {
+		req := asUser(httptest.NewRequest("DELETE", "/api/posts/"+id, nil), username, role)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		return callJSON(t, DeletePost, req, nil, nil)
+	}
+
+	status, _ := create("writer", "author", "published")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, post := create("writer", "author", "draft")
+	require.Equal(t, http.StatusCreated, status)
+
+	// Authors edit their own drafts only
+	assert.Equal(t, http.StatusOK, update("writer", "author", post.ID, "draft"))
+	assert.Equal(t, http.StatusForbidden, update("other", "author", post.ID, "draft"))
+	assert.Equal(t, http.StatusForbidden, remove("other", "author", post.ID))
+	assert.Equal(t, http.StatusForbidden, update("writer", "author", post.ID, "published"))
+
+	// Editors publish any post, which takes it out of the author's hands
+	require.Equal(t, http.StatusOK, update("chief", "editor", post.ID, "published"))
+	assert.Equal(t, http.StatusForbidden, update("writer", "author", post.ID, "draft"))
+	assert.Equal(t, http.StatusForbidden, remove("writer", "author", post.ID))
+	assert.Equal(t, http.StatusOK, remove("chief", "editor", post.ID))
+
+	// Unknown roles may do nothing
+	status, _ = create("guest", "guest", "draft")
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestUpdateRoles(t *testing.T) {
+	db := setupTestContainer(t)
+
+	writer := &models.User{Username: "writer", Email: "writer@example.com", Role: "author", Active: true}
+	require.NoError(t, writer.SetPassword("password"))
+	require.NoError(t, db.CreateUser(writer))
+
+	req := asUser(httptest.NewRequest("GET", "/api/admin/settings/roles", nil), "chief", "editor")
+	assert.Equal(t, http.StatusForbidden, callJSON(t, GetRoles, req, nil, nil))
+
+	assert.Equal(t, http.StatusBadRequest, setRoles(t, map[string][]string{"admin": {"posts:*"}}))
+	assert.Equal(t, http.StatusBadRequest, setRoles(t, map[string][]string{"admin": {"*"}, "author": {"pages:read"}}))
+	// Users must keep their role
+	assert.Equal(t, http.StatusConflict, setRoles(t, map[string][]string{"admin": {"*"}, "editor": {"posts:*"}}))
+
+	require.Equal(t, http.StatusOK, setRoles(t, map[string][]string{
+		"admin":  {"*"},
+		"author": {"posts:read", "posts:update:own", "categories:*"},
+	}))
+
+	var roles models.RoleSettings
+	req = asUser(httptest.NewRequest("GET", "/api/admin/settings/roles", nil), "admin", "admin")
+	require.Equal(t, http.StatusOK, callJSON(t, GetRoles, req, nil, &roles))
+	assert.Len(t, roles.Roles, 2)
+
+	// The new permissions apply right away
+	var me models.CurrentUserResponse
+	req = asUser(httptest.NewRequest("GET", "/api/auth/me", nil), "writer", "author")
+	require.Equal(t, http.StatusOK, callJSON(t, GetCurrentUser, req, nil, &me))
+	assert.Equal(t, "writer", me.User.Username)
+	assert.Equal(t, []string{
+		"categories:create",
+		"categories:delete",
+		"categories:update",
+		"posts:read",
+		"posts:update:own",
+	}, me.Permissions)
+
+	req = asUser(httptest.NewRequest("POST", "/api/posts", nil), "writer", "author")
+	assert.Equal(t, http.StatusForbidden, callJSON(t, CreatePost, req, models.Post{Title: "Draft"}, nil))
+}
+
+func TestUserRoleAssignment(t *testing.T) {
+	db := setupTestContainer(t)
+
+	require.Equal(t, http.StatusOK, setRoles(t, map[string][]string{
+		"admin":    {"*"},
+		"author":   {"posts:*"},
+		"managers": {"users:*"},
+	}))
+
+	createUser := func(role string) int {
+		req := asUser(httptest.NewRequest("POST", "/api/users", nil), "boss", "managers")
+		return callJSON(t, CreateUser, req, map[string]interface{}{
+			"username": role + "-user",
+			"email":    role + "@example.com",
+			"password": "correct horse battery",
+			"role":     role,
+			"active":   true,
+		}, nil)
+	}
+
+	assert.Equal(t, http.StatusCreated, createUser("author"))
+	assert.Equal(t, http.StatusBadRequest, createUser("editor"))
+	// Only admins make admins
+	assert.Equal(t, http.StatusForbidden, createUser("admin"))
+
+	admin, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+	req := asUser(httptest.NewRequest("PUT", "/api/users/"+admin.ID, nil), "boss", "managers")
+	req = mux.SetURLVars(req, map[string]string{"id": admin.ID})
+	assert.Equal(t, http.StatusForbidden, callJSON(t, UpdateUser, req, map[string]interface{}{"active": false}, nil))
+}
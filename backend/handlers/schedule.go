@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/services"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errPostBeingPublished = errors.New("the post is being published")
+	errPostPublished      = errors.New("the post is already published")
+	errPostNotScheduled   = errors.New("the post is not scheduled")
+)
+
+// withPublishClaim runs fn while holding the claim the scheduler publishes a
+// post under, so that changes to the schedule of the post can't race its
+// publishing. It fails with errPostBeingPublished while the claim is taken.
+func withPublishClaim(postID string, fn func() error) error {
+	cache := globalContainer.Cache()
+	key := services.PublishClaimKey(postID)
+	owner := uuid.New().String()
+
+	acquired, err := cache.AcquireLock(key, owner, services.PublishClaimTTL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errPostBeingPublished
+	}
+	defer cache.ReleaseLock(key, owner)
+
+	return fn()
+}
+
+// SchedulePost godoc
+//
+//	@Summary		Schedule or reschedule post
+//	@Description	Schedule a post for automatic publishing at the given time (needs posts:publish, or posts:publish:own for its author). Published posts can't be scheduled.
+//	@Tags			Posts
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		string						true	"Post ID"
+//	@Param			schedule	body		object{scheduled_at=string}	true	"Publish time (RFC 3339)"
+//	@Success		200			{object}	models.Post
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		404			{object}	models.ErrorResponse
+//	@Failure		409			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/posts/{id}/schedule [put]
+func SchedulePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req struct {
+		ScheduledAt *time.Time `json:"scheduled_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ScheduledAt == nil {
+		http.Error(w, "scheduled_at is required", http.StatusBadRequest)
+		return
+	}
+	if !req.ScheduledAt.After(time.Now()) {
+		http.Error(w, "scheduled_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+
+	post, ok := loadPost(w, id)
+	if !ok {
+		return
+	}
+
+	if !permitPost(w, claims, permissions.Publish, post, true) {
+		return
+	}
+
+	// Published posts stay online with their publish date
+	var previousPost models.Post
+	err := withPublishClaim(id, func() error {
+		// The scheduler may have published the post in the meantime
+		current, err := db.GetPost(id)
+		if err != nil {
+			return err
+		}
+		if current.Status == "published" {
+			return errPostPublished
+		}
+
+		previousPost = *current
+		current.Status = "scheduled"
+		current.ScheduledAt = req.ScheduledAt
+		current.PublishedAt = nil
+		post = current
+
+		return db.UpdatePost(id, post)
+	})
+	switch {
+	case errors.Is(err, errPostPublished):
+		http.Error(w, "Post is already published", http.StatusConflict)
+		return
+	case errors.Is(err, errPostBeingPublished):
+		http.Error(w, "Post is being published", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to schedule post", http.StatusInternalServerError)
+		return
+	}
+
+	updateCategoryCounts(&previousPost, post)
+	invalidatePostCaches(id)
+	recordPostRevision(&previousPost, post, claims.Username, 0)
+	indexPost(post)
+	recordAudit(r, "post.schedule", "post", id, &previousPost, post)
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// UnschedulePost godoc
+//
+//	@Summary		Unschedule post
+//	@Description	Cancel scheduled publishing and move the post back to draft (needs posts:publish, or posts:publish:own for its author)
+//	@Tags			Posts
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Post ID"
+//	@Success		200	{object}	models.Post
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		409	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/posts/{id}/schedule [delete]
+func UnschedulePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	db := globalContainer.Database()
+
+	post, ok := loadPost(w, id)
+	if !ok {
+		return
+	}
+
+	if !permitPost(w, claims, permissions.Publish, post, true) {
+		return
+	}
+
+	var previousPost models.Post
+	err := withPublishClaim(id, func() error {
+		// The scheduler may have published the post in the meantime
+		current, err := db.GetPost(id)
+		if err != nil {
+			return err
+		}
+		if current.Status != "scheduled" {
+			return errPostNotScheduled
+		}
+
+		previousPost = *current
+		current.Status = "draft"
+		current.ScheduledAt = nil
+		post = current
+
+		return db.UpdatePost(id, post)
+	})
+	switch {
+	case errors.Is(err, errPostNotScheduled):
+		http.Error(w, "Post is not scheduled", http.StatusConflict)
+		return
+	case errors.Is(err, errPostBeingPublished):
+		http.Error(w, "Post is being published", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to unschedule post", http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePostCaches(id)
+	recordPostRevision(&previousPost, post, claims.Username, 0)
+	indexPost(post)
+	recordAudit(r, "post.unschedule", "post", id, &previousPost, post)
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// OnPostPublished keeps derived data in step when the scheduler publishes a post
+func OnPostPublished(before, after *models.Post) {
+	updateCategoryCounts(before, after)
+	recordPostRevision(before, after, "scheduler", 0)
+	indexPost(after)
+	recordJobAudit("scheduler", "post.publish", "post", after.ID, before, after)
+}
+
+// invalidatePostCaches drops the cached copy of a post and all cached post lists
+func invalidatePostCaches(id string) {
+	if globalContainer == nil {
+		return
+	}
+
+	cache := globalContainer.Cache()
+
+	go func() {
+		if err := cache.InvalidatePostCache(id); err != nil {
+			fmt.Printf("Failed to invalidate post cache for %s: %v\n", id, err)
+		}
+		if err := cache.InvalidatePostsListCache(); err != nil {
+			fmt.Printf("Failed to invalidate posts list cache: %v\n", err)
+		}
+	}()
+}
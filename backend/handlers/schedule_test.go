@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/services"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulePost(t *testing.T) {
+	db := setupTestContainer(t)
+
+	schedule := func(id string, at time.Time) (int, models.Post) {
+		var post models.Post
+		req := asUser(httptest.NewRequest("PUT", "/api/posts/"+id+"/schedule", nil), "chief", "editor")
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		return callJSON(t, SchedulePost, req, map[string]time.Time{"scheduled_at": at}, &post), post
+	}
+	unschedule := func(id string) int {
+		req := asUser(httptest.NewRequest("DELETE", "/api/posts/"+id+"/schedule", nil), "chief", "editor")
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		return callJSON(t, UnschedulePost, req, nil, nil)
+	}
+	later := time.Now().Add(time.Hour)
+
+	t.Run("Drafts are scheduled and unscheduled", func(t *testing.T) {
+		post := &models.Post{Title: "Draft", Slug: "draft", Status: "draft"}
+		require.NoError(t, db.CreatePost(post))
+
+		status, scheduled := schedule(post.ID, later)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "scheduled", scheduled.Status)
+		require.NotNil(t, scheduled.ScheduledAt)
+
+		require.Equal(t, http.StatusOK, unschedule(post.ID))
+		stored, err := db.GetPost(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "draft", stored.Status)
+		assert.Nil(t, stored.ScheduledAt)
+		assert.Equal(t, http.StatusConflict, unschedule(post.ID))
+	})
+
+	t.Run("Published posts stay published", func(t *testing.T) {
+		post := &models.Post{Title: "Live", Slug: "live", Status: "published"}
+		require.NoError(t, db.CreatePost(post))
+		live, err := db.GetPost(post.ID)
+		require.NoError(t, err)
+		require.NotNil(t, live.PublishedAt)
+
+		status, _ := schedule(post.ID, later)
+		assert.Equal(t, http.StatusConflict, status)
+
+		stored, err := db.GetPost(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "published", stored.Status)
+		require.NotNil(t, stored.PublishedAt)
+		assert.True(t, live.PublishedAt.Equal(*stored.PublishedAt))
+	})
+
+	t.Run("Posts being published are left to the scheduler", func(t *testing.T) {
+		post := &models.Post{Title: "Due", Slug: "due", Status: "draft"}
+		require.NoError(t, db.CreatePost(post))
+		status, _ := schedule(post.ID, later)
+		require.Equal(t, http.StatusOK, status)
+
+		cache := globalContainer.Cache()
+		key := services.PublishClaimKey(post.ID)
+		acquired, err := cache.AcquireLock(key, "scheduler", services.PublishClaimTTL)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		assert.Equal(t, http.StatusConflict, unschedule(post.ID))
+		status, _ = schedule(post.ID, later.Add(time.Hour))
+		assert.Equal(t, http.StatusConflict, status)
+
+		stored, err := db.GetPost(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "scheduled", stored.Status)
+		require.NotNil(t, stored.ScheduledAt)
+		assert.WithinDuration(t, later, *stored.ScheduledAt, time.Second)
+
+		require.NoError(t, cache.ReleaseLock(key, "scheduler"))
+		assert.Equal(t, http.StatusOK, unschedule(post.ID))
+	})
+}
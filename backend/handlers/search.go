@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/search"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SearchPosts godoc
+//
+//	@Summary		Search posts
+//	@Description	Full-text search over posts ranked by relevance. Supports "quoted phrases". Callers without posts:read, including public ones, only ever see published posts.
+//	@Tags			Search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q			query		string	true	"Search query"
+//	@Param			status		query		string	false	"Filter by post status (other than published needs posts:read)"
+//	@Param			tag			query		string	false	"Filter by tag"
+//	@Param			category	query		string	false	"Filter by category slug"
+//	@Param			author		query		string	false	"Filter by author"
+//	@Param			page		query		int		false	"Page number (default: 1)"
+//	@Param			limit		query		int		false	"Items per page (default: 10, max: 100)"
+//	@Success		200			{object}	search.Results
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/search [get]
+func SearchPosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if globalSearch == nil {
+		http.Error(w, "Search not available", http.StatusInternalServerError)
+		return
+	}
+
+	params := r.URL.Query()
+
+	text := params.Get("q")
+	if text == "" {
+		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		return
+	}
+
+	page, limit := getPaginationParams(r)
+
+	query := search.Query{
+		Text:     text,
+		Tag:      params.Get("tag"),
+		Category: params.Get("category"),
+		Author:   params.Get("author"),
+		Limit:    limit,
+		Offset:   (page - 1) * limit,
+	}
+
+	status, ok := postStatusFilter(w, r, params.Get("status"))
+	if !ok {
+		return
+	}
+	query.Status = status
+
+	results, err := globalSearch.Search(query)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// indexPost adds or refreshes a post in the search index
+func indexPost(post *models.Post) {
+	if globalSearch == nil {
+		return
+	}
+
+	if err := globalSearch.Index(search.DocumentFromPost(post)); err != nil {
+		utils.LogError(err, "Failed to index post", logrus.Fields{
+			"post_id": post.ID,
+		})
+	}
+}
+
+// unindexPost removes a post from the search index
+func unindexPost(id string) {
+	if globalSearch == nil {
+		return
+	}
+
+	if err := globalSearch.Delete(id); err != nil {
+		utils.LogError(err, "Failed to remove post from search index", logrus.Fields{
+			"post_id": id,
+		})
+	}
+}
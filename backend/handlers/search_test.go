@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/search"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchUnpublishedPosts(t *testing.T) {
+	db := setupTestContainer(t)
+	middleware.SetServiceContainer(globalContainer)
+	SetSearchIndex(search.NewMemoryIndex())
+	t.Cleanup(func() {
+		middleware.SetServiceContainer(nil)
+		SetSearchIndex(nil)
+	})
+
+	writer := &models.User{Username: "writer", Email: "writer@example.com", Role: "author", Active: true}
+	require.NoError(t, writer.SetPassword("password"))
+	require.NoError(t, db.CreateUser(writer))
+
+	require.Equal(t, http.StatusOK, setRoles(t, map[string][]string{
+		"admin":       {"*"},
+		"author":      {"posts:create", "posts:read", "posts:update:own", "media:create", "media:read"},
+		"contributor": {"posts:create", "posts:update:own"},
+	}))
+
+	indexPost(&models.Post{ID: "live", Title: "Launch notes", Status: "published"})
+	indexPost(&models.Post{ID: "secret", Title: "Launch plans", Status: "draft"})
+
+	searchAs := func(r *http.Request) (int, []string) {
+		var results search.Results
+		code := callJSON(t, SearchPosts, r, nil, &results)
+		ids := make([]string, 0, len(results.Hits))
+		for _, hit := range results.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return code, ids
+	}
+	request := func(query string) *http.Request {
+		return httptest.NewRequest("GET", "/api/search?q=launch"+query, nil)
+	}
+
+	t.Run("Public callers see published posts", func(t *testing.T) {
+		code, ids := searchAs(request("&status=draft"))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"live"}, ids)
+	})
+
+	t.Run("Roles without posts:read see published posts", func(t *testing.T) {
+		code, _ := searchAs(asUser(request("&status=draft"), "helper", "contributor"))
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, ids := searchAs(asUser(request(""), "helper", "contributor"))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"live"}, ids)
+	})
+
+	t.Run("Roles with posts:read see drafts", func(t *testing.T) {
+		code, ids := searchAs(asUser(request("&status=draft"), "writer", "author"))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"secret"}, ids)
+
+		code, ids = searchAs(asUser(request(""), "writer", "author"))
+		require.Equal(t, http.StatusOK, code)
+		assert.ElementsMatch(t, []string{"live", "secret"}, ids)
+	})
+
+	t.Run("API keys need posts:read in their scopes", func(t *testing.T) {
+		createKey := func(scopes ...string) string {
+			var created models.CreateAPIKeyResponse
+			req := asUser(httptest.NewRequest("POST", "/api/auth/api-keys", nil), "writer", "author")
+			require.Equal(t, http.StatusCreated, callJSON(t, CreateAPIKey, req, models.CreateAPIKeyRequest{
+				Name:   "search",
+				Scopes: scopes,
+			}, &created))
+			return created.Key
+		}
+
+		mediaKey := createKey("media:read")
+		assert.Equal(t, http.StatusForbidden, withAPIKey(t, SearchPosts, request("&status=draft"), mediaKey, nil, nil))
+		var results search.Results
+		require.Equal(t, http.StatusOK, withAPIKey(t, SearchPosts, request(""), mediaKey, nil, &results))
+		require.Len(t, results.Hits, 1)
+		assert.Equal(t, "live", results.Hits[0].ID)
+
+		postsKey := createKey("posts:read")
+		require.Equal(t, http.StatusOK, withAPIKey(t, SearchPosts, request("&status=draft"), postsKey, nil, &results))
+		require.Len(t, results.Hits, 1)
+		assert.Equal(t, "secret", results.Hits[0].ID)
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// startSession records the session of a login with the device it came
+// from. Logins without a record still work, so failures are only logged.
+func startSession(r *http.Request, result *auth.AuthResult, user *models.User) {
+	if globalSessions == nil || result.Claims == nil {
+		return
+	}
+
+	if err := globalSessions.StartSession(result.Claims.SessionID, middleware.SessionData{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		UserAgent: r.UserAgent(),
+		IP:        middleware.ClientIP(r),
+	}); err != nil {
+		utils.LogError(err, "Failed to record session", logrus.Fields{
+			"user_id": user.ID,
+		})
+	}
+}
+
+// sessionRevoked reports whether a session was revoked. Sessions count as
+// revoked while that can't be checked.
+func sessionRevoked(sessionID string) bool {
+	if globalSessions == nil || sessionID == "" {
+		return false
+	}
+
+	revoked, err := globalSessions.IsRevoked(sessionID)
+	if err != nil {
+		utils.LogError(err, "Failed to check session", logrus.Fields{
+			"session_id": sessionID,
+		})
+		return true
+	}
+	return revoked
+}
+
+// endSession ends the session of a token on logout. Only tokens the auth
+// adapter issued name a session, so forged ones can't end others' sessions.
+func endSession(token string) error {
+	if globalSessions == nil {
+		return nil
+	}
+
+	sessionID, err := globalContainer.Auth().TokenSession(token)
+	if err != nil || sessionID == "" {
+		return nil
+	}
+	return globalSessions.RevokeSession(sessionID)
+}
+
+// signOutUser revokes every token and session of a user
+func signOutUser(userID string) error {
+	if err := globalContainer.Auth().RevokeUserTokens(userID); err != nil {
+		return err
+	}
+	if globalSessions == nil {
+		return nil
+	}
+	return globalSessions.InvalidateAllUserSessions(userID)
+}
+
+// sessionOwner returns the claims of a request for its user's own sessions,
+// writing the error response when there are none. Like account security,
+// sessions can't be managed with an API key.
+func sessionOwner(w http.ResponseWriter, r *http.Request) (*middleware.Claims, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok || claims.Subject == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+	if claims.APIKeyID != "" {
+		http.Error(w, "Not available with an API key", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+// listSessions writes the sessions of a user, marking the one of the
+// request
+func listSessions(w http.ResponseWriter, userID, currentID string) {
+	if globalSessions == nil {
+		http.Error(w, "Sessions not available", http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := globalSessions.ListUserSessions(userID)
+	if err != nil {
+		utils.LogError(err, "Failed to list sessions", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	sessions := make([]models.Session, 0, len(stored))
+	for _, session := range stored {
+		sessions = append(sessions, models.Session{
+			ID:        session.ID,
+			UserAgent: session.UserAgent,
+			IP:        session.IP,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			Current:   currentID != "" && session.ID == currentID,
+		})
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetSessions godoc
+//
+//	@Summary		List my sessions
+//	@Description	List the signed-in devices of the current user, most recently seen first
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.Session
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/sessions [get]
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	listSessions(w, claims.Subject, claims.SessionID)
+}
+
+// RevokeSession godoc
+//
+//	@Summary		Revoke my session
+//	@Description	Sign out one of the devices of the current user. Its tokens stop working right away.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Session ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/sessions/{id} [delete]
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if globalSessions == nil {
+		http.Error(w, "Sessions not available", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := mux.Vars(r)["id"]
+	session, err := globalSessions.LookupSession(sessionID)
+	if err != nil {
+		utils.LogError(err, "Failed to get session", logrus.Fields{
+			"session_id": sessionID,
+		})
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	// Sessions of other users look the same as unknown ones
+	if session == nil || session.UserID != claims.Subject {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := globalSessions.RevokeSession(sessionID); err != nil {
+		utils.LogError(err, "Failed to revoke session", logrus.Fields{
+			"session_id": sessionID,
+		})
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("Session revoked", logrus.Fields{
+		"user_id":    claims.Subject,
+		"session_id": sessionID,
+	})
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Session revoked"})
+}
+
+// GetUserSessions godoc
+//
+//	@Summary		List sessions of a user
+//	@Description	List the signed-in devices of any user, most recently seen first (needs users:read)
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{array}		models.Session
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/users/{id}/sessions [get]
+func GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Read)
+	if !ok {
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	if _, err := globalContainer.Database().GetUser(userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	listSessions(w, userID, claims.SessionID)
+}
+
+// SignOutUser godoc
+//
+//	@Summary		Sign out a user everywhere
+//	@Description	Revoke every session and token of a user (needs users:update; only admins sign out admins). The user has to log in again on every device.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/users/{id}/sessions [delete]
+func SignOutUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Update)
+	if !ok {
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	user, err := globalContainer.Database().GetUser(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if user.Role == permissions.AdminRole && claims.Role != permissions.AdminRole {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	if err := signOutUser(userID); err != nil {
+		utils.LogError(err, "Failed to sign out user", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("User signed out everywhere", logrus.Fields{
+		"user_id":       userID,
+		"signed_out_by": claims.Username,
+	})
+	recordAudit(r, "user.sign_out", "user", userID, nil, nil)
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "User signed out everywhere"})
+}
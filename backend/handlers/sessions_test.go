@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useSessions records sessions in the cache of the test container, the way
+// main wires them
+func useSessions(t *testing.T) *middleware.SessionManager {
+	sessions := middleware.NewSessionManager(globalContainer.Cache(), "", false)
+	SetSessionManager(sessions)
+	middleware.SetSessionManager(sessions)
+	t.Cleanup(func() {
+		SetSessionManager(nil)
+		middleware.SetSessionManager(nil)
+	})
+	return sessions
+}
+
+// withToken serves a request through the auth middleware as the bearer of
+// token
+func withToken(t *testing.T, handler http.HandlerFunc, req *http.Request, token string, vars map[string]string, out interface{}) int {
+	t.Helper()
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+
+	rr := httptest.NewRecorder()
+	middleware.AuthMiddlewareWithAdapter(globalContainer.Auth())(handler).ServeHTTP(rr, req)
+	if out != nil && rr.Code < 300 {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), out))
+	}
+	return rr.Code
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestContainer(t)
+	useSessions(t)
+
+	loginFrom := func(username, password, userAgent, ip string) models.LoginResponse {
+		body, err := json.Marshal(models.LoginRequest{Username: username, Password: password})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		Login(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response models.LoginResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+	list := func(token string) []models.Session {
+		var sessions []models.Session
+		require.Equal(t, http.StatusOK, withToken(t, GetSessions, httptest.NewRequest("GET", "/api/auth/sessions", nil), token, nil, &sessions))
+		return sessions
+	}
+	revoke := func(token, sessionID string) int {
+		req := httptest.NewRequest("DELETE", "/api/auth/sessions/"+sessionID, nil)
+		return withToken(t, RevokeSession, req, token, map[string]string{"id": sessionID}, nil)
+	}
+
+	laptop := loginFrom("admin", "/juk+vfdbNk6TICg", "Laptop", "10.0.0.1")
+	phone := loginFrom("admin", "/juk+vfdbNk6TICg", "Phone", "10.0.0.2")
+
+	editor := &models.User{Username: "editor", Email: "editor@example.com", Role: "editor", Active: true}
+	require.NoError(t, editor.SetPassword("kL9#vQ2!mZp4xR7w"))
+	require.NoError(t, db.CreateUser(editor))
+	editorSession := loginFrom("editor", "kL9#vQ2!mZp4xR7w", "Desktop", "10.0.0.3")
+
+	t.Run("Logins are listed with their device", func(t *testing.T) {
+		sessions := list(laptop.Token)
+		require.Len(t, sessions, 2)
+
+		byAgent := map[string]models.Session{}
+		for _, session := range sessions {
+			byAgent[session.UserAgent] = session
+		}
+		assert.True(t, byAgent["Laptop"].Current)
+		assert.False(t, byAgent["Phone"].Current)
+		assert.Equal(t, "10.0.0.2", byAgent["Phone"].IP)
+		assert.False(t, byAgent["Phone"].CreatedAt.IsZero())
+
+		assert.Len(t, list(editorSession.Token), 1)
+	})
+
+	t.Run("Users revoke only their own sessions", func(t *testing.T) {
+		editorSessions := list(editorSession.Token)
+		require.Len(t, editorSessions, 1)
+		assert.Equal(t, http.StatusNotFound, revoke(laptop.Token, editorSessions[0].ID))
+		assert.True(t, authorized(editorSession.Token))
+
+		var phoneID string
+		for _, session := range list(laptop.Token) {
+			if !session.Current {
+				phoneID = session.ID
+			}
+		}
+		require.Equal(t, http.StatusOK, revoke(laptop.Token, phoneID))
+
+		assert.False(t, authorized(phone.Token))
+		assert.Equal(t, http.StatusUnauthorized, refresh(phone.RefreshToken).Code)
+		assert.True(t, authorized(laptop.Token))
+		assert.Len(t, list(laptop.Token), 1)
+	})
+
+	t.Run("Logging out ends the session", func(t *testing.T) {
+		tablet := loginFrom("admin", "/juk+vfdbNk6TICg", "Tablet", "10.0.0.4")
+		require.Len(t, list(laptop.Token), 2)
+
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+tablet.Token)
+		rr := httptest.NewRecorder()
+		Logout(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Len(t, list(laptop.Token), 1)
+	})
+
+	t.Run("API keys can't manage sessions", func(t *testing.T) {
+		admin, err := db.GetUserByUsername("admin")
+		require.NoError(t, err)
+		withKey := func(r *http.Request) *http.Request {
+			return r.WithContext(context.WithValue(r.Context(), "user", &middleware.Claims{
+				Username: "admin",
+				Role:     "admin",
+				APIKeyID: "key-1",
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject: admin.ID,
+				},
+			}))
+		}
+
+		assert.Equal(t, http.StatusForbidden, callJSON(t, GetSessions, withKey(httptest.NewRequest("GET", "/api/auth/sessions", nil)), nil, nil))
+		sessions := list(laptop.Token)
+		require.NotEmpty(t, sessions)
+		req := mux.SetURLVars(withKey(httptest.NewRequest("DELETE", "/api/auth/sessions/"+sessions[0].ID, nil)),
+			map[string]string{"id": sessions[0].ID})
+		assert.Equal(t, http.StatusForbidden, callJSON(t, RevokeSession, req, nil, nil))
+		assert.Len(t, list(laptop.Token), len(sessions))
+	})
+
+	t.Run("Forged tokens don't end sessions", func(t *testing.T) {
+		var current string
+		for _, session := range list(laptop.Token) {
+			if session.Current {
+				current = session.ID
+			}
+		}
+		require.NotEmpty(t, current)
+
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodNone, &auth.JWTClaims{SessionID: current}).
+			SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+forged)
+		rr := httptest.NewRecorder()
+		Logout(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		assert.True(t, authorized(laptop.Token))
+	})
+
+	t.Run("Admins sign users out everywhere", func(t *testing.T) {
+		second := loginFrom("editor", "kL9#vQ2!mZp4xR7w", "Phone", "10.0.0.5")
+
+		var sessions []models.Session
+		req := httptest.NewRequest("GET", "/api/admin/users/"+editor.ID+"/sessions", nil)
+		require.Equal(t, http.StatusOK, withToken(t, GetUserSessions, req, laptop.Token, map[string]string{"id": editor.ID}, &sessions))
+		assert.Len(t, sessions, 2)
+
+		// Editors can't sign out admins
+		admin, err := db.GetUserByUsername("admin")
+		require.NoError(t, err)
+		req = httptest.NewRequest("DELETE", "/api/admin/users/"+admin.ID+"/sessions", nil)
+		assert.Equal(t, http.StatusForbidden, withToken(t, SignOutUser, req, editorSession.Token, map[string]string{"id": admin.ID}, nil))
+
+		req = httptest.NewRequest("DELETE", "/api/admin/users/"+editor.ID+"/sessions", nil)
+		require.Equal(t, http.StatusOK, withToken(t, SignOutUser, req, laptop.Token, map[string]string{"id": editor.ID}, nil))
+
+		assert.False(t, authorized(editorSession.Token))
+		assert.False(t, authorized(second.Token))
+		assert.Equal(t, http.StatusUnauthorized, refresh(second.RefreshToken).Code)
+		assert.True(t, authorized(laptop.Token))
+
+		req = httptest.NewRequest("GET", "/api/admin/users/"+editor.ID+"/sessions", nil)
+		require.Equal(t, http.StatusOK, withToken(t, GetUserSessions, req, laptop.Token, map[string]string{"id": editor.ID}, &sessions))
+		assert.Empty(t, sessions)
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loadSecuritySettings returns the stored security settings, or the
+// defaults when they were never saved
+func loadSecuritySettings(db database.DatabaseAdapter) (*models.SecuritySettings, error) {
+	settings := &models.SecuritySettings{TwoFactorRoles: []string{}}
+
+	setting, err := db.GetSetting(models.SecuritySettingsKey)
+	if err != nil {
+		return nil, err
+	}
+	if setting == nil {
+		return settings, nil
+	}
+
+	if err := json.Unmarshal([]byte(setting.Value), settings); err != nil {
+		return nil, fmt.Errorf("failed to decode security settings: %w", err)
+	}
+	return settings, nil
+}
+
+// GetSecuritySettings godoc
+//
+//	@Summary		Get security settings
+//	@Description	Get the security policy, such as the roles that must use two-factor authentication (needs settings:read)
+//	@Tags			Settings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	models.SecuritySettings
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/settings/security [get]
+func GetSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, ok := authorize(w, r, permissions.Settings, permissions.Read); !ok {
+		return
+	}
+
+	settings, err := loadSecuritySettings(globalContainer.Database())
+	if err != nil {
+		utils.LogError(err, "Failed to load security settings", logrus.Fields{})
+		http.Error(w, "Failed to load security settings", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSecuritySettings godoc
+//
+//	@Summary		Update security settings
+//	@Description	Update the security policy (needs settings:update). Fields left out keep their value. Users of a role that newly requires two-factor authentication set it up at their next login.
+//	@Tags			Settings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			settings	body		models.SecuritySettings	true	"Security settings"
+//	@Success		200			{object}	models.SecuritySettings
+//	@Failure		400			{object}	models.ErrorResponse
+//	@Failure		401			{object}	models.ErrorResponse
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		500			{object}	models.ErrorResponse
+//	@Router			/admin/settings/security [put]
+func UpdateSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Settings, permissions.Update)
+	if !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	settings, err := loadSecuritySettings(db)
+	if err != nil {
+		utils.LogError(err, "Failed to load security settings", logrus.Fields{})
+		http.Error(w, "Failed to load security settings", http.StatusInternalServerError)
+		return
+	}
+
+	// Decoding reuses the slices of the settings, so the audit log gets a copy
+	before := models.SecuritySettings{
+		TwoFactorRoles: append([]string(nil), settings.TwoFactorRoles...),
+	}
+
+	// Decoding over the current settings keeps the fields left out
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userRoles, err := loadRoles(db)
+	if err != nil {
+		utils.LogError(err, "Failed to load roles", logrus.Fields{})
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+
+	roles := []string{}
+	seen := make(map[string]bool)
+	for _, role := range settings.TwoFactorRoles {
+		if _, ok := userRoles[role]; !ok {
+			http.Error(w, "Invalid role: "+role, http.StatusBadRequest)
+			return
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	settings.TwoFactorRoles = roles
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		http.Error(w, "Failed to encode security settings", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.SaveSetting(&models.Setting{
+		Key:       models.SecuritySettingsKey,
+		Value:     string(value),
+		UpdatedBy: claims.Username,
+	}); err != nil {
+		utils.LogError(err, "Failed to save security settings", logrus.Fields{})
+		http.Error(w, "Failed to save security settings", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("Security settings updated", logrus.Fields{
+		"updated_by":       claims.Username,
+		"two_factor_roles": settings.TwoFactorRoles,
+	})
+	recordAudit(r, "settings.update", "settings", models.SecuritySettingsKey, &before, settings)
+
+	json.NewEncoder(w).Encode(settings)
+}
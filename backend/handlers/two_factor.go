@@ -0,0 +1,744 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"webenable-cms-backend/adapters/auth"
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/totp"
+	"webenable-cms-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// twoFactorIssuer names the CMS in authenticator apps
+	twoFactorIssuer = "WebEnable CMS"
+	// recoveryCodeCount is the number of recovery codes issued at once
+	recoveryCodeCount = 10
+	// twoFactorLockTTL bounds how long a crashed request can hold the
+	// two-factor lock of a user
+	twoFactorLockTTL = 10 * time.Second
+)
+
+var (
+	errTwoFactorBusy     = errors.New("another two-factor operation is in progress")
+	errTwoFactorNotSetUp = errors.New("two-factor authentication is not set up")
+	errTwoFactorEnabled  = errors.New("two-factor authentication is already enabled")
+)
+
+// withTwoFactorLock runs fn while holding the two-factor lock of a user, so
+// concurrent requests can neither replay a code nor overwrite each other's
+// used codes. It fails with errTwoFactorBusy while the lock is taken.
+func withTwoFactorLock(userID string, fn func() error) error {
+	cache := globalContainer.Cache()
+	key := "two_factor_lock:" + userID
+	owner := uuid.New().String()
+
+	acquired, err := cache.AcquireLock(key, owner, twoFactorLockTTL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errTwoFactorBusy
+	}
+	defer cache.ReleaseLock(key, owner)
+
+	return fn()
+}
+
+// verifyTwoFactorCode checks a TOTP code, or with allowRecovery also a
+// recovery code, and records it as used. It must run under the two-factor
+// lock of the user.
+func verifyTwoFactorCode(db database.DatabaseAdapter, twoFactor *models.TwoFactor, code string, allowRecovery bool) (bool, error) {
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		// Each code is accepted once
+		if step <= twoFactor.LastUsedStep {
+			return false, nil
+		}
+		twoFactor.LastUsedStep = step
+		return true, db.SaveTwoFactor(twoFactor)
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+
+	hash := totp.HashRecoveryCode(code)
+	for i, stored := range twoFactor.RecoveryCodes {
+		if stored == hash {
+			twoFactor.RecoveryCodes = append(twoFactor.RecoveryCodes[:i:i], twoFactor.RecoveryCodes[i+1:]...)
+			return true, db.SaveTwoFactor(twoFactor)
+		}
+	}
+	return false, nil
+}
+
+// setNewRecoveryCodes replaces the recovery codes of a configuration and
+// returns the new codes in plain text
+func setNewRecoveryCodes(twoFactor *models.TwoFactor) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor.RecoveryCodes = make([]string, len(codes))
+	for i, code := range codes {
+		twoFactor.RecoveryCodes[i] = totp.HashRecoveryCode(code)
+	}
+	return codes, nil
+}
+
+// startTwoFactorSetup stores a new pending secret for a user. An enabled
+// configuration is never replaced.
+func startTwoFactorSetup(db database.DatabaseAdapter, user *models.User) (*models.TwoFactorSetupResponse, error) {
+	var response *models.TwoFactorSetupResponse
+
+	err := withTwoFactorLock(user.ID, func() error {
+		existing, err := db.GetTwoFactor(user.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Enabled {
+			return errTwoFactorEnabled
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return err
+		}
+		if err := db.SaveTwoFactor(&models.TwoFactor{UserID: user.ID, Secret: secret}); err != nil {
+			return err
+		}
+
+		response = &models.TwoFactorSetupResponse{
+			Secret:          secret,
+			ProvisioningURI: totp.ProvisioningURI(twoFactorIssuer, user.Username, secret),
+		}
+		return nil
+	})
+
+	return response, err
+}
+
+// finishTwoFactorSetup enables the pending configuration of a user when
+// code matches its secret. It returns the new recovery codes, or nil when
+// the code is wrong.
+func finishTwoFactorSetup(db database.DatabaseAdapter, twoFactor *models.TwoFactor, code string) ([]string, error) {
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, nil
+	}
+
+	codes, err := setNewRecoveryCodes(twoFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	twoFactor.Enabled = true
+	twoFactor.EnabledAt = &now
+	twoFactor.LastUsedStep = step
+	if err := db.SaveTwoFactor(twoFactor); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// twoFactorChallenge starts the second step of a login when the user has
+// two-factor authentication enabled or their role requires it. It returns
+// nil when the password is enough, and errLoginLocked when logins with the
+// user are locked.
+func twoFactorChallenge(r *http.Request, user *models.User) (*models.TwoFactorChallenge, error) {
+	db := globalContainer.Database()
+
+	twoFactor, err := db.GetTwoFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := loadSecuritySettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := twoFactor != nil && twoFactor.Enabled
+	if !enabled && !settings.RequiresTwoFactor(user.Role) {
+		return nil, nil
+	}
+
+	if err := recordLoginChallenge(r, user); err != nil {
+		return nil, err
+	}
+	challenge, err := globalContainer.Auth().IssueChallenge(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		SetupRequired:     !enabled,
+		ChallengeToken:    challenge.Token,
+		ExpiresAt:         challenge.ExpiresAt,
+	}, nil
+}
+
+// missingRequiredTwoFactor reports whether the role of a user requires
+// two-factor authentication that the user has not enabled
+func missingRequiredTwoFactor(user *models.User) (bool, error) {
+	db := globalContainer.Database()
+
+	settings, err := loadSecuritySettings(db)
+	if err != nil || !settings.RequiresTwoFactor(user.Role) {
+		return false, err
+	}
+
+	twoFactor, err := db.GetTwoFactor(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor == nil || !twoFactor.Enabled, nil
+}
+
+// checkLoginChallenge resolves the challenge token of a login to its active
+// user, writing the error response when that fails
+func checkLoginChallenge(w http.ResponseWriter, token string) (*models.User, bool) {
+	userID, err := globalContainer.Auth().CheckChallenge(token)
+	if errors.Is(err, auth.ErrUnknownToken) {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		utils.LogError(err, "Failed to check login challenge", logrus.Fields{})
+		http.Error(w, "Failed to check login challenge", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err := globalContainer.Database().GetUser(userID)
+	if err != nil || !user.Active {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// currentUser returns the active user of an authenticated request, writing
+// the error response when there is none. Account security can't be managed
+// with an API key.
+func currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := r.Context().Value("user").(*middleware.Claims)
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if claims.APIKeyID != "" {
+		http.Error(w, "Not available with an API key", http.StatusForbidden)
+		return nil, false
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err := globalContainer.Database().GetUserByUsername(claims.Username)
+	if err != nil || !user.Active {
+		http.Error(w, "User not found or inactive", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writeTwoFactorError writes the response for a failed two-factor
+// operation
+func writeTwoFactorError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, errTwoFactorBusy), errors.Is(err, errTwoFactorEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errTwoFactorNotSetUp):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		utils.LogError(err, message, logrus.Fields{})
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// GetTwoFactorStatus godoc
+//
+//	@Summary		Get two-factor status
+//	@Description	Get whether two-factor authentication is enabled or required for the current user
+//	@Tags			Two-Factor Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	models.TwoFactorStatus
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/2fa [get]
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	twoFactor, err := db.GetTwoFactor(user.ID)
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to load two-factor status")
+		return
+	}
+	settings, err := loadSecuritySettings(db)
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to load two-factor status")
+		return
+	}
+
+	status := models.TwoFactorStatus{Required: settings.RequiresTwoFactor(user.Role)}
+	if twoFactor != nil && twoFactor.Enabled {
+		status.Enabled = true
+		status.EnabledAt = twoFactor.EnabledAt
+		status.RecoveryCodesRemaining = len(twoFactor.RecoveryCodes)
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
+
+// SetupTwoFactor godoc
+//
+//	@Summary		Start two-factor setup
+//	@Description	Generate a new TOTP secret for the current user. It takes effect once confirmed with a code through /auth/2fa/enable.
+//	@Tags			Two-Factor Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	models.TwoFactorSetupResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		409	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/auth/2fa/setup [post]
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := startTwoFactorSetup(globalContainer.Database(), user)
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to set up two-factor authentication")
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// EnableTwoFactor godoc
+//
+//	@Summary		Enable two-factor authentication
+//	@Description	Confirm the pending TOTP secret with a code and enable two-factor authentication. The recovery codes in the response are shown only once.
+//	@Tags			Two-Factor Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		models.TwoFactorCodeRequest	true	"TOTP code"
+//	@Success		200		{object}	models.RecoveryCodesResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/2fa/enable [post]
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	var codes []string
+	err := withTwoFactorLock(user.ID, func() error {
+		twoFactor, err := db.GetTwoFactor(user.ID)
+		if err != nil {
+			return err
+		}
+		if twoFactor == nil {
+			return errTwoFactorNotSetUp
+		}
+		if twoFactor.Enabled {
+			return errTwoFactorEnabled
+		}
+
+		codes, err = finishTwoFactorSetup(db, twoFactor, req.Code)
+		return err
+	})
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to enable two-factor authentication")
+		return
+	}
+	if codes == nil {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	utils.LogInfo("Two-factor authentication enabled", logrus.Fields{
+		"user_id": user.ID,
+	})
+
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+//
+//	@Summary		Disable two-factor authentication
+//	@Description	Disable two-factor authentication for the current user with a TOTP or recovery code. Not allowed when the role of the user requires it.
+//	@Tags			Two-Factor Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		models.TwoFactorCodeRequest	true	"TOTP or recovery code"
+//	@Success		200		{object}	models.SuccessResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/2fa/disable [post]
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	settings, err := loadSecuritySettings(db)
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to disable two-factor authentication")
+		return
+	}
+	if settings.RequiresTwoFactor(user.Role) {
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+
+	verified := false
+	err = withTwoFactorLock(user.ID, func() error {
+		twoFactor, err := db.GetTwoFactor(user.ID)
+		if err != nil {
+			return err
+		}
+		if twoFactor == nil || !twoFactor.Enabled {
+			return errTwoFactorNotSetUp
+		}
+
+		if verified, err = verifyTwoFactorCode(db, twoFactor, req.Code, true); err != nil || !verified {
+			return err
+		}
+		return db.DeleteTwoFactor(user.ID)
+	})
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to disable two-factor authentication")
+		return
+	}
+	if !verified {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	utils.LogInfo("Two-factor authentication disabled", logrus.Fields{
+		"user_id": user.ID,
+	})
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+//
+//	@Summary		Regenerate recovery codes
+//	@Description	Replace the recovery codes of the current user, confirmed with a TOTP code. The new codes are shown only once.
+//	@Tags			Two-Factor Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		models.TwoFactorCodeRequest	true	"TOTP code"
+//	@Success		200		{object}	models.RecoveryCodesResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	db := globalContainer.Database()
+	var codes []string
+	err := withTwoFactorLock(user.ID, func() error {
+		twoFactor, err := db.GetTwoFactor(user.ID)
+		if err != nil {
+			return err
+		}
+		if twoFactor == nil || !twoFactor.Enabled {
+			return errTwoFactorNotSetUp
+		}
+
+		verified, err := verifyTwoFactorCode(db, twoFactor, req.Code, false)
+		if err != nil || !verified {
+			return err
+		}
+
+		if codes, err = setNewRecoveryCodes(twoFactor); err != nil {
+			return err
+		}
+		return db.SaveTwoFactor(twoFactor)
+	})
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to regenerate recovery codes")
+		return
+	}
+	if codes == nil {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// SetupTwoFactorLogin godoc
+//
+//	@Summary		Start two-factor setup during login
+//	@Description	Generate a TOTP secret for a user whose role requires two-factor authentication but who has not set it up. The login completes through /auth/login/2fa with a code for the new secret.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.TwoFactorSetupRequest	true	"Login challenge"
+//	@Success		200		{object}	models.TwoFactorSetupResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/login/2fa/setup [post]
+func SetupTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.TwoFactorSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	user, ok := checkLoginChallenge(w, req.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	response, err := startTwoFactorSetup(globalContainer.Database(), user)
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to set up two-factor authentication")
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// VerifyTwoFactorLogin godoc
+//
+//	@Summary		Complete login with a second factor
+//	@Description	Complete a login with the challenge token from /auth/login and a TOTP or recovery code. A login that set up two-factor authentication returns its recovery codes, shown only once. Wrong codes count as failed logins of the user.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		models.TwoFactorLoginRequest	true	"Login challenge and code"
+//	@Success		200		{object}	models.LoginResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		409		{object}	models.ErrorResponse
+//	@Failure		429		{object}	models.ErrorResponse	"Too many failed logins of this user"
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/auth/login/2fa [post]
+func VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
+		return
+	}
+
+	user, ok := checkLoginChallenge(w, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	// Wrong codes count as failed logins, so the second factor can't be
+	// guessed over many challenges
+	if refuseLockedLogin(w, user.Username) {
+		return
+	}
+
+	db := globalContainer.Database()
+	verified := false
+	var recoveryCodes []string
+	err := withTwoFactorLock(user.ID, func() error {
+		twoFactor, err := db.GetTwoFactor(user.ID)
+		if err != nil {
+			return err
+		}
+		if twoFactor == nil {
+			return errTwoFactorNotSetUp
+		}
+
+		// A pending secret is confirmed by the login that set it up
+		if !twoFactor.Enabled {
+			recoveryCodes, err = finishTwoFactorSetup(db, twoFactor, req.Code)
+			verified = recoveryCodes != nil
+			return err
+		}
+
+		verified, err = verifyTwoFactorCode(db, twoFactor, req.Code, true)
+		return err
+	})
+	if err != nil {
+		writeTwoFactorError(w, err, "Failed to verify two-factor code")
+		return
+	}
+	if !verified {
+		utils.LogWarning("Invalid two-factor code", logrus.Fields{
+			"user_id":     user.ID,
+			"remote_addr": r.RemoteAddr,
+		})
+		recordLoginFailure(r, user.Username, user)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	authAdapter := globalContainer.Auth()
+	if err := authAdapter.EndChallenge(req.ChallengeToken); err != nil {
+		utils.LogError(err, "Failed to end login challenge", logrus.Fields{
+			"user_id": user.ID,
+		})
+	}
+
+	result, err := authAdapter.IssueTokens(auth.AuthClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Email:    user.Email,
+	})
+	if err != nil {
+		utils.LogError(err, "Failed to issue tokens", logrus.Fields{
+			"user_id": user.ID,
+		})
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	clearLoginFailures(user.Username)
+	startSession(r, result, user)
+
+	response := loginResponse(result, user)
+	response.RecoveryCodes = recoveryCodes
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResetUserTwoFactor godoc
+//
+//	@Summary		Reset two-factor authentication of a user
+//	@Description	Remove the two-factor configuration of a user who lost their authenticator and sign them out everywhere (needs users:update). Users whose role requires two-factor authentication set it up again at their next login.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	models.SuccessResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/admin/users/{id}/2fa [delete]
+func ResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Update)
+	if !ok {
+		return
+	}
+
+	db := globalContainer.Database()
+	userID := mux.Vars(r)["id"]
+	if _, err := db.GetUser(userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := db.DeleteTwoFactor(userID); err != nil {
+		utils.LogError(err, "Failed to reset two-factor authentication", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to reset two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := signOutUser(userID); err != nil {
+		utils.LogError(err, "Failed to revoke user tokens", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+
+	utils.LogInfo("Two-factor authentication reset", logrus.Fields{
+		"user_id":  userID,
+		"reset_by": claims.Username,
+	})
+	recordAudit(r, "user.reset_two_factor", "user", userID, nil, nil)
+
+	json.NewEncoder(w).Encode(models.SuccessResponse{Message: "Two-factor authentication reset"})
+}
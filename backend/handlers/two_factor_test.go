@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/totp"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// callJSON serves req with body encoded as JSON and decodes a successful
+// response into out
+func callJSON(t *testing.T, handler http.HandlerFunc, req *http.Request, body, out interface{}) int {
+	t.Helper()
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		req.Body = io.NopCloser(bytes.NewReader(encoded))
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if out != nil && rr.Code < 300 {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), out))
+	}
+	return rr.Code
+}
+
+// codeAt returns the TOTP code of secret offset periods from now
+func codeAt(t *testing.T, secret string, offset int) string {
+	t.Helper()
+	code, err := totp.Code(secret, time.Now().Add(time.Duration(offset)*totp.Period))
+	require.NoError(t, err)
+	return code
+}
+
+// passwordLogin logs in as the seeded admin and returns the status with
+// the challenge, if any
+func passwordLogin(t *testing.T) (int, models.TwoFactorChallenge) {
+	t.Helper()
+
+	var challenge models.TwoFactorChallenge
+	req := httptest.NewRequest("POST", "/api/auth/login", nil)
+	status := callJSON(t, Login, req, models.LoginRequest{Username: "admin", Password: "/juk+vfdbNk6TICg"}, &challenge)
+	return status, challenge
+}
+
+// enableTwoFactor sets up two-factor authentication for the seeded admin
+// and returns the secret and recovery codes
+func enableTwoFactor(t *testing.T) (string, []string) {
+	t.Helper()
+
+	var setup models.TwoFactorSetupResponse
+	req := asUser(httptest.NewRequest("POST", "/api/auth/2fa/setup", nil), "admin", "admin")
+	require.Equal(t, http.StatusOK, callJSON(t, SetupTwoFactor, req, nil, &setup))
+	require.NotEmpty(t, setup.Secret)
+	assert.Contains(t, setup.ProvisioningURI, "otpauth://totp/")
+
+	var codes models.RecoveryCodesResponse
+	req = asUser(httptest.NewRequest("POST", "/api/auth/2fa/enable", nil), "admin", "admin")
+	require.Equal(t, http.StatusOK, callJSON(t, EnableTwoFactor, req, models.TwoFactorCodeRequest{Code: codeAt(t, setup.Secret, 0)}, &codes))
+	require.Len(t, codes.RecoveryCodes, recoveryCodeCount)
+
+	return setup.Secret, codes.RecoveryCodes
+}
+
+func setSecuritySettings(t *testing.T, settings models.SecuritySettings) int {
+	t.Helper()
+	req := asUser(httptest.NewRequest("PUT", "/api/admin/settings/security", nil), "admin", "admin")
+	return callJSON(t, UpdateSecuritySettings, req, settings, nil)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	setupTestContainer(t)
+	secret, recoveryCodes := enableTwoFactor(t)
+
+	var status models.TwoFactorStatus
+	req := asUser(httptest.NewRequest("GET", "/api/auth/2fa", nil), "admin", "admin")
+	require.Equal(t, http.StatusOK, callJSON(t, GetTwoFactorStatus, req, nil, &status))
+	assert.True(t, status.Enabled)
+	assert.False(t, status.Required)
+	assert.Equal(t, recoveryCodeCount, status.RecoveryCodesRemaining)
+
+	verify := func(challenge, code string) (int, models.LoginResponse) {
+		var response models.LoginResponse
+		req := httptest.NewRequest("POST", "/api/auth/login/2fa", nil)
+		status := callJSON(t, VerifyTwoFactorLogin, req, models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: code}, &response)
+		return status, response
+	}
+
+	t.Run("Password alone is not enough", func(t *testing.T) {
+		code, challenge := passwordLogin(t)
+		require.Equal(t, http.StatusAccepted, code)
+		assert.True(t, challenge.TwoFactorRequired)
+		assert.False(t, challenge.SetupRequired)
+		assert.NotEmpty(t, challenge.ChallengeToken)
+	})
+
+	t.Run("TOTP code completes the login once", func(t *testing.T) {
+		_, challenge := passwordLogin(t)
+		// The code of the current period was used to enable two-factor
+		code, _ := verify(challenge.ChallengeToken, codeAt(t, secret, 0))
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, response := verify(challenge.ChallengeToken, codeAt(t, secret, 1))
+		require.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.Empty(t, response.RecoveryCodes)
+		assert.True(t, authorized(response.Token))
+
+		// The challenge ends with the login
+		code, _ = verify(challenge.ChallengeToken, codeAt(t, secret, 1))
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Recovery codes work once", func(t *testing.T) {
+		_, challenge := passwordLogin(t)
+		code, _ := verify(challenge.ChallengeToken, recoveryCodes[0])
+		require.Equal(t, http.StatusOK, code)
+
+		_, challenge = passwordLogin(t)
+		code, _ = verify(challenge.ChallengeToken, recoveryCodes[0])
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Challenges allow few attempts", func(t *testing.T) {
+		// Wrong codes delay logins; skip the delays
+		waitOut := func() { require.NoError(t, globalContainer.Cache().Delete(loginLockKey("admin"))) }
+
+		_, challenge := passwordLogin(t)
+		for i := 0; i < 5; i++ {
+			waitOut()
+			code, _ := verify(challenge.ChallengeToken, "000000")
+			require.Equal(t, http.StatusUnauthorized, code)
+		}
+		waitOut()
+		code, _ := verify(challenge.ChallengeToken, recoveryCodes[1])
+		assert.Equal(t, http.StatusUnauthorized, code)
+		clearLoginFailures("admin")
+	})
+
+	t.Run("Disabling needs a code", func(t *testing.T) {
+		req := asUser(httptest.NewRequest("POST", "/api/auth/2fa/disable", nil), "admin", "admin")
+		assert.Equal(t, http.StatusBadRequest, callJSON(t, DisableTwoFactor, req, models.TwoFactorCodeRequest{Code: "123456"}, nil))
+
+		req = asUser(httptest.NewRequest("POST", "/api/auth/2fa/disable", nil), "admin", "admin")
+		assert.Equal(t, http.StatusOK, callJSON(t, DisableTwoFactor, req, models.TwoFactorCodeRequest{Code: recoveryCodes[2]}, nil))
+
+		code, _ := passwordLogin(t)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestRequiredTwoFactor(t *testing.T) {
+	setupTestContainer(t)
+	session := login(t)
+
+	require.Equal(t, http.StatusOK, setSecuritySettings(t, models.SecuritySettings{TwoFactorRoles: []string{"admin", "admin"}}))
+
+	var settings models.SecuritySettings
+	req := asUser(httptest.NewRequest("GET", "/api/admin/settings/security", nil), "admin", "admin")
+	require.Equal(t, http.StatusOK, callJSON(t, GetSecuritySettings, req, nil, &settings))
+	assert.Equal(t, []string{"admin"}, settings.TwoFactorRoles)
+
+	// Existing sessions end at their next refresh
+	assert.Equal(t, http.StatusUnauthorized, refresh(session.RefreshToken).Code)
+
+	code, challenge := passwordLogin(t)
+	require.Equal(t, http.StatusAccepted, code)
+	assert.True(t, challenge.SetupRequired)
+
+	var setup models.TwoFactorSetupResponse
+	req = httptest.NewRequest("POST", "/api/auth/login/2fa/setup", nil)
+	require.Equal(t, http.StatusOK, callJSON(t, SetupTwoFactorLogin, req, models.TwoFactorSetupRequest{ChallengeToken: challenge.ChallengeToken}, &setup))
+
+	var response models.LoginResponse
+	req = httptest.NewRequest("POST", "/api/auth/login/2fa", nil)
+	require.Equal(t, http.StatusOK, callJSON(t, VerifyTwoFactorLogin, req, models.TwoFactorLoginRequest{
+		ChallengeToken: challenge.ChallengeToken,
+		Code:           codeAt(t, setup.Secret, 0),
+	}, &response))
+	assert.NotEmpty(t, response.Token)
+	assert.Len(t, response.RecoveryCodes, recoveryCodeCount)
+
+	// Required two-factor authentication can't be turned off
+	req = asUser(httptest.NewRequest("POST", "/api/auth/2fa/disable", nil), "admin", "admin")
+	assert.Equal(t, http.StatusForbidden, callJSON(t, DisableTwoFactor, req, models.TwoFactorCodeRequest{Code: response.RecoveryCodes[0]}, nil))
+}
+
+func TestResetUserTwoFactor(t *testing.T) {
+	db := setupTestContainer(t)
+	enableTwoFactor(t)
+	_, challenge := passwordLogin(t)
+	require.NotEmpty(t, challenge.ChallengeToken)
+
+	editor := &models.User{Username: "editor", Email: "editor@example.com", Role: "editor", Active: true}
+	require.NoError(t, db.CreateUser(editor))
+	admin, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+
+	reset := func(id, role string) int {
+		req := asUser(httptest.NewRequest("DELETE", "/api/admin/users/"+id+"/2fa", nil), "editor", role)
+		return callJSON(t, ResetUserTwoFactor, mux.SetURLVars(req, map[string]string{"id": id}), nil, nil)
+	}
+
+	assert.Equal(t, http.StatusForbidden, reset(admin.ID, "editor"))
+	assert.Equal(t, http.StatusNotFound, reset("missing", "admin"))
+	require.Equal(t, http.StatusOK, reset(admin.ID, "admin"))
+
+	twoFactor, err := db.GetTwoFactor(admin.ID)
+	require.NoError(t, err)
+	assert.Nil(t, twoFactor)
+}
+
+func TestUpdateSecuritySettingsValidation(t *testing.T) {
+	setupTestContainer(t)
+
+	assert.Equal(t, http.StatusBadRequest, setSecuritySettings(t, models.SecuritySettings{TwoFactorRoles: []string{"root"}}))
+
+	req := asUser(httptest.NewRequest("PUT", "/api/admin/settings/security", nil), "editor", "editor")
+	assert.Equal(t, http.StatusForbidden, callJSON(t, UpdateSecuritySettings, req, models.SecuritySettings{}, nil))
+}
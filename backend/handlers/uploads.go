@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"webenable-cms-backend/adapters/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// inlineContentTypes are the uploaded content types browsers may display.
+// Everything else is served as a download.
+var inlineContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"audio/mpeg":      true,
+	"audio/wav":       true,
+}
+
+// ServeUpload godoc
+//
+//	@Summary		Download an uploaded file
+//	@Description	Serve a file from local storage with Range and conditional request support. Files outside the public prefixes (STORAGE_PUBLIC_PREFIXES, default media/) need a signed URL.
+//	@Tags			Media
+//	@Produce		octet-stream
+//	@Param			path		path	string	true	"File path"
+//	@Param			expires		query	int		false	"Expiry of a signed URL as a Unix time"
+//	@Param			signature	query	string	false	"Signature of a signed URL"
+//	@Success		200			{file}	binary
+//	@Success		206			{file}	binary
+//	@Success		304
+//	@Failure		403			{object}	models.ErrorResponse
+//	@Failure		404			{object}	models.ErrorResponse
+//	@Router			/uploads/{path} [get]
+func ServeUpload(w http.ResponseWriter, r *http.Request) {
+	if globalContainer == nil {
+		http.Error(w, "Storage not available", http.StatusInternalServerError)
+		return
+	}
+
+	// Only local files are served here, other storage serves its own
+	local, ok := storage.LocalFiles(globalContainer.Storage())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	filePath := mux.Vars(r)["path"]
+	query := r.URL.Query()
+
+	if query.Has("signature") {
+		err := local.VerifySignedURL(filePath, query)
+		if errors.Is(err, storage.ErrExpiredSignature) {
+			http.Error(w, "Link expired", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid link", http.StatusForbidden)
+			return
+		}
+	} else if !local.IsPublic(filePath) {
+		http.Error(w, "Signed URL required", http.StatusForbidden)
+		return
+	}
+
+	file, err := local.Download(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if closer, ok := file.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, ok := file.Content.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	metadata, err := local.GetMetadata(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", file.ContentType)
+	header.Set("ETag", fmt.Sprintf(`"%x-%x"`, metadata.Size, metadata.ModifiedAt.UnixNano()))
+	// Uploaded HTML or SVG must never run in the site's origin
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !inlineContentTypes[strings.Split(file.ContentType, ";")[0]] {
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(file.Path)))
+	}
+	if query.Has("signature") {
+		header.Set("Cache-Control", "private, no-cache")
+	} else {
+		header.Set("Cache-Control", "public, max-age=86400")
+	}
+
+	http.ServeContent(w, r, path.Base(file.Path), metadata.ModifiedAt, content)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters/storage"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeUpload(t *testing.T) {
+	setupTestContainer(t)
+	store := globalContainer.Storage()
+
+	// Write the files in place, store would keep them under their hash
+	local, ok := storage.LocalFiles(store)
+	require.True(t, ok)
+	for path, content := range map[string]string{
+		"media/2024/05/notes.txt":  "public notes",
+		"attachments/contact.html": "<script>alert(1)</script>",
+	} {
+		_, err := local.Upload(storage.StorageFile{Path: path, Content: strings.NewReader(content)})
+		require.NoError(t, err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/uploads/{path:.+}", ServeUpload)
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	signed, err := store.GetSignedURL("attachments/contact.html", time.Hour)
+	require.NoError(t, err)
+	signedURL, err := url.Parse(signed)
+	require.NoError(t, err)
+	signedTarget := signedURL.RequestURI()
+
+	t.Run("Public file", func(t *testing.T) {
+		w := get("/uploads/media/2024/05/notes.txt", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "public notes", w.Body.String())
+		assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Cache-Control"), "public")
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+		assert.Equal(t, http.StatusNotModified, get("/uploads/media/2024/05/notes.txt", http.Header{"If-None-Match": {etag}}).Code)
+	})
+
+	t.Run("Range request", func(t *testing.T) {
+		w := get("/uploads/media/2024/05/notes.txt", http.Header{"Range": {"bytes=7-"}})
+		require.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "notes", w.Body.String())
+		assert.Equal(t, "bytes 7-11/12", w.Header().Get("Content-Range"))
+	})
+
+	t.Run("Signed private file", func(t *testing.T) {
+		w := get(signedTarget, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "<script>alert(1)</script>", w.Body.String())
+		assert.Equal(t, "text/html", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+		assert.Contains(t, w.Header().Get("Content-Security-Policy"), "sandbox")
+		assert.Contains(t, w.Header().Get("Cache-Control"), "private")
+	})
+
+	tests := []struct {
+		name     string
+		target   string
+		expected int
+	}{
+		{"Private file without signature", "/uploads/attachments/contact.html", http.StatusForbidden},
+		{"Tampered signature", strings.Replace(signedTarget, "signature=", "signature=x", 1), http.StatusForbidden},
+		{"Extended expiry", strings.Replace(signedTarget, "expires=", "expires=9", 1), http.StatusForbidden},
+		{"Signature for another file", strings.Replace(signedTarget, "contact.html", "other.html", 1), http.StatusForbidden},
+		{"Missing public file", "/uploads/media/missing.txt", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, get(tt.target, nil).Code)
+		})
+	}
+
+	t.Run("Traversal out of a public prefix", func(t *testing.T) {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/uploads/attachments/contact.html", nil),
+			map[string]string{"path": "media/../attachments/contact.html"})
+		w := httptest.NewRecorder()
+		ServeUpload(w, r)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -2,86 +2,89 @@ package handlers
 
 import (
 	"encoding/json"
-	"math"
 	"net/http"
 	"time"
 
-	"webenable-cms-backend/database"
-	"webenable-cms-backend/middleware"
 	"webenable-cms-backend/models"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/utils"
 
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 // GetUsers godoc
 //
 //	@Summary		Get all users
-//	@Description	Get all users with pagination (admin only)
+//	@Description	Get users with optional filters, sorting and page or cursor pagination (needs users:read)
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
 //	@Security		BearerAuth
-//	@Param			page	query		int	false	"Page number (default: 1)"
-//	@Param			limit	query		int	false	"Items per page (default: 10, max: 100)"
-//	@Success		200		{object}	models.PaginatedUsersResponse
-//	@Failure		401		{object}	models.ErrorResponse
-//	@Failure		403		{object}	models.ErrorResponse
-//	@Failure		500		{object}	models.ErrorResponse
+//	@Param			role			query		string	false	"Filter by role"
+//	@Param			active			query		bool	false	"Filter by active flag"
+//	@Param			created_after	query		string	false	"Only users created at or after this RFC 3339 time"
+//	@Param			created_before	query		string	false	"Only users created at or before this RFC 3339 time"
+//	@Param			sort			query		string	false	"Sort field (created_at, username), prefix with - for descending (default: created_at)"
+//	@Param			cursor			query		string	false	"Cursor from meta.next_cursor of the previous page"
+//	@Param			page			query		int		false	"Page number (default: 1)"
+//	@Param			limit			query		int		false	"Items per page (default: 10, max: 100)"
+//	@Success		200				{object}	models.PaginatedUsersResponse
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		500				{object}	models.ErrorResponse
 //	@Router			/users [get]
 //
-// GetUsers returns all users with pagination (admin only)
+// GetUsers returns all users with pagination
 func GetUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	// Only admin can access user management
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	db := globalContainer.Database()
+
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
 		return
 	}
 
-	// Get pagination parameters
-	page, limit := getPaginationParams(r)
+	list := getListRequest(r, "created_at")
+	query := models.UserQuery{
+		Role:        r.URL.Query().Get("role"),
+		ListOptions: list.options,
+	}
 
-	users, err := database.GetAllUsers()
-	if err != nil {
-		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+	var err error
+	if query.Active, err = getBoolParam(r, "active"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Created, err = getTimeRange(r, "created"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Calculate pagination
-	total := len(users)
-	totalPages := int(math.Ceil(float64(total) / float64(limit)))
-	offset := (page - 1) * limit
-
-	// Get the slice for current page
-	var paginatedUsers []models.User
-	if offset < total {
-		end := offset + limit
-		if end > total {
-			end = total
-		}
-		paginatedUsers = users[offset:end]
+	users, err := db.ListUsers(query)
+	if isListQueryError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
 	}
 
-	// Create pagination metadata
-	meta := models.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      total,
-		TotalPages: totalPages,
-		HasNext:    page < totalPages,
-		HasPrev:    page > 1,
+	meta, err := list.meta(users.NextCursor, func() (int, error) { return db.CountUsers(query) })
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
 	}
 
 	response := models.PaginatedUsersResponse{
-		Data: paginatedUsers,
+		Data: users.Users,
 		Meta: meta,
 	}
 
@@ -91,7 +94,7 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 // GetUser godoc
 //
 //	@Summary		Get user by ID
-//	@Description	Get a single user by ID (admin only)
+//	@Description	Get a single user by ID (needs users:read)
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -104,27 +107,25 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500	{object}	models.ErrorResponse
 //	@Router			/users/{id} [get]
 //
-// GetUser returns a single user by ID (admin only)
+// GetUser returns a single user by ID
 func GetUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	// Only admin can access user management
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	db := globalContainer.Database()
+
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
 		return
 	}
 
 	vars := mux.Vars(r)
 	userID := vars["id"]
 
-	user, err := database.GetUserByID(userID)
+	user, err := db.GetUser(userID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -140,7 +141,7 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 // CreateUser godoc
 //
 //	@Summary		Create new user
-//	@Description	Create a new user (admin only)
+//	@Description	Create a new user (needs users:create; only admins create admins). A verification link is emailed to the address of the user. The password must meet the password policy.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -154,20 +155,19 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/users [post]
 //
-// CreateUser creates a new user (admin only)
+// CreateUser creates a new user
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	// Only admin can create users
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	db := globalContainer.Database()
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Create)
+	if !ok {
 		return
 	}
 
@@ -191,20 +191,31 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate role
-	if req.Role != "admin" && req.Role != "editor" && req.Role != "author" {
+	valid, err := validRole(db, req.Role)
+	if err != nil {
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
 		http.Error(w, "Invalid role", http.StatusBadRequest)
 		return
 	}
 
+	// Only admins make admins
+	if req.Role == permissions.AdminRole && claims.Role != permissions.AdminRole {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
 	// Check if username already exists
-	existingUser, err := database.GetUserByUsername(req.Username)
+	existingUser, err := db.GetUserByUsername(req.Username)
 	if err == nil && existingUser != nil {
 		http.Error(w, "Username already exists", http.StatusConflict)
 		return
 	}
 
 	// Check if email already exists
-	existingUser, err = database.GetUserByEmail(req.Email)
+	existingUser, err = db.GetUserByEmail(req.Email)
 	if err == nil && existingUser != nil {
 		http.Error(w, "Email already exists", http.StatusConflict)
 		return
@@ -219,17 +230,28 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set password
+	if !checkNewPassword(w, user, req.Password) {
+		return
+	}
 	if err := user.SetPassword(req.Password); err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
 	// Save user
-	if err := database.CreateUser(user); err != nil {
+	if err := db.CreateUser(user); err != nil {
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
+	if err := sendEmailVerification(user); err != nil {
+		utils.LogError(err, "Failed to send email verification", logrus.Fields{
+			"user_id": user.ID,
+		})
+	}
+
+	recordAudit(r, "user.create", "user", user.ID, nil, user)
+
 	// Don't return password hash and revision in API response
 	user.PasswordHash = ""
 	user.Rev = ""
@@ -241,7 +263,7 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 // UpdateUser godoc
 //
 //	@Summary		Update user
-//	@Description	Update an existing user (admin only)
+//	@Description	Update an existing user (needs users:update; only admins change admins or make them). A changed email address is unverified until confirmed through the emailed link. A new password must meet the password policy and not be a recent one.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -256,20 +278,19 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500		{object}	models.ErrorResponse
 //	@Router			/users/{id} [put]
 //
-// UpdateUser updates an existing user (admin only)
+// UpdateUser updates an existing user
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	// Only admin can update users
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	db := globalContainer.Database()
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Update)
+	if !ok {
 		return
 	}
 
@@ -290,21 +311,35 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user exists
-	existingUser, err := database.GetUserByID(userID)
+	existingUser, err := db.GetUser(userID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	// Validate role if provided
-	if req.Role != "" && req.Role != "admin" && req.Role != "editor" && req.Role != "author" {
-		http.Error(w, "Invalid role", http.StatusBadRequest)
+	if req.Role != "" {
+		valid, err := validRole(db, req.Role)
+		if err != nil {
+			http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Only admins make admins or change them
+	if (req.Role == permissions.AdminRole || existingUser.Role == permissions.AdminRole) &&
+		claims.Role != permissions.AdminRole {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
 		return
 	}
 
 	// Check if username already exists (if changing)
 	if req.Username != "" && req.Username != existingUser.Username {
-		existing, err := database.GetUserByUsername(req.Username)
+		existing, err := db.GetUserByUsername(req.Username)
 		if err == nil && existing != nil {
 			http.Error(w, "Username already exists", http.StatusConflict)
 			return
@@ -313,7 +348,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Check if email already exists (if changing)
 	if req.Email != "" && req.Email != existingUser.Email {
-		existing, err := database.GetUserByEmail(req.Email)
+		existing, err := db.GetUserByEmail(req.Email)
 		if err == nil && existing != nil {
 			http.Error(w, "Email already exists", http.StatusConflict)
 			return
@@ -335,27 +370,67 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Hash password if provided
 	if req.Password != "" {
+		if !checkNewPassword(w, existingUser, req.Password) {
+			return
+		}
 		if err := updates.SetPassword(req.Password); err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
 	}
 
+	// Tokens carry the username and role, so changing them, the password or
+	// deactivating the user ends every session of the user
+	if (req.Username != "" && req.Username != existingUser.Username) ||
+		(req.Role != "" && req.Role != existingUser.Role) ||
+		req.Password != "" || (existingUser.Active && !updates.Active) {
+		if err := signOutUser(userID); err != nil {
+			utils.LogError(err, "Failed to revoke user tokens", logrus.Fields{
+				"user_id": userID,
+			})
+			http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The hashes go into the audit diff, which records only that the
+	// password changed
+	passwordHash := updates.PasswordHash
+	if passwordHash == "" {
+		passwordHash = existingUser.PasswordHash
+	}
+
 	// Update user
-	updatedUser, err := database.UpdateUser(userID, updates)
-	if err != nil {
+	if err := db.UpdateUser(userID, updates); err != nil {
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(updatedUser)
+	if req.Password != "" {
+		rememberPassword(userID, existingUser.PasswordHash)
+	}
+
+	after := *updates
+	after.PasswordHash = passwordHash
+	recordAudit(r, "user.update", "user", userID, existingUser, &after)
+
+	// A new email address has to be verified again
+	if req.Email != "" && req.Email != existingUser.Email {
+		if err := sendEmailVerification(updates); err != nil {
+			utils.LogError(err, "Failed to send email verification", logrus.Fields{
+				"user_id": userID,
+			})
+		}
+	}
+
+	json.NewEncoder(w).Encode(updates)
 }
 
-// DeleteUser deletes a user (admin only)
+// DeleteUser deletes a user
 // DeleteUser godoc
 //
 //	@Summary		Delete user
-//	@Description	Delete a user (admin only)
+//	@Description	Delete a user (needs users:delete)
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -370,16 +445,15 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if globalContainer == nil {
+		http.Error(w, "Database not available", http.StatusInternalServerError)
 		return
 	}
 
-	// Only admin can delete users
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+	db := globalContainer.Database()
+
+	claims, ok := authorize(w, r, permissions.Users, permissions.Delete)
+	if !ok {
 		return
 	}
 
@@ -387,25 +461,35 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	userID := vars["id"]
 
 	// Prevent admin from deleting themselves
-	currentUser, err := database.GetUserByUsername(claims.Username)
+	currentUser, err := db.GetUserByUsername(claims.Username)
 	if err == nil && currentUser != nil && currentUser.ID == userID {
 		http.Error(w, "Cannot delete your own account", http.StatusBadRequest)
 		return
 	}
 
 	// Check if user exists
-	_, err = database.GetUserByID(userID)
+	user, err := db.GetUser(userID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
+	if err := signOutUser(userID); err != nil {
+		utils.LogError(err, "Failed to revoke user tokens", logrus.Fields{
+			"user_id": userID,
+		})
+		http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+
 	// Delete user
-	if err := database.DeleteUser(userID); err != nil {
+	if err := db.DeleteUser(userID); err != nil {
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
 		return
 	}
 
+	recordAudit(r, "user.delete", "user", userID, user, nil)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
 }
@@ -413,7 +497,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 // GetUserStats godoc
 //
 //	@Summary		Get user statistics
-//	@Description	Get user statistics (admin only)
+//	@Description	Get user statistics (needs users:read)
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -424,24 +508,17 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 //	@Failure		500	{object}	models.ErrorResponse
 //	@Router			/users/stats [get]
 //
-// GetUserStats returns user statistics (admin only)
+// GetUserStats returns user statistics
 func GetUserStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get user claims from JWT middleware
-	claims, ok := r.Context().Value("user").(*middleware.Claims)
-	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+	if _, ok := authorize(w, r, permissions.Users, permissions.Read); !ok {
 		return
 	}
 
-	// Only admin can access stats
-	if claims.Role != "admin" {
-		http.Error(w, "Insufficient permissions", http.StatusForbidden)
-		return
-	}
+	db := globalContainer.Database()
 
-	users, err := database.GetAllUsers()
+	users, err := loadAll(db.GetUsers)
 	if err != nil {
 		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
 		return
@@ -455,11 +532,14 @@ func GetUserStats(w http.ResponseWriter, r *http.Request) {
 		"author_users": 0,
 		"last_updated": time.Now(),
 	}
+	usersByRole := make(map[string]int)
+	stats["users_by_role"] = usersByRole
 
 	for _, user := range users {
 		if user.Active {
 			stats["active_users"] = stats["active_users"].(int) + 1
 		}
+		usersByRole[user.Role]++
 
 		switch user.Role {
 		case "admin":
@@ -0,0 +1,229 @@
+// Package imaging decodes, resizes and re-encodes uploaded images. It is
+// pure Go so image processing works on every platform the backend builds for.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// JPEGQuality is the quality resized JPEGs are encoded with
+const JPEGQuality = 85
+
+// MaxPixels is the largest number of pixels an image may have to be
+// decoded. Decoding allocates every pixel up front, so a small file
+// declaring huge dimensions could otherwise exhaust memory.
+const MaxPixels = 50_000_000
+
+// ErrTooManyPixels is returned for images larger than MaxPixels
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// CheckSize returns ErrTooManyPixels when an image of width x height pixels
+// is too large to decode
+func CheckSize(width, height int) error {
+	if int64(width)*int64(height) > MaxPixels {
+		return fmt.Errorf("%w: %dx%d is over %d megapixels", ErrTooManyPixels, width, height, MaxPixels/1_000_000)
+	}
+	return nil
+}
+
+// Fit controls how an image is fitted into a target width and height
+type Fit string
+
+const (
+	// FitContain scales the image to fit inside the box, keeping its aspect ratio
+	FitContain Fit = "contain"
+	// FitCover scales the image to fill the box and crops the overflow around the center
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the exact box size
+	FitFill Fit = "fill"
+)
+
+// ParseFit parses a fit mode, defaulting to FitContain
+func ParseFit(value string) (Fit, error) {
+	switch Fit(value) {
+	case "":
+		return FitContain, nil
+	case FitContain, FitCover, FitFill:
+		return Fit(value), nil
+	default:
+		return "", fmt.Errorf("unsupported fit %q, use contain, cover or fill", value)
+	}
+}
+
+// Decode decodes a JPEG, PNG, GIF or WebP image and returns it upright,
+// applying the EXIF orientation of JPEGs. Animated GIFs decode to their
+// first frame. Images over MaxPixels are refused before decoding.
+func Decode(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if err := CheckSize(config.Width, config.Height); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	if format == "jpeg" {
+		img = Orient(img, Orientation(data))
+	}
+
+	return img, format, nil
+}
+
+// OutputFormat returns the format resized copies of a source format are
+// encoded in. GIFs become PNGs since only the first frame survives decoding.
+func OutputFormat(format string) string {
+	switch format {
+	case "jpeg", "png", "webp":
+		return format
+	default:
+		return "png"
+	}
+}
+
+// ContentType returns the MIME type of an output format
+func ContentType(format string) string {
+	return "image/" + OutputFormat(format)
+}
+
+// Extension returns the file extension of an output format
+func Extension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + OutputFormat(format)
+}
+
+// Encode writes img in the given output format. Nothing from the source
+// file other than pixels is written, so encoding strips all metadata. WebP
+// is encoded losslessly.
+func Encode(w io.Writer, img image.Image, format string) error {
+	var err error
+	switch OutputFormat(format) {
+	case "jpeg":
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+	case "webp":
+		err = nativewebp.Encode(w, img, nil)
+	default:
+		err = png.Encode(w, img)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return nil
+}
+
+// Resize scales img into a width by height box. A zero width or height
+// leaves that side unconstrained, in which case cover and fill behave like
+// contain. Images are never enlarged; when nothing needs to change img is
+// returned as is.
+func Resize(img image.Image, width, height int, fit Fit) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	if width < 0 || height < 0 || (width == 0 && height == 0) || srcWidth == 0 || srcHeight == 0 {
+		return img
+	}
+	if width == 0 || height == 0 {
+		fit = FitContain
+	}
+
+	src := bounds
+	var dstWidth, dstHeight int
+
+	switch fit {
+	case FitCover:
+		// Crop the largest centered region with the aspect ratio of the box
+		cropWidth, cropHeight := srcWidth, scaleSide(srcWidth, height, width)
+		if cropHeight > srcHeight {
+			cropWidth, cropHeight = scaleSide(srcHeight, width, height), srcHeight
+		}
+		x := bounds.Min.X + (srcWidth-cropWidth)/2
+		y := bounds.Min.Y + (srcHeight-cropHeight)/2
+		src = image.Rect(x, y, x+cropWidth, y+cropHeight)
+
+		dstWidth, dstHeight = width, height
+		if cropWidth < width {
+			dstWidth, dstHeight = cropWidth, cropHeight
+		}
+	case FitFill:
+		dstWidth, dstHeight = min(width, srcWidth), min(height, srcHeight)
+	default:
+		scale := 1.0
+		if width > 0 {
+			scale = math.Min(scale, float64(width)/float64(srcWidth))
+		}
+		if height > 0 {
+			scale = math.Min(scale, float64(height)/float64(srcHeight))
+		}
+		dstWidth = max(1, int(math.Round(float64(srcWidth)*scale)))
+		dstHeight = max(1, int(math.Round(float64(srcHeight)*scale)))
+	}
+
+	if src == bounds && dstWidth == srcWidth && dstHeight == srcHeight {
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// scaleSide returns side * numerator / denominator rounded, at least 1
+func scaleSide(side, numerator, denominator int) int {
+	return max(1, int(math.Round(float64(side)*float64(numerator)/float64(denominator))))
+}
+
+// Orient returns img transformed according to an EXIF orientation value
+// (1-8) so that it displays upright without the orientation tag
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := srcWidth, srcHeight
+	if orientation >= 5 {
+		dstWidth, dstHeight = srcHeight, srcWidth
+	}
+
+	// source maps a destination pixel to the source pixel it shows
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return srcWidth - 1 - x, y },
+		3: func(x, y int) (int, int) { return srcWidth - 1 - x, srcHeight - 1 - y },
+		4: func(x, y int) (int, int) { return x, srcHeight - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, srcHeight - 1 - x },
+		7: func(x, y int) (int, int) { return srcWidth - 1 - y, srcHeight - 1 - x },
+		8: func(x, y int) (int, int) { return srcWidth - 1 - y, x },
+	}[orientation]
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			sx, sy := source(x, y)
+			dst.Set(x, y, color.NRGBAModel.Convert(img.At(bounds.Min.X+sx, bounds.Min.Y+sy)))
+		}
+	}
+
+	return dst
+}
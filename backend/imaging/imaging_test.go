@@ -0,0 +1,228 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// halves returns a width x height image, red on the left and blue on the right
+func halves(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+// jpegWithEXIF encodes img as a JPEG carrying an EXIF orientation and a comment
+func jpegWithEXIF(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 95}))
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	data := []byte{0xFF, markerSOI, 0xFF, markerAPP1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+	data = append(data, payload...)
+	data = append(data, 0xFF, markerCOM, 0x00, 0x07)
+	data = append(data, "Nikon"...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+func TestResize(t *testing.T) {
+	src := halves(400, 200)
+
+	tests := []struct {
+		name           string
+		width, height  int
+		fit            Fit
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"Contain in a square", 100, 100, FitContain, 100, 50},
+		{"Contain by height only", 0, 100, FitContain, 200, 100},
+		{"Cover crops to the box", 100, 100, FitCover, 100, 100},
+		{"Cover without a height contains", 100, 0, FitCover, 100, 50},
+		{"Cover never enlarges", 800, 100, FitCover, 400, 50},
+		{"Fill stretches", 100, 30, FitFill, 100, 30},
+		{"Contain never enlarges", 800, 800, FitContain, 400, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resized := Resize(src, tt.width, tt.height, tt.fit)
+			assert.Equal(t, tt.expectedWidth, resized.Bounds().Dx())
+			assert.Equal(t, tt.expectedHeight, resized.Bounds().Dy())
+		})
+	}
+
+	assert.Same(t, src, Resize(src, 800, 800, FitContain))
+
+	// Covering a square keeps the center, half red and half blue
+	cover := Resize(src, 100, 100, FitCover)
+	r, _, b, _ := cover.At(10, 50).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = cover.At(90, 50).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestOrientation(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation uint16
+		width       int
+		height      int
+		// redAt is a pixel expected to show the red half
+		redAt image.Point
+	}{
+		{"Upright", 1, 32, 16, image.Pt(4, 8)},
+		{"Mirrored", 2, 32, 16, image.Pt(28, 8)},
+		{"Upside down", 3, 32, 16, image.Pt(28, 8)},
+		{"Rotated clockwise", 6, 16, 32, image.Pt(8, 4)},
+		{"Rotated counter-clockwise", 8, 16, 32, image.Pt(8, 28)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := jpegWithEXIF(t, halves(32, 16), tt.orientation)
+			assert.Equal(t, int(tt.orientation), Orientation(data))
+
+			img, format, err := Decode(data)
+			require.NoError(t, err)
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, tt.width, img.Bounds().Dx())
+			assert.Equal(t, tt.height, img.Bounds().Dy())
+
+			r, _, b, _ := img.At(tt.redAt.X, tt.redAt.Y).RGBA()
+			assert.Greater(t, r, b)
+		})
+	}
+
+	assert.Equal(t, 1, Orientation([]byte("not a jpeg")))
+}
+
+func TestStripMetadata(t *testing.T) {
+	t.Run("JPEG keeps image data", func(t *testing.T) {
+		data := jpegWithEXIF(t, halves(32, 16), 1)
+
+		stripped, err := StripMetadata(data, "jpeg")
+		require.NoError(t, err)
+		assert.NotContains(t, string(stripped), "Exif")
+		assert.NotContains(t, string(stripped), "Nikon")
+		assert.Equal(t, data[len(data)-100:], stripped[len(stripped)-100:])
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+		require.NoError(t, err)
+		assert.Equal(t, 32, config.Width)
+	})
+
+	t.Run("Rotated JPEG is re-encoded upright", func(t *testing.T) {
+		stripped, err := StripMetadata(jpegWithEXIF(t, halves(32, 16), 6), "jpeg")
+		require.NoError(t, err)
+		assert.NotContains(t, string(stripped), "Exif")
+		assert.Equal(t, 1, Orientation(stripped))
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+		require.NoError(t, err)
+		assert.Equal(t, 16, config.Width)
+		assert.Equal(t, 32, config.Height)
+	})
+
+	t.Run("PNG text chunks", func(t *testing.T) {
+		var encoded bytes.Buffer
+		require.NoError(t, png.Encode(&encoded, halves(4, 4)))
+		data := encoded.Bytes()
+
+		// Insert a tEXt chunk after IHDR
+		text := []byte("tEXtAuthor\x00Jane")
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+		chunk = append(chunk, text...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+		ihdrEnd := 8 + 12 + 13
+		data = append(append(append([]byte{}, data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+
+		_, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		stripped, err := StripMetadata(data, "png")
+		require.NoError(t, err)
+		assert.Equal(t, encoded.Bytes(), stripped)
+	})
+
+	t.Run("WebP EXIF chunk", func(t *testing.T) {
+		var encoded bytes.Buffer
+		require.NoError(t, nativewebp.Encode(&encoded, halves(4, 4), nil))
+
+		data := append([]byte{}, encoded.Bytes()...)
+		data = append(data, "EXIF\x03\x00\x00\x00abc\x00"...)
+		binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+		stripped, err := StripMetadata(data, "webp")
+		require.NoError(t, err)
+		assert.Equal(t, encoded.Bytes(), stripped)
+	})
+
+	t.Run("Invalid data", func(t *testing.T) {
+		_, err := StripMetadata([]byte("garbage"), "jpeg")
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeRejectsHugeImages(t *testing.T) {
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, halves(4, 4)))
+
+	// Declare 50000x50000 pixels in the IHDR chunk
+	data := append([]byte{}, encoded.Bytes()...)
+	binary.BigEndian.PutUint32(data[16:], 50000)
+	binary.BigEndian.PutUint32(data[20:], 50000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 50000, config.Width)
+
+	_, _, err = Decode(data)
+	assert.ErrorIs(t, err, ErrTooManyPixels)
+
+	_, _, err = Decode(encoded.Bytes())
+	assert.NoError(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	for _, format := range []string{"jpeg", "png", "gif", "webp"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, halves(8, 4), format))
+
+			img, decoded, err := Decode(buf.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, OutputFormat(format), decoded)
+			assert.Equal(t, image.Pt(8, 4), img.Bounds().Size())
+		})
+	}
+}
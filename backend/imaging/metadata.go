@@ -0,0 +1,271 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+)
+
+// JPEG markers
+const (
+	markerSOI   = 0xD8
+	markerSOS   = 0xDA
+	markerAPP1  = 0xE1 // EXIF and XMP
+	markerAPP13 = 0xED // IPTC and Photoshop resources
+	markerCOM   = 0xFE
+)
+
+// exifOrientationTag is the IFD0 tag holding the orientation of a photo
+const exifOrientationTag = 0x0112
+
+// jpegSegment is a marker segment in the header of a JPEG file
+type jpegSegment struct {
+	marker  byte
+	start   int // offset of the 0xFF byte
+	end     int
+	payload []byte
+}
+
+// jpegSegments returns the segments before the scan data of a JPEG along
+// with the offset where the scan starts
+func jpegSegments(data []byte) ([]jpegSegment, int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, 0, fmt.Errorf("not a JPEG")
+	}
+
+	var segments []jpegSegment
+	offset := 2
+	for offset < len(data) {
+		if data[offset] != 0xFF {
+			return nil, 0, fmt.Errorf("invalid JPEG marker at offset %d", offset)
+		}
+
+		start := offset
+		// Markers may be preceded by any number of fill bytes
+		for offset < len(data) && data[offset] == 0xFF {
+			offset++
+		}
+		if offset+2 >= len(data) {
+			break
+		}
+
+		marker := data[offset]
+		if marker == markerSOS {
+			return segments, start, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+1:]))
+		end := offset + 1 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, fmt.Errorf("truncated JPEG segment at offset %d", start)
+		}
+
+		segments = append(segments, jpegSegment{
+			marker:  marker,
+			start:   start,
+			end:     end,
+			payload: data[offset+3 : end],
+		})
+		offset = end
+	}
+
+	return nil, 0, fmt.Errorf("JPEG has no image data")
+}
+
+// Orientation returns the EXIF orientation (1-8) of a JPEG, or 1 when the
+// file has none
+func Orientation(data []byte) int {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 1
+	}
+
+	for _, segment := range segments {
+		if segment.marker == markerAPP1 && bytes.HasPrefix(segment.payload, []byte("Exif\x00\x00")) {
+			if orientation := exifOrientation(segment.payload[6:]); orientation != 0 {
+				return orientation
+			}
+		}
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the IFD0 of a TIFF
+// structure, returning 0 if it is missing or malformed
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+
+		// A single SHORT stored inline in the value field
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 0
+		}
+		return orientation
+	}
+
+	return 0
+}
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata, which can carry
+// GPS locations and camera serial numbers, from a JPEG, PNG or WebP file.
+// JPEGs whose EXIF orientation rotates them are re-encoded upright; all
+// other files keep their image data byte for byte. Other formats are
+// returned unchanged.
+func StripMetadata(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data)
+	case "webp":
+		return stripWebP(data)
+	default:
+		return data, nil
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if orientation := Orientation(data); orientation != 1 {
+		img, _, err := Decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92}); err != nil {
+			return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	segments, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped := make([]byte, 0, len(data))
+	stripped = append(stripped, data[:2]...)
+	for _, segment := range segments {
+		switch segment.marker {
+		case markerAPP1, markerAPP13, markerCOM:
+			continue
+		}
+		stripped = append(stripped, data[segment.start:segment.end]...)
+	}
+
+	return append(stripped, data[scan:]...), nil
+}
+
+// pngMetadataChunks are the ancillary PNG chunks that only carry metadata
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, fmt.Errorf("not a PNG")
+	}
+
+	stripped := make([]byte, 0, len(data))
+	stripped = append(stripped, signature...)
+
+	offset := len(signature)
+	for offset < len(data) {
+		if offset+8 > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk at offset %d", offset)
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		end := offset + 12 + length // length, type, data and CRC
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk at offset %d", offset)
+		}
+
+		if !pngMetadataChunks[kind] {
+			stripped = append(stripped, data[offset:end]...)
+		}
+		offset = end
+
+		if kind == "IEND" {
+			break
+		}
+	}
+
+	return stripped, nil
+}
+
+// VP8X flags announcing metadata chunks
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP")
+	}
+
+	stripped := make([]byte, 12, len(data))
+	copy(stripped, data[:12])
+
+	offset := 12
+	for offset+8 <= len(data) {
+		kind := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		end := offset + 8 + length + length%2 // chunks are padded to even sizes
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated WebP chunk at offset %d", offset)
+		}
+
+		switch kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[offset:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			stripped = append(stripped, chunk...)
+		default:
+			stripped = append(stripped, data[offset:end]...)
+		}
+		offset = end
+	}
+
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -26,14 +26,17 @@ import (
 	"net/http"
 	"time"
 
-	"webenable-cms-backend/adapters"
+	"webenable-cms-backend/adapters/storage"
 	"webenable-cms-backend/cache"
 	"webenable-cms-backend/config"
 	"webenable-cms-backend/container"
-	"webenable-cms-backend/database"
 	_ "webenable-cms-backend/docs"
 	"webenable-cms-backend/handlers"
 	"webenable-cms-backend/middleware"
+	"webenable-cms-backend/passwords"
+	"webenable-cms-backend/permissions"
+	"webenable-cms-backend/search"
+	"webenable-cms-backend/services"
 	"webenable-cms-backend/utils"
 
 	_ "github.com/go-kivik/kivik/v4/couchdb"
@@ -47,34 +50,20 @@ func main() {
 	// Initialize configuration
 	config.Init()
 
-	// Initialize legacy database (for backward compatibility during migration)
-	database.Init()
-
-	// Create adapter factory
-	factory := adapters.NewAdapterFactory(config.AppConfig.Adapters)
-
-	// Create all adapters
-	adapterSet, err := factory.CreateAllAdapters()
+	// Create service container, which owns every adapter
+	serviceContainer, err := container.NewContainer(config.AppConfig.Adapters)
 	if err != nil {
-		utils.LogError(err, "Failed to create adapters", logrus.Fields{})
+		utils.LogError(err, "Failed to create service container", logrus.Fields{})
 		panic(err)
 	}
-	defer adapterSet.Close()
+	defer serviceContainer.Close()
 
 	// Check adapter health
-	if err := adapterSet.Health(); err != nil {
+	if err := serviceContainer.Health(); err != nil {
 		utils.LogError(err, "Adapter health check failed", logrus.Fields{})
 		panic(err)
 	}
 
-	// Create service container
-	serviceContainer, err := container.NewContainer(config.AppConfig.Adapters)
-	if err != nil {
-		utils.LogError(err, "Failed to create service container", logrus.Fields{})
-		panic(err)
-	}
-	defer serviceContainer.Close()
-
 	// Initialize legacy Valkey client for backward compatibility
 	valkeyClient, err := cache.NewValkeyClient(config.AppConfig.ValkeyURL)
 	if err != nil {
@@ -85,9 +74,6 @@ func main() {
 	}
 	defer valkeyClient.Close()
 
-	// Set global dependencies for handlers (legacy support)
-	handlers.SetGlobalCache(valkeyClient)
-
 	// Initialize middleware using adapters
 	rateLimiter := middleware.NewRateLimiter(valkeyClient)
 	pageCache := middleware.NewPageCache(valkeyClient).WithTTL(10 * time.Minute)
@@ -98,13 +84,93 @@ func main() {
 	// Set service container for handlers
 	handlers.SetServiceContainer(serviceContainer)
 
+	// Configure password hashing and the password policy
+	if err := passwords.SetParams(passwords.Params{
+		Algorithm:     config.AppConfig.PasswordHashAlgorithm,
+		BcryptCost:    config.AppConfig.PasswordBcryptCost,
+		Argon2Time:    uint32(config.AppConfig.PasswordArgon2Time),
+		Argon2Memory:  uint32(config.AppConfig.PasswordArgon2Memory),
+		Argon2Threads: uint8(config.AppConfig.PasswordArgon2Threads),
+	}); err != nil {
+		utils.LogError(err, "Invalid password hash settings", logrus.Fields{})
+		panic(err)
+	}
+	passwordPolicy := passwords.Policy{
+		MinLength:  config.AppConfig.PasswordMinLength,
+		MinEntropy: float64(config.AppConfig.PasswordMinEntropy),
+		History:    config.AppConfig.PasswordHistory,
+	}
+	if dir := config.AppConfig.PasswordBreachedDir; dir != "" {
+		passwordPolicy.Breached, err = passwords.OpenBreachedList(dir)
+		if err != nil {
+			utils.LogError(err, "Failed to open breached password list", logrus.Fields{
+				"dir": dir,
+			})
+			panic(err)
+		}
+	}
+	handlers.SetPasswordPolicy(passwordPolicy)
+
 	// Set service container for middleware
 	middleware.SetServiceContainer(serviceContainer)
 
+	// Record the sessions of logins; they last as long as their refresh tokens
+	sessions := middleware.NewSessionManager(serviceContainer.Cache(), config.AppConfig.SessionDomain, config.AppConfig.SessionSecure)
+	refreshExpiration, _ := config.AppConfig.Adapters.Auth.Config["refresh_expiration"].(string)
+	if maxAge, err := time.ParseDuration(refreshExpiration); err == nil {
+		sessions.WithMaxAge(maxAge)
+	}
+	handlers.SetSessionManager(sessions)
+	middleware.SetSessionManager(sessions)
+
+	// Start scheduled publishing worker (safe to run on every replica)
+	scheduler := services.NewPostScheduler(serviceContainer.Database(), serviceContainer.Cache(), config.AppConfig.SchedulerInterval)
+	scheduler.OnPublish = handlers.OnPostPublished
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// Build the search index and keep it in step with other replicas
+	searchIndex, err := search.New(config.AppConfig.SearchBackend)
+	if err != nil {
+		utils.LogError(err, "Failed to create search index", logrus.Fields{})
+		panic(err)
+	}
+	handlers.SetSearchIndex(searchIndex)
+
+	// Give posts saved before slugs existed a slug (once, on one replica)
+	if updated, err := handlers.BackfillPostSlugs(); err != nil {
+		utils.LogError(err, "Failed to backfill post slugs", logrus.Fields{})
+	} else if updated > 0 {
+		utils.LogInfo("Backfilled post slugs", logrus.Fields{
+			"posts": updated,
+		})
+	}
+
+	searchIndexer := services.NewSearchIndexer(serviceContainer.Database(), searchIndex, config.AppConfig.SearchReindexInterval)
+	searchIndexer.Start()
+	defer searchIndexer.Stop()
+
+	// Check stored files against their hashes and delete unreferenced ones
+	if blobs, ok := storage.Blobs(serviceContainer.Storage()); ok {
+		storageVerifier := services.NewStorageVerifier(blobs, config.AppConfig.StorageVerifyInterval)
+		storageVerifier.Start()
+		defer storageVerifier.Stop()
+	}
+
+	// Delete audit events past their retention period
+	if days := config.AppConfig.AuditRetentionDays; days > 0 {
+		auditPurger := services.NewAuditPurger(serviceContainer.Database(), time.Duration(days)*24*time.Hour, config.AppConfig.AuditPurgeInterval)
+		auditPurger.Start()
+		defer auditPurger.Stop()
+	}
+
 	// Initialize router
 	r := mux.NewRouter()
 
-	// Add security headers middleware (first)
+	// Tag every request with an ID for logs and the audit log (first)
+	r.Use(middleware.RequestID)
+
+	// Add security headers middleware
 	r.Use(middleware.SecurityHeaders)
 
 	// Add XSS protection middleware
@@ -119,6 +185,9 @@ func main() {
 	// Swagger documentation endpoint
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
+	// Files in local storage, private ones through signed URLs
+	r.HandleFunc("/uploads/{path:.+}", handlers.ServeUpload).Methods("GET", "HEAD")
+
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
 
@@ -134,7 +203,7 @@ func main() {
 	//	@Router			/health [get]
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		// Check all adapter health
-		if err := adapterSet.Health(); err != nil {
+		if err := serviceContainer.Health(); err != nil {
 			http.Error(w, "One or more adapters unavailable", http.StatusServiceUnavailable)
 			return
 		}
@@ -168,19 +237,48 @@ func main() {
 	public.Use(rateLimiter.RateLimit(100))             // 100 requests per minute for public routes
 	public.Use(pageCache.PageCacheMiddleware())        // Add page caching for public routes
 	public.Use(middleware.CacheControlMiddleware(600)) // 10 minutes browser cache
+	public.HandleFunc("/posts/by-slug/{slug}", handlers.GetPostBySlug).Methods("GET")
 	public.HandleFunc("/posts/{id}", handlers.GetPost).Methods("GET")
 	public.HandleFunc("/contact", handlers.SubmitContact).Methods("POST")
+	public.HandleFunc("/categories", handlers.GetCategories).Methods("GET")
+	public.HandleFunc("/categories/{id}", handlers.GetCategory).Methods("GET")
+	public.HandleFunc("/search", handlers.SearchPosts).Methods("GET")
+
+	// Resized images set their own long-lived cache headers
+	images := api.PathPrefix("").Subrouter()
+	images.Use(rateLimiter.RateLimit(100)) // 100 requests per minute, shared with public routes
+	images.HandleFunc("/media/{id}/image", handlers.GetMediaImage).Methods("GET")
 
 	// Authentication routes with strict rate limiting
 	auth := api.PathPrefix("/auth").Subrouter()
 	auth.Use(rateLimiter.AuthRateLimit(100)) // 100 attempts per hour for auth (development)
 	auth.HandleFunc("/login", handlers.Login).Methods("POST")
 	auth.HandleFunc("/logout", handlers.Logout).Methods("POST")
+	auth.HandleFunc("/refresh", handlers.RefreshToken).Methods("POST")
+	auth.HandleFunc("/login/2fa", handlers.VerifyTwoFactorLogin).Methods("POST")
+	auth.HandleFunc("/login/2fa/setup", handlers.SetupTwoFactorLogin).Methods("POST")
+	auth.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	auth.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
+	auth.HandleFunc("/email/verify", handlers.VerifyEmail).Methods("POST")
+	auth.HandleFunc("/email/verify/resend", handlers.ResendVerification).Methods("POST")
+	auth.HandleFunc("/invitations/accept", handlers.AcceptInvitation).Methods("POST")
+	auth.HandleFunc("/oidc/login", handlers.BeginOIDCLogin).Methods("GET")
+	auth.HandleFunc("/oidc/callback", handlers.CompleteOIDCLogin).Methods("POST")
 
 	// Protected auth routes (require JWT authentication)
 	authProtected := auth.PathPrefix("").Subrouter()
 	authProtected.Use(middleware.AuthMiddleware)
 	authProtected.HandleFunc("/me", handlers.GetCurrentUser).Methods("GET")
+	authProtected.HandleFunc("/2fa", handlers.GetTwoFactorStatus).Methods("GET")
+	authProtected.HandleFunc("/2fa/setup", handlers.SetupTwoFactor).Methods("POST")
+	authProtected.HandleFunc("/2fa/enable", handlers.EnableTwoFactor).Methods("POST")
+	authProtected.HandleFunc("/2fa/disable", handlers.DisableTwoFactor).Methods("POST")
+	authProtected.HandleFunc("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes).Methods("POST")
+	authProtected.HandleFunc("/api-keys", handlers.GetAPIKeys).Methods("GET")
+	authProtected.HandleFunc("/api-keys", handlers.CreateAPIKey).Methods("POST")
+	authProtected.HandleFunc("/api-keys/{id}", handlers.RevokeAPIKey).Methods("DELETE")
+	authProtected.HandleFunc("/sessions", handlers.GetSessions).Methods("GET")
+	authProtected.HandleFunc("/sessions/{id}", handlers.RevokeSession).Methods("DELETE")
 
 	// Protected routes (require JWT authentication)
 	protected := api.PathPrefix("").Subrouter()
@@ -189,6 +287,20 @@ func main() {
 	protected.HandleFunc("/posts", handlers.CreatePost).Methods("POST")
 	protected.HandleFunc("/posts/{id}", handlers.UpdatePost).Methods("PUT")
 	protected.HandleFunc("/posts/{id}", handlers.DeletePost).Methods("DELETE")
+	protected.HandleFunc("/posts/{id}/schedule", handlers.SchedulePost).Methods("PUT")
+	protected.HandleFunc("/posts/{id}/schedule", handlers.UnschedulePost).Methods("DELETE")
+	protected.HandleFunc("/posts/{id}/revisions", handlers.GetPostRevisions).Methods("GET")
+	protected.HandleFunc("/posts/{id}/revisions/diff", handlers.DiffPostRevisions).Methods("GET")
+	protected.HandleFunc("/posts/{id}/revisions/{revision:[0-9]+}", handlers.GetPostRevision).Methods("GET")
+	protected.HandleFunc("/posts/{id}/revisions/{revision:[0-9]+}/restore", handlers.RestorePostRevision).Methods("POST")
+	protected.HandleFunc("/media", handlers.GetMediaList).Methods("GET")
+	protected.HandleFunc("/media", handlers.UploadMedia).Methods("POST")
+	protected.HandleFunc("/media/{id}", handlers.GetMedia).Methods("GET")
+	protected.HandleFunc("/media/{id}", handlers.UpdateMedia).Methods("PUT")
+	protected.HandleFunc("/media/{id}", handlers.DeleteMedia).Methods("DELETE")
+	protected.HandleFunc("/categories", handlers.CreateCategory).Methods("POST")
+	protected.HandleFunc("/categories/{id}", handlers.UpdateCategory).Methods("PUT")
+	protected.HandleFunc("/categories/{id}", handlers.DeleteCategory).Methods("DELETE")
 
 	// Admin routes with real-time headers and no caching
 	admin := api.PathPrefix("/admin").Subrouter()
@@ -204,11 +316,34 @@ func main() {
 	admin.HandleFunc("/users/{id}", handlers.GetUser).Methods("GET")
 	admin.HandleFunc("/users/{id}", handlers.UpdateUser).Methods("PUT")
 	admin.HandleFunc("/users/{id}", handlers.DeleteUser).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/2fa", handlers.ResetUserTwoFactor).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/lockout", handlers.GetUserLockout).Methods("GET")
+	admin.HandleFunc("/users/{id}/lockout", handlers.UnlockUser).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/sessions", handlers.GetUserSessions).Methods("GET")
+	admin.HandleFunc("/users/{id}/sessions", handlers.SignOutUser).Methods("DELETE")
+	admin.HandleFunc("/invitations", handlers.GetInvitations).Methods("GET")
+	admin.HandleFunc("/invitations", handlers.CreateInvitation).Methods("POST")
+	admin.HandleFunc("/invitations/{id}/resend", handlers.ResendInvitation).Methods("POST")
+	admin.HandleFunc("/invitations/{id}", handlers.RevokeInvitation).Methods("DELETE")
+	admin.HandleFunc("/api-keys", handlers.GetAllAPIKeys).Methods("GET")
+	admin.HandleFunc("/api-keys/{id}", handlers.RevokeUserAPIKey).Methods("DELETE")
+	admin.HandleFunc("/settings/security", handlers.GetSecuritySettings).Methods("GET")
+	admin.HandleFunc("/settings/security", handlers.UpdateSecuritySettings).Methods("PUT")
+	admin.HandleFunc("/settings/roles", handlers.GetRoles).Methods("GET")
+	admin.HandleFunc("/settings/roles", handlers.UpdateRoles).Methods("PUT")
 	admin.HandleFunc("/contacts", handlers.GetContacts).Methods("GET")
 	admin.HandleFunc("/contacts/{id}", handlers.GetContact).Methods("GET")
 	admin.HandleFunc("/contacts/{id}", handlers.UpdateContactStatus).Methods("PUT")
 	admin.HandleFunc("/contacts/{id}/reply", handlers.ReplyToContact).Methods("POST")
 	admin.HandleFunc("/contacts/{id}", handlers.DeleteContact).Methods("DELETE")
+	admin.HandleFunc("/categories", handlers.GetCategories).Methods("GET")
+	admin.HandleFunc("/categories", handlers.CreateCategory).Methods("POST")
+	admin.HandleFunc("/categories/{id}", handlers.GetCategory).Methods("GET")
+	admin.HandleFunc("/categories/{id}", handlers.UpdateCategory).Methods("PUT")
+	admin.HandleFunc("/categories/{id}", handlers.DeleteCategory).Methods("DELETE")
+	admin.HandleFunc("/search", handlers.SearchPosts).Methods("GET")
+	admin.HandleFunc("/audit", handlers.GetAuditEvents).Methods("GET")
+	admin.HandleFunc("/audit/export", handlers.ExportAuditEvents).Methods("GET")
 
 	// Legacy protected routes for backward compatibility
 	protected.HandleFunc("/contacts", handlers.GetContacts).Methods("GET")
@@ -217,7 +352,7 @@ func main() {
 	protected.HandleFunc("/contacts/{id}/reply", handlers.ReplyToContact).Methods("POST")
 	protected.HandleFunc("/contacts/{id}", handlers.DeleteContact).Methods("DELETE")
 
-	// User management routes (admin only) - keep for backward compatibility
+	// User management routes - keep for backward compatibility
 	protected.HandleFunc("/users", handlers.GetUsers).Methods("GET")
 	protected.HandleFunc("/users", handlers.CreateUser).Methods("POST")
 	protected.HandleFunc("/users/stats", handlers.GetUserStats).Methods("GET")
@@ -230,7 +365,7 @@ func main() {
 	protected.HandleFunc("/admin/rate-limit/status", handlers.GetRateLimitStatus).Methods("GET")
 
 	// Stats endpoint for monitoring
-	protected.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+	protected.Handle("/stats", handlers.RequirePermission(permissions.System, permissions.Read)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		// Get cache stats using adapter
@@ -288,7 +423,7 @@ func main() {
 		}
 
 		json.NewEncoder(w).Encode(stats)
-	}).Methods("GET")
+	}))).Methods("GET")
 
 	// Setup CORS with secure configuration
 	c := cors.New(cors.Options{
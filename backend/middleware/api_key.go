@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"webenable-cms-backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs in
+// the Authorization header
+const APIKeyPrefix = "wcms_"
+
+// apiKeyTouchInterval limits how often the last use of a key is written
+const apiKeyTouchInterval = time.Minute
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// IsAPIKey reports whether a bearer token is an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns the hash under which an API key is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyClaims validates an API key and returns the claims of its user,
+// limited to the scopes of the key. The role is read from the user, so role
+// changes and deactivation apply to keys right away.
+func apiKeyClaims(r *http.Request, key string) (*Claims, error) {
+	db := globalServiceContainer.Database()
+
+	stored, err := db.GetAPIKeyByHash(HashAPIKey(key))
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+	now := time.Now()
+	if !stored.Active(now) {
+		return nil, errInvalidAPIKey
+	}
+
+	user, err := db.GetUser(stored.UserID)
+	if err != nil || !user.Active {
+		return nil, errInvalidAPIKey
+	}
+
+	ip := getClientIP(r)
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= apiKeyTouchInterval || stored.LastUsedIP != ip {
+		if err := db.TouchAPIKey(stored.ID, now, ip); err != nil {
+			utils.LogWarning("Failed to record API key use", logrus.Fields{
+				"key_id": stored.ID,
+				"error":  err.Error(),
+			})
+		}
+	}
+
+	scopes := stored.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &Claims{
+		Username: user.Username,
+		Role:     user.Role,
+		APIKeyID: stored.ID,
+		Scopes:   scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(stored.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(stored.ExpiresAt),
+		},
+	}, nil
+}
@@ -13,8 +13,13 @@ import (
 )
 
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	// APIKeyID and Scopes are set for requests made with an API key, whose
+	// permissions are those of the role limited to the scopes
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -26,7 +31,9 @@ func SetServiceContainer(container *container.Container) {
 	globalServiceContainer = container
 }
 
-// AuthMiddleware provides JWT authentication using the auth adapter
+// AuthMiddleware provides JWT authentication using the auth adapter. API
+// keys are accepted as bearer tokens as well. Tokens of revoked sessions
+// are refused.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -43,20 +50,29 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 		tokenString := bearerToken[1]
 
+		if IsAPIKey(tokenString) && globalServiceContainer != nil {
+			claims, err := apiKeyClaims(r, tokenString)
+			if err != nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Use auth adapter if available, otherwise fall back to direct JWT
 		if globalServiceContainer != nil {
 			authAdapter := globalServiceContainer.Auth()
 			claims, err := authAdapter.ValidateToken(tokenString)
-			if err != nil {
+			if err != nil || !sessionActive(r, claims.SessionID) {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
 			// Convert auth claims to middleware claims
-			middlewareClaims := &Claims{
-				Username: claims.Username,
-				Role:     claims.Role,
-			}
+			middlewareClaims := newClaims(claims)
 
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), "user", middlewareClaims)
@@ -98,16 +114,13 @@ func AuthMiddlewareWithAdapter(authAdapter auth.AuthAdapter) func(http.Handler)
 
 			tokenString := bearerToken[1]
 			claims, err := authAdapter.ValidateToken(tokenString)
-			if err != nil {
+			if err != nil || !sessionActive(r, claims.SessionID) {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
 			// Convert auth claims to middleware claims
-			middlewareClaims := &Claims{
-				Username: claims.Username,
-				Role:     claims.Role,
-			}
+			middlewareClaims := newClaims(claims)
 
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), "user", middlewareClaims)
@@ -115,3 +128,18 @@ func AuthMiddlewareWithAdapter(authAdapter auth.AuthAdapter) func(http.Handler)
 		})
 	}
 }
+
+// newClaims converts validated auth claims to middleware claims
+func newClaims(claims *auth.AuthClaims) *Claims {
+	return &Claims{
+		Username:  claims.Username,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        claims.TokenID,
+			Subject:   claims.UserID,
+			IssuedAt:  jwt.NewNumericDate(claims.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+		},
+	}
+}
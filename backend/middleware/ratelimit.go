@@ -44,6 +44,11 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
+// ClientIP returns the address of the client that made r
+func ClientIP(r *http.Request) string {
+	return getClientIP(r)
+}
+
 // RateLimit middleware for general API endpoints
 func (rl *RateLimiter) RateLimit(requestsPerMinute int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
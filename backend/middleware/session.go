@@ -4,26 +4,66 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
-	"webenable-cms-backend/cache"
+	"webenable-cms-backend/adapters/cache"
+	"webenable-cms-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// sessionTouchInterval limits how often the last sight of a session is
+	// written
+	sessionTouchInterval = time.Minute
+	// sessionIndexLockTTL bounds how long a crashed request can hold the
+	// session index of a user, and sessionIndexAttempts how often a busy
+	// index is tried
+	sessionIndexLockTTL  = 5 * time.Second
+	sessionIndexAttempts = 50
 )
 
-// SessionData represents session information
+var errSessionIndexBusy = errors.New("session index is busy")
+
+// SessionData represents session information. The session of a login is
+// stored under the session ID of its tokens, with the device it came from.
 type SessionData struct {
+	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
 	Role      string    `json:"role"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
 	CreatedAt time.Time `json:"created_at"`
 	LastSeen  time.Time `json:"last_seen"`
 }
 
-// SessionManager handles session operations
+// Global session manager for middleware
+var globalSessionManager *SessionManager
+
+// SetSessionManager sets the session manager whose revoked sessions
+// AuthMiddleware refuses
+func SetSessionManager(sm *SessionManager) {
+	globalSessionManager = sm
+}
+
+// Cache keys. sessionKey is where the cache adapters keep what SetSession
+// stores.
+func sessionKey(sessionID string) string        { return "session:" + sessionID }
+func userSessionsKey(userID string) string      { return "user_sessions:" + userID }
+func revokedSessionKey(sessionID string) string { return "session_revoked:" + sessionID }
+
+// SessionManager handles session operations. Sessions of a user are
+// indexed, so they can be listed and revoked together.
 type SessionManager struct {
-	cache      *cache.ValkeyClient
+	cache      cache.CacheAdapter
 	cookieName string
 	domain     string
 	secure     bool
@@ -33,9 +73,9 @@ type SessionManager struct {
 }
 
 // NewSessionManager creates a new session manager
-func NewSessionManager(valkeyClient *cache.ValkeyClient, domain string, secure bool) *SessionManager {
+func NewSessionManager(cacheAdapter cache.CacheAdapter, domain string, secure bool) *SessionManager {
 	return &SessionManager{
-		cache:      valkeyClient,
+		cache:      cacheAdapter,
 		cookieName: "webenable_session",
 		domain:     domain,
 		secure:     secure,
@@ -45,6 +85,13 @@ func NewSessionManager(valkeyClient *cache.ValkeyClient, domain string, secure b
 	}
 }
 
+// WithMaxAge sets how long sessions last without being seen. Sessions of
+// logins should last as long as their refresh tokens.
+func (sm *SessionManager) WithMaxAge(maxAge time.Duration) *SessionManager {
+	sm.maxAge = maxAge
+	return sm
+}
+
 // generateSessionID creates a secure random session ID
 func (sm *SessionManager) generateSessionID() string {
 	bytes := make([]byte, 32)
@@ -56,12 +103,7 @@ func (sm *SessionManager) generateSessionID() string {
 func (sm *SessionManager) CreateSession(w http.ResponseWriter, userData SessionData) (string, error) {
 	sessionID := sm.generateSessionID()
 
-	// Set session data
-	userData.CreatedAt = time.Now()
-	userData.LastSeen = time.Now()
-
-	err := sm.cache.SetSession(sessionID, userData, sm.maxAge)
-	if err != nil {
+	if err := sm.StartSession(sessionID, userData); err != nil {
 		return "", err
 	}
 
@@ -110,8 +152,7 @@ func (sm *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Remove from cache
-	err = sm.cache.DeleteSession(cookie.Value)
-	if err != nil {
+	if err := sm.RevokeSession(cookie.Value); err != nil {
 		return err
 	}
 
@@ -207,20 +248,216 @@ func (sm *SessionManager) RefreshSession(r *http.Request) error {
 	return sm.cache.SetSession(cookie.Value, sessionData, sm.maxAge)
 }
 
-// GetAllUserSessions returns all active sessions for a user
+// StartSession records a new session under sessionID, which for logins is
+// the session ID of their tokens
+func (sm *SessionManager) StartSession(sessionID string, data SessionData) error {
+	now := time.Now()
+	data.ID = sessionID
+	data.CreatedAt = now
+	data.LastSeen = now
+
+	if err := sm.cache.SetSession(sessionID, data, sm.maxAge); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return sm.updateUserSessions(data.UserID, func(ids []string) []string {
+		return append(ids, sessionID)
+	})
+}
+
+// LookupSession returns a session, or nil when it ended or expired
+func (sm *SessionManager) LookupSession(sessionID string) (*SessionData, error) {
+	var session SessionData
+	if err := sm.cache.GetSession(sessionID, &session); err != nil {
+		exists, existsErr := sm.cache.Exists(sessionKey(sessionID))
+		if existsErr != nil || exists {
+			return nil, fmt.Errorf("failed to load session: %w", err)
+		}
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// TouchSession records that a session was seen from ip, which keeps it
+// from expiring. The time is written at most once a minute per address.
+func (sm *SessionManager) TouchSession(sessionID, ip string) error {
+	session, err := sm.LookupSession(sessionID)
+	if err != nil || session == nil {
+		return err
+	}
+
+	if time.Since(session.LastSeen) < sessionTouchInterval && session.IP == ip {
+		return nil
+	}
+	session.LastSeen = time.Now()
+	session.IP = ip
+	if err := sm.cache.SetSession(sessionID, session, sm.maxAge); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return sm.cache.SetExpiration(userSessionsKey(session.UserID), sm.maxAge)
+}
+
+// RevokeSession ends a session. It stays marked as revoked for as long as
+// its tokens could be used, so they are refused.
+func (sm *SessionManager) RevokeSession(sessionID string) error {
+	if err := sm.cache.Set(revokedSessionKey(sessionID), true, sm.maxAge); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	session, err := sm.LookupSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := sm.cache.DeleteSession(sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if session == nil {
+		return nil
+	}
+	return sm.updateUserSessions(session.UserID, func(ids []string) []string {
+		kept := ids[:0]
+		for _, id := range ids {
+			if id != sessionID {
+				kept = append(kept, id)
+			}
+		}
+		return kept
+	})
+}
+
+// IsRevoked reports whether a session was revoked
+func (sm *SessionManager) IsRevoked(sessionID string) (bool, error) {
+	revoked, err := sm.cache.Exists(revokedSessionKey(sessionID))
+	if err != nil {
+		return false, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// ListUserSessions returns the sessions of a user, most recently seen
+// first
+func (sm *SessionManager) ListUserSessions(userID string) ([]SessionData, error) {
+	ids, err := sm.GetAllUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []SessionData{}
+	for _, id := range ids {
+		session, err := sm.LookupSession(id)
+		if err != nil {
+			return nil, err
+		}
+		// Expired sessions linger in the index until it is next written
+		if session != nil {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// GetAllUserSessions returns the IDs of the sessions of a user
 func (sm *SessionManager) GetAllUserSessions(userID string) ([]string, error) {
-	// This would require a more complex implementation with session indexing
-	// For now, we'll implement basic functionality
-	return []string{}, nil
+	var ids []string
+	if err := sm.cache.Get(userSessionsKey(userID), &ids); err != nil {
+		exists, existsErr := sm.cache.Exists(userSessionsKey(userID))
+		if existsErr != nil || exists {
+			return nil, fmt.Errorf("failed to load sessions: %w", err)
+		}
+		return []string{}, nil
+	}
+	return ids, nil
 }
 
-// InvalidateAllUserSessions removes all sessions for a user
+// InvalidateAllUserSessions revokes every session of a user
 func (sm *SessionManager) InvalidateAllUserSessions(userID string) error {
-	// This would require session indexing by user ID
-	// For now, return success
+	ids, err := sm.GetAllUserSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := sm.RevokeSession(id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// updateUserSessions changes the session index of a user while holding
+// its lock, so concurrent logins don't drop each other's sessions.
+// Sessions that expired are dropped on the way.
+func (sm *SessionManager) updateUserSessions(userID string, change func(ids []string) []string) error {
+	key := userSessionsKey(userID)
+	owner := uuid.New().String()
+
+	for attempt := 1; ; attempt++ {
+		acquired, err := sm.cache.AcquireLock(key, owner, sessionIndexLockTTL)
+		if err != nil {
+			return fmt.Errorf("failed to lock sessions: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if attempt == sessionIndexAttempts {
+			return errSessionIndexBusy
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer sm.cache.ReleaseLock(key, owner)
+
+	ids, err := sm.GetAllUserSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	live := []string{}
+	for _, id := range change(ids) {
+		if exists, err := sm.cache.Exists(sessionKey(id)); err != nil || exists {
+			live = append(live, id)
+		}
+	}
+
+	if len(live) == 0 {
+		return sm.cache.Delete(key)
+	}
+	if err := sm.cache.Set(key, live, sm.maxAge); err != nil {
+		return fmt.Errorf("failed to store sessions: %w", err)
+	}
+	return nil
+}
+
+// sessionActive reports whether the tokens of a session may be used, and
+// records that the session was seen. Tokens are refused while revocation
+// can't be checked.
+func sessionActive(r *http.Request, sessionID string) bool {
+	if globalSessionManager == nil || sessionID == "" {
+		return true
+	}
+
+	revoked, err := globalSessionManager.IsRevoked(sessionID)
+	if err != nil {
+		utils.LogError(err, "Failed to check session", logrus.Fields{
+			"session_id": sessionID,
+		})
+		return false
+	}
+	if revoked {
+		return false
+	}
+
+	if err := globalSessionManager.TouchSession(sessionID, getClientIP(r)); err != nil {
+		utils.LogWarning("Failed to record session use", logrus.Fields{
+			"session_id": sessionID,
+			"error":      err.Error(),
+		})
+	}
+	return true
+}
+
 // GetSessionStats returns session statistics
 func (sm *SessionManager) GetSessionStats() (map[string]interface{}, error) {
 	// Basic session statistics
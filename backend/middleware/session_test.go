@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionManager(t *testing.T) *SessionManager {
+	cacheAdapter, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+	return NewSessionManager(cacheAdapter, "", false).WithMaxAge(time.Hour)
+}
+
+func TestSessionManager(t *testing.T) {
+	sm := newTestSessionManager(t)
+
+	require.NoError(t, sm.StartSession("s1", SessionData{UserID: "u1", UserAgent: "laptop", IP: "10.0.0.1"}))
+	require.NoError(t, sm.StartSession("s2", SessionData{UserID: "u1", UserAgent: "phone", IP: "10.0.0.2"}))
+	require.NoError(t, sm.StartSession("s3", SessionData{UserID: "u2", UserAgent: "tablet"}))
+
+	t.Run("Sessions are listed per user", func(t *testing.T) {
+		sessions, err := sm.ListUserSessions("u1")
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.ElementsMatch(t, []string{"s1", "s2"}, []string{sessions[0].ID, sessions[1].ID})
+
+		session, err := sm.LookupSession("s1")
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, "laptop", session.UserAgent)
+		assert.Equal(t, "10.0.0.1", session.IP)
+		assert.False(t, session.CreatedAt.IsZero())
+
+		sessions, err = sm.ListUserSessions("nobody")
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("A new address is recorded right away", func(t *testing.T) {
+		require.NoError(t, sm.TouchSession("s1", "10.0.0.9"))
+		session, err := sm.LookupSession("s1")
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.9", session.IP)
+
+		sessions, err := sm.ListUserSessions("u1")
+		require.NoError(t, err)
+		assert.Equal(t, "s1", sessions[0].ID)
+	})
+
+	t.Run("Revoked sessions are gone and remembered", func(t *testing.T) {
+		require.NoError(t, sm.RevokeSession("s1"))
+
+		revoked, err := sm.IsRevoked("s1")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+		revoked, err = sm.IsRevoked("s2")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		session, err := sm.LookupSession("s1")
+		require.NoError(t, err)
+		assert.Nil(t, session)
+
+		ids, err := sm.GetAllUserSessions("u1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s2"}, ids)
+	})
+
+	t.Run("Invalidating revokes every session of the user", func(t *testing.T) {
+		require.NoError(t, sm.InvalidateAllUserSessions("u1"))
+
+		revoked, err := sm.IsRevoked("s2")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+		sessions, err := sm.ListUserSessions("u1")
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		sessions, err = sm.ListUserSessions("u2")
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+}
+
+func TestSessionActive(t *testing.T) {
+	t.Cleanup(func() { SetSessionManager(nil) })
+	r := httptest.NewRequest("GET", "/api/auth/me", nil)
+
+	assert.True(t, sessionActive(r, "s1"), "without a session manager nothing is revoked")
+
+	sm := newTestSessionManager(t)
+	SetSessionManager(sm)
+	require.NoError(t, sm.StartSession("s1", SessionData{UserID: "u1"}))
+
+	assert.True(t, sessionActive(r, "s1"))
+	assert.True(t, sessionActive(r, ""), "tokens without a session aren't tracked")
+
+	require.NoError(t, sm.RevokeSession("s1"))
+	assert.False(t, sessionActive(r, "s1"))
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// APIKey is a personal access key for automation. The key itself is shown
+// once when it is created; only its SHA-256 hash is stored. Requests made
+// with the key act as its user, limited to the key's scopes.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy  string     `json:"revoked_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key can still be used at the given time
+func (k *APIKey) Active(at time.Time) bool {
+	return k.RevokedAt == nil && at.Before(k.ExpiresAt)
+}
+
+// CreateAPIKeyRequest creates an API key. Scopes are permissions like
+// "posts:create" and must be within those of the user's role.
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// CreateAPIKeyResponse carries a new API key. The key is shown once.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// AuditChange is the value of a field before and after a mutation. Before
+// is null for created records and After is null for deleted ones.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEvent records who changed what. Events are append-only: they are
+// never updated, and only deleted once they are older than the retention
+// period. Action names the mutation as "<target type>.<verb>", like
+// "post.delete" or "user.update". The actor of events recorded by
+// background jobs is the name of the job, like "scheduler".
+type AuditEvent struct {
+	ID         string                 `json:"id"`
+	ActorID    string                 `json:"actor_id,omitempty"`
+	Actor      string                 `json:"actor"`
+	APIKeyID   string                 `json:"api_key_id,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id,omitempty"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// AuditQuery filters and orders audit events
+type AuditQuery struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Created    TimeRange
+
+	ListOptions
+}
+
+// AuditList is one page of audit events. NextCursor is empty on the last
+// page.
+type AuditList struct {
+	Events     []AuditEvent
+	NextCursor string
+}
+
+// PaginatedAuditResponse represents a paginated list of audit events
+type PaginatedAuditResponse struct {
+	Data []AuditEvent   `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account with an identity provider,
+// named by the issuer and subject of its ID tokens. Users signing in with
+// the provider are found by the identity rather than by email address.
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Invitation is a pending invitation of a user, who is created inactive and
+// without a password. The invitee sets a password with the emailed link,
+// which activates the account. Only the SHA-256 hash of the link's token is
+// stored, and a user has at most one invitation.
+type Invitation struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	TokenHash string    `json:"-"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SentAt    time.Time `json:"sent_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Expired reports whether the link of the invitation no longer works at
+// the given time
+func (i *Invitation) Expired(at time.Time) bool {
+	return !at.Before(i.ExpiresAt)
+}
+
+// PendingInvitation is an invitation together with the user it invites
+type PendingInvitation struct {
+	Invitation
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Expired  bool   `json:"expired"`
+}
+
+// CreateInvitationRequest invites a new user with a role
+type CreateInvitationRequest struct {
+	Username string `json:"username" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Role     string `json:"role" validate:"required"`
+}
+
+// AcceptInvitationRequest sets the password of an invited user with the
+// token of their invitation link
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
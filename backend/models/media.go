@@ -0,0 +1,87 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Media is an uploaded asset in the media library. UsedBy lists the IDs of
+// the posts that reference the asset by URL. Images carry the resized
+// variants generated at upload. Assets with identical content share their
+// stored file, and so their Path and URL.
+type Media struct {
+	ID         string         `json:"id,omitempty" db:"_id"`
+	Rev        string         `json:"rev,omitempty" db:"_rev"`
+	Filename   string         `json:"filename"`
+	Path       string         `json:"path"`
+	URL        string         `json:"url"`
+	MimeType   string         `json:"mime_type"`
+	Size       int64          `json:"size"`
+	SHA256     string         `json:"sha256,omitempty"`
+	Width      int            `json:"width,omitempty"`
+	Height     int            `json:"height,omitempty"`
+	AltText    string         `json:"alt_text"`
+	UploadedBy string         `json:"uploaded_by"`
+	UsedBy     []string       `json:"used_by"`
+	Variants   []MediaVariant `json:"variants,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// MediaVariant is a resized or re-encoded copy of an image, such as its
+// thumbnail
+type MediaVariant struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// IsImage reports whether the asset is an image
+func (m *Media) IsImage() bool {
+	return strings.HasPrefix(m.MimeType, "image/")
+}
+
+// MediaUpdateRequest holds the editable fields of a media asset
+type MediaUpdateRequest struct {
+	Filename *string `json:"filename,omitempty"`
+	AltText  *string `json:"alt_text,omitempty"`
+}
+
+// PaginatedMediaResponse represents a paginated media library response
+type PaginatedMediaResponse struct {
+	Data []Media        `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// mediaReferencePattern matches URLs in HTML src/href attributes and in
+// Markdown links and images
+var mediaReferencePattern = regexp.MustCompile(`(?i)(?:src|href)\s*=\s*["']([^"']+)["']|\]\(\s*<?([^)\s>]+)`)
+
+// MediaReferences returns the distinct URLs a post refers to, starting with
+// its featured image
+func (p *Post) MediaReferences() []string {
+	seen := make(map[string]bool)
+	var references []string
+
+	add := func(url string) {
+		url = strings.TrimSpace(url)
+		if url == "" || seen[url] {
+			return
+		}
+		seen[url] = true
+		references = append(references, url)
+	}
+
+	add(p.FeaturedImage)
+	for _, match := range mediaReferencePattern.FindAllStringSubmatch(p.Content, -1) {
+		add(match[1])
+		add(match[2])
+	}
+
+	return references
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostMediaReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		post     Post
+		expected []string
+	}{
+		{
+			name:     "No references",
+			post:     Post{Content: "Plain text"},
+			expected: nil,
+		},
+		{
+			name:     "Featured image first",
+			post:     Post{FeaturedImage: "/uploads/a.jpg", Content: `<img src="/uploads/b.png">`},
+			expected: []string{"/uploads/a.jpg", "/uploads/b.png"},
+		},
+		{
+			name:     "HTML attributes and Markdown",
+			post:     Post{Content: `<a href='/uploads/doc.pdf'>doc</a> ![chart](/uploads/chart.png "Chart") [clip](</uploads/clip.mp4>)`},
+			expected: []string{"/uploads/doc.pdf", "/uploads/chart.png", "/uploads/clip.mp4"},
+		},
+		{
+			name:     "Duplicates are reported once",
+			post:     Post{FeaturedImage: "/uploads/a.jpg", Content: `<img SRC="/uploads/a.jpg"> ![a](/uploads/a.jpg)`},
+			expected: []string{"/uploads/a.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.post.MediaReferences())
+		})
+	}
+}
@@ -3,13 +3,15 @@ package models
 import (
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"webenable-cms-backend/passwords"
 )
 
 type Post struct {
 	ID            string     `json:"id,omitempty" db:"_id"`
 	Rev           string     `json:"rev,omitempty" db:"_rev"`
 	Title         string     `json:"title" validate:"required"`
+	Slug          string     `json:"slug"`
+	PreviousSlugs []string   `json:"previous_slugs,omitempty"`
 	Content       string     `json:"content" validate:"required"`
 	Excerpt       string     `json:"excerpt"`
 	Author        string     `json:"author" validate:"required"`
@@ -43,15 +45,16 @@ type Category struct {
 }
 
 type User struct {
-	ID           string    `json:"id,omitempty"`
-	Rev          string    `json:"_rev,omitempty"`
-	Username     string    `json:"username" validate:"required,min=3,max=20"`
-	Email        string    `json:"email" validate:"required,email"`
-	PasswordHash string    `json:"password_hash,omitempty"`
-	Role         string    `json:"role" validate:"required,oneof=admin editor author"`
-	Active       bool      `json:"active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            string    `json:"id,omitempty"`
+	Rev           string    `json:"_rev,omitempty"`
+	Username      string    `json:"username" validate:"required,min=3,max=20"`
+	Email         string    `json:"email" validate:"required,email"`
+	EmailVerified bool      `json:"email_verified"`
+	PasswordHash  string    `json:"password_hash,omitempty"`
+	Role          string    `json:"role" validate:"required"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type Contact struct {
@@ -75,8 +78,32 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string     `json:"token"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	User         User       `json:"user"`
+	// RecoveryCodes are returned once when two-factor authentication was
+	// set up during the login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// CurrentUserResponse describes the signed in user with the permissions of
+// their role
+type CurrentUserResponse struct {
+	User        User     `json:"user"`
+	Permissions []string `json:"permissions"`
+}
+
+// RefreshTokenRequest carries a refresh token to redeem or revoke
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// OIDCCallbackRequest carries the code and state an OpenID Connect provider
+// sent back to the redirect URL
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
 }
 
 // ErrorResponse represents an error response
@@ -90,6 +117,13 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
+// SlugRedirectResponse tells the client that a slug has moved permanently
+type SlugRedirectResponse struct {
+	Status   int    `json:"status"`
+	Slug     string `json:"slug"`
+	Location string `json:"location"`
+}
+
 // UserStatsResponse represents user statistics
 type UserStatsResponse struct {
 	TotalUsers  int `json:"total_users"`
@@ -97,16 +131,21 @@ type UserStatsResponse struct {
 	EditorUsers int `json:"editor_users"`
 	AuthorUsers int `json:"author_users"`
 	ActiveUsers int `json:"active_users"`
+	// UsersByRole counts the users of every role, including custom ones
+	UsersByRole map[string]int `json:"users_by_role"`
 }
 
-// PaginationMeta represents pagination metadata
+// PaginationMeta represents pagination metadata. Page, Total and TotalPages
+// are only filled for page based requests, not when following a cursor.
 type PaginationMeta struct {
-	Page       int  `json:"page"`
-	Limit      int  `json:"limit"`
-	Total      int  `json:"total"`
-	TotalPages int  `json:"total_pages"`
-	HasNext    bool `json:"has_next"`
-	HasPrev    bool `json:"has_prev"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // PaginatedPostsResponse represents paginated posts response
@@ -121,16 +160,19 @@ type PaginatedUsersResponse struct {
 	Meta PaginationMeta `json:"meta"`
 }
 
+// SetPassword hashes password with the current hash parameters. It doesn't
+// check the password policy.
 func (u *User) SetPassword(password string) error {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	hash, err := passwords.Hash(password)
 	if err != nil {
 		return err
 	}
-	u.PasswordHash = string(bytes)
+	u.PasswordHash = hash
 	return nil
 }
 
+// CheckPassword reports whether password is the password of the user,
+// whatever the parameters of the stored hash
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
-	return err == nil
+	return passwords.Verify(u.PasswordHash, password)
 }
@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// Sortable fields of each list. Every adapter backs these with an index.
+var (
+	PostSortFields    = []string{"created_at", "published_at", "view_count", "title"}
+	UserSortFields    = []string{"created_at", "username"}
+	ContactSortFields = []string{"created_at"}
+	MediaSortFields   = []string{"created_at", "filename", "size"}
+	AuditSortFields   = []string{"created_at"}
+)
+
+// ListOptions controls the order and the page of a list query
+type ListOptions struct {
+	// Sort is one of the sortable fields of the list, created_at by default
+	Sort string
+	Desc bool
+
+	Limit int
+
+	// Cursor continues a list where a previous page stopped and must be
+	// used with the same sort. Offset is ignored when a cursor is given.
+	Cursor string
+	Offset int
+}
+
+// TimeRange matches times between From and To inclusive. A nil bound is open.
+type TimeRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// IsZero reports whether the range matches every time
+func (r TimeRange) IsZero() bool {
+	return r.From == nil && r.To == nil
+}
+
+// PostQuery filters and orders posts. Sorting by published_at only lists
+// posts that have a publish time.
+type PostQuery struct {
+	Status    string
+	Tag       string
+	Category  string
+	Author    string
+	Featured  *bool
+	Created   TimeRange
+	Published TimeRange
+
+	ListOptions
+}
+
+// UserQuery filters and orders users
+type UserQuery struct {
+	Role    string
+	Active  *bool
+	Created TimeRange
+
+	ListOptions
+}
+
+// ContactQuery filters and orders contacts
+type ContactQuery struct {
+	Status  string
+	Created TimeRange
+
+	ListOptions
+}
+
+// MediaQuery filters and orders the media library. Search matches the
+// filename and alt text, MimeType matches a full type or a prefix such as
+// "image/".
+type MediaQuery struct {
+	Search     string
+	MimeType   string
+	UploadedBy string
+
+	ListOptions
+}
+
+// PostList is one page of posts. NextCursor is empty on the last page.
+type PostList struct {
+	Posts      []Post
+	NextCursor string
+}
+
+// UserList is one page of users. NextCursor is empty on the last page.
+type UserList struct {
+	Users      []User
+	NextCursor string
+}
+
+// ContactList is one page of contacts. NextCursor is empty on the last page.
+type ContactList struct {
+	Contacts   []Contact
+	NextCursor string
+}
+
+// MediaList is one page of media. NextCursor is empty on the last page.
+type MediaList struct {
+	Media      []Media
+	NextCursor string
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// PostRevision is an immutable snapshot of a post taken every time it is saved
+type PostRevision struct {
+	ID            string       `json:"id,omitempty"`
+	PostID        string       `json:"post_id"`
+	Number        int          `json:"number"`
+	Author        string       `json:"author"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ChangedFields []string     `json:"changed_fields"`
+	RestoredFrom  int          `json:"restored_from,omitempty"`
+	Snapshot      PostSnapshot `json:"snapshot"`
+}
+
+// PostSnapshot holds the editable fields of a post. Counters and timestamps
+// managed by the system are deliberately left out.
+type PostSnapshot struct {
+	Title         string     `json:"title"`
+	Slug          string     `json:"slug,omitempty"`
+	Content       string     `json:"content"`
+	Excerpt       string     `json:"excerpt"`
+	Status        string     `json:"status"`
+	Tags          []string   `json:"tags"`
+	Categories    []string   `json:"categories"`
+	FeaturedImage string     `json:"featured_image"`
+	ImageAlt      string     `json:"image_alt"`
+	MetaTitle     string     `json:"meta_title"`
+	MetaDesc      string     `json:"meta_description"`
+	IsFeatured    bool       `json:"is_featured"`
+	ScheduledAt   *time.Time `json:"scheduled_at,omitempty"`
+}
+
+// FieldChange describes a single field that differs between two snapshots
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// PostRevisionDiff is the field-level difference between two revisions
+type PostRevisionDiff struct {
+	PostID  string        `json:"post_id"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// SnapshotPost captures the editable fields of a post
+func SnapshotPost(post *Post) PostSnapshot {
+	return PostSnapshot{
+		Title:         post.Title,
+		Slug:          post.Slug,
+		Content:       post.Content,
+		Excerpt:       post.Excerpt,
+		Status:        post.Status,
+		Tags:          post.Tags,
+		Categories:    post.Categories,
+		FeaturedImage: post.FeaturedImage,
+		ImageAlt:      post.ImageAlt,
+		MetaTitle:     post.MetaTitle,
+		MetaDesc:      post.MetaDesc,
+		IsFeatured:    post.IsFeatured,
+		ScheduledAt:   post.ScheduledAt,
+	}
+}
+
+// ApplyTo copies the snapshot fields onto a post. The slug is left alone:
+// moving a post to another slug keeps the old one for redirects, which is
+// up to the caller.
+func (s PostSnapshot) ApplyTo(post *Post) {
+	post.Title = s.Title
+	post.Content = s.Content
+	post.Excerpt = s.Excerpt
+	post.Status = s.Status
+	post.Tags = s.Tags
+	post.Categories = s.Categories
+	post.FeaturedImage = s.FeaturedImage
+	post.ImageAlt = s.ImageAlt
+	post.MetaTitle = s.MetaTitle
+	post.MetaDesc = s.MetaDesc
+	post.IsFeatured = s.IsFeatured
+	post.ScheduledAt = s.ScheduledAt
+}
+
+// DiffSnapshots returns the fields that differ between two snapshots, named
+// by their JSON keys. Nil and empty slices are treated as equal.
+func DiffSnapshots(from, to PostSnapshot) []FieldChange {
+	changes := []FieldChange{}
+
+	fromValue := reflect.ValueOf(from)
+	toValue := reflect.ValueOf(to)
+	snapshotType := fromValue.Type()
+
+	for i := 0; i < snapshotType.NumField(); i++ {
+		a := fromValue.Field(i)
+		b := toValue.Field(i)
+
+		if fieldsEqual(a, b) {
+			continue
+		}
+
+		name := strings.Split(snapshotType.Field(i).Tag.Get("json"), ",")[0]
+		changes = append(changes, FieldChange{
+			Field: name,
+			From:  a.Interface(),
+			To:    b.Interface(),
+		})
+	}
+
+	return changes
+}
+
+// ChangedFieldNames returns just the names from a list of changes
+func ChangedFieldNames(changes []FieldChange) []string {
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		names = append(names, change.Field)
+	}
+	return names
+}
+
+func fieldsEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if at, ok := a.Interface().(*time.Time); ok {
+			return at.Equal(*b.Interface().(*time.Time))
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
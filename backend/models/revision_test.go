@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	scheduled := time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC)
+	sameInstant := scheduled.In(time.FixedZone("ICT", 7*60*60))
+
+	base := PostSnapshot{
+		Title:   "Hello",
+		Slug:    "hello",
+		Content: "First draft",
+		Status:  "draft",
+		Tags:    nil,
+	}
+
+	t.Run("No changes", func(t *testing.T) {
+		other := base
+		other.Tags = []string{}
+		assert.Empty(t, DiffSnapshots(base, other))
+	})
+
+	t.Run("Changed fields use JSON names", func(t *testing.T) {
+		other := base
+		other.Slug = "hello-again"
+		other.Content = "Second draft"
+		other.MetaDesc = "Summary"
+		other.Tags = []string{"go"}
+
+		changes := DiffSnapshots(base, other)
+		assert.Equal(t, []string{"slug", "content", "tags", "meta_description"}, ChangedFieldNames(changes))
+		assert.Equal(t, "hello", changes[0].From)
+		assert.Equal(t, "hello-again", changes[0].To)
+		assert.Equal(t, "First draft", changes[1].From)
+		assert.Equal(t, "Second draft", changes[1].To)
+	})
+
+	t.Run("Times compare by instant", func(t *testing.T) {
+		a := base
+		a.ScheduledAt = &scheduled
+		b := base
+		b.ScheduledAt = &sameInstant
+		assert.Empty(t, DiffSnapshots(a, b))
+
+		assert.Equal(t, []string{"scheduled_at"}, ChangedFieldNames(DiffSnapshots(base, a)))
+	})
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	post := &Post{
+		ID:         "post-1",
+		Title:      "Title",
+		Content:    "Body",
+		Status:     "published",
+		Categories: []string{"news"},
+		ViewCount:  42,
+	}
+
+	restored := &Post{ID: "post-1", ViewCount: 42}
+	SnapshotPost(post).ApplyTo(restored)
+
+	assert.Equal(t, post, restored)
+
+	// Slugs are snapshotted but moved by the caller
+	post.Slug = "title"
+	assert.Equal(t, "title", SnapshotPost(post).Slug)
+	SnapshotPost(post).ApplyTo(restored)
+	assert.Empty(t, restored.Slug)
+}
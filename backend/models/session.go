@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is a signed-in device of a user. A session starts with a login
+// and lasts as long as its tokens are refreshed, until it is revoked.
+type Session struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Current marks the session of the request
+	Current bool `json:"current"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Setting keys
+const (
+	SecuritySettingsKey = "security"
+	RoleSettingsKey     = "roles"
+)
+
+// Setting is a runtime setting admins can change without a deploy. Value
+// holds the setting as JSON.
+type Setting struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SecuritySettings holds the security policy. TwoFactorRoles lists the
+// roles that must sign in with a second factor.
+type SecuritySettings struct {
+	TwoFactorRoles []string `json:"two_factor_roles"`
+}
+
+// RequiresTwoFactor reports whether users with role must use two-factor
+// authentication
+func (s *SecuritySettings) RequiresTwoFactor(role string) bool {
+	for _, required := range s.TwoFactorRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleSettings maps each role to its permissions, like "posts:update:own"
+type RoleSettings struct {
+	Roles map[string][]string `json:"roles"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// TwoFactor is the TOTP configuration of a user. A secret is pending until
+// the user confirms it with a code, which enables two-factor login. The
+// recovery codes are stored as hashes and removed once used.
+type TwoFactor struct {
+	UserID        string     `json:"user_id"`
+	Secret        string     `json:"-"`
+	Enabled       bool       `json:"enabled"`
+	RecoveryCodes []string   `json:"-"`
+	LastUsedStep  int64      `json:"-"`
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TwoFactorStatus describes the two-factor state of the current user
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+}
+
+// TwoFactorChallenge is returned by a login that needs a second factor. The
+// challenge token stands in for the password in the second step.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	SetupRequired     bool      `json:"setup_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// TwoFactorSetupRequest starts enrollment during a login. Signed in users
+// enroll without a challenge token.
+type TwoFactorSetupRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// TwoFactorSetupResponse carries a new pending secret
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or, where accepted, a recovery
+// code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest completes a login with the second factor
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// RecoveryCodesResponse carries new recovery codes. They are shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,206 @@
+// Package passwords hashes passwords and checks new ones against the
+// password policy. Hashes carry their algorithm and parameters, so hashes
+// made with older settings keep working and can be upgraded the next time
+// their user logs in.
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+	// bcryptMaxBytes is the longest password bcrypt hashes
+	bcryptMaxBytes = 72
+)
+
+// Params are the algorithm and cost of new hashes
+type Params struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Time is the number of passes, Argon2Memory the memory in KiB
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id
+var DefaultParams = Params{
+	Algorithm:     Argon2id,
+	BcryptCost:    14,
+	Argon2Time:    2,
+	Argon2Memory:  19 * 1024,
+	Argon2Threads: 1,
+}
+
+var (
+	mu     sync.RWMutex
+	params = DefaultParams
+)
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// Validate checks that the parameters can hash passwords
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if p.Argon2Time < 1 || p.Argon2Threads < 1 {
+			return errors.New("argon2 time and threads must be at least 1")
+		}
+		if p.Argon2Memory < 8*uint32(p.Argon2Threads) {
+			return errors.New("argon2 memory must be at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+// SetParams sets the algorithm and cost of new hashes. Existing hashes
+// with other parameters need a rehash.
+func SetParams(p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	params = p
+	return nil
+}
+
+// CurrentParams returns the parameters of new hashes
+func CurrentParams() Params {
+	mu.RLock()
+	defer mu.RUnlock()
+	return params
+}
+
+// Hash hashes a password with the current parameters
+func Hash(password string) (string, error) {
+	p := CurrentParams()
+
+	if p.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return argon2Hash{
+		memory:  p.Argon2Memory,
+		time:    p.Argon2Time,
+		threads: p.Argon2Threads,
+		salt:    salt,
+		key:     argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeySize),
+	}.String(), nil
+}
+
+// Verify reports whether password matches hash, whatever the parameters
+// of the hash
+func Verify(hash, password string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	parsed, err := parseArgon2(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.time, parsed.memory, parsed.threads, uint32(len(parsed.key)))
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1
+}
+
+// NeedsRehash reports whether hash was made with other parameters than
+// the current ones
+func NeedsRehash(hash string) bool {
+	p := CurrentParams()
+
+	if p.Algorithm == Bcrypt {
+		if !isBcrypt(hash) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != p.BcryptCost
+	}
+
+	parsed, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	return parsed.time != p.Argon2Time || parsed.memory != p.Argon2Memory ||
+		parsed.threads != p.Argon2Threads || len(parsed.key) != argon2KeySize
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// argon2Hash is an argon2id hash in the PHC string format, like
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h argon2Hash) String() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(h.salt), base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+func parseArgon2(hash string) (argon2Hash, error) {
+	var h argon2Hash
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Argon2id {
+		return h, errUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, errUnknownHash
+	}
+	if h.time < 1 || h.threads < 1 {
+		return h, errUnknownHash
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return h, errUnknownHash
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return h, errUnknownHash
+	}
+	return h, nil
+}
@@ -0,0 +1,118 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useParams sets the parameters of new hashes for the rest of a test
+func useParams(t *testing.T, p Params) {
+	t.Helper()
+	previous := CurrentParams()
+	require.NoError(t, SetParams(p))
+	t.Cleanup(func() { SetParams(previous) })
+}
+
+var (
+	fastArgon2 = Params{Algorithm: Argon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+	fastBcrypt = Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		prefix string
+	}{
+		{"Argon2id", fastArgon2, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"Bcrypt", fastBcrypt, "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useParams(t, tt.params)
+
+			hash, err := Hash("correct horse battery")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.prefix), hash)
+			assert.True(t, Verify(hash, "correct horse battery"))
+			assert.False(t, Verify(hash, "correct horse battery!"))
+			assert.False(t, NeedsRehash(hash))
+
+			other, err := Hash("correct horse battery")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other, "hashes are salted")
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	useParams(t, fastBcrypt)
+	bcryptHash, err := Hash("correct horse battery")
+	require.NoError(t, err)
+
+	useParams(t, fastArgon2)
+	argon2Hash, err := Hash("correct horse battery")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		params Params
+		hash   string
+		rehash bool
+	}{
+		{"Same argon2id parameters", fastArgon2, argon2Hash, false},
+		{"More argon2id memory", Params{Algorithm: Argon2id, Argon2Time: 1, Argon2Memory: 128, Argon2Threads: 1}, argon2Hash, true},
+		{"More argon2id passes", Params{Algorithm: Argon2id, Argon2Time: 2, Argon2Memory: 64, Argon2Threads: 1}, argon2Hash, true},
+		{"Bcrypt to argon2id", fastArgon2, bcryptHash, true},
+		{"Same bcrypt cost", fastBcrypt, bcryptHash, false},
+		{"Higher bcrypt cost", Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"Argon2id to bcrypt", fastBcrypt, argon2Hash, true},
+		{"Unknown hash", fastArgon2, "plain", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useParams(t, tt.params)
+			assert.Equal(t, tt.rehash, NeedsRehash(tt.hash))
+			// Hashes keep verifying whatever the current parameters
+			if tt.hash != "plain" {
+				assert.True(t, Verify(tt.hash, "correct horse battery"))
+			}
+		})
+	}
+}
+
+func TestVerifyInvalidHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		"$2a$04$short",
+	} {
+		assert.False(t, Verify(hash, "correct horse battery"), hash)
+	}
+}
+
+func TestSetParams(t *testing.T) {
+	useParams(t, fastArgon2)
+
+	for _, p := range []Params{
+		{Algorithm: "md5"},
+		{Algorithm: Bcrypt, BcryptCost: 3},
+		{Algorithm: Bcrypt, BcryptCost: 32},
+		{Algorithm: Argon2id, Argon2Time: 0, Argon2Memory: 64, Argon2Threads: 1},
+		{Algorithm: Argon2id, Argon2Time: 1, Argon2Memory: 8, Argon2Threads: 2},
+	} {
+		assert.Error(t, SetParams(p), p)
+	}
+	assert.Equal(t, fastArgon2, CurrentParams())
+}
@@ -0,0 +1,190 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy is what new passwords must be like
+type Policy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MinEntropy is the minimum of the rough guessing entropy in bits
+	// that Entropy estimates
+	MinEntropy float64
+	// History is the number of previous passwords of a user, besides the
+	// current one, that can't be used again
+	History int
+	// Breached is checked for passwords known from data breaches, nil
+	// skips the check
+	Breached *BreachedList
+}
+
+// DefaultPolicy is used until the configuration sets another
+var DefaultPolicy = Policy{
+	MinLength:  12,
+	MinEntropy: 50,
+	History:    5,
+}
+
+// PolicyError tells why a password doesn't meet the policy
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+// Check returns a PolicyError when password doesn't meet the policy.
+// personal are things like the username and email address of the user,
+// which the password must not contain. Other errors come from reading the
+// breached password list.
+func (p Policy) Check(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PolicyError{fmt.Sprintf("Password must be at least %d characters long", p.MinLength)}
+	}
+	if CurrentParams().Algorithm == Bcrypt && len(password) > bcryptMaxBytes {
+		return &PolicyError{fmt.Sprintf("Password must be at most %d bytes long", bcryptMaxBytes)}
+	}
+
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		if len(value) >= 3 && strings.Contains(lower, strings.ToLower(value)) {
+			return &PolicyError{"Password must not contain your username or email address"}
+		}
+	}
+
+	if Entropy(password) < p.MinEntropy {
+		return &PolicyError{"Password is too easy to guess; use a longer password or a passphrase"}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return &PolicyError{"Password has appeared in a data breach; choose another one"}
+		}
+	}
+
+	return nil
+}
+
+// Reused reports whether password matches any of hashes
+func Reused(password string, hashes []string) bool {
+	for _, hash := range hashes {
+		if hash != "" && Verify(hash, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entropy roughly estimates how many bits of guessing a password takes.
+// Each character is worth as much as picking it from the kinds of
+// characters the password uses, except that repeating the previous
+// character or continuing a run like abc or 321 is worth one bit.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, kind := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if kind.used {
+			pool += kind.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perCharacter := math.Log2(float64(pool))
+	bits := 0.0
+	previous := rune(-1)
+	for _, r := range password {
+		if d := r - previous; d >= -1 && d <= 1 {
+			bits++
+		} else {
+			bits += perCharacter
+		}
+		previous = r
+	}
+	return bits
+}
+
+// BreachedList is a local copy of the hashes of passwords known from data
+// breaches, laid out like the k-anonymity range API of Have I Been Pwned:
+// a directory with a file for each prefix of five hex digits of the SHA-1
+// hash of a password, named like ABCDE.txt, listing the other 35 digits of
+// the hashes with that prefix as SUFFIX:COUNT lines. Only the file of one
+// prefix is read per check, so the list can be larger than memory.
+type BreachedList struct {
+	dir string
+}
+
+// OpenBreachedList opens the breached password list in dir
+func OpenBreachedList(dir string) (*BreachedList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list %s is not a directory", dir)
+	}
+	return &BreachedList{dir: dir}, nil
+}
+
+// Contains reports whether password is on the list. Padding entries with a
+// count of 0 don't count.
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		entry, count, _ := strings.Cut(strings.TrimSpace(lines.Text()), ":")
+		if strings.EqualFold(entry, suffix) {
+			return strings.TrimSpace(count) != "0", nil
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return false, nil
+}
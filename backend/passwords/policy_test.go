@@ -0,0 +1,128 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBreachedList writes a breached password list with passwords, and a
+// padding entry for padding, to a temporary directory
+func writeBreachedList(t *testing.T, padding string, passwords ...string) *BreachedList {
+	t.Helper()
+	dir := t.TempDir()
+
+	entry := func(password, count string) {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		file, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		defer file.Close()
+		_, err = file.WriteString(hash[5:] + ":" + count + "\r\n")
+		require.NoError(t, err)
+	}
+	for _, password := range passwords {
+		entry(password, "42")
+	}
+	entry(padding, "0")
+
+	list, err := OpenBreachedList(dir)
+	require.NoError(t, err)
+	return list
+}
+
+func TestPolicyCheck(t *testing.T) {
+	useParams(t, fastArgon2)
+	policy := DefaultPolicy
+	policy.Breached = writeBreachedList(t, "padding entry only", "Tr0ub4dor&3xyz")
+
+	tests := []struct {
+		name     string
+		password string
+		reason   string
+	}{
+		{"Strong", "correct horse battery", ""},
+		{"Too short", "x7#Kq!", "at least 12 characters"},
+		{"Contains username", "alice-wonder-7#Kq", "must not contain your username"},
+		{"Contains email", "Bob.Smith-7#Kq!z", "must not contain your username"},
+		{"Repeated", "aaaaaaaaaaaaaaaa", "too easy to guess"},
+		{"Sequence", "abcdefghijklmnop", "too easy to guess"},
+		{"Digits only", "202420242024", "too easy to guess"},
+		{"Breached", "Tr0ub4dor&3xyz", "appeared in a data breach"},
+		{"Padding isn't breached", "padding entry only", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "alice", "bob.smith")
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var policyErr *PolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Contains(t, policyErr.Reason, tt.reason)
+		})
+	}
+}
+
+func TestPolicyCheckBcryptLimit(t *testing.T) {
+	password := strings.Repeat("correct horse battery ", 4)
+
+	useParams(t, fastArgon2)
+	assert.NoError(t, DefaultPolicy.Check(password))
+
+	useParams(t, fastBcrypt)
+	var policyErr *PolicyError
+	require.ErrorAs(t, DefaultPolicy.Check(password), &policyErr)
+	assert.Contains(t, policyErr.Reason, "at most 72 bytes")
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		min, max float64
+	}{
+		{"Empty", "", 0, 0},
+		{"Repeats", "aaaa", 4.7, 7.8},
+		{"Sequence", "abcd", 4.7, 7.8},
+		{"Reversed sequence", "4321", 3.3, 6.4},
+		{"Lowercase", "qwzx", 18.8, 18.9},
+		{"Mixed kinds", "qW3#", 26.2, 26.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits := Entropy(tt.password)
+			assert.GreaterOrEqual(t, bits, tt.min)
+			assert.LessOrEqual(t, bits, tt.max)
+		})
+	}
+}
+
+func TestReused(t *testing.T) {
+	useParams(t, fastArgon2)
+	old, err := Hash("correct horse battery")
+	require.NoError(t, err)
+
+	assert.True(t, Reused("correct horse battery", []string{"", old}))
+	assert.False(t, Reused("staple lamp river moon", []string{"", old}))
+	assert.False(t, Reused("correct horse battery", nil))
+}
+
+func TestOpenBreachedList(t *testing.T) {
+	_, err := OpenBreachedList(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "list.txt")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err = OpenBreachedList(file)
+	assert.Error(t, err)
+}
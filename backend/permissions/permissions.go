@@ -0,0 +1,244 @@
+// Package permissions maps roles to what their users may do. A permission
+// names an action on a kind of resource, like "posts:publish". The ":own"
+// suffix limits it to resources the user owns, like "posts:update:own", and
+// "*" stands for every action or resource.
+package permissions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Actions
+const (
+	Create  = "create"
+	Read    = "read"
+	Update  = "update"
+	Delete  = "delete"
+	Publish = "publish"
+)
+
+// Resources
+const (
+	Posts      = "posts"
+	Categories = "categories"
+	Media      = "media"
+	Contacts   = "contacts"
+	Users      = "users"
+	Settings   = "settings"
+	System     = "system"
+	Audit      = "audit"
+)
+
+const (
+	// All matches every action or resource
+	All = "*"
+	// Own limits a permission to resources the user owns
+	Own = "own"
+	// AdminRole is the role that always has every permission, so the
+	// system can't be locked out of its own configuration
+	AdminRole = "admin"
+)
+
+// resources lists the actions of each resource
+var resources = map[string][]string{
+	Posts:      {Create, Read, Update, Delete, Publish},
+	Categories: {Create, Update, Delete},
+	Media:      {Create, Read, Update, Delete},
+	Contacts:   {Read, Update, Delete},
+	Users:      {Create, Read, Update, Delete},
+	Settings:   {Read, Update},
+	System:     {Read, Update},
+	Audit:      {Read},
+}
+
+// owned are the resources that have an owner, posts their author and media
+// their uploader
+var owned = map[string]bool{Posts: true, Media: true}
+
+// permission is a parsed permission
+type permission struct {
+	resource string
+	action   string
+	own      bool
+}
+
+func parse(value string) (permission, error) {
+	if value == All {
+		return permission{resource: All, action: All}, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return permission{}, fmt.Errorf("invalid permission %q: expected resource:action[:own]", value)
+	}
+
+	p := permission{resource: parts[0], action: parts[1]}
+	actions, ok := resources[p.resource]
+	if !ok {
+		return permission{}, fmt.Errorf("invalid permission %q: unknown resource %q", value, p.resource)
+	}
+	if p.action != All && !contains(actions, p.action) {
+		return permission{}, fmt.Errorf("invalid permission %q: unknown action %q", value, p.action)
+	}
+	if len(parts) == 3 {
+		if parts[2] != Own {
+			return permission{}, fmt.Errorf("invalid permission %q: unknown scope %q", value, parts[2])
+		}
+		if !owned[p.resource] {
+			return permission{}, fmt.Errorf("invalid permission %q: %s have no owner", value, p.resource)
+		}
+		p.own = true
+	}
+	return p, nil
+}
+
+func (p permission) matches(resource, action string, owner bool) bool {
+	return (p.resource == All || p.resource == resource) &&
+		(p.action == All || p.action == action) &&
+		(!p.own || owner)
+}
+
+// Validate checks that value is a well-formed permission
+func Validate(value string) error {
+	_, err := parse(value)
+	return err
+}
+
+// Set is the permissions of a role
+type Set []string
+
+// Allows reports whether the set permits action on resource. owner tells
+// whether the user owns the resource, and is false for resources without
+// an owner.
+func (s Set) Allows(resource, action string, owner bool) bool {
+	for _, value := range s {
+		p, err := parse(value)
+		if err == nil && p.matches(resource, action, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// Effective lists every permission the set grants, with wildcards
+// expanded. Actions that are only permitted on owned resources keep the
+// ":own" suffix.
+func (s Set) Effective() []string {
+	effective := []string{}
+	for resource, actions := range resources {
+		for _, action := range actions {
+			switch {
+			case s.Allows(resource, action, false):
+				effective = append(effective, resource+":"+action)
+			case s.Allows(resource, action, true):
+				effective = append(effective, resource+":"+action+":"+Own)
+			}
+		}
+	}
+	sort.Strings(effective)
+	return effective
+}
+
+// Covers reports whether the set grants everything other grants, so that
+// other can be handed out without raising any privileges
+func (s Set) Covers(other Set) bool {
+	for resource, actions := range resources {
+		for _, action := range actions {
+			for _, owner := range []bool{false, true} {
+				if other.Allows(resource, action, owner) && !s.Allows(resource, action, owner) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Limit returns the permissions that both the set and scopes grant
+func (s Set) Limit(scopes Set) Set {
+	limited := Set{}
+	for resource, actions := range resources {
+		for _, action := range actions {
+			switch {
+			case s.Allows(resource, action, false) && scopes.Allows(resource, action, false):
+				limited = append(limited, resource+":"+action)
+			case s.Allows(resource, action, true) && scopes.Allows(resource, action, true):
+				limited = append(limited, resource+":"+action+":"+Own)
+			}
+		}
+	}
+	sort.Strings(limited)
+	return limited
+}
+
+// Roles maps role names to their permissions
+type Roles map[string]Set
+
+// DefaultRoles returns the built-in roles. Authors write and manage their
+// own drafts and uploads, editors publish and manage all content, and
+// admins may do everything.
+func DefaultRoles() Roles {
+	return Roles{
+		AdminRole: {All},
+		"editor": {
+			"posts:*",
+			"categories:*",
+			"media:*",
+			"contacts:*",
+		},
+		"author": {
+			"posts:create",
+			"posts:read",
+			"posts:update:own",
+			"posts:delete:own",
+			"media:create",
+			"media:read",
+			"media:update:own",
+			"media:delete:own",
+		},
+	}
+}
+
+// Validate checks the role names and permissions. The admin role must be
+// present and keep every permission.
+func (r Roles) Validate() error {
+	admin, ok := r[AdminRole]
+	if !ok || !contains(admin, All) {
+		return fmt.Errorf("the %s role must have the %q permission", AdminRole, All)
+	}
+
+	for name, set := range r {
+		if !validRoleName(name) {
+			return fmt.Errorf("invalid role name %q: use 1-32 lower-case letters, digits, - or _", name)
+		}
+		for _, value := range set {
+			if err := Validate(value); err != nil {
+				return fmt.Errorf("role %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validRoleName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
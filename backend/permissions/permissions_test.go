@@ -0,0 +1,136 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		permission string
+		valid      bool
+	}{
+		{"*", true},
+		{"posts:update", true},
+		{"posts:*", true},
+		{"posts:update:own", true},
+		{"media:delete:own", true},
+		{"posts", false},
+		{"pages:read", false},
+		{"categories:publish", false},
+		{"posts:update:team", false},
+		{"users:update:own", false},
+		{"posts:update:own:x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			err := Validate(tt.permission)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	roles := DefaultRoles()
+
+	tests := []struct {
+		name     string
+		role     string
+		resource string
+		action   string
+		owner    bool
+		allowed  bool
+	}{
+		{"Admin may do everything", "admin", Users, Delete, false, true},
+		{"Editor publishes any post", "editor", Posts, Publish, false, true},
+		{"Editor edits any post", "editor", Posts, Update, false, true},
+		{"Editor can't manage users", "editor", Users, Read, false, false},
+		{"Author edits own posts", "author", Posts, Update, true, true},
+		{"Author can't edit others' posts", "author", Posts, Update, false, false},
+		{"Author can't publish own posts", "author", Posts, Publish, true, false},
+		{"Author deletes own media", "author", Media, Delete, true, true},
+		{"Author can't read contacts", "author", Contacts, Read, false, false},
+		{"Unknown role has no permissions", "guest", Posts, Read, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, roles[tt.role].Allows(tt.resource, tt.action, tt.owner))
+		})
+	}
+}
+
+func TestEffective(t *testing.T) {
+	set := Set{"posts:read", "posts:update:own", "categories:*"}
+	assert.Equal(t, []string{
+		"categories:create",
+		"categories:delete",
+		"categories:update",
+		"posts:read",
+		"posts:update:own",
+	}, set.Effective())
+
+	assert.Len(t, Set{All}.Effective(), 24)
+	assert.Empty(t, Set{}.Effective())
+}
+
+func TestCovers(t *testing.T) {
+	roles := DefaultRoles()
+
+	tests := []struct {
+		name    string
+		role    string
+		scopes  Set
+		covered bool
+	}{
+		{"Admin covers everything", "admin", Set{All}, true},
+		{"Same permission", "editor", Set{"posts:publish"}, true},
+		{"Wildcard within role", "editor", Set{"posts:*", "media:read"}, true},
+		{"Own within any", "editor", Set{"posts:update:own"}, true},
+		{"Outside role", "editor", Set{"users:read"}, false},
+		{"Any beyond own", "author", Set{"posts:update"}, false},
+		{"Own within own", "author", Set{"posts:update:own", "posts:create"}, true},
+		{"Wildcard beyond role", "author", Set{"posts:*"}, false},
+		{"Nothing", "author", Set{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.covered, roles[tt.role].Covers(tt.scopes))
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	roles := DefaultRoles()
+
+	assert.Equal(t, Set{"posts:create", "posts:update:own"}, roles["author"].Limit(Set{"posts:create", "posts:update", "users:read"}))
+	assert.Equal(t, Set{"media:read"}, roles["admin"].Limit(Set{"media:read"}))
+	assert.Empty(t, roles["editor"].Limit(Set{}))
+}
+
+func TestRolesValidate(t *testing.T) {
+	assert.NoError(t, DefaultRoles().Validate())
+
+	tests := []struct {
+		name  string
+		roles Roles
+	}{
+		{"Missing admin", Roles{"editor": {"posts:*"}}},
+		{"Restricted admin", Roles{"admin": {"posts:*"}}},
+		{"Invalid name", Roles{"admin": {All}, "Chief Editor": {"posts:*"}}},
+		{"Invalid permission", Roles{"admin": {All}, "editor": {"pages:*"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.roles.Validate())
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kljensen/snowball/english"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// token is a single analyzed term together with where it came from
+type token struct {
+	term     string
+	position int
+	start    int
+	end      int
+}
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// stripHTML turns rich text content into plain text
+func stripHTML(s string) string {
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(s, " "))
+}
+
+// analyze splits text into words and normalizes each one into an index term.
+// Offsets refer to byte positions in text so that matches can be highlighted.
+func analyze(text string) []token {
+	var tokens []token
+
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+
+	return tokens
+}
+
+func appendToken(tokens []token, text string, start, end int) []token {
+	term := normalizeTerm(text[start:end])
+	if term == "" {
+		return tokens
+	}
+	return append(tokens, token{
+		term:     term,
+		position: len(tokens),
+		start:    start,
+		end:      end,
+	})
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// normalizeTerm lowercases a word, strips accents and reduces it to its stem
+func normalizeTerm(word string) string {
+	folder := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(folder, word)
+	if err != nil {
+		folded = word
+	}
+	folded = strings.ToLower(folded)
+
+	if !isASCII(folded) || utf8.RuneCountInString(folded) < 3 {
+		return folded
+	}
+	return english.Stem(folded, true)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// parsedQuery is the analyzed form of a query string
+type parsedQuery struct {
+	terms   []string
+	phrases [][]string
+}
+
+// parseQuery splits a query into bare terms and "quoted phrases". An
+// unterminated quote runs to the end of the query.
+func parseQuery(text string) parsedQuery {
+	var q parsedQuery
+
+	for i, part := range strings.Split(text, `"`) {
+		tokens := analyze(part)
+		if i%2 == 0 || len(tokens) < 2 {
+			for _, t := range tokens {
+				q.terms = append(q.terms, t.term)
+			}
+			continue
+		}
+
+		phrase := make([]string, len(tokens))
+		for j, t := range tokens {
+			phrase[j] = t.term
+		}
+		q.phrases = append(q.phrases, phrase)
+	}
+
+	return q
+}
+
+// allTerms returns every distinct term in the query, including phrase terms
+func (q parsedQuery) allTerms() []string {
+	seen := make(map[string]bool)
+	var terms []string
+
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	for _, term := range q.terms {
+		add(term)
+	}
+	for _, phrase := range q.phrases {
+		for _, term := range phrase {
+			add(term)
+		}
+	}
+
+	return terms
+}
@@ -0,0 +1,100 @@
+// Package search provides full-text search over posts.
+package search
+
+import (
+	"fmt"
+	"time"
+
+	"webenable-cms-backend/models"
+)
+
+// Index is a full-text index of posts. Implementations must be safe for
+// concurrent use.
+type Index interface {
+	// Index adds a document, replacing any document with the same ID
+	Index(doc Document) error
+	// Delete removes a document; deleting an unknown ID is not an error
+	Delete(id string) error
+	// Rebuild atomically replaces the whole index with the documents load
+	// returns. Documents indexed or deleted while load runs are newer than
+	// its snapshot and win over it.
+	Rebuild(load func() ([]Document, error)) error
+	// Search runs a query and returns ranked hits
+	Search(query Query) (*Results, error)
+}
+
+// Document is the searchable representation of a post
+type Document struct {
+	ID          string
+	Slug        string
+	Title       string
+	Excerpt     string
+	Content     string
+	Author      string
+	Status      string
+	Tags        []string
+	Categories  []string
+	PublishedAt *time.Time
+}
+
+// Query describes a search. Text supports bare terms, which must all match,
+// and "quoted phrases". Empty filters match everything.
+type Query struct {
+	Text     string
+	Status   string
+	Tag      string
+	Category string
+	Author   string
+	Limit    int
+	Offset   int
+}
+
+// Hit is a single ranked search result. Highlight fields are HTML-escaped
+// with matches wrapped in <mark> tags.
+type Hit struct {
+	ID             string     `json:"id"`
+	Slug           string     `json:"slug"`
+	Title          string     `json:"title"`
+	Excerpt        string     `json:"excerpt"`
+	Author         string     `json:"author"`
+	Status         string     `json:"status"`
+	Tags           []string   `json:"tags"`
+	Categories     []string   `json:"categories"`
+	PublishedAt    *time.Time `json:"published_at,omitempty"`
+	Score          float64    `json:"score"`
+	TitleHighlight string     `json:"title_highlight"`
+	Snippet        string     `json:"snippet"`
+}
+
+// Results is a page of hits together with the total number of matches
+type Results struct {
+	Query string `json:"query"`
+	Total int    `json:"total"`
+	Hits  []Hit  `json:"hits"`
+}
+
+// New creates an index for the configured backend
+func New(backend string) (Index, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryIndex(), nil
+	default:
+		return nil, fmt.Errorf("unsupported search backend: %s", backend)
+	}
+}
+
+// DocumentFromPost converts a post into a search document
+func DocumentFromPost(post *models.Post) Document {
+	return Document{
+		ID:          post.ID,
+		Slug:        post.Slug,
+		Title:       post.Title,
+		Excerpt:     post.Excerpt,
+		Content:     post.Content,
+		Author:      post.Author,
+		Status:      post.Status,
+		Tags:        post.Tags,
+		Categories:  post.Categories,
+		PublishedAt: post.PublishedAt,
+	}
+}
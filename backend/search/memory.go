@@ -0,0 +1,506 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field identifies which part of a post a term was found in
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldTags
+	fieldExcerpt
+	fieldContent
+	numFields
+)
+
+// fieldBoosts weights matches by where they occur; a title match counts three
+// times as much as a match in the body
+var fieldBoosts = [numFields]float64{
+	fieldTitle:   3.0,
+	fieldTags:    2.0,
+	fieldExcerpt: 1.5,
+	fieldContent: 1.0,
+}
+
+const (
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// tagGap separates the positions of consecutive tags so that a phrase
+	// never matches across two tags
+	tagGap = 10
+
+	// snippetLead is the number of words shown before the first match and
+	// snippetWords the total length of a snippet
+	snippetLead  = 8
+	snippetWords = 30
+)
+
+// storedDoc is an indexed document with per-field term positions
+type storedDoc struct {
+	doc       Document
+	plainText string
+	lengths   [numFields]int
+	positions map[string]*[numFields][]int
+}
+
+// MemoryIndex is an in-process inverted index. Each replica keeps its own
+// copy, so it should be rebuilt periodically when running more than one.
+type MemoryIndex struct {
+	rebuildMu    sync.Mutex
+	mu           sync.RWMutex
+	docs         map[string]*storedDoc
+	postings     map[string]map[string]struct{}
+	totalLengths [numFields]int
+
+	// changes records the documents indexed, or deleted as nil, while a
+	// rebuild loads its snapshot, to replay over that snapshot
+	changes map[string]*storedDoc
+}
+
+// NewMemoryIndex creates an empty in-memory index
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[string]*storedDoc),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// Index adds or replaces a document
+func (m *MemoryIndex) Index(doc Document) error {
+	stored := buildStoredDoc(doc)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(doc.ID)
+	m.add(stored)
+	if m.changes != nil {
+		m.changes[doc.ID] = stored
+	}
+
+	return nil
+}
+
+// Delete removes a document from the index
+func (m *MemoryIndex) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(id)
+	if m.changes != nil {
+		m.changes[id] = nil
+	}
+
+	return nil
+}
+
+// Rebuild replaces the contents of the index with the documents load
+// returns. Changes made while load runs are replayed over its snapshot, so
+// a post deleted or updated meanwhile doesn't come back in its old state.
+func (m *MemoryIndex) Rebuild(load func() ([]Document, error)) error {
+	m.rebuildMu.Lock()
+	defer m.rebuildMu.Unlock()
+
+	m.mu.Lock()
+	m.changes = make(map[string]*storedDoc)
+	m.mu.Unlock()
+
+	docs, err := load()
+	if err != nil {
+		m.mu.Lock()
+		m.changes = nil
+		m.mu.Unlock()
+		return err
+	}
+
+	stored := make([]*storedDoc, 0, len(docs))
+	for _, doc := range docs {
+		stored = append(stored, buildStoredDoc(doc))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := m.changes
+	m.changes = nil
+
+	m.docs = make(map[string]*storedDoc, len(stored))
+	m.postings = make(map[string]map[string]struct{})
+	m.totalLengths = [numFields]int{}
+	for _, d := range stored {
+		m.remove(d.doc.ID)
+		m.add(d)
+	}
+	for id, d := range changes {
+		m.remove(id)
+		if d != nil {
+			m.add(d)
+		}
+	}
+
+	return nil
+}
+
+// Search returns the documents matching every term and phrase of the query,
+// ranked by BM25 with per-field boosts
+func (m *MemoryIndex) Search(query Query) (*Results, error) {
+	results := &Results{
+		Query: query.Text,
+		Hits:  []Hit{},
+	}
+
+	parsed := parseQuery(query.Text)
+	terms := parsed.allTerms()
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type scored struct {
+		doc   *storedDoc
+		score float64
+	}
+
+	var matches []scored
+	for id := range m.candidates(terms) {
+		d := m.docs[id]
+		if !matchesFilters(d.doc, query) || !d.hasPhrases(parsed.phrases) {
+			continue
+		}
+		matches = append(matches, scored{doc: d, score: m.score(d, terms)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		ap, bp := a.doc.doc.PublishedAt, b.doc.doc.PublishedAt
+		if ap != nil && bp != nil && !ap.Equal(*bp) {
+			return ap.After(*bp)
+		}
+		if (ap == nil) != (bp == nil) {
+			return ap != nil
+		}
+		return a.doc.doc.ID < b.doc.doc.ID
+	})
+
+	results.Total = len(matches)
+
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	end := len(matches)
+	if query.Limit > 0 && offset+query.Limit < end {
+		end = offset + query.Limit
+	}
+
+	highlightTerms := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		highlightTerms[term] = true
+	}
+
+	for _, match := range matches[offset:end] {
+		results.Hits = append(results.Hits, buildHit(match.doc, match.score, highlightTerms))
+	}
+
+	return results, nil
+}
+
+func buildStoredDoc(doc Document) *storedDoc {
+	d := &storedDoc{
+		doc:       doc,
+		plainText: stripHTML(doc.Content),
+		positions: make(map[string]*[numFields][]int),
+	}
+
+	d.addTokens(fieldTitle, analyze(doc.Title), 0)
+
+	base := 0
+	for _, tag := range doc.Tags {
+		tokens := analyze(tag)
+		d.addTokens(fieldTags, tokens, base)
+		base += len(tokens) + tagGap
+	}
+
+	d.addTokens(fieldExcerpt, analyze(stripHTML(doc.Excerpt)), 0)
+	d.addTokens(fieldContent, analyze(d.plainText), 0)
+
+	return d
+}
+
+func (d *storedDoc) addTokens(f field, tokens []token, base int) {
+	for _, t := range tokens {
+		p, ok := d.positions[t.term]
+		if !ok {
+			p = &[numFields][]int{}
+			d.positions[t.term] = p
+		}
+		p[f] = append(p[f], base+t.position)
+	}
+	d.lengths[f] += len(tokens)
+}
+
+// hasPhrases reports whether every phrase occurs, in order, within one field
+func (d *storedDoc) hasPhrases(phrases [][]string) bool {
+	for _, phrase := range phrases {
+		if !d.hasPhrase(phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *storedDoc) hasPhrase(phrase []string) bool {
+	first := d.positions[phrase[0]]
+	if first == nil {
+		return false
+	}
+
+	for f := field(0); f < numFields; f++ {
+	starts:
+		for _, start := range first[f] {
+			for i := 1; i < len(phrase); i++ {
+				p := d.positions[phrase[i]]
+				if p == nil || !containsInt(p[f], start+i) {
+					continue starts
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(sorted []int, v int) bool {
+	i := sort.SearchInts(sorted, v)
+	return i < len(sorted) && sorted[i] == v
+}
+
+// add and remove must be called with the write lock held
+func (m *MemoryIndex) add(d *storedDoc) {
+	m.docs[d.doc.ID] = d
+	for term := range d.positions {
+		ids, ok := m.postings[term]
+		if !ok {
+			ids = make(map[string]struct{})
+			m.postings[term] = ids
+		}
+		ids[d.doc.ID] = struct{}{}
+	}
+	for f := field(0); f < numFields; f++ {
+		m.totalLengths[f] += d.lengths[f]
+	}
+}
+
+func (m *MemoryIndex) remove(id string) {
+	d, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	for term := range d.positions {
+		delete(m.postings[term], id)
+		if len(m.postings[term]) == 0 {
+			delete(m.postings, term)
+		}
+	}
+	for f := field(0); f < numFields; f++ {
+		m.totalLengths[f] -= d.lengths[f]
+	}
+	delete(m.docs, id)
+}
+
+// candidates returns the IDs of documents containing every term
+func (m *MemoryIndex) candidates(terms []string) map[string]struct{} {
+	sets := make([]map[string]struct{}, 0, len(terms))
+	for _, term := range terms {
+		ids := m.postings[term]
+		if len(ids) == 0 {
+			return nil
+		}
+		sets = append(sets, ids)
+	}
+
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+
+	result := make(map[string]struct{}, len(sets[0]))
+next:
+	for id := range sets[0] {
+		for _, set := range sets[1:] {
+			if _, ok := set[id]; !ok {
+				continue next
+			}
+		}
+		result[id] = struct{}{}
+	}
+	return result
+}
+
+func (m *MemoryIndex) score(d *storedDoc, terms []string) float64 {
+	n := float64(len(m.docs))
+	score := 0.0
+
+	for _, term := range terms {
+		p := d.positions[term]
+		if p == nil {
+			continue
+		}
+
+		df := float64(len(m.postings[term]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for f := field(0); f < numFields; f++ {
+			tf := float64(len(p[f]))
+			if tf == 0 {
+				continue
+			}
+			avg := float64(m.totalLengths[f]) / n
+			if avg == 0 {
+				avg = 1
+			}
+			norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.lengths[f])/avg))
+			score += fieldBoosts[f] * idf * norm
+		}
+	}
+
+	return score
+}
+
+func matchesFilters(doc Document, query Query) bool {
+	if query.Status != "" && doc.Status != query.Status {
+		return false
+	}
+	if query.Author != "" && !strings.EqualFold(doc.Author, query.Author) {
+		return false
+	}
+	if query.Tag != "" && !containsFold(doc.Tags, query.Tag) {
+		return false
+	}
+	if query.Category != "" && !containsFold(doc.Categories, query.Category) {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func buildHit(d *storedDoc, score float64, terms map[string]bool) Hit {
+	titleTokens := analyze(d.doc.Title)
+
+	return Hit{
+		ID:             d.doc.ID,
+		Slug:           d.doc.Slug,
+		Title:          d.doc.Title,
+		Excerpt:        d.doc.Excerpt,
+		Author:         d.doc.Author,
+		Status:         d.doc.Status,
+		Tags:           d.doc.Tags,
+		Categories:     d.doc.Categories,
+		PublishedAt:    d.doc.PublishedAt,
+		Score:          score,
+		TitleHighlight: highlight(d.doc.Title, titleTokens, 0, len(titleTokens)-1, terms),
+		Snippet:        snippet(d, terms),
+	}
+}
+
+// snippet returns a short highlighted passage around the first match in the
+// content, falling back to the excerpt and then to the start of the content
+func snippet(d *storedDoc, terms map[string]bool) string {
+	sources := []string{d.plainText, stripHTML(d.doc.Excerpt)}
+
+	for _, text := range sources {
+		tokens := analyze(text)
+		for i, t := range tokens {
+			if terms[t.term] {
+				from := i - snippetLead
+				if from < 0 {
+					from = 0
+				}
+				return window(text, tokens, from, terms)
+			}
+		}
+	}
+
+	text := sources[0]
+	if text == "" {
+		text = sources[1]
+	}
+	return window(text, analyze(text), 0, terms)
+}
+
+// window highlights snippetWords tokens of text starting at token from
+func window(text string, tokens []token, from int, terms map[string]bool) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	to := from + snippetWords - 1
+	if to > len(tokens)-1 {
+		to = len(tokens) - 1
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("… ")
+	}
+	b.WriteString(highlight(text, tokens, from, to, terms))
+	if to < len(tokens)-1 {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+// highlight HTML-escapes text between tokens from and to, inclusive, and
+// wraps the tokens matching terms in <mark> tags. With no tokens the whole
+// text is returned escaped.
+func highlight(text string, tokens []token, from, to int, terms map[string]bool) string {
+	if len(tokens) == 0 || from > to {
+		return html.EscapeString(text)
+	}
+
+	start := tokens[from].start
+	end := tokens[to].end
+	if from == 0 {
+		start = 0
+	}
+	if to == len(tokens)-1 {
+		end = len(text)
+	}
+
+	var b strings.Builder
+	pos := start
+	for _, t := range tokens[from : to+1] {
+		if !terms[t.term] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+
+	return b.String()
+}
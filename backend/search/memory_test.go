@@ -0,0 +1,222 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testIndex(t *testing.T) *MemoryIndex {
+	t.Helper()
+
+	index := NewMemoryIndex()
+	docs := []Document{
+		{
+			ID:      "running",
+			Title:   "Running a CMS in production",
+			Content: "<p>Notes on deploying containers &amp; scaling databases.</p>",
+			Author:  "alice",
+			Status:  "published",
+			Tags:    []string{"devops"},
+		},
+		{
+			ID:         "golang",
+			Title:      "Why we like Go",
+			Content:    "<p>Go makes running services in production simple.</p>",
+			Author:     "bob",
+			Status:     "published",
+			Tags:       []string{"golang", "production"},
+			Categories: []string{"engineering"},
+		},
+		{
+			ID:      "draft",
+			Title:   "Production checklist",
+			Content: "Unfinished notes about production databases.",
+			Author:  "alice",
+			Status:  "draft",
+		},
+	}
+	for _, doc := range docs {
+		require.NoError(t, index.Index(doc))
+	}
+
+	return index
+}
+
+func hitIDs(results *Results) []string {
+	ids := make([]string, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	index := testIndex(t)
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{
+			name:     "Stemming matches other word forms",
+			query:    Query{Text: "runs", Status: "published"},
+			expected: []string{"running", "golang"},
+		},
+		{
+			name:     "All terms must match",
+			query:    Query{Text: "production scaling"},
+			expected: []string{"running"},
+		},
+		{
+			name:     "Phrase requires adjacent words",
+			query:    Query{Text: `"running services"`},
+			expected: []string{"golang"},
+		},
+		{
+			name:     "Phrase does not match out of order",
+			query:    Query{Text: `"services running"`},
+			expected: []string{},
+		},
+		{
+			name:     "Status filter hides drafts",
+			query:    Query{Text: "databases", Status: "published"},
+			expected: []string{"running"},
+		},
+		{
+			name:     "Tag filter",
+			query:    Query{Text: "production", Tag: "GoLang"},
+			expected: []string{"golang"},
+		},
+		{
+			name:     "Category and author filters",
+			query:    Query{Text: "production", Category: "engineering", Author: "alice"},
+			expected: []string{},
+		},
+		{
+			name:     "Empty query matches nothing",
+			query:    Query{Text: "  "},
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := index.Search(tt.query)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, hitIDs(results))
+			assert.Equal(t, len(tt.expected), results.Total)
+		})
+	}
+}
+
+func TestMemoryIndexRanking(t *testing.T) {
+	index := NewMemoryIndex()
+	require.NoError(t, index.Index(Document{ID: "body", Title: "Weekly notes", Content: "A short mention of kubernetes."}))
+	require.NoError(t, index.Index(Document{ID: "title", Title: "Kubernetes basics", Content: "An introduction."}))
+	require.NoError(t, index.Index(Document{ID: "tag", Title: "Cluster notes", Content: "Nothing else.", Tags: []string{"kubernetes"}}))
+
+	results, err := index.Search(Query{Text: "kubernetes"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"title", "tag", "body"}, hitIDs(results))
+
+	paged, err := index.Search(Query{Text: "kubernetes", Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag"}, hitIDs(paged))
+	assert.Equal(t, 3, paged.Total)
+}
+
+func TestMemoryIndexHighlights(t *testing.T) {
+	index := testIndex(t)
+
+	results, err := index.Search(Query{Text: "scaling", Status: "published"})
+	require.NoError(t, err)
+	require.Len(t, results.Hits, 1)
+
+	hit := results.Hits[0]
+	assert.Equal(t, "Running a CMS in production", hit.TitleHighlight)
+	assert.Equal(t, "Notes on deploying containers &amp; <mark>scaling</mark> databases.", hit.Snippet)
+
+	results, err = index.Search(Query{Text: "production", Tag: "devops"})
+	require.NoError(t, err)
+	require.Len(t, results.Hits, 1)
+	assert.Equal(t, "Running a CMS in <mark>production</mark>", results.Hits[0].TitleHighlight)
+}
+
+func TestMemoryIndexUpdateAndDelete(t *testing.T) {
+	index := testIndex(t)
+
+	require.NoError(t, index.Index(Document{ID: "golang", Title: "Why we like Rust", Status: "published"}))
+
+	results, err := index.Search(Query{Text: "go"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+
+	results, err = index.Search(Query{Text: "rust"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"golang"}, hitIDs(results))
+
+	require.NoError(t, index.Delete("golang"))
+	require.NoError(t, index.Delete("missing"))
+
+	results, err = index.Search(Query{Text: "rust"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+
+	require.NoError(t, index.Rebuild(func() ([]Document, error) {
+		return []Document{{ID: "only", Title: "Rust again"}}, nil
+	}))
+	results, err = index.Search(Query{Text: "rust"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"only"}, hitIDs(results))
+
+	results, err = index.Search(Query{Text: "production"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+}
+
+func TestMemoryIndexRebuildKeepsConcurrentChanges(t *testing.T) {
+	index := testIndex(t)
+
+	// The snapshot is read before the post is deleted and another one
+	// updated, but handed over after
+	require.NoError(t, index.Rebuild(func() ([]Document, error) {
+		snapshot := []Document{
+			{ID: "running", Title: "Running a CMS in production", Status: "published"},
+			{ID: "golang", Title: "Why we like Go", Status: "published"},
+		}
+		require.NoError(t, index.Delete("running"))
+		require.NoError(t, index.Index(Document{ID: "golang", Title: "Why we like Rust", Status: "published"}))
+		return snapshot, nil
+	}))
+
+	results, err := index.Search(Query{Text: "production"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+
+	results, err = index.Search(Query{Text: "go"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+	results, err = index.Search(Query{Text: "rust"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"golang"}, hitIDs(results))
+
+	// Changes are only replayed over the rebuild they happened during
+	require.NoError(t, index.Rebuild(func() ([]Document, error) {
+		return []Document{{ID: "running", Title: "Running a CMS in production"}}, nil
+	}))
+	results, err = index.Search(Query{Text: "production"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"running"}, hitIDs(results))
+
+	// A failed rebuild leaves the index as it was
+	assert.Error(t, index.Rebuild(func() ([]Document, error) {
+		return nil, assert.AnError
+	}))
+	require.NoError(t, index.Delete("running"))
+	results, err = index.Search(Query{Text: "production"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Hits)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuditPurger periodically deletes the audit events older than the
+// retention period. Deleting by age is idempotent, so every replica runs a
+// purger without coordinating.
+type AuditPurger struct {
+	db        database.DatabaseAdapter
+	retention time.Duration
+	interval  time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewAuditPurger creates a purger that deletes events older than retention
+// every interval
+func NewAuditPurger(db database.DatabaseAdapter, retention, interval time.Duration) *AuditPurger {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	return &AuditPurger{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the purge loop in the background until Stop is called
+func (p *AuditPurger) Start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := p.RunOnce(); err != nil {
+				utils.LogError(err, "Audit log purge failed", logrus.Fields{})
+			}
+
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the purge loop and waits for the current pass to finish
+func (p *AuditPurger) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	<-p.done
+}
+
+// RunOnce deletes the events older than the retention period and returns
+// how many were deleted
+func (p *AuditPurger) RunOnce() (int, error) {
+	deleted, err := p.db.DeleteAuditEventsBefore(time.Now().Add(-p.retention))
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete expired audit events: %w", err)
+	}
+
+	if deleted > 0 {
+		utils.LogInfo("Deleted expired audit events", logrus.Fields{
+			"events":    deleted,
+			"retention": p.retention.String(),
+		})
+	}
+	return deleted, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"webenable-cms-backend/adapters/cache"
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+	"webenable-cms-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// schedulerLockKey is held by the replica currently running a publish pass
+	schedulerLockKey = "post_scheduler"
+	// PublishClaimTTL bounds how long a single post claim can be held
+	PublishClaimTTL = 30 * time.Second
+)
+
+// PublishClaimKey returns the cache lock a post is claimed under while it is
+// published. Changes to the schedule of a post take the same claim, so they
+// can't race a publish already under way.
+func PublishClaimKey(postID string) string {
+	return "publish_post:" + postID
+}
+
+// PostScheduler publishes scheduled posts once their ScheduledAt time has
+// passed. Every replica runs a scheduler, but a pass only proceeds on the
+// replica holding the shared cache lock, and each post is claimed
+// individually before it is published.
+type PostScheduler struct {
+	db       database.DatabaseAdapter
+	cache    cache.CacheAdapter
+	interval time.Duration
+	owner    string
+
+	// OnPublish is called after a post has been published, with the post as
+	// it was before and after the change
+	OnPublish func(before, after *models.Post)
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPostScheduler creates a scheduler that checks for due posts every interval
+func NewPostScheduler(db database.DatabaseAdapter, cacheAdapter cache.CacheAdapter, interval time.Duration) *PostScheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &PostScheduler{
+		db:       db,
+		cache:    cacheAdapter,
+		interval: interval,
+		owner:    fmt.Sprintf("%s-%s", hostname, uuid.New().String()),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler loop in the background until Stop is called
+func (s *PostScheduler) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		utils.LogInfo("Post scheduler started", logrus.Fields{
+			"interval": s.interval.String(),
+			"owner":    s.owner,
+		})
+
+		for {
+			if _, err := s.RunOnce(); err != nil {
+				utils.LogError(err, "Scheduled publishing pass failed", logrus.Fields{})
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler loop and waits for the current pass to finish
+func (s *PostScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// RunOnce publishes every post that is due and returns how many were published
+func (s *PostScheduler) RunOnce() (int, error) {
+	// The lock outlives a normal pass so that a slow replica cannot overlap
+	// with the next tick on another one
+	acquired, err := s.cache.AcquireLock(schedulerLockKey, s.owner, 2*s.interval)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer s.cache.ReleaseLock(schedulerLockKey, s.owner)
+
+	now := time.Now()
+	posts, err := s.db.GetScheduledPosts(now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load scheduled posts: %w", err)
+	}
+
+	published := 0
+	for _, post := range posts {
+		ok, err := s.publish(post.ID, now)
+		if err != nil {
+			utils.LogError(err, "Failed to publish scheduled post", logrus.Fields{
+				"post_id": post.ID,
+			})
+			continue
+		}
+		if ok {
+			published++
+		}
+	}
+
+	return published, nil
+}
+
+// publish claims and publishes a single post. It re-reads the post after
+// claiming it so that a post unscheduled in the meantime is left alone.
+func (s *PostScheduler) publish(postID string, now time.Time) (bool, error) {
+	claimKey := PublishClaimKey(postID)
+	claimed, err := s.cache.AcquireLock(claimKey, s.owner, PublishClaimTTL)
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		return false, nil
+	}
+	defer s.cache.ReleaseLock(claimKey, s.owner)
+
+	post, err := s.db.GetPost(postID)
+	if err != nil {
+		return false, err
+	}
+	if post.Status != "scheduled" || post.ScheduledAt == nil || post.ScheduledAt.After(now) {
+		return false, nil
+	}
+
+	before := *post
+
+	publishedAt := *post.ScheduledAt
+	post.Status = "published"
+	post.PublishedAt = &publishedAt
+
+	if err := s.db.UpdatePost(postID, post); err != nil {
+		return false, err
+	}
+
+	if err := s.cache.InvalidatePostCache(postID); err != nil {
+		utils.LogError(err, "Failed to invalidate post cache", logrus.Fields{
+			"post_id": postID,
+		})
+	}
+	if err := s.cache.InvalidatePostsListCache(); err != nil {
+		utils.LogError(err, "Failed to invalidate posts list cache", logrus.Fields{})
+	}
+
+	if s.OnPublish != nil {
+		s.OnPublish(&before, post)
+	}
+
+	utils.LogInfo("Published scheduled post", logrus.Fields{
+		"post_id":      postID,
+		"scheduled_at": publishedAt,
+	})
+
+	return true, nil
+}
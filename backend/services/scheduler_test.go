@@ -0,0 +1,187 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"webenable-cms-backend/adapters/cache"
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSchedulerStores(t *testing.T) (database.DatabaseAdapter, cache.CacheAdapter) {
+	t.Helper()
+
+	db, err := database.NewSQLiteAdapter(map[string]interface{}{
+		"path": filepath.Join(t.TempDir(), "cms.db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	cacheAdapter, err := cache.NewMemoryAdapter(map[string]interface{}{})
+	require.NoError(t, err)
+
+	return db, cacheAdapter
+}
+
+func createScheduledPost(t *testing.T, db database.DatabaseAdapter, slug string, at time.Time) *models.Post {
+	t.Helper()
+
+	post := &models.Post{Title: slug, Slug: slug, Status: "scheduled", ScheduledAt: &at}
+	require.NoError(t, db.CreatePost(post))
+	return post
+}
+
+// unschedulingDB unschedules a post right after the scheduler loaded the due
+// ones, the way an editor could in the meantime
+type unschedulingDB struct {
+	database.DatabaseAdapter
+	postID string
+}
+
+func (d *unschedulingDB) GetScheduledPosts(before time.Time) ([]models.Post, error) {
+	posts, err := d.DatabaseAdapter.GetScheduledPosts(before)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := d.DatabaseAdapter.GetPost(d.postID)
+	if err != nil {
+		return nil, err
+	}
+	post.Status = "draft"
+	post.ScheduledAt = nil
+	return posts, d.DatabaseAdapter.UpdatePost(d.postID, post)
+}
+
+func TestPostScheduler(t *testing.T) {
+	t.Run("Due posts are published", func(t *testing.T) {
+		db, cacheAdapter := newSchedulerStores(t)
+		due := createScheduledPost(t, db, "due", time.Now().Add(-time.Minute).Truncate(time.Second))
+		later := createScheduledPost(t, db, "later", time.Now().Add(time.Hour))
+
+		scheduler := NewPostScheduler(db, cacheAdapter, time.Minute)
+		var before, after []*models.Post
+		scheduler.OnPublish = func(b, a *models.Post) {
+			before = append(before, b)
+			after = append(after, a)
+		}
+
+		published, err := scheduler.RunOnce()
+		require.NoError(t, err)
+		assert.Equal(t, 1, published)
+
+		post, err := db.GetPost(due.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "published", post.Status)
+		require.NotNil(t, post.PublishedAt)
+		assert.True(t, post.PublishedAt.Equal(*due.ScheduledAt), "published at the scheduled time")
+
+		post, err = db.GetPost(later.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "scheduled", post.Status)
+
+		require.Len(t, before, 1)
+		require.Len(t, after, 1)
+		assert.Equal(t, due.ID, before[0].ID)
+		assert.Equal(t, "scheduled", before[0].Status)
+		assert.Nil(t, before[0].PublishedAt)
+		assert.Equal(t, due.ID, after[0].ID)
+		assert.Equal(t, "published", after[0].Status)
+		assert.NotNil(t, after[0].PublishedAt)
+
+		published, err = scheduler.RunOnce()
+		require.NoError(t, err)
+		assert.Zero(t, published)
+		assert.Len(t, after, 1)
+	})
+
+	t.Run("Schedulers sharing a cache publish each post once", func(t *testing.T) {
+		db, cacheAdapter := newSchedulerStores(t)
+		due := time.Now().Add(-time.Minute)
+		posts := make([]*models.Post, 0, 5)
+		for _, slug := range []string{"one", "two", "three", "four", "five"} {
+			posts = append(posts, createScheduledPost(t, db, slug, due))
+		}
+
+		var mu sync.Mutex
+		publishes := map[string]int{}
+		schedulers := []*PostScheduler{
+			NewPostScheduler(db, cacheAdapter, time.Minute),
+			NewPostScheduler(db, cacheAdapter, time.Minute),
+		}
+		for _, scheduler := range schedulers {
+			scheduler.OnPublish = func(_, after *models.Post) {
+				mu.Lock()
+				defer mu.Unlock()
+				publishes[after.ID]++
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, scheduler := range schedulers {
+			wg.Add(1)
+			go func(scheduler *PostScheduler) {
+				defer wg.Done()
+				for i := 0; i < 3; i++ {
+					_, err := scheduler.RunOnce()
+					assert.NoError(t, err)
+				}
+			}(scheduler)
+		}
+		wg.Wait()
+
+		for _, post := range posts {
+			assert.Equal(t, 1, publishes[post.ID], post.Slug)
+		}
+
+		// A post claimed by one replica is skipped by the other, and a
+		// published one isn't published again
+		post := createScheduledPost(t, db, "claimed", due)
+		claimKey := PublishClaimKey(post.ID)
+		acquired, err := cacheAdapter.AcquireLock(claimKey, schedulers[0].owner, PublishClaimTTL)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		ok, err := schedulers[1].publish(post.ID, time.Now())
+		require.NoError(t, err)
+		assert.False(t, ok)
+		require.NoError(t, cacheAdapter.ReleaseLock(claimKey, schedulers[0].owner))
+
+		ok, err = schedulers[0].publish(post.ID, time.Now())
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = schedulers[1].publish(post.ID, time.Now())
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 1, publishes[post.ID])
+	})
+
+	t.Run("Posts unscheduled in the meantime are left alone", func(t *testing.T) {
+		db, cacheAdapter := newSchedulerStores(t)
+		due := time.Now().Add(-time.Minute)
+		kept := createScheduledPost(t, db, "kept", due)
+		unscheduled := createScheduledPost(t, db, "unscheduled", due)
+
+		scheduler := NewPostScheduler(&unschedulingDB{DatabaseAdapter: db, postID: unscheduled.ID}, cacheAdapter, time.Minute)
+		var publishedIDs []string
+		scheduler.OnPublish = func(_, after *models.Post) {
+			publishedIDs = append(publishedIDs, after.ID)
+		}
+
+		published, err := scheduler.RunOnce()
+		require.NoError(t, err)
+		assert.Equal(t, 1, published)
+		assert.Equal(t, []string{kept.ID}, publishedIDs)
+
+		post, err := db.GetPost(unscheduled.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "draft", post.Status)
+		assert.Nil(t, post.PublishedAt)
+	})
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"webenable-cms-backend/adapters/database"
+	"webenable-cms-backend/search"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reindexBatchSize is the number of posts loaded per database call
+const reindexBatchSize = 100
+
+// SearchIndexer rebuilds the search index from the database on startup and
+// then periodically, so that replicas pick up changes made on other replicas
+type SearchIndexer struct {
+	db       database.DatabaseAdapter
+	index    search.Index
+	interval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSearchIndexer creates an indexer that rebuilds index every interval
+func NewSearchIndexer(db database.DatabaseAdapter, index search.Index, interval time.Duration) *SearchIndexer {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	return &SearchIndexer{
+		db:       db,
+		index:    index,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the rebuild loop in the background until Stop is called
+func (s *SearchIndexer) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			count, err := s.RunOnce()
+			if err != nil {
+				utils.LogError(err, "Search index rebuild failed", logrus.Fields{})
+			} else {
+				utils.LogInfo("Search index rebuilt", logrus.Fields{
+					"posts": count,
+				})
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the rebuild loop and waits for the current rebuild to finish
+func (s *SearchIndexer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// RunOnce rebuilds the index from every post and returns how many were indexed
+func (s *SearchIndexer) RunOnce() (int, error) {
+	var count int
+
+	err := s.index.Rebuild(func() ([]search.Document, error) {
+		var docs []search.Document
+
+		for offset := 0; ; offset += reindexBatchSize {
+			posts, err := s.db.GetPosts(reindexBatchSize, offset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load posts: %w", err)
+			}
+
+			for i := range posts {
+				docs = append(docs, search.DocumentFromPost(&posts[i]))
+			}
+
+			if len(posts) < reindexBatchSize {
+				break
+			}
+		}
+
+		count = len(docs)
+		return docs, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"webenable-cms-backend/adapters/storage"
+	"webenable-cms-backend/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// blobGracePeriod is how long an unreferenced blob is kept, so uploads in
+// progress on other replicas can add their reference
+const blobGracePeriod = time.Hour
+
+var (
+	errCorruptBlob = errors.New("blob content does not match its hash")
+	errMissingBlob = errors.New("referenced blob not found")
+)
+
+// StorageVerifier periodically checks the integrity of stored blobs and
+// deletes the ones that are no longer referenced
+type StorageVerifier struct {
+	blobs    storage.BlobStore
+	interval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewStorageVerifier creates a verifier that checks blobs every interval
+func NewStorageVerifier(blobs storage.BlobStore, interval time.Duration) *StorageVerifier {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	return &StorageVerifier{
+		blobs:    blobs,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the verify loop in the background until Stop is called. The
+// first pass runs after one interval, not on startup.
+func (v *StorageVerifier) Start() {
+	go func() {
+		defer close(v.done)
+
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-v.stop:
+				return
+			}
+
+			report, err := v.RunOnce()
+			if err != nil {
+				utils.LogError(err, "Storage verification failed", logrus.Fields{})
+				continue
+			}
+			utils.LogInfo("Storage verified", logrus.Fields{
+				"checked": report.Checked,
+				"corrupt": len(report.Corrupt),
+				"missing": len(report.Missing),
+			})
+		}
+	}()
+}
+
+// Stop stops the verify loop and waits for the current pass to finish
+func (v *StorageVerifier) Stop() {
+	v.stopOnce.Do(func() {
+		close(v.stop)
+	})
+	<-v.done
+}
+
+// RunOnce rehashes every blob, logs each corrupt or missing one and then
+// deletes the unreferenced blobs
+func (v *StorageVerifier) RunOnce() (*storage.IntegrityReport, error) {
+	report, err := v.blobs.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify blobs: %w", err)
+	}
+
+	for _, path := range report.Corrupt {
+		utils.LogError(errCorruptBlob, "Corrupt blob in storage", logrus.Fields{
+			"path": path,
+		})
+	}
+	for _, path := range report.Missing {
+		utils.LogError(errMissingBlob, "Missing blob in storage", logrus.Fields{
+			"path": path,
+		})
+	}
+
+	deleted, err := v.blobs.CollectGarbage(blobGracePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect unreferenced blobs: %w", err)
+	}
+	if deleted > 0 {
+		utils.LogInfo("Deleted unreferenced blobs", logrus.Fields{
+			"blobs": deleted,
+		})
+	}
+
+	return report, nil
+}
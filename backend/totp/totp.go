@@ -0,0 +1,152 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters every authenticator app supports: HMAC-SHA1, six digits and a
+// 30 second period. It also generates the one-time recovery codes that
+// stand in for a lost authenticator.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the length of a code
+	Digits = 6
+	// Period is how long a code is valid
+	Period = 30 * time.Second
+	// Skew is the number of periods before and after the current one whose
+	// codes are accepted, to allow for clock drift
+	Skew = 1
+
+	// secretSize is the secret length in bytes recommended by RFC 4226
+	secretSize = 20
+	// recoveryCodeLength is the number of characters of a recovery code,
+	// not counting the separator
+	recoveryCodeLength = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded as
+// authenticator apps expect it
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// ProvisioningURI returns the otpauth URI authenticator apps import the
+// secret from, usually rendered as a QR code
+func ProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Step returns the time step t falls into
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code of secret for the time step of t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Step(t)), nil
+}
+
+// Validate checks code against the steps around t. It returns the step the
+// code belongs to, so callers can reject a code that was already used.
+func Validate(secret, value string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	value = strings.ReplaceAll(value, " ", "")
+	if len(value) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, step)), []byte(value)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n random recovery codes formatted as
+// xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	// Five bits per character of the lower-case base32 alphabet
+	raw := make([]byte, recoveryCodeLength*5/8)
+	codes := make([]string, n)
+	for i := range codes {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		value := strings.ToLower(encoding.EncodeToString(raw))
+		codes[i] = value[:recoveryCodeLength/2] + "-" + value[recoveryCodeLength/2:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hash recovery codes are stored as. Case,
+// spaces and separators are ignored so codes can be typed loosely.
+func HashRecoveryCode(value string) string {
+	value = strings.ToLower(value)
+	value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeSecret decodes a base32 secret, tolerating lower case and padding
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "=")
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %w", err)
+	}
+	return key, nil
+}
+
+// code computes the HOTP value of key for counter as in RFC 4226
+func code(key []byte, counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo)
+}
@@ -0,0 +1,109 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The last six digits of the eight digit RFC 6238 test vectors
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			require.NoError(t, err)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+
+	_, err := Code("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		valid bool
+	}{
+		{"Current period", now, true},
+		{"Previous period", now.Add(-Period), true},
+		{"Next period", now.Add(Period), true},
+		{"Too old", now.Add(-2 * Period), false},
+		{"Too new", now.Add(2 * Period), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(secret, tt.at)
+			require.NoError(t, err)
+
+			step, ok := Validate(secret, code, now)
+			assert.Equal(t, tt.valid, ok)
+			if ok {
+				assert.Equal(t, Step(tt.at), step)
+			}
+		})
+	}
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+	_, ok := Validate(strings.ToLower(secret), code[:3]+" "+code[3:], now)
+	assert.True(t, ok)
+	_, ok = Validate(secret, code[:5], now)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("WebEnable CMS", "jane doe", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/WebEnable CMS:jane doe", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "WebEnable CMS", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode(codes[0])
+	assert.Equal(t, hash, HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+	assert.NotEqual(t, hash, HashRecoveryCode(codes[1]))
+}
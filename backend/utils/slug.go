@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify converts a title or name into a lowercase, URL-safe slug.
+// Accented characters are folded to their ASCII base letter and any run of
+// non-alphanumeric characters becomes a single hyphen.
+func Slugify(s string) string {
+	var b strings.Builder
+	lastHyphen := true
+
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Drop combining marks left over from decomposition
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+			lastHyphen = false
+		case !lastHyphen:
+			b.WriteByte('-')
+			lastHyphen = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Simple title", input: "Hello World", expected: "hello-world"},
+		{name: "Punctuation", input: "Go 1.24: What's new?", expected: "go-1-24-what-s-new"},
+		{name: "Accents", input: "Café Déjà Vu", expected: "cafe-deja-vu"},
+		{name: "Surrounding separators", input: "  --Trim me--  ", expected: "trim-me"},
+		{name: "Non-latin only", input: "日本語", expected: ""},
+		{name: "Empty", input: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Slugify(tt.input))
+		})
+	}
+}